@@ -8,10 +8,12 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/cmd"
 	daemon "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
@@ -27,18 +29,32 @@ import (
 const (
 	programName          = "agent-protocol-forwarder"
 	API_SERVER_REST_PORT = 8006
+
+	// lastGoodConfigSuffix names the copy of the last daemon config that was loaded successfully,
+	// kept next to the config file
+	lastGoodConfigSuffix = ".last-good"
 )
 
 var logger = log.New(log.Writer(), "[forwarder] ", log.LstdFlags|log.Lmsgprefix)
 
+// output is where -print-config writes to. This variable can be replaced for testing
+var output io.Writer = os.Stdout
+
 type Config struct {
 	tlsConfig           *tlsutil.TLSConfig
 	daemonConfig        daemon.Config
 	configPath          string
 	listenAddr          string
+	adminListenAddr     string
+	enablePprof         bool
+	adminTokenFile      string
 	kataAgentSocketPath string
 	podNamespace        string
 	HostInterface       string
+	tunnelReadyFile     string
+	// The kata agent is probed through the forwarder every tunnelProbeInterval, disabled if 0
+	tunnelProbeInterval time.Duration
+	tunnelProbeFailures int
 }
 
 func load(path string, obj interface{}) error {
@@ -55,9 +71,134 @@ func load(path string, obj interface{}) error {
 	return nil
 }
 
+// loadDaemonConfig loads the daemon config and keeps a copy of it. When the config can't be
+// loaded, e.g. process-user-data failed to refresh it because IMDS was unavailable, it falls
+// back to the last good copy, so that a restart of the forwarder doesn't bring the pod VM down.
+func loadDaemonConfig(path string, daemonConfig *daemon.Config) error {
+	lastGoodPath := path + lastGoodConfigSuffix
+
+	if err := load(path, daemonConfig); err != nil {
+		var lastGood daemon.Config
+		if lastGoodErr := load(lastGoodPath, &lastGood); lastGoodErr != nil {
+			return err
+		}
+		logger.Printf("Warning: %v, using the last good config %s", err, lastGoodPath)
+		*daemonConfig = lastGood
+		return nil
+	}
+
+	if err := saveLastGood(lastGoodPath, daemonConfig); err != nil {
+		logger.Printf("Warning: failed to save the last good config: %v", err)
+	}
+	return nil
+}
+
+func saveLastGood(path string, daemonConfig *daemon.Config) error {
+	data, err := json.Marshal(daemonConfig)
+	if err != nil {
+		return fmt.Errorf("failed to encode the config: %w", err)
+	}
+
+	// Write to a temporary file first, so that the last good copy is never truncated
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename %s: %w", tmpPath, err)
+	}
+	return nil
+}
+
+// readAdminToken reads the bearer token of the admin config endpoint from path
+func readAdminToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the admin token: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("admin token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// effectiveConfig is the view of the forwarder configuration printed by -print-config
+type effectiveConfig struct {
+	ListenAddr          string        `json:"listen"`
+	AdminListenAddr     string        `json:"admin-listen,omitempty"`
+	EnablePprof         bool          `json:"enable-pprof,omitempty"`
+	AdminTokenFile      string        `json:"admin-token-file,omitempty"`
+	KataAgentSocketPath string        `json:"kata-agent-socket"`
+	PodNamespace        string        `json:"pod-namespace"`
+	HostInterface       string        `json:"host-interface,omitempty"`
+	CAFile              string        `json:"ca-cert-file,omitempty"`
+	ExtraCAFile         string        `json:"extra-ca-file,omitempty"`
+	CertFile            string        `json:"cert-file,omitempty"`
+	KeyFile             string        `json:"cert-key,omitempty"`
+	DisableTLS          bool          `json:"disable-tls"`
+	SecureComms         bool          `json:"secure-comms"`
+	Daemon              daemon.Config `json:"daemon"`
+}
+
+func printConfig(w io.Writer, cfg *Config, tlsConfig *tlsutil.TLSConfig, disableTLS, secureComms bool) error {
+	effective := effectiveConfig{
+		ListenAddr:          cfg.listenAddr,
+		AdminListenAddr:     cfg.adminListenAddr,
+		EnablePprof:         cfg.enablePprof,
+		AdminTokenFile:      cfg.adminTokenFile,
+		KataAgentSocketPath: cfg.kataAgentSocketPath,
+		PodNamespace:        cfg.podNamespace,
+		HostInterface:       cfg.HostInterface,
+		CAFile:              tlsConfig.CAFile,
+		ExtraCAFile:         tlsConfig.ExtraCAFile,
+		CertFile:            tlsConfig.CertFile,
+		KeyFile:             tlsConfig.KeyFile,
+		DisableTLS:          disableTLS,
+		SecureComms:         secureComms || cfg.daemonConfig.SecureComms,
+		Daemon:              cfg.daemonConfig.Redact(),
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(&effective); err != nil {
+		return fmt.Errorf("failed to print the effective config: %w", err)
+	}
+	return nil
+}
+
+// validate checks a daemon config file offline, without touching the network
+func validate(w io.Writer, path string) error {
+	var daemonConfig daemon.Config
+	if err := load(path, &daemonConfig); err != nil {
+		return err
+	}
+	if err := daemonConfig.Validate(); err != nil {
+		return fmt.Errorf("%s is invalid:\n%w", path, err)
+	}
+	fmt.Fprintf(w, "%s is valid\n", path)
+	return nil
+}
+
 func (cfg *Config) Setup() (cmd.Starter, error) {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		if len(os.Args) != 3 {
+			return nil, fmt.Errorf("usage: %s validate <config file>", programName)
+		}
+		if err := validate(output, os.Args[2]); err != nil {
+			return nil, err
+		}
+		cmd.Exit(0)
+		return cmd.NewStarter(), nil
+	}
+
 	var (
 		showVersion          bool
+		showConfig           bool
+		bundlePath           string
+		bundleKeyPath        string
+		discoverMTU          bool
 		disableTLS           bool
 		secureComms          bool
 		secureCommsInbounds  string
@@ -68,12 +209,23 @@ func (cfg *Config) Setup() (cmd.Starter, error) {
 
 	cmd.Parse(programName, os.Args, func(flags *flag.FlagSet) {
 		flags.BoolVar(&showVersion, "version", false, "Show version")
-		flags.StringVar(&cfg.configPath, "config", daemon.DefaultConfigPath, "Path to a daemon config file")
-		flags.StringVar(&cfg.listenAddr, "listen", daemon.DefaultListenAddr, "Listen address")
+		flags.BoolVar(&showConfig, "print-config", false, "Print the effective config with secrets redacted and exit")
+		flags.StringVar(&cfg.configPath, "config", daemon.DefaultConfigPath, "Path to a daemon config file, the last one loaded successfully is kept next to it as a fallback")
+		flags.StringVar(&bundlePath, "bundle", "", "Path to a signed bundle of the daemon config to use instead of -config, e.g. in air-gapped installs without IMDS")
+		flags.StringVar(&bundleKeyPath, "bundle-public-key", "", "Path to the PEM encoded ed25519 public key that verifies the -bundle signature")
+		flags.StringVar(&cfg.listenAddr, "listen", daemon.DefaultListenAddr, "Listen address, unused when the socket is passed by systemd socket activation")
+		flags.StringVar(&cfg.adminListenAddr, "admin-listen", daemon.DefaultAdminListenAddr, "Listen address for the health, metrics and pprof endpoints served without TLS, e.g. 127.0.0.1:15151, disabled if empty")
+		flags.BoolVar(&cfg.enablePprof, "enable-pprof", false, "Serve the pprof endpoints on the -admin-listen address, for diagnostics only")
+		flags.StringVar(&cfg.adminTokenFile, "admin-token-file", "", "File holding the bearer token that grants access to the redacted daemon config on the -admin-listen address, which is not served if empty")
 		flags.StringVar(&cfg.kataAgentSocketPath, "kata-agent-socket", daemon.DefaultKataAgentSocketPath, "Path to a kata agent socket")
-		flags.StringVar(&cfg.podNamespace, "pod-namespace", daemon.DefaultPodNamespace, "Path to the network namespace where the pod runs")
-		flags.StringVar(&cfg.HostInterface, "host-interface", "", "network interface name that is used for network tunnel traffic")
-		flags.StringVar(&tlsConfig.CAFile, "ca-cert-file", "", "CA cert file")
+		flags.StringVar(&cfg.podNamespace, "pod-namespace", daemon.DefaultPodNamespace, "Path to the network namespace where the pod runs, the kata-agent-namespace from userData overrides the default")
+		flags.StringVar(&cfg.tunnelReadyFile, "tunnel-ready-file", "", "File created once the pod network tunnel is established and removed when it is torn down, disabled if empty")
+		flags.DurationVar(&cfg.tunnelProbeInterval, "tunnel-probe-interval", 0, "Interval of the health check sent to the kata agent through the forwarder listener, which reports the forwarder unhealthy on -admin-listen once it keeps failing, disabled if 0")
+		flags.IntVar(&cfg.tunnelProbeFailures, "tunnel-probe-failures", daemon.DefaultTunnelProbeFailureThreshold, "Number of consecutive tunnel probe failures after which the forwarder is unhealthy")
+		flags.BoolVar(&discoverMTU, "discover-mtu", false, "Lower the MTU of the pod network tunnel to fit the path MTU to the worker node, as if discover-mtu were set in userData")
+		flags.StringVar(&cfg.HostInterface, "host-interface", "", "network interface name that is used for network tunnel traffic, \"auto\" to use the one routing to the worker node IP")
+		flags.StringVar(&tlsConfig.CAFile, "ca-cert-file", "", "CA cert file, replaces the tls-client-ca from userData")
+		flags.StringVar(&tlsConfig.ExtraCAFile, "extra-ca-file", "", "CA bundle file appended to the CA from userData or -ca-cert-file, e.g. node-local intermediate CAs")
 		flags.StringVar(&tlsConfig.CertFile, "cert-file", "", "cert file")
 		flags.StringVar(&tlsConfig.KeyFile, "cert-key", "", "cert key")
 		flags.BoolVar(&tlsConfig.SkipVerify, "tls-skip-verify", false, "Skip TLS certificate verification - use it only for testing")
@@ -89,10 +241,52 @@ func (cfg *Config) Setup() (cmd.Starter, error) {
 		cmd.Exit(0)
 	}
 
-	if err := load(cfg.configPath, &cfg.daemonConfig); err != nil {
+	if bundlePath != "" {
+		if bundleKeyPath == "" {
+			return nil, fmt.Errorf("-bundle-public-key is required with -bundle")
+		}
+		if err := daemon.LoadBundle(bundlePath, bundleKeyPath, &cfg.daemonConfig); err != nil {
+			return nil, err
+		}
+		// The config comes from the bundle, errors below refer to it
+		cfg.configPath = bundlePath
+	} else if err := loadDaemonConfig(cfg.configPath, &cfg.daemonConfig); err != nil {
 		return nil, err
 	}
 
+	if placement := cfg.daemonConfig.Placement; placement != nil {
+		logger.Printf("pod VM placement: %s", placement)
+	}
+
+	// The port from userData is the one the worker node dials, so it takes precedence
+	if port := cfg.daemonConfig.ListenPort; port != "" {
+		listenAddr, err := daemon.ListenAddrWithPort(cfg.listenAddr, port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen port in %s: %w", cfg.configPath, err)
+		}
+		cfg.listenAddr = listenAddr
+	}
+
+	if discoverMTU && cfg.daemonConfig.PodNetwork != nil {
+		cfg.daemonConfig.PodNetwork.DiscoverMTU = true
+	}
+
+	// Unlike the listen port, the namespace from userData only replaces the default
+	if ns := cfg.daemonConfig.KataAgentNamespace; ns != "" && cfg.podNamespace == daemon.DefaultPodNamespace {
+		if _, err := os.Stat(ns); err != nil {
+			return nil, fmt.Errorf("invalid kata-agent-namespace in %s: %w", cfg.configPath, err)
+		}
+		cfg.podNamespace = ns
+	}
+
+	if showConfig {
+		if err := printConfig(output, cfg, &tlsConfig, disableTLS, secureComms); err != nil {
+			return nil, err
+		}
+		cmd.Exit(0)
+		return cmd.NewStarter(), nil
+	}
+
 	if secureComms || cfg.daemonConfig.SecureComms {
 		var inbounds, outbounds []string
 
@@ -141,7 +335,30 @@ func (cfg *Config) Setup() (cmd.Starter, error) {
 
 	podNode := podnetwork.NewPodNode(cfg.podNamespace, cfg.HostInterface, cfg.daemonConfig.PodNetwork)
 
-	services = append(services, daemon.NewDaemon(&cfg.daemonConfig, cfg.listenAddr, cfg.tlsConfig, interceptor, podNode))
+	var opts []daemon.DaemonOption
+	if cfg.tunnelReadyFile != "" {
+		opts = append(opts, daemon.WithTunnelReadyFile(cfg.tunnelReadyFile))
+	}
+	if cfg.tunnelProbeInterval > 0 {
+		opts = append(opts, daemon.WithListenerProbe(cfg.tunnelProbeInterval, cfg.tunnelProbeFailures))
+	}
+	forwarder := daemon.NewDaemon(&cfg.daemonConfig, cfg.listenAddr, cfg.tlsConfig, interceptor, podNode, opts...)
+	services = append(services, forwarder)
+
+	if cfg.adminListenAddr != "" {
+		var adminOpts []daemon.AdminOption
+		if cfg.enablePprof {
+			adminOpts = append(adminOpts, daemon.WithPprof())
+		}
+		if cfg.adminTokenFile != "" {
+			token, err := readAdminToken(cfg.adminTokenFile)
+			if err != nil {
+				return nil, err
+			}
+			adminOpts = append(adminOpts, daemon.WithConfig(&cfg.daemonConfig, token))
+		}
+		services = append(services, daemon.NewAdminServer(cfg.adminListenAddr, forwarder, adminOpts...))
+	}
 
 	return cmd.NewStarter(services...), nil
 }
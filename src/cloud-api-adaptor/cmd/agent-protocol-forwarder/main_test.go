@@ -0,0 +1,358 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/cmd"
+	daemon "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
+)
+
+func TestPrintConfig(t *testing.T) {
+	secrets := []string{"server-key-data", "server-cert-data", "client-ca-data", "pp-private-key"}
+
+	daemonConfig := daemon.Config{
+		PodName:       "test-pod",
+		PodNamespace:  "default",
+		TLSServerKey:  secrets[0],
+		TLSServerCert: secrets[1],
+		TLSClientCA:   secrets[2],
+		PpPrivateKey:  []byte(secrets[3]),
+	}
+	data, err := json.Marshal(&daemonConfig)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	configPath := filepath.Join(t.TempDir(), "apf.json")
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	oldArgs, oldExit, oldOutput := os.Args, cmd.Exit, output
+	defer func() {
+		os.Args, cmd.Exit, output = oldArgs, oldExit, oldOutput
+	}()
+
+	exitCode := -1
+	cmd.Exit = func(code int) {
+		exitCode = code
+	}
+	var buffer bytes.Buffer
+	output = &buffer
+	os.Args = []string{programName, "-config", configPath, "-print-config"}
+
+	cfg := &Config{}
+	if _, err := cfg.Setup(); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("Expect exit code 0, got %d", exitCode)
+	}
+
+	printed := buffer.String()
+	for _, secret := range secrets {
+		if strings.Contains(printed, secret) {
+			t.Errorf("Expect %q to be redacted, got %s", secret, printed)
+		}
+	}
+
+	var effective effectiveConfig
+	if err := json.Unmarshal(buffer.Bytes(), &effective); err != nil {
+		t.Fatalf("Expect valid JSON output, got %v", err)
+	}
+	if e, a := "test-pod", effective.Daemon.PodName; e != a {
+		t.Errorf("Expect %q, got %q", e, a)
+	}
+	if e, a := daemon.DefaultListenAddr, effective.ListenAddr; e != a {
+		t.Errorf("Expect %q, got %q", e, a)
+	}
+	// The admin server serves without TLS, it is only enabled by -admin-listen
+	if a := effective.AdminListenAddr; a != "" {
+		t.Errorf("Expect the admin server to be disabled, got %q", a)
+	}
+}
+
+func TestListenPortFromConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		listenPort string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name: "default port",
+			want: daemon.DefaultListenAddr,
+		},
+		{
+			name:       "port from userData",
+			listenPort: "16150",
+			want:       daemon.DefaultListenHost + ":16150",
+		},
+		{
+			name:       "invalid port",
+			listenPort: "70000",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(&daemon.Config{PodName: "test-pod", ListenPort: tt.listenPort})
+			if err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+			configPath := filepath.Join(t.TempDir(), "apf.json")
+			if err := os.WriteFile(configPath, data, 0600); err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+
+			oldArgs, oldExit, oldOutput := os.Args, cmd.Exit, output
+			defer func() {
+				os.Args, cmd.Exit, output = oldArgs, oldExit, oldOutput
+			}()
+			cmd.Exit = func(code int) {}
+			output = &bytes.Buffer{}
+			os.Args = []string{programName, "-config", configPath, "-print-config"}
+
+			cfg := &Config{}
+			_, err = cfg.Setup()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expect error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && cfg.listenAddr != tt.want {
+				t.Errorf("Expect listen address %q, got %q", tt.want, cfg.listenAddr)
+			}
+		})
+	}
+}
+
+func TestKataAgentNamespaceFromConfig(t *testing.T) {
+	namespace := filepath.Join(t.TempDir(), "podns")
+	if err := os.WriteFile(namespace, nil, 0600); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		args      []string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name: "default namespace",
+			want: daemon.DefaultPodNamespace,
+		},
+		{
+			name:      "namespace from userData",
+			namespace: namespace,
+			want:      namespace,
+		},
+		{
+			name:      "flag takes precedence",
+			namespace: namespace,
+			args:      []string{"-pod-namespace", "/run/netns/other"},
+			want:      "/run/netns/other",
+		},
+		{
+			name:      "missing namespace",
+			namespace: namespace + "-missing",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(&daemon.Config{PodName: "test-pod", KataAgentNamespace: tt.namespace})
+			if err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+			configPath := filepath.Join(t.TempDir(), "apf.json")
+			if err := os.WriteFile(configPath, data, 0600); err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+
+			oldArgs, oldExit, oldOutput := os.Args, cmd.Exit, output
+			defer func() {
+				os.Args, cmd.Exit, output = oldArgs, oldExit, oldOutput
+			}()
+			cmd.Exit = func(code int) {}
+			var buffer bytes.Buffer
+			output = &buffer
+			os.Args = append([]string{programName, "-config", configPath, "-print-config"}, tt.args...)
+
+			cfg := &Config{}
+			_, err = cfg.Setup()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expect error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			var effective effectiveConfig
+			if err := json.Unmarshal(buffer.Bytes(), &effective); err != nil {
+				t.Fatalf("Expect valid JSON output, got %v", err)
+			}
+			if effective.PodNamespace != tt.want {
+				t.Errorf("Expect pod namespace %q, got %q", tt.want, effective.PodNamespace)
+			}
+		})
+	}
+}
+
+func TestLastGoodConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "apf.json")
+
+	oldArgs, oldExit, oldOutput := os.Args, cmd.Exit, output
+	defer func() {
+		os.Args, cmd.Exit, output = oldArgs, oldExit, oldOutput
+	}()
+	cmd.Exit = func(code int) {}
+
+	setup := func() (string, error) {
+		var buffer bytes.Buffer
+		output = &buffer
+		os.Args = []string{programName, "-config", configPath, "-print-config"}
+
+		cfg := &Config{}
+		if _, err := cfg.Setup(); err != nil {
+			return "", err
+		}
+		var effective effectiveConfig
+		if err := json.Unmarshal(buffer.Bytes(), &effective); err != nil {
+			t.Fatalf("Expect valid JSON output, got %v", err)
+		}
+		return effective.Daemon.PodName, nil
+	}
+	writeConfig := func(data string) {
+		if err := os.WriteFile(configPath, []byte(data), 0600); err != nil {
+			t.Fatalf("Expect no error, got %v", err)
+		}
+	}
+
+	// Without a last good config, an invalid config is an error
+	writeConfig(`{"pod-name": `)
+	if _, err := setup(); err == nil {
+		t.Fatal("Expect an error, got nil")
+	}
+
+	writeConfig(`{"pod-name": "first"}`)
+	if podName, err := setup(); err != nil || podName != "first" {
+		t.Fatalf("Expect pod name %q, got %q, %v", "first", podName, err)
+	}
+
+	// A refresh that failed with IMDS unavailable leaves a truncated config
+	writeConfig(`{"pod-name": `)
+	if podName, err := setup(); err != nil || podName != "first" {
+		t.Fatalf("Expect the last good pod name %q, got %q, %v", "first", podName, err)
+	}
+
+	// A missing config falls back too
+	if err := os.Remove(configPath); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if podName, err := setup(); err != nil || podName != "first" {
+		t.Fatalf("Expect the last good pod name %q, got %q, %v", "first", podName, err)
+	}
+
+	// A new good config replaces the last good one
+	writeConfig(`{"pod-name": "second"}`)
+	if podName, err := setup(); err != nil || podName != "second" {
+		t.Fatalf("Expect pod name %q, got %q, %v", "second", podName, err)
+	}
+	writeConfig(`{"pod-name": `)
+	if podName, err := setup(); err != nil || podName != "second" {
+		t.Fatalf("Expect the last good pod name %q, got %q, %v", "second", podName, err)
+	}
+}
+
+func TestValidateSubcommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			config: `{"pod-network": {"podip": "10.244.1.5/24", "interface": "eth0", "worker-node-ip": "192.168.122.10/24", "tunnel-type": "vxlan", "mtu": 1450}}`,
+		},
+		{
+			name:    "invalid",
+			config:  `{"pod-network": {"podip": "10.244.1.5/24", "interface": "eth0", "tunnel-type": "vxlan", "mtu": 1450}}`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			config:  `{"pod-network": `,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "apf.json")
+			if err := os.WriteFile(configPath, []byte(tt.config), 0600); err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+
+			oldArgs, oldExit, oldOutput := os.Args, cmd.Exit, output
+			defer func() {
+				os.Args, cmd.Exit, output = oldArgs, oldExit, oldOutput
+			}()
+			exitCode := -1
+			cmd.Exit = func(code int) {
+				exitCode = code
+			}
+			var buffer bytes.Buffer
+			output = &buffer
+			os.Args = []string{programName, "validate", configPath}
+
+			cfg := &Config{}
+			_, err := cfg.Setup()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expect error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil {
+				if exitCode != 0 {
+					t.Errorf("Expect exit code 0, got %d", exitCode)
+				}
+				if !strings.Contains(buffer.String(), "is valid") {
+					t.Errorf("Expect a valid report, got %q", buffer.String())
+				}
+			}
+		})
+	}
+}
+
+func TestReadAdminToken(t *testing.T) {
+	dir := t.TempDir()
+
+	tokenPath := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenPath, []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if token, err := readAdminToken(tokenPath); err != nil || token != "secret" {
+		t.Errorf("Expect token %q, got %q, %v", "secret", token, err)
+	}
+
+	emptyPath := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyPath, []byte(" \n"), 0600); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if _, err := readAdminToken(emptyPath); err == nil {
+		t.Error("Expect an error for an empty token, got nil")
+	}
+
+	if _, err := readAdminToken(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expect an error for a missing token file, got nil")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/cmd"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor"
@@ -127,16 +128,26 @@ func (cfg *daemonConfig) Setup() (cmd.Starter, error) {
 		flags.BoolVar(&cfg.networkConfig.ExternalNetViaPodVM, "ext-network-via-podvm", false, "[EXPERIMENTAL] Enable external networking via pod VM")
 		// Local pod subnets. This will be used by APF to create routes for local pod subnets when using external networking via pod VM
 		flags.Var(&cfg.networkConfig.PodSubnetCIDRs, "pod-subnet-cidrs", "[EXPERIMENTAL] Comma separated CIDRs for local pod subnets")
+		flags.Var(&cfg.networkConfig.EgressAllowCIDRs, "egress-allow-cidrs", "Comma separated CIDRs pods are allowed to connect to, all egress traffic is allowed if not set")
+		flags.Var(&cfg.networkConfig.Sysctls, "pod-sysctls", "Comma separated key=value sysctls set on the pod network namespace of the pod VMs, e.g. net.ipv4.tcp_keepalive_time=600. Only the net.ipv4 sysctls that are safe per namespace are allowed")
 		flags.StringVar(&cfg.serverConfig.Initdata, "initdata", "", "Default initdata for all Pods")
 		flags.BoolVar(&cfg.serverConfig.EnableCloudConfigVerify, "cloud-config-verify", false, "Enable cloud config verify - should use it for production")
 		flags.IntVar(&cfg.serverConfig.PeerPodsLimitPerNode, "peerpods-limit-per-node", 10, "peer pods limit per node (default=10)")
 		flags.BoolVar(&cfg.serverConfig.EnableScratchSpace, "enable-scratch-space", false, "Enable encrypted scratch space for pod VMs")
+		flags.IntVar(&cfg.serverConfig.MaxConcurrentCreates, "max-concurrent-creates", 0, "Maximum number of pod VMs created concurrently, 0 means unlimited")
+		flags.DurationVar(&cfg.serverConfig.CreateQueueTimeout, "create-queue-timeout", 5*time.Minute, "Maximum time a pod VM creation waits for a free slot when max-concurrent-creates is set")
+		flags.DurationVar(&cfg.serverConfig.ReconcileInterval, "reconcile-interval", 0, "Interval at which pod VMs created from this node that no sandbox or PeerPod object uses are deleted or returned to the pool (aws and byom only), 0 disables it")
+		flags.BoolVar(&cfg.serverConfig.SizeFromPodResources, "size-from-pod-resources", false, "Size the pod VMs without instance type, vCPU or memory annotations for the CPU requests and memory limits of the pod. The CRI only passes the sum of the container memory limits, so pods without memory limits get the default memory, whatever their requests")
 
 		cloud.ParseCmd(flags)
 	})
 
 	cmd.ShowVersion(programName)
 
+	if err := daemon.ValidatePort(cfg.serverConfig.ForwarderPort); err != nil {
+		return nil, fmt.Errorf("invalid -forwarder-port: %w", err)
+	}
+
 	fmt.Printf("%s: starting Cloud API Adaptor daemon for %q\n", programName, cloudName)
 
 	if secureComms {
@@ -32,18 +32,20 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	var fetchTimeout int
+	var forwarderConfigCopies []string
 	rootCmd.PersistentFlags().BoolVarP(&versionFlag, "version", "v", false, "Print the version")
 
 	var provisionFilesCmd = &cobra.Command{
 		Use:   "provision-files",
 		Short: "Provision required files based on user data",
 		RunE: func(_ *cobra.Command, _ []string) error {
-			cfg := userdata.NewConfig(fetchTimeout)
+			cfg := userdata.NewConfig(fetchTimeout, forwarderConfigCopies...)
 			return userdata.ProvisionFiles(cfg)
 		},
 		SilenceUsage: true, // Silence usage on error
 	}
 	provisionFilesCmd.Flags().IntVarP(&fetchTimeout, "user-data-fetch-timeout", "t", 180, "Timeout (in secs) for fetching user data")
+	provisionFilesCmd.Flags().StringSliceVar(&forwarderConfigCopies, "forwarder-config-copy", nil, "Additional paths the agent-protocol-forwarder config is written to, for images expecting it elsewhere. All the paths are written or none")
 	rootCmd.AddCommand(provisionFilesCmd)
 }
 
@@ -29,6 +29,8 @@ cleanup_spaces() {
 [[ "${PROXY_TIMEOUT}" ]] && optionals+="-proxy-timeout ${PROXY_TIMEOUT} "
 [[ "${INITDATA}" ]] && optionals+="-initdata ${INITDATA} "
 [[ "${FORWARDER_PORT}" ]] && optionals+="-forwarder-port ${FORWARDER_PORT} "
+[[ "${EGRESS_ALLOW_CIDRS}" ]] && optionals+="-egress-allow-cidrs $(cleanup_spaces "${EGRESS_ALLOW_CIDRS}") "
+[[ "${POD_SYSCTLS}" ]] && optionals+="-pod-sysctls $(cleanup_spaces "${POD_SYSCTLS}") "
 [[ "${CLOUD_CONFIG_VERIFY}" == "true" ]] && optionals+="-cloud-config-verify "
 [[ "${SECURE_COMMS}" == "true" ]] && optionals+="-secure-comms "
 [[ "${SECURE_COMMS_NO_TRUSTEE}" == "true" ]] && optionals+="-secure-comms-no-trustee "
@@ -40,6 +42,10 @@ cleanup_spaces() {
 [[ "${PEERPODS_LIMIT_PER_NODE}" ]] && optionals+="-peerpods-limit-per-node ${PEERPODS_LIMIT_PER_NODE} "
 [[ "${DISABLECVM}" == "true" ]] && optionals+="-disable-cvm "
 [[ "${ENABLE_SCRATCH_SPACE}" == "true" ]] && optionals+="-enable-scratch-space "
+[[ "${MAX_CONCURRENT_CREATES}" ]] && optionals+="-max-concurrent-creates ${MAX_CONCURRENT_CREATES} "
+[[ "${CREATE_QUEUE_TIMEOUT}" ]] && optionals+="-create-queue-timeout ${CREATE_QUEUE_TIMEOUT} "
+[[ "${RECONCILE_INTERVAL}" ]] && optionals+="-reconcile-interval ${RECONCILE_INTERVAL} "
+[[ "${SIZE_FROM_POD_RESOURCES}" == "true" ]] && optionals+="-size-from-pod-resources "
 
 test_vars() {
     for i in "$@"; do
@@ -65,10 +71,24 @@ aws() {
     [[ "${PODVM_INSTANCE_TYPES}" ]] && optionals+="-instance-types ${PODVM_INSTANCE_TYPES} "
     [[ "${SSH_KP_NAME}" ]] && optionals+="-keyname ${SSH_KP_NAME} "                    # if not retrieved from IMDS
     [[ "${AWS_SUBNET_ID}" ]] && optionals+="-subnetid ${AWS_SUBNET_ID} "               # if not set retrieved from IMDS
+    [[ "${AWS_SUBNET_IDS}" ]] && optionals+="-subnetids ${AWS_SUBNET_IDS} "            # tried in order on capacity errors, precedence over AWS_SUBNET_ID
     [[ "${AWS_REGION}" ]] && optionals+="-aws-region ${AWS_REGION} "                   # if not set retrieved from IMDS
     [[ "${TAGS}" ]] && optionals+="-tags $(cleanup_spaces "${TAGS}") "                 # Custom tags applied to pod vm
     [[ "${USE_PUBLIC_IP}" == "true" ]] && optionals+="-use-public-ip "                 # Use public IP for pod vm
     [[ "${ROOT_VOLUME_SIZE}" ]] && optionals+="-root-volume-size ${ROOT_VOLUME_SIZE} " # Specify root volume size for pod vm
+    [[ "${AWS_ROOT_VOLUME_TYPE}" ]] && optionals+="-root-volume-type ${AWS_ROOT_VOLUME_TYPE} " # default gp3
+    [[ "${AWS_ROOT_VOLUME_IOPS}" ]] && optionals+="-root-volume-iops ${AWS_ROOT_VOLUME_IOPS} " # required for io1 and io2
+    [[ "${USERDATA_FORMAT}" ]] && optionals+="-userdata-format ${USERDATA_FORMAT} "     # cloud-init or ignition
+    [[ "${AWS_USE_SPOT_INSTANCES}" == "true" ]] && optionals+="-use-spot-instances "
+    [[ "${AWS_SPOT_MAX_PRICE}" ]] && optionals+="-spot-max-price ${AWS_SPOT_MAX_PRICE} " # defaults to the on-demand price
+    [[ "${AWS_RUN_INSTANCES_ATTEMPTS}" ]] && optionals+="-run-instances-attempts ${AWS_RUN_INSTANCES_ATTEMPTS} "       # default 3
+    [[ "${AWS_RUN_INSTANCES_RETRY_DELAY}" ]] && optionals+="-run-instances-retry-delay ${AWS_RUN_INSTANCES_RETRY_DELAY} " # default 1s
+    [[ "${AWS_INSTANCE_READY_TIMEOUT}" ]] && optionals+="-instance-ready-timeout ${AWS_INSTANCE_READY_TIMEOUT} " # default 2m
+    [[ "${AWS_REQUIRE_IMDSV2}" == "true" ]] && optionals+="-require-imdsv2 "
+    [[ "${AWS_PLACEMENT_GROUP_NAME}" ]] && optionals+="-placement-group-name ${AWS_PLACEMENT_GROUP_NAME} "
+    [[ "${AWS_IAM_INSTANCE_PROFILE}" ]] && optionals+="-iam-instance-profile ${AWS_IAM_INSTANCE_PROFILE} "
+    [[ "${AWS_ASSUME_ROLE_ARN}" ]] && optionals+="-use-sts -role-arn ${AWS_ASSUME_ROLE_ARN} "
+    [[ "${AWS_TAG_PREFIX}" ]] && optionals+="-tag-prefix ${AWS_TAG_PREFIX} "             # prefix of the pod metadata tags, defaults to peerpod-
     [[ "${EXTERNAL_NETWORK_VIA_PODVM}" ]] && optionals+="-ext-network-via-podvm  "
     [[ "${POD_SUBNET_CIDRS}" ]] && optionals+="-pod-subnet-cidrs ${POD_SUBNET_CIDRS} "
 
@@ -85,10 +105,34 @@ azure() {
 
     [[ "${SSH_USERNAME}" ]] && optionals+="-ssh-username ${SSH_USERNAME} "
     [[ "${AZURE_INSTANCE_SIZES}" ]] && optionals+="-instance-sizes $(cleanup_spaces "${AZURE_INSTANCE_SIZES}") "
+    [[ "${AZURE_ZONES}" ]] && optionals+="-zone $(cleanup_spaces "${AZURE_ZONES}") " # Spread pod vms across these availability zones
     [[ "${TAGS}" ]] && optionals+="-tags $(cleanup_spaces "${TAGS}") " # Custom tags applied to pod vm
     [[ "${ENABLE_SECURE_BOOT}" == "true" ]] && optionals+="-enable-secure-boot "
+    [[ "${AZURE_SECURITY_TYPE}" ]] && optionals+="-security-type ${AZURE_SECURITY_TYPE} "
+    [[ "${AZURE_DISABLE_VTPM}" == "true" ]] && optionals+="-disable-vtpm "
+    [[ "${AZURE_RETAIN_OS_DISK_ON_DELETE}" == "true" ]] && optionals+="-retain-os-disk-on-delete "
+    [[ "${AZURE_DEDICATED_HOST_ID}" ]] && optionals+="-dedicated-host-id ${AZURE_DEDICATED_HOST_ID} "
+    [[ "${AZURE_HOST_GROUP_ID}" ]] && optionals+="-host-group-id ${AZURE_HOST_GROUP_ID} " # automatic placement on the hosts of the group
+    [[ "${AZURE_APPLICATION_SECURITY_GROUP_IDS}" ]] && optionals+="-application-security-group-ids $(cleanup_spaces "${AZURE_APPLICATION_SECURITY_GROUP_IDS}") "
     [[ "${USE_PUBLIC_IP}" == "true" ]] && optionals+="-use-public-ip "
+    [[ "${AZURE_ENABLE_ACCELERATED_NETWORKING}" == "true" ]] && optionals+="-enable-accelerated-networking "
     [[ "${ROOT_VOLUME_SIZE}" ]] && optionals+="-root-volume-size ${ROOT_VOLUME_SIZE} " # Specify root volume size for pod vm
+    [[ "${AZURE_ROOT_VOLUME_TYPE}" ]] && optionals+="-root-volume-type ${AZURE_ROOT_VOLUME_TYPE} " # default Premium_LRS
+    [[ "${AZURE_ENSURE_NSG_RULES}" == "true" ]] && optionals+="-ensure-nsg-rules "
+    [[ "${AZURE_NSG_RULE_SOURCE_PREFIX}" ]] && optionals+="-nsg-rule-source-prefix ${AZURE_NSG_RULE_SOURCE_PREFIX} "
+    [[ "${AZURE_DISABLE_VM_AGENT}" == "true" ]] && optionals+="-disable-vm-agent "
+    [[ "${AZURE_DISABLE_EXTENSION_OPERATIONS}" == "true" ]] && optionals+="-disable-extension-operations "
+    [[ "${AZURE_DISABLE_BOOT_DIAGNOSTICS}" == "true" ]] && optionals+="-disable-boot-diagnostics "
+    [[ "${AZURE_USERDATA_STORAGE_ACCOUNT}" ]] && optionals+="-userdata-storage-account ${AZURE_USERDATA_STORAGE_ACCOUNT} "
+    [[ "${AZURE_USERDATA_STORAGE_CONTAINER}" ]] && optionals+="-userdata-storage-container ${AZURE_USERDATA_STORAGE_CONTAINER} "
+    [[ "${AZURE_TEARDOWN_DELETE_VMS}" == "true" ]] && optionals+="-teardown-delete-vms "
+    [[ "${AZURE_CLEANUP_ORPHANED_DISKS}" == "true" ]] && optionals+="-cleanup-orphaned-disks "
+    [[ "${AZURE_USE_HIBERNATION}" == "true" ]] && optionals+="-use-hibernation "
+    [[ "${AZURE_USE_SPOT}" == "true" ]] && optionals+="-use-spot "
+    [[ "${AZURE_SPOT_MAX_PRICE}" ]] && optionals+="-spot-max-price ${AZURE_SPOT_MAX_PRICE} "
+    [[ "${AZURE_SPOT_EVICTION_POLICY}" ]] && optionals+="-spot-eviction-policy ${AZURE_SPOT_EVICTION_POLICY} "
+    [[ "${AZURE_DISABLE_POD_TAGS}" == "true" ]] && optionals+="-disable-pod-tags "
+    [[ "${USERDATA_FORMAT}" ]] && optionals+="-userdata-format ${USERDATA_FORMAT} "
 
     set -x
     exec cloud-api-adaptor azure \
@@ -258,8 +302,21 @@ byom() {
     [[ "${SSH_PRIV_KEY_PATH}" ]] && optionals+="-ssh-priv-key ${SSH_PRIV_KEY_PATH} "
     [[ "${SSH_TIMEOUT}" ]] && optionals+="-ssh-timeout ${SSH_TIMEOUT} "
     [[ "${SSH_HOST_KEY_ALLOWLIST_DIR}" ]] && optionals+="-ssh-host-key-allowlist-dir ${SSH_HOST_KEY_ALLOWLIST_DIR} "
+    [[ "${FILE_TRANSPORT}" ]] && optionals+="-file-transport ${FILE_TRANSPORT} "
+    [[ "${RESET_ON_ALLOCATE}" == "true" ]] && optionals+="-reset-on-allocate "
+    [[ "${ALLOW_SKIP_REBOOT}" == "true" ]] && optionals+="-allow-skip-reboot "
     [[ "${POOL_NAMESPACE}" ]] && optionals+="-pool-namespace ${POOL_NAMESPACE} "
     [[ "${POOL_CONFIGMAP_NAME}" ]] && optionals+="-pool-configmap-name ${POOL_CONFIGMAP_NAME} "
+    [[ "${POOL_AUDIT_HISTORY_SIZE}" ]] && optionals+="-pool-audit-history-size ${POOL_AUDIT_HISTORY_SIZE} "
+    [[ "${POOL_NAMESPACE_QUOTAS}" ]] && optionals+="-pool-namespace-quotas $(cleanup_spaces "${POOL_NAMESPACE_QUOTAS}") "
+    [[ "${POOL_HEALTH_LISTEN}" ]] && optionals+="-pool-health-listen ${POOL_HEALTH_LISTEN} "
+    [[ "${POOL_STARTUP_PROBE}" == "true" ]] && optionals+="-pool-startup-probe "
+    [[ "${POOL_STARTUP_MIN_HEALTHY}" ]] && optionals+="-pool-startup-min-healthy ${POOL_STARTUP_MIN_HEALTHY} "
+    [[ "${CLUSTER_ID}" ]] && optionals+="-cluster-id ${CLUSTER_ID} "
+    [[ "${POOL_READ_ONLY}" == "true" ]] && optionals+="-pool-read-only "
+    [[ "${POOL_WARM_WINDOW}" ]] && optionals+="-pool-warm-window ${POOL_WARM_WINDOW} "
+    [[ "${POOL_REUSE_GRACE_PERIOD}" ]] && optionals+="-pool-reuse-grace-period ${POOL_REUSE_GRACE_PERIOD} "
+    [[ "${SHRED_ON_DELETE}" == "true" ]] && optionals+="-shred-on-delete "
 
     set -x
     exec cloud-api-adaptor byom \
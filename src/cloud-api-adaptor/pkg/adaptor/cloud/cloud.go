@@ -56,6 +56,10 @@ type ServerConfig struct {
 	PeerPodsLimitPerNode    int
 	RootVolumeSize          int
 	EnableScratchSpace      bool
+	MaxConcurrentCreates    int
+	CreateQueueTimeout      time.Duration
+	ReconcileInterval       time.Duration
+	SizeFromPodResources    bool
 }
 
 var logger = log.New(log.Writer(), "[adaptor/cloud] ", log.LstdFlags|log.Lmsgprefix)
@@ -125,16 +129,109 @@ func NewService(provider provider.Provider, proxyFactory proxy.Factory, workerNo
 		sshClient:    sshClient,
 	}
 	s.cond = sync.NewCond(&s.mutex)
+	if serverConfig.MaxConcurrentCreates > 0 {
+		s.createSem = make(chan struct{}, serverConfig.MaxConcurrentCreates)
+	}
 	s.ppService, err = k8sops.NewPeerPodService()
 	if err != nil {
 		logger.Printf("failed to create PeerPodService, runtime failure may result in dangling resources %s", err)
+	} else {
+		s.peerPods = s.ppService
+	}
+	if serverConfig.ReconcileInterval > 0 {
+		s.startReconciler(serverConfig.ReconcileInterval)
 	}
 
 	return s
 }
 
+// startReconciler periodically garbage-collects the instances no sandbox uses, if the provider supports it
+func (s *cloudService) startReconciler(interval time.Duration) {
+	reconciler, ok := s.provider.(provider.Reconciler)
+	if !ok {
+		logger.Printf("the provider can't reconcile orphaned instances, ignoring the reconcile interval")
+		return
+	}
+	// After a restart the sandboxes are empty, only the PeerPod objects still tell the
+	// instances of the running pods apart from the orphaned ones
+	if s.peerPods == nil {
+		logger.Printf("the PeerPod objects recording the instances in use are not available, ignoring the reconcile interval")
+		return
+	}
+
+	s.stopReconciler = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stopReconciler:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				s.reconcile(ctx, reconciler)
+				cancel()
+			}
+		}
+	}()
+}
+
+// reconcile garbage-collects the instances that neither a PeerPod object nor a sandbox uses. The
+// sandboxes cover the instances created but not recorded in a PeerPod object yet.
+func (s *cloudService) reconcile(ctx context.Context, reconciler provider.Reconciler) {
+	inUse, err := s.peerPods.InstanceIDs(ctx)
+	if err != nil {
+		logger.Printf("not reconciling orphaned instances, listing the PeerPod objects: %v", err)
+		return
+	}
+
+	s.mutex.Lock()
+	for _, sandbox := range s.sandboxes {
+		if sandbox.instanceID != "" {
+			inUse[sandbox.instanceID] = true
+		}
+	}
+	s.mutex.Unlock()
+
+	if err := reconciler.Reconcile(ctx, inUse); err != nil {
+		logger.Printf("reconciling orphaned instances: %v", err)
+	}
+}
+
+// createInstance calls the provider's CreateInstance, bounding the number of
+// in-flight creations when MaxConcurrentCreates is set. Calls over the limit
+// wait for a free slot for at most CreateQueueTimeout.
+func (s *cloudService) createInstance(ctx context.Context, podName, sid string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
+	if s.createSem != nil {
+		waitCtx := ctx
+		if s.serverConfig.CreateQueueTimeout > 0 {
+			var cancel context.CancelFunc
+			waitCtx, cancel = context.WithTimeout(ctx, s.serverConfig.CreateQueueTimeout)
+			defer cancel()
+		}
+
+		select {
+		case s.createSem <- struct{}{}:
+			defer func() { <-s.createSem }()
+		case <-waitCtx.Done():
+			return nil, fmt.Errorf("waiting for one of %d instance creation slots: %w", cap(s.createSem), waitCtx.Err())
+		}
+	}
+
+	return s.provider.CreateInstance(ctx, podName, sid, cloudConfig, spec)
+}
+
 func (s *cloudService) Teardown() error {
-	return s.provider.Teardown()
+	if s.stopReconciler != nil {
+		close(s.stopReconciler)
+	}
+
+	err := s.provider.Teardown()
+	if closer, ok := s.provider.(provider.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
 }
 
 func (s *cloudService) ConfigVerifier() error {
@@ -216,6 +313,13 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 	// Get Pod VM cpu, memory and gpu from annotations
 	vcpus, memory, gpus := util.GetPodvmResourcesFromAnnotation(req.Annotations)
 
+	// Without any, size the Pod VM for the resources of the pod if enabled. The CRI passes no
+	// GPUs, which are only ever set by the annotations.
+	if s.serverConfig.SizeFromPodResources && instanceType == "" && vcpus == 0 && memory == 0 && gpus == 0 {
+		resources := provider.InstanceTypeSpecFromResources(util.GetPodResourcesFromAnnotation(req.Annotations))
+		vcpus, memory = resources.VCPUs, resources.Memory
+	}
+
 	// Get Pod VM image from annotations
 	image := util.GetImageFromAnnotation(req.Annotations)
 
@@ -256,6 +360,7 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		PodName:      pod,
 		PodNetwork:   podNetworkConfig,
 		TLSClientCA:  string(agentProxy.ClientCA()),
+		ListenPort:   s.serverConfig.ForwarderPort,
 	}
 
 	if caService := agentProxy.CAService(); caService != nil {
@@ -354,6 +459,7 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		id:            sid,
 		podName:       pod,
 		podNamespace:  namespace,
+		annotations:   req.Annotations,
 		netNSPath:     netNSPath,
 		agentProxy:    agentProxy,
 		podNetwork:    podNetworkConfig,
@@ -385,7 +491,10 @@ func (s *cloudService) StartVM(ctx context.Context, req *pb.StartVMRequest) (res
 		return nil, fmt.Errorf("getting sandbox: %w", err)
 	}
 
-	instance, err := s.provider.CreateInstance(ctx, sandbox.podName, string(sid), sandbox.cloudConfig, sandbox.spec)
+	ctx = provider.WithPodIdentity(ctx, provider.PodIdentity{Name: sandbox.podName, Namespace: sandbox.podNamespace, SandboxID: string(sid)})
+	ctx = provider.WithPodAnnotations(ctx, sandbox.annotations)
+
+	instance, err := s.createInstance(ctx, sandbox.podName, string(sid), sandbox.cloudConfig, sandbox.spec)
 	if err != nil {
 		return nil, fmt.Errorf("creating an instance : %w", err)
 	}
@@ -400,12 +509,17 @@ func (s *cloudService) StartVM(ctx context.Context, req *pb.StartVMRequest) (res
 		return nil, fmt.Errorf("setting instance: %w", err)
 	}
 
-	logger.Printf("created an instance %s for sandbox %s", instance.Name, sid)
+	logger.Printf("created an instance %s for sandbox %s in %s (zone: %q, from pool: %t)", instance.Name, sid, instance.CreationDuration, instance.Zone, instance.FromPool)
 
 	if len(instance.IPs) == 0 {
 		return nil, fmt.Errorf("instance IP is not available")
 	}
 
+	// The agent can't be reached on an instance that is not going to run
+	if instance.State == provider.InstanceStateStopped || instance.State == provider.InstanceStateTerminated {
+		return nil, fmt.Errorf("instance %s is %s", instance.Name, instance.State)
+	}
+
 	instanceIP := instance.IPs[0].String()
 	forwarderPort := s.serverConfig.ForwarderPort
 
@@ -475,6 +589,9 @@ func (s *cloudService) StopVM(ctx context.Context, req *pb.StopVMRequest) (*pb.S
 		sandbox.sshClientInst.DisconnectPP(string(sid))
 	}
 
+	ctx = provider.WithPodIdentity(ctx, provider.PodIdentity{Name: sandbox.podName, Namespace: sandbox.podNamespace, SandboxID: string(sid)})
+	ctx = provider.WithPodAnnotations(ctx, sandbox.annotations)
+
 	if err := s.provider.DeleteInstance(ctx, sandbox.instanceID); err != nil {
 		logger.Printf("Error deleting an instance %s: %v", sandbox.instanceID, err)
 	} else if s.ppService != nil {
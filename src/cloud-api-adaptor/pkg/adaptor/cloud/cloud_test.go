@@ -5,10 +5,13 @@ package cloud
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/netip"
 	"net/url"
+	"sync"
 	"testing"
+	"time"
 
 	cri "github.com/containerd/containerd/pkg/cri/annotations"
 	pb "github.com/kata-containers/kata-containers/src/runtime/protocols/hypervisor"
@@ -162,6 +165,32 @@ func TestCloudService(t *testing.T) {
 	assert.NotNil(t, res3)
 }
 
+func TestCreateVMSizeFromPodResources(t *testing.T) {
+	annotations := map[string]string{
+		cri.SandboxNamespace: "default",
+		cri.SandboxName:      "mypod",
+		cri.SandboxCPUShares: "2048",
+		cri.SandboxMem:       "4294967296",
+	}
+
+	for _, enabled := range []bool{false, true} {
+		dir := t.TempDir()
+		cfg := &ServerConfig{PodsDir: dir, ForwarderPort: forwarder.DefaultListenPort, SizeFromPodResources: enabled}
+		s := NewService(&mockProvider{}, &mockProxyFactory{podsDir: dir}, &mockWorkerNode{}, cfg, "").(*cloudService)
+
+		_, err := s.CreateVM(context.Background(), &pb.CreateVMRequest{Id: "123", Annotations: annotations})
+		assert.NoError(t, err)
+
+		want := provider.InstanceTypeSpec{}
+		if enabled {
+			want = provider.InstanceTypeSpec{VCPUs: 2, Memory: 4096}
+		}
+		sandbox, err := s.getSandbox("123")
+		assert.NoError(t, err)
+		assert.Equal(t, want, sandbox.spec, "size from pod resources %v", enabled)
+	}
+}
+
 func TestCloudServiceWithSecureComms(t *testing.T) {
 	sshport := "6001"
 	kubemgr.InitKubeMgrMock()
@@ -232,3 +261,187 @@ func TestCloudServiceWithSecureComms(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, res3)
 }
+
+type blockingProvider struct {
+	mockProvider
+	mutex    sync.Mutex
+	inFlight int
+	maxSeen  int
+	release  chan struct{}
+}
+
+func (p *blockingProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
+	p.mutex.Lock()
+	p.inFlight++
+	if p.inFlight > p.maxSeen {
+		p.maxSeen = p.inFlight
+	}
+	p.mutex.Unlock()
+
+	<-p.release
+
+	p.mutex.Lock()
+	p.inFlight--
+	p.mutex.Unlock()
+
+	return p.mockProvider.CreateInstance(ctx, podName, sandboxID, cloudConfig, spec)
+}
+
+func TestCreateInstanceConcurrencyLimit(t *testing.T) {
+	const limit = 2
+	const creates = 6
+
+	p := &blockingProvider{release: make(chan struct{})}
+	cfg := &ServerConfig{
+		MaxConcurrentCreates: limit,
+		CreateQueueTimeout:   time.Minute,
+	}
+	s := NewService(p, &mockProxyFactory{}, &mockWorkerNode{}, cfg, "").(*cloudService)
+
+	var wg sync.WaitGroup
+	for i := 0; i < creates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.createInstance(context.Background(), "pod", fmt.Sprintf("sandbox-%d", i), &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+			assert.NoError(t, err)
+		}(i)
+	}
+
+	// Wait until the limit is reached and check that no more creations are let through
+	assert.Eventually(t, func() bool {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		return p.inFlight == limit
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 0; i < creates; i++ {
+		p.release <- struct{}{}
+	}
+	wg.Wait()
+
+	assert.Equal(t, limit, p.maxSeen)
+}
+
+func TestCreateInstanceQueueTimeout(t *testing.T) {
+	p := &blockingProvider{release: make(chan struct{})}
+	cfg := &ServerConfig{
+		MaxConcurrentCreates: 1,
+		CreateQueueTimeout:   50 * time.Millisecond,
+	}
+	s := NewService(p, &mockProxyFactory{}, &mockWorkerNode{}, cfg, "").(*cloudService)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := s.createInstance(context.Background(), "pod", "sandbox-1", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+		assert.NoError(t, err)
+	}()
+
+	assert.Eventually(t, func() bool {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		return p.inFlight == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err := s.createInstance(context.Background(), "pod", "sandbox-2", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	p.release <- struct{}{}
+	<-done
+}
+
+type reconcilingProvider struct {
+	mockProvider
+	mutex sync.Mutex
+	inUse []map[string]bool
+}
+
+func (p *reconcilingProvider) Reconcile(ctx context.Context, inUse map[string]bool) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.inUse = append(p.inUse, inUse)
+	return nil
+}
+
+type fakePeerPodLister struct {
+	ids map[string]bool
+	err error
+}
+
+func (l *fakePeerPodLister) InstanceIDs(ctx context.Context) (map[string]bool, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	ids := make(map[string]bool, len(l.ids))
+	for id := range l.ids {
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+func TestReconcile(t *testing.T) {
+	p := &reconcilingProvider{}
+	s := NewService(p, &mockProxyFactory{}, &mockWorkerNode{}, &ServerConfig{}, "").(*cloudService)
+	s.peerPods = &fakePeerPodLister{ids: map[string]bool{"i-2": true}}
+
+	// Only sandboxes with an instance are in use, along with the instances of the PeerPods
+	assert.NoError(t, s.addSandbox("sandbox-1", &sandbox{id: "sandbox-1", instanceID: "i-1"}))
+	assert.NoError(t, s.addSandbox("sandbox-2", &sandbox{id: "sandbox-2"}))
+
+	s.startReconciler(10 * time.Millisecond)
+	assert.Eventually(t, func() bool {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		return len(p.inUse) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	p.mutex.Lock()
+	assert.Equal(t, map[string]bool{"i-1": true, "i-2": true}, p.inUse[0])
+	p.mutex.Unlock()
+
+	assert.NoError(t, s.Teardown())
+}
+
+func TestReconcileAfterRestart(t *testing.T) {
+	p := &reconcilingProvider{}
+	s := NewService(p, &mockProxyFactory{}, &mockWorkerNode{}, &ServerConfig{}, "").(*cloudService)
+	s.peerPods = &fakePeerPodLister{ids: map[string]bool{"i-1": true}}
+
+	// No sandbox is recovered yet, the PeerPod keeps its instance
+	s.reconcile(context.Background(), p)
+	assert.Equal(t, []map[string]bool{{"i-1": true}}, p.inUse)
+}
+
+func TestReconcileSkipped(t *testing.T) {
+	p := &reconcilingProvider{}
+	s := NewService(p, &mockProxyFactory{}, &mockWorkerNode{}, &ServerConfig{}, "").(*cloudService)
+
+	// Without the PeerPod objects the reconciler does not start
+	s.startReconciler(10 * time.Millisecond)
+	assert.Nil(t, s.stopReconciler)
+
+	// A failed listing skips the round rather than treating every instance as orphaned
+	s.peerPods = &fakePeerPodLister{err: errors.New("forbidden")}
+	s.reconcile(context.Background(), p)
+	assert.Empty(t, p.inUse)
+}
+
+type closingProvider struct {
+	mockProvider
+	closed bool
+}
+
+func (p *closingProvider) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestTeardownClosesProvider(t *testing.T) {
+	p := &closingProvider{}
+	s := NewService(p, &mockProxyFactory{}, &mockWorkerNode{}, &ServerConfig{}, "")
+
+	assert.NoError(t, s.Teardown())
+	assert.True(t, p.closed)
+}
@@ -33,8 +33,18 @@ type cloudService struct {
 	cond         *sync.Cond
 	mutex        sync.Mutex
 	ppService    *k8sops.PeerPodService
+	// Lists the instances recorded in the PeerPod objects, nil without a PeerPodService
+	peerPods     peerPodLister
 	sshClient    *wnssh.SshClient
 	serverConfig *ServerConfig
+	createSem    chan struct{}
+	// Closed on Teardown to stop the periodic reconcile, nil if it's not running
+	stopReconciler chan struct{}
+}
+
+// peerPodLister lists the IDs of the instances recorded in the PeerPod objects
+type peerPodLister interface {
+	InstanceIDs(ctx context.Context) (map[string]bool, error)
 }
 
 type sandboxID string
@@ -46,6 +56,7 @@ type sandbox struct {
 	id            sandboxID
 	podName       string
 	podNamespace  string
+	annotations   map[string]string
 	instanceName  string
 	instanceID    string
 	netNSPath     string
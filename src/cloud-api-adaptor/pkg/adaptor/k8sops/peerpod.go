@@ -110,6 +110,23 @@ func (s *PeerPodService) OwnPeerPod(podname string, podns string, instanceID str
 	return nil
 }
 
+// InstanceIDs returns the IDs of the instances recorded in the PeerPod objects of the cloud
+// provider in all namespaces. Unlike the sandboxes of the adaptor, they survive a restart.
+func (s *PeerPodService) InstanceIDs(ctx context.Context) (map[string]bool, error) {
+	list := peerPodV1alpha1.PeerPodList{}
+	if err := s.uclient.Get().Resource("peerPods").Do(ctx).Into(&list); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool, len(list.Items))
+	for _, pp := range list.Items {
+		if pp.Spec.CloudProvider == s.cloudProvider && pp.Spec.InstanceID != "" {
+			ids[pp.Spec.InstanceID] = true
+		}
+	}
+	return ids, nil
+}
+
 // remove finalizer from PeerPod
 func (s *PeerPodService) ReleasePeerPod(podname string, podns string, instanceID string) error {
 	pod, err := s.getPod(podname, podns)
@@ -17,6 +17,7 @@ import (
 	"time"
 
 	retry "github.com/avast/retry-go/v4"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/agentproto"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
 	"github.com/containerd/ttrpc"
 	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
@@ -26,6 +27,10 @@ const (
 	SocketName          = "agent.ttrpc"
 	DefaultProxyTimeout = 5 * time.Minute
 
+	// Number of dial attempts, with exponential backoff, to re-establish a dropped agent
+	// connection before the proxy gives up
+	DefaultReconnectAttempts = 5
+
 	// The server TLS certificate must have this as SAN
 	// TODO: Avoid hard coding of server name
 	podvmServername = "podvm-server"
@@ -51,6 +56,8 @@ type agentProxy struct {
 	pauseImage   string
 	proxyTimeout time.Duration
 	stopOnce     sync.Once
+
+	reconnectAttempts uint
 }
 
 func NewAgentProxy(serverName, socketPath, pauseImage string, tlsConfig *tlsutil.TLSConfig, caService tlsutil.CAService, proxyTimeout time.Duration) AgentProxy {
@@ -63,10 +70,14 @@ func NewAgentProxy(serverName, socketPath, pauseImage string, tlsConfig *tlsutil
 		pauseImage:   pauseImage,
 		tlsConfig:    tlsConfig,
 		caService:    caService,
+
+		reconnectAttempts: DefaultReconnectAttempts,
 	}
 }
 
-func (p *agentProxy) dial(ctx context.Context, address string) (net.Conn, error) {
+// dial connects to the agent at address. It retries with exponential backoff until
+// the proxy timeout expires, or until attempts dials have failed if attempts is not 0.
+func (p *agentProxy) dial(ctx context.Context, address string, attempts uint) (net.Conn, error) {
 	var conn net.Conn
 
 	var dialer interface {
@@ -115,7 +126,7 @@ func (p *agentProxy) dial(ctx context.Context, address string) (net.Conn, error)
 			}
 			return err
 		},
-		retry.Attempts(0),
+		retry.Attempts(attempts),
 		retry.Context(ctx),
 		retry.MaxDelay(5*time.Second),
 	)
@@ -144,8 +155,20 @@ func (p *agentProxy) Start(ctx context.Context, serverURL *url.URL) error {
 		return fmt.Errorf("failed to listen on %s: %w", p.socketPath, err)
 	}
 
+	// The first connection waits for the pod VM to boot. Once it is up, a dropped
+	// connection is only retried reconnectAttempts times. The dialer is always called
+	// with the redirector lock held, so connected needs no synchronization.
+	var connected bool
 	dialer := func(ctx context.Context) (net.Conn, error) {
-		return p.dial(ctx, serverURL.Host)
+		var attempts uint
+		if connected {
+			attempts = p.reconnectAttempts
+		}
+		conn, err := p.dial(ctx, serverURL.Host, attempts)
+		if err == nil {
+			connected = true
+		}
+		return conn, err
 	}
 
 	proxyService := newProxyService(dialer, p.pauseImage)
@@ -184,6 +207,9 @@ func (p *agentProxy) Start(ctx context.Context, serverURL *url.URL) error {
 		}
 	}()
 
+	reconnectErr := make(chan error, 1)
+	go p.reconnect(ctx, proxyService, reconnectErr)
+
 	close(p.readyCh)
 
 	select {
@@ -194,11 +220,35 @@ func (p *agentProxy) Start(ctx context.Context, serverURL *url.URL) error {
 	case <-p.stopCh:
 	case err := <-ttrpcServerErr:
 		return err
+	case err := <-reconnectErr:
+		return err
 	}
 
 	return nil
 }
 
+// reconnect re-establishes the agent connection whenever it drops, so that a transient
+// network failure doesn't tear down the sandbox. It reports an error on errCh when the
+// connection can't be re-established.
+func (p *agentProxy) reconnect(ctx context.Context, redirector agentproto.Redirector, errCh chan<- error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-redirector.Disconnected():
+		}
+
+		logger.Print("agent proxy connection lost, reconnecting")
+
+		if err := redirector.Connect(ctx); err != nil {
+			if ctx.Err() == nil {
+				errCh <- fmt.Errorf("failed to re-establish agent proxy connection: %w", err)
+			}
+			return
+		}
+	}
+}
+
 func (p *agentProxy) Ready() chan struct{} {
 	return p.readyCh
 }
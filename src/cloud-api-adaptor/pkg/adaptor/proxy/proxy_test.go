@@ -6,6 +6,7 @@ package proxy
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/url"
 	"path/filepath"
@@ -170,7 +171,7 @@ func TestDialerSuccess(t *testing.T) {
 			}
 		}()
 
-		conn, err := p.dial(context.Background(), address)
+		conn, err := p.dial(context.Background(), address, 0)
 		if err == nil {
 			listener.Close()
 			break
@@ -197,7 +198,7 @@ func TestDialerFailure(t *testing.T) {
 	}
 
 	address := "0.0.0.0:0"
-	conn, err := p.dial(context.Background(), address)
+	conn, err := p.dial(context.Background(), address, 0)
 	if err == nil {
 		conn.Close()
 		t.Fatal("expect error, got nil")
@@ -208,6 +209,147 @@ func TestDialerFailure(t *testing.T) {
 	}
 }
 
+// flakyListener hands every accepted connection to the test, so that it can drop them
+type flakyListener struct {
+	net.Listener
+	conns chan net.Conn
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.conns <- conn
+	}
+	return conn, err
+}
+
+func startFlakyAgent(t *testing.T) (*ttrpc.Server, *flakyListener) {
+	t.Helper()
+
+	agentServer, err := ttrpc.NewServer()
+	if err != nil {
+		t.Fatalf("expect no error, got %q", err)
+	}
+	pb.RegisterAgentServiceService(agentServer, &agentMock{})
+	pb.RegisterHealthService(agentServer, &agentMock{})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expect no error, got %q", err)
+	}
+	agentListener := &flakyListener{Listener: listener, conns: make(chan net.Conn, 10)}
+
+	go func() {
+		_ = agentServer.Serve(context.Background(), agentListener)
+	}()
+	t.Cleanup(func() {
+		agentServer.Close()
+	})
+
+	return agentServer, agentListener
+}
+
+func startProxy(t *testing.T, serverURL *url.URL, reconnectAttempts uint) (*agentProxy, chan error) {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+
+	p := NewAgentProxy("podvm", socketPath, "", nil, nil, 5*time.Second).(*agentProxy)
+	p.reconnectAttempts = reconnectAttempts
+
+	proxyErrCh := make(chan error, 1)
+	go func() {
+		defer close(proxyErrCh)
+
+		if err := p.Start(context.Background(), serverURL); err != nil {
+			proxyErrCh <- err
+		}
+	}()
+
+	select {
+	case err := <-proxyErrCh:
+		t.Fatalf("expect no error, got %q", err)
+	case <-p.Ready():
+	}
+
+	return p, proxyErrCh
+}
+
+func TestReconnect(t *testing.T) {
+
+	_, agentListener := startFlakyAgent(t)
+
+	serverURL := &url.URL{
+		Scheme: "grpc",
+		Host:   agentListener.Addr().String(),
+	}
+
+	p, proxyErrCh := startProxy(t, serverURL, DefaultReconnectAttempts)
+	defer func() {
+		if err := p.Shutdown(); err != nil {
+			t.Fatalf("expect no error, got %q", err)
+		}
+	}()
+
+	// Drop the first agent connection
+	(<-agentListener.conns).Close()
+
+	select {
+	case <-agentListener.conns:
+	case err := <-proxyErrCh:
+		t.Fatalf("expect no error, got %q", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("expect the proxy to reconnect, got timeout")
+	}
+
+	conn, err := net.Dial("unix", p.socketPath)
+	if err != nil {
+		t.Fatalf("expect no error, got %q", err)
+	}
+	client := pb.NewAgentServiceClient(ttrpc.NewClient(conn))
+
+	res, err := client.CreateContainer(context.Background(), &pb.CreateContainerRequest{ContainerId: "123", OCI: &pb.Spec{}})
+	if err != nil {
+		t.Fatalf("expect no error, got %q", err)
+	}
+	if res == nil {
+		t.Fatal("expect non nil, got nil")
+	}
+
+	select {
+	case err := <-proxyErrCh:
+		t.Fatalf("expect no error, got %q", err)
+	default:
+	}
+}
+
+func TestReconnectFailure(t *testing.T) {
+
+	agentServer, agentListener := startFlakyAgent(t)
+
+	serverURL := &url.URL{
+		Scheme: "grpc",
+		Host:   agentListener.Addr().String(),
+	}
+
+	_, proxyErrCh := startProxy(t, serverURL, 2)
+
+	// Take the agent down for good
+	if err := agentServer.Close(); err != nil {
+		t.Fatalf("expect no error, got %q", err)
+	}
+	(<-agentListener.conns).Close()
+
+	select {
+	case err := <-proxyErrCh:
+		if e, a := "failed to re-establish agent proxy connection", fmt.Sprint(err); !strings.Contains(a, e) {
+			t.Fatalf("expect %q, got %q", e, a)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expect the proxy to fail, got timeout")
+	}
+}
+
 type agentMock struct{}
 
 func (m *agentMock) CreateContainer(ctx context.Context, req *pb.CreateContainerRequest) (*emptypb.Empty, error) {
@@ -16,8 +16,7 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/cloud"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/proxy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
-	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
-	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/providertest"
 	"github.com/containerd/containerd/pkg/cri/annotations"
 	"github.com/containerd/ttrpc"
 	"github.com/google/uuid"
@@ -150,7 +149,9 @@ func startAgentServer(t *testing.T) string {
 func newServer(t *testing.T, socketPath, podsDir string) Server {
 
 	port := startAgentServer(t)
-	provider := &mockProvider{}
+	provider := &providertest.MockProvider{
+		IPs: []netip.Addr{netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("127.0.0.1")},
+	}
 	serverConfig := &cloud.ServerConfig{
 		SocketPath:              socketPath,
 		PodsDir:                 podsDir,
@@ -191,45 +192,3 @@ func (n *mockWorkerNode) Setup(nsPath string, podNodeIPs []netip.Addr, config *t
 func (n *mockWorkerNode) Teardown(nsPath string, config *tunneler.Config) error {
 	return nil
 }
-
-type mockProvider struct {
-	primaryIP   string
-	secondaryIP string
-}
-
-func (p *mockProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
-
-	primaryIP := p.primaryIP
-	if primaryIP == "" {
-		primaryIP = "127.0.0.1"
-	}
-
-	secondaryIP := p.secondaryIP
-	if secondaryIP == "" {
-		secondaryIP = "127.0.0.1"
-	}
-
-	ips := make([]netip.Addr, 2)
-	ips[0] = netip.MustParseAddr(primaryIP)
-	ips[1] = netip.MustParseAddr(secondaryIP)
-
-	instance := &provider.Instance{
-		ID:   "mock",
-		Name: "mock",
-		IPs:  ips,
-	}
-
-	return instance, nil
-}
-
-func (p *mockProvider) DeleteInstance(ctx context.Context, instanceID string) error {
-	return nil
-}
-
-func (p *mockProvider) Teardown() error {
-	return nil
-}
-
-func (p *mockProvider) ConfigVerifier() error {
-	return nil
-}
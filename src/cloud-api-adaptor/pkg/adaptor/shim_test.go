@@ -10,6 +10,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"sync"
@@ -22,6 +23,7 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder/interceptor"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/providertest"
 	"github.com/containerd/containerd/pkg/cri/annotations"
 	"github.com/containerd/ttrpc"
 	pb "github.com/kata-containers/kata-containers/src/runtime/protocols/hypervisor"
@@ -76,6 +78,9 @@ func TestShim(t *testing.T) {
 		t.Fatal(err)
 	}
 	secondaryIP := os.Getenv("SHIMTEST_SECONDARY_POD_NODE_IP")
+	if secondaryIP == "" {
+		secondaryIP = "127.0.0.1"
+	}
 
 	var workerNode podnetwork.WorkerNode
 
@@ -98,7 +103,9 @@ func TestShim(t *testing.T) {
 		PeerPodsLimitPerNode:    -1,
 	}
 
-	provider := &mockProvider{primaryIP: primaryIP, secondaryIP: secondaryIP}
+	provider := &providertest.MockProvider{
+		IPs: []netip.Addr{netip.MustParseAddr(primaryIP), netip.MustParseAddr(secondaryIP)},
+	}
 	srv := NewServer(provider, serverConfig, workerNode)
 
 	serverDone := make(chan struct{})
@@ -0,0 +1,211 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultAdminListenAddr leaves the admin server disabled, since it serves without TLS.
+	// It is enabled by setting a listen address, e.g. 127.0.0.1:15151 to keep it local.
+	DefaultAdminListenAddr = ""
+	AdminHealthPath        = "/healthz"
+	AdminMetricsPath       = "/metrics"
+	AdminPprofPath         = "/debug/pprof/"
+	AdminConfigPath        = "/config"
+)
+
+// AdminServer serves health and metrics endpoints, and optionally pprof and the daemon
+// config, over plain HTTP on a listener separate from the agent protocol data port
+type AdminServer interface {
+	Start(ctx context.Context) error
+	Ready() chan struct{}
+	Addr() string
+}
+
+type adminServer struct {
+	listenAddr string
+	daemon     Daemon
+	startTime  time.Time
+	readyCh    chan struct{}
+	pprof      bool
+	config     *Config
+	token      string
+}
+
+// AdminOption customizes an admin server created by NewAdminServer
+type AdminOption func(*adminServer)
+
+// WithPprof serves the net/http/pprof endpoints under AdminPprofPath. They expose the
+// internals of the process, so they are only meant for diagnostics in the field
+func WithPprof() AdminOption {
+	return func(s *adminServer) {
+		s.pprof = true
+	}
+}
+
+// WithConfig serves the daemon config, with its secrets redacted, under AdminConfigPath to
+// the requests carrying token as bearer token, e.g. to debug the pod network remotely.
+// The endpoint is not served with an empty token.
+func WithConfig(config *Config, token string) AdminOption {
+	return func(s *adminServer) {
+		if token != "" {
+			s.config = config
+			s.token = token
+		}
+	}
+}
+
+func NewAdminServer(listenAddr string, daemon Daemon, opts ...AdminOption) AdminServer {
+	s := &adminServer{
+		listenAddr: listenAddr,
+		daemon:     daemon,
+		readyCh:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *adminServer) daemonReady() bool {
+	select {
+	case <-s.daemon.Ready():
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *adminServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !s.daemonReady() {
+		http.Error(w, "agent-protocol-forwarder is not ready", http.StatusServiceUnavailable)
+		return
+	}
+	if !s.daemon.Healthy() {
+		http.Error(w, "agent-protocol-forwarder tunnel probe is failing", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *adminServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	ready := 0
+	if s.daemonReady() {
+		ready = 1
+	}
+	healthy := 0
+	if s.daemon.Healthy() {
+		healthy = 1
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP apf_ready Whether the agent protocol forwarder is ready to serve requests.\n")
+	fmt.Fprintf(w, "# TYPE apf_ready gauge\n")
+	fmt.Fprintf(w, "apf_ready %d\n", ready)
+	fmt.Fprintf(w, "# HELP apf_tunnel_healthy Whether the tunnel probe succeeds, 1 when probing is disabled.\n")
+	fmt.Fprintf(w, "# TYPE apf_tunnel_healthy gauge\n")
+	fmt.Fprintf(w, "apf_tunnel_healthy %d\n", healthy)
+	fmt.Fprintf(w, "# HELP apf_uptime_seconds Time since the admin server started.\n")
+	fmt.Fprintf(w, "# TYPE apf_uptime_seconds gauge\n")
+	fmt.Fprintf(w, "apf_uptime_seconds %f\n", time.Since(s.startTime).Seconds())
+	fmt.Fprintf(w, "# HELP apf_goroutines Number of goroutines that currently exist.\n")
+	fmt.Fprintf(w, "# TYPE apf_goroutines gauge\n")
+	fmt.Fprintf(w, "apf_goroutines %d\n", runtime.NumGoroutine())
+}
+
+func (s *adminServer) handleConfig(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s.config.Redact()); err != nil {
+		logger.Printf("error writing the config: %v", err)
+	}
+}
+
+// handler routes the requests to the enabled endpoints
+func (s *adminServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(AdminHealthPath, s.handleHealth)
+	mux.HandleFunc(AdminMetricsPath, s.handleMetrics)
+	if s.pprof {
+		mux.HandleFunc(AdminPprofPath, pprof.Index)
+		mux.HandleFunc(AdminPprofPath+"cmdline", pprof.Cmdline)
+		mux.HandleFunc(AdminPprofPath+"profile", pprof.Profile)
+		mux.HandleFunc(AdminPprofPath+"symbol", pprof.Symbol)
+		mux.HandleFunc(AdminPprofPath+"trace", pprof.Trace)
+	}
+	if s.config != nil {
+		mux.HandleFunc(AdminConfigPath, s.handleConfig)
+	}
+	return mux
+}
+
+func (s *adminServer) Start(ctx context.Context) error {
+
+	listener, err := net.Listen("tcp", s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to create admin listener: %w", err)
+	}
+	s.listenAddr = listener.Addr().String()
+	s.startTime = time.Now()
+
+	server := &http.Server{
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serverErr := make(chan error)
+	go func() {
+		defer close(serverErr)
+
+		logger.Printf("Starting admin server on address %v", s.listenAddr)
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- fmt.Errorf("error running admin server: %w", err)
+		}
+	}()
+
+	close(s.readyCh)
+
+	select {
+	case <-ctx.Done():
+	case err := <-serverErr:
+		return err
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Printf("error shutting down admin server: %v", err)
+	}
+
+	return nil
+}
+
+func (s *adminServer) Ready() chan struct{} {
+	return s.readyCh
+}
+
+func (s *adminServer) Addr() string {
+	<-s.readyCh
+	return s.listenAddr
+}
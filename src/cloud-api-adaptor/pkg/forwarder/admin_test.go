@@ -0,0 +1,309 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+)
+
+func TestAdminServer(t *testing.T) {
+
+	ca, err := tlsutil.NewCAService("test")
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	certPEM, keyPEM, err := ca.Issue("localhost")
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+
+	d := &daemon{
+		tlsConfig: &tlsutil.TLSConfig{
+			CAData:   ca.RootCertificate(),
+			CertData: certPEM,
+			KeyData:  keyPEM,
+		},
+		listenAddr:  "127.0.0.1:0",
+		interceptor: newMockInterceptor(),
+		podNode:     &mockPodNode{},
+		readyCh:     make(chan struct{}),
+		stopCh:      make(chan struct{}),
+	}
+	admin := NewAdminServer("127.0.0.1:0", d)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		if err := d.Start(ctx); err != nil {
+			t.Errorf("Expect no error, got %q", err)
+		}
+	}()
+	go func() {
+		if err := admin.Start(ctx); err != nil {
+			t.Errorf("Expect no error, got %q", err)
+		}
+	}()
+
+	// The admin port serves health over plain HTTP
+	resp, err := http.Get("http://" + admin.Addr() + AdminHealthPath)
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expect status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	resp, err = http.Get("http://" + admin.Addr() + AdminMetricsPath)
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "apf_ready 1") {
+		t.Errorf("Expect apf_ready 1 in metrics, got %s", body)
+	}
+
+	// The data port still requires a client certificate
+	conn, err := tls.Dial("tcp", d.Addr(), &tls.Config{InsecureSkipVerify: true})
+	if err == nil {
+		defer conn.Close()
+		// With TLS 1.3 the server rejects the missing certificate after the client finishes the handshake
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+	}
+	if err == nil {
+		t.Error("Expect data port to reject a connection without a client certificate")
+	}
+}
+
+func TestAdminServerNotReady(t *testing.T) {
+
+	d := &daemon{
+		readyCh: make(chan struct{}),
+		stopCh:  make(chan struct{}),
+	}
+	admin := NewAdminServer("127.0.0.1:0", d)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		if err := admin.Start(ctx); err != nil {
+			t.Errorf("Expect no error, got %q", err)
+		}
+	}()
+
+	resp, err := http.Get("http://" + admin.Addr() + AdminHealthPath)
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expect status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
+
+func TestAdminServerTunnelUnhealthy(t *testing.T) {
+
+	d := &daemon{
+		readyCh: make(chan struct{}),
+		stopCh:  make(chan struct{}),
+	}
+	close(d.readyCh)
+	d.unhealthy.Store(true)
+	admin := NewAdminServer("127.0.0.1:0", d)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		if err := admin.Start(ctx); err != nil {
+			t.Errorf("Expect no error, got %q", err)
+		}
+	}()
+
+	resp, err := http.Get("http://" + admin.Addr() + AdminHealthPath)
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expect status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	resp, err = http.Get("http://" + admin.Addr() + AdminMetricsPath)
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "apf_tunnel_healthy 0") {
+		t.Errorf("Expect apf_tunnel_healthy 0 in metrics, got %s", body)
+	}
+}
+
+func TestAdminServerPprof(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		opts       []AdminOption
+		wantStatus int
+	}{
+		{
+			name:       "disabled by default",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "enabled",
+			opts:       []AdminOption{WithPprof()},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &daemon{
+				readyCh: make(chan struct{}),
+				stopCh:  make(chan struct{}),
+			}
+			admin := NewAdminServer("127.0.0.1:0", d, tt.opts...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			go func() {
+				if err := admin.Start(ctx); err != nil {
+					t.Errorf("Expect no error, got %q", err)
+				}
+			}()
+
+			for _, path := range []string{AdminPprofPath, AdminPprofPath + "cmdline", AdminPprofPath + "goroutine"} {
+				resp, err := http.Get("http://" + admin.Addr() + path)
+				if err != nil {
+					t.Fatalf("Expect no error, got %q", err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("Expect status %d for %s, got %d", tt.wantStatus, path, resp.StatusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminServerConfig(t *testing.T) {
+
+	config := &Config{
+		PodNetwork: &tunneler.Config{
+			PodIP:      netip.MustParsePrefix("10.244.1.5/24"),
+			TunnelType: "vxlan",
+			VXLANID:    555000,
+			MTU:        1450,
+		},
+		PodNamespace:  "default",
+		PodName:       "nginx",
+		TLSServerKey:  "key-material",
+		TLSServerCert: "cert-material",
+		PpPrivateKey:  []byte("pp-key-material"),
+	}
+
+	tests := []struct {
+		name       string
+		opts       []AdminOption
+		auth       string
+		wantStatus int
+	}{
+		{
+			name:       "disabled by default",
+			auth:       "Bearer secret",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "disabled without a token",
+			opts:       []AdminOption{WithConfig(config, "")},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "no token",
+			opts:       []AdminOption{WithConfig(config, "secret")},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong token",
+			opts:       []AdminOption{WithConfig(config, "secret")},
+			auth:       "Bearer guess",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "valid token",
+			opts:       []AdminOption{WithConfig(config, "secret")},
+			auth:       "Bearer secret",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := NewAdminServer("127.0.0.1:0", &daemon{}, tt.opts...).(*adminServer)
+			server := httptest.NewServer(admin.handler())
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+AdminConfigPath, nil)
+			if err != nil {
+				t.Fatalf("Expect no error, got %q", err)
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Expect no error, got %q", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Expect status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Expect no error, got %q", err)
+			}
+			for _, secret := range []string{"key-material", "cert-material", "pp-key-material"} {
+				if strings.Contains(string(body), secret) {
+					t.Errorf("Expect %q to be redacted, got %s", secret, body)
+				}
+			}
+
+			var got Config
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("Expect no error, got %q", err)
+			}
+			if !reflect.DeepEqual(got.PodNetwork, config.PodNetwork) {
+				t.Errorf("Expect pod network %+v, got %+v", config.PodNetwork, got.PodNetwork)
+			}
+			if got.PodName != "nginx" || got.TLSServerKey != redacted {
+				t.Errorf("Expect pod name nginx and a redacted key, got %q and %q", got.PodName, got.TLSServerKey)
+			}
+		})
+	}
+}
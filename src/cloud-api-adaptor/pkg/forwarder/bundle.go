@@ -0,0 +1,85 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Bundle is a signed daemon config for pod VMs without an instance metadata service, e.g. in
+// air-gapped installs. The config carries the certs and keys like the one from userData does.
+type Bundle struct {
+	// Config is the daemon config in JSON, base64 encoded in the bundle file
+	Config []byte `json:"config"`
+	// Signature is the ed25519 signature of Config, base64 encoded in the bundle file
+	Signature []byte `json:"signature"`
+}
+
+// ParsePublicKey parses a PEM encoded ed25519 public key
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the public key: %w", err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T, expected ed25519", key)
+	}
+	return publicKey, nil
+}
+
+// VerifyBundle checks the signature of the bundle in data and returns its config
+func VerifyBundle(data []byte, publicKey ed25519.PublicKey) ([]byte, error) {
+	var bundle Bundle
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("failed to decode the bundle: %w", err)
+	}
+	if len(bundle.Config) == 0 {
+		return nil, errors.New("the bundle has no config")
+	}
+	if !ed25519.Verify(publicKey, bundle.Config, bundle.Signature) {
+		return nil, errors.New("the bundle signature is invalid")
+	}
+	return bundle.Config, nil
+}
+
+// LoadBundle verifies the bundle at path with the public key at publicKeyPath and decodes its
+// config into config. Nothing is decoded unless the signature is valid.
+func LoadBundle(path, publicKeyPath string, config *Config) error {
+	keyData, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the bundle public key: %w", err)
+	}
+	publicKey, err := ParsePublicKey(keyData)
+	if err != nil {
+		return fmt.Errorf("invalid bundle public key %s: %w", publicKeyPath, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read the bundle: %w", err)
+	}
+	configData, err := VerifyBundle(data, publicKey)
+	if err != nil {
+		return fmt.Errorf("failed to verify %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(configData, config); err != nil {
+		return fmt.Errorf("failed to decode the config of bundle %s: %w", path, err)
+	}
+	return nil
+}
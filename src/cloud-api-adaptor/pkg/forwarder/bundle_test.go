@@ -0,0 +1,166 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestBundle(t *testing.T, privateKey ed25519.PrivateKey, config string) *Bundle {
+	t.Helper()
+	return &Bundle{
+		Config:    []byte(config),
+		Signature: ed25519.Sign(privateKey, []byte(config)),
+	}
+}
+
+func encodeBundle(t *testing.T, bundle any) []byte {
+	t.Helper()
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	return data
+}
+
+func TestVerifyBundle(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	config := `{"pod-name": "test-pod", "tls-server-cert": "server-cert-data"}`
+
+	tests := []struct {
+		name   string
+		bundle func() any
+		err    string
+	}{
+		{
+			name:   "valid",
+			bundle: func() any { return newTestBundle(t, privateKey, config) },
+		},
+		{
+			name: "tampered config",
+			bundle: func() any {
+				bundle := newTestBundle(t, privateKey, config)
+				bundle.Config = []byte(strings.Replace(config, "test-pod", "evil-pod", 1))
+				return bundle
+			},
+			err: "signature is invalid",
+		},
+		{
+			name: "tampered signature",
+			bundle: func() any {
+				bundle := newTestBundle(t, privateKey, config)
+				bundle.Signature[0] ^= 0xff
+				return bundle
+			},
+			err: "signature is invalid",
+		},
+		{
+			name:   "signed with another key",
+			bundle: func() any { return newTestBundle(t, otherKey, config) },
+			err:    "signature is invalid",
+		},
+		{
+			name:   "no signature",
+			bundle: func() any { return &Bundle{Config: []byte(config)} },
+			err:    "signature is invalid",
+		},
+		{
+			name:   "no config",
+			bundle: func() any { return &Bundle{} },
+			err:    "no config",
+		},
+		{
+			name: "unknown field",
+			bundle: func() any {
+				return map[string]any{"config": []byte(config), "signature": []byte{}, "key": "attacker-key"}
+			},
+			err: "unknown field",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyBundle(encodeBundle(t, tt.bundle()), publicKey)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Expect error containing %q, got %v", tt.err, err)
+				}
+				if got != nil {
+					t.Errorf("Expect no config, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+			if string(got) != config {
+				t.Errorf("Expect config %s, got %s", config, got)
+			}
+		})
+	}
+}
+
+func TestLoadBundle(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "bundle.pub")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	bundle := newTestBundle(t, privateKey, `{"pod-name": "test-pod", "tls-client-ca": "client-ca-data"}`)
+	bundlePath := filepath.Join(dir, "apf.bundle")
+	if err := os.WriteFile(bundlePath, encodeBundle(t, bundle), 0600); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	var config Config
+	if err := LoadBundle(bundlePath, keyPath, &config); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if config.PodName != "test-pod" || config.TLSClientCA != "client-ca-data" {
+		t.Errorf("Expect the config from the bundle, got %+v", config)
+	}
+
+	// A tampered bundle is rejected and leaves the config untouched
+	bundle.Config = []byte(`{"pod-name": "evil-pod"}`)
+	if err := os.WriteFile(bundlePath, encodeBundle(t, bundle), 0600); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	config = Config{}
+	if err := LoadBundle(bundlePath, keyPath, &config); err == nil {
+		t.Fatal("Expect an error, got nil")
+	}
+	if config.PodName != "" {
+		t.Errorf("Expect no pod name, got %q", config.PodName)
+	}
+
+	// A key that is not PEM encoded is rejected
+	if _, err := ParsePublicKey([]byte("not a key")); err == nil {
+		t.Error("Expect an error for a key without PEM data, got nil")
+	}
+}
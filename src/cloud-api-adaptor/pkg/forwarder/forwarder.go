@@ -10,9 +10,14 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/containerd/ttrpc"
+	"github.com/coreos/go-systemd/activation"
 	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder/interceptor"
@@ -23,6 +28,11 @@ import (
 
 var logger = log.New(log.Writer(), "[forwarder] ", log.LstdFlags|log.Lmsgprefix)
 
+// activationFiles returns the sockets passed by systemd (LISTEN_FDS), if any
+var activationFiles = func() []*os.File {
+	return activation.Files(true)
+}
+
 const (
 	DefaultListenHost          = "0.0.0.0"
 	DefaultListenPort          = "15150"
@@ -38,6 +48,11 @@ type Config struct {
 	PodNetwork   *tunneler.Config `json:"pod-network"`
 	PodNamespace string           `json:"pod-namespace"`
 	PodName      string           `json:"pod-name"`
+	// ListenPort overrides the port of the listen address, so that it matches the port the worker node dials
+	ListenPort string `json:"listen-port,omitempty"`
+	// KataAgentNamespace is the path of the network namespace where the kata agent and the pod run,
+	// for images where it differs from the -pod-namespace default
+	KataAgentNamespace string `json:"kata-agent-namespace,omitempty"`
 
 	TLSServerKey  string `json:"tls-server-key,omitempty"`
 	TLSServerCert string `json:"tls-server-cert,omitempty"`
@@ -48,33 +63,115 @@ type Config struct {
 	SecureCommsInbounds  string `json:"sc-inbounds,omitempty"`
 	SecureCommsOutbounds string `json:"sc-outbounds,omitempty"`
 	SecureComms          bool   `json:"sc,omitempty"`
+
+	// Placement is added on the pod VM from the instance metadata service
+	Placement *Placement `json:"placement,omitempty"`
+}
+
+// Placement describes where the pod VM runs
+type Placement struct {
+	Provider   string `json:"provider"`
+	Region     string `json:"region,omitempty"`
+	Zone       string `json:"zone,omitempty"`
+	InstanceID string `json:"instance-id,omitempty"`
+}
+
+func (p *Placement) String() string {
+	return fmt.Sprintf("provider=%s region=%s zone=%s instance-id=%s", p.Provider, p.Region, p.Zone, p.InstanceID)
+}
+
+const redacted = "**********"
+
+// Redact returns a copy of the config with TLS and secure comms key material masked
+func (c Config) Redact() Config {
+	for _, field := range []*string{&c.TLSServerKey, &c.TLSServerCert, &c.TLSClientCA} {
+		if *field != "" {
+			*field = redacted
+		}
+	}
+	if len(c.PpPrivateKey) > 0 {
+		c.PpPrivateKey = []byte(redacted)
+	}
+	return c
+}
+
+// ValidatePort checks that port is a TCP port number usable by the forwarder
+func ValidatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q: must be a number between 1 and 65535", port)
+	}
+	return nil
+}
+
+// ListenAddrWithPort returns listenAddr with its port replaced by port
+func ListenAddrWithPort(listenAddr, port string) (string, error) {
+	if err := ValidatePort(port); err != nil {
+		return "", err
+	}
+	host, _, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %q: %w", listenAddr, err)
+	}
+	return net.JoinHostPort(host, port), nil
 }
 
 type Daemon interface {
 	Start(ctx context.Context) error
 	Shutdown() error
 	Ready() chan struct{}
+	// TunnelEstablished is closed once the pod network is set up
+	TunnelEstablished() chan struct{}
+	// Healthy is false while the tunnel probe keeps failing
+	Healthy() bool
 	Addr() string
 }
 
+// DaemonOption customizes a daemon created by NewDaemon
+type DaemonOption func(*daemon)
+
+// WithTunnelReadyFile makes the daemon create the file at path once the pod network tunnel is
+// established, and remove it when the tunnel is torn down, so that external tooling can key
+// pod readiness off it
+func WithTunnelReadyFile(path string) DaemonOption {
+	return func(d *daemon) {
+		d.tunnelReadyFile = path
+	}
+}
+
 type daemon struct {
 	tlsConfig           *tlsutil.TLSConfig
 	interceptor         interceptor.Interceptor
 	podNode             podnetwork.PodNode
 	readyCh             chan struct{}
+	tunnelCh            chan struct{}
+	tunnelReadyFile     string
 	stopCh              chan struct{}
 	listenAddr          string
 	stopOnce            sync.Once
 	externalNetViaPodVM bool
+
+	// activationFiles overrides how the sockets passed by systemd are found
+	activationFiles func() []*os.File
+
+	prober                TunnelProber
+	listenerProbe         bool
+	listenNetwork         string
+	probeTLSConfig        *tls.Config
+	probeInterval         time.Duration
+	probeFailureThreshold int
+	unhealthy             atomic.Bool
 }
 
-func NewDaemon(spec *Config, listenAddr string, tlsConfig *tlsutil.TLSConfig, interceptor interceptor.Interceptor, podNode podnetwork.PodNode) Daemon {
+func NewDaemon(spec *Config, listenAddr string, tlsConfig *tlsutil.TLSConfig, interceptor interceptor.Interceptor, podNode podnetwork.PodNode, opts ...DaemonOption) Daemon {
 
 	if tlsConfig != nil && !tlsConfig.HasCertAuth() {
 		tlsConfig.CertData = []byte(spec.TLSServerCert)
 		tlsConfig.KeyData = []byte(spec.TLSServerKey)
 	}
 
+	// A CA file given on the command line replaces the CA from userData, while the extra
+	// CA file is appended to whichever of the two is used
 	if tlsConfig != nil && !tlsConfig.HasCA() {
 		tlsConfig.CAData = []byte(spec.TLSClientCA)
 	}
@@ -85,6 +182,7 @@ func NewDaemon(spec *Config, listenAddr string, tlsConfig *tlsutil.TLSConfig, in
 		interceptor: interceptor,
 		podNode:     podNode,
 		readyCh:     make(chan struct{}),
+		tunnelCh:    make(chan struct{}),
 		stopCh:      make(chan struct{}),
 	}
 
@@ -92,6 +190,10 @@ func NewDaemon(spec *Config, listenAddr string, tlsConfig *tlsutil.TLSConfig, in
 		daemon.externalNetViaPodVM = spec.PodNetwork.ExternalNetViaPodVM
 	}
 
+	for _, opt := range opts {
+		opt(daemon)
+	}
+
 	return daemon
 }
 
@@ -108,36 +210,49 @@ func (d *daemon) Start(ctx context.Context) error {
 		}
 	}()
 
+	d.tunnelEstablished()
+	if d.tunnelReadyFile != "" {
+		defer func() {
+			if err := os.Remove(d.tunnelReadyFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+				logger.Printf("failed to remove tunnel ready file: %v", err)
+			}
+		}()
+	}
+
 	// Set up agent protocol interceptor
 
-	var listener net.Listener
+	if err := d.interceptor.CheckAgent(ctx); err != nil {
+		return err
+	}
+
+	listener, err := d.listen()
+	if err != nil {
+		logger.Printf("failed to create agent-protocol-forwarder listener: %v", err)
+		return err
+	}
 
-	logger.Printf("Starting agent-protocol-forwarder listener on address %v", d.listenAddr)
 	if d.tlsConfig != nil {
 		logger.Printf("TLS is configured. Configure TLS listener")
 
 		// Create a TLS configuration object
 		tlsConfig, err := tlsutil.GetTLSConfigFor(d.tlsConfig)
 		if err != nil {
+			listener.Close()
 			return fmt.Errorf("Failed to create tls config: %v", err)
 		}
 
-		listener, err = tls.Listen("tcp", d.listenAddr, tlsConfig)
-		if err != nil {
-			logger.Printf("failed to create tls agent-protocol-forwarder listener: %v", err)
-			return err
+		if d.listenerProbe {
+			if d.probeTLSConfig, err = newProbeTLSConfig(tlsConfig); err != nil {
+				listener.Close()
+				return fmt.Errorf("failed to set up the TLS config of the listener probe: %w", err)
+			}
 		}
-	} else {
-		var err error
 
-		listener, err = net.Listen("tcp", d.listenAddr)
-		if err != nil {
-			logger.Printf("failed to create agent-protocol-forwarder listener: %v", err)
-			return err
-		}
+		listener = tls.NewListener(listener, tlsConfig)
 	}
 
 	d.listenAddr = listener.Addr().String()
+	d.listenNetwork = listener.Addr().Network()
 
 	ttrpcServer, err := ttrpc.NewServer()
 	if err != nil {
@@ -166,6 +281,10 @@ func (d *daemon) Start(ctx context.Context) error {
 
 	close(d.readyCh)
 
+	if d.prober != nil && d.probeInterval > 0 {
+		go d.probeTunnel(ctx)
+	}
+
 	select {
 	case <-ctx.Done():
 		return d.Shutdown()
@@ -177,6 +296,36 @@ func (d *daemon) Start(ctx context.Context) error {
 	return nil
 }
 
+// listen returns the listener passed by systemd socket activation, so that the socket can
+// be created beforehand with its own permissions, or binds the listen address otherwise
+func (d *daemon) listen() (net.Listener, error) {
+	getFiles := activationFiles
+	if d.activationFiles != nil {
+		getFiles = d.activationFiles
+	}
+	files := getFiles()
+	if len(files) == 0 {
+		logger.Printf("Starting agent-protocol-forwarder listener on address %v", d.listenAddr)
+		return net.Listen("tcp", d.listenAddr)
+	}
+
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	if len(files) > 1 {
+		return nil, fmt.Errorf("expected a single socket from systemd, got %d", len(files))
+	}
+
+	listener, err := net.FileListener(files[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket %s from systemd: %w", files[0].Name(), err)
+	}
+	logger.Printf("Starting agent-protocol-forwarder listener on address %v from systemd socket activation, ignoring %v", listener.Addr(), d.listenAddr)
+	return listener, nil
+}
+
 func (d *daemon) Shutdown() error {
 	d.stopOnce.Do(func() {
 		close(d.stopCh)
@@ -188,6 +337,25 @@ func (d *daemon) Ready() chan struct{} {
 	return d.readyCh
 }
 
+func (d *daemon) TunnelEstablished() chan struct{} {
+	return d.tunnelCh
+}
+
+// tunnelEstablished signals that the pod network is set up. Failing to write the ready file
+// is only logged, the tunnel itself is up.
+func (d *daemon) tunnelEstablished() {
+	logger.Printf("pod network tunnel established")
+	if d.tunnelCh != nil {
+		close(d.tunnelCh)
+	}
+	if d.tunnelReadyFile == "" {
+		return
+	}
+	if err := os.WriteFile(d.tunnelReadyFile, nil, 0644); err != nil {
+		logger.Printf("failed to write tunnel ready file: %v", err)
+	}
+}
+
 func (d *daemon) Addr() string {
 	<-d.readyCh
 	return d.listenAddr
@@ -5,7 +5,10 @@ package forwarder
 
 import (
 	"context"
+	"errors"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -28,12 +31,25 @@ func dummyDialer(ctx context.Context) (net.Conn, error) {
 	return &mockConn{}, nil
 }
 
+type mockInterceptor struct {
+	agentproto.Redirector
+	agentErr error
+}
+
+func newMockInterceptor() *mockInterceptor {
+	return &mockInterceptor{Redirector: agentproto.NewRedirector(dummyDialer)}
+}
+
+func (m *mockInterceptor) CheckAgent(ctx context.Context) error {
+	return m.agentErr
+}
+
 func TestNew(t *testing.T) {
 
 	config := &Config{}
 	tlsConfig := tlsutil.TLSConfig{}
 
-	ret := NewDaemon(config, DefaultListenAddr, &tlsConfig, agentproto.NewRedirector(dummyDialer), &mockPodNode{})
+	ret := NewDaemon(config, DefaultListenAddr, &tlsConfig, newMockInterceptor(), &mockPodNode{})
 	if ret == nil {
 		t.Fatal("Expect non nil, got nil")
 	}
@@ -57,7 +73,7 @@ func TestNew(t *testing.T) {
 func TestStart(t *testing.T) {
 
 	d := &daemon{
-		interceptor: agentproto.NewRedirector(dummyDialer),
+		interceptor: newMockInterceptor(),
 		podNode:     &mockPodNode{},
 		readyCh:     make(chan struct{}),
 		stopCh:      make(chan struct{}),
@@ -91,12 +107,200 @@ func TestStart(t *testing.T) {
 	}
 }
 
-type mockPodNode struct{}
+func TestStartAgentUnreachable(t *testing.T) {
+
+	agentErr := errors.New("connection refused")
+	interceptor := newMockInterceptor()
+	interceptor.agentErr = agentErr
+
+	d := &daemon{
+		interceptor: interceptor,
+		podNode:     &mockPodNode{},
+		readyCh:     make(chan struct{}),
+		stopCh:      make(chan struct{}),
+	}
+
+	if err := d.Start(context.Background()); !errors.Is(err, agentErr) {
+		t.Fatalf("Expect %q, got %v", agentErr, err)
+	}
+
+	select {
+	case <-d.Ready():
+		t.Fatal("Expect the daemon not to be ready")
+	default:
+	}
+}
+
+func TestStartSocketActivation(t *testing.T) {
+
+	// The socket systemd would have created and passed as an inherited fd
+	socket, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	file, err := socket.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	socketAddr := socket.Addr().String()
+	socket.Close()
+
+	d := &daemon{
+		// Not used when the socket is passed by systemd
+		listenAddr:      "127.0.0.1:-1",
+		interceptor:     newMockInterceptor(),
+		podNode:         &mockPodNode{},
+		readyCh:         make(chan struct{}),
+		stopCh:          make(chan struct{}),
+		activationFiles: func() []*os.File { return []*os.File{file} },
+	}
+
+	errCh := make(chan error)
+	go func() {
+		defer close(errCh)
+
+		if err := d.Start(context.Background()); err != nil {
+			errCh <- err
+		}
+	}()
+
+	select {
+	case <-d.Ready():
+	case err := <-errCh:
+		t.Fatalf("Expect no error, got %q", err)
+	}
+
+	if e, a := socketAddr, d.Addr(); e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+
+	conn, err := net.Dial("tcp", socketAddr)
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	conn.Close()
+
+	if err := d.Shutdown(); err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+}
+
+func TestStartTunnelEstablished(t *testing.T) {
+
+	readyFile := filepath.Join(t.TempDir(), "tunnel-ready")
+	d := NewDaemon(&Config{}, "127.0.0.1:0", nil, newMockInterceptor(), &mockPodNode{}, WithTunnelReadyFile(readyFile))
+
+	errCh := make(chan error)
+	go func() {
+		defer close(errCh)
+
+		if err := d.Start(context.Background()); err != nil {
+			errCh <- err
+		}
+	}()
+
+	select {
+	case <-d.TunnelEstablished():
+	case err := <-errCh:
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	if _, err := os.Stat(readyFile); err != nil {
+		t.Fatalf("Expect the tunnel ready file, got %v", err)
+	}
+
+	<-d.Ready()
+	if err := d.Shutdown(); err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+
+	// The tunnel is torn down with the daemon
+	if _, err := os.Stat(readyFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expect the tunnel ready file to be removed, got %v", err)
+	}
+}
+
+func TestStartTunnelSetupFailure(t *testing.T) {
+
+	setupErr := errors.New("failed to create vxlan interface")
+	readyFile := filepath.Join(t.TempDir(), "tunnel-ready")
+	d := NewDaemon(&Config{}, "127.0.0.1:0", nil, newMockInterceptor(), &mockPodNode{setupErr: setupErr}, WithTunnelReadyFile(readyFile))
+
+	if err := d.Start(context.Background()); !errors.Is(err, setupErr) {
+		t.Fatalf("Expect %q, got %v", setupErr, err)
+	}
+
+	select {
+	case <-d.TunnelEstablished():
+		t.Fatal("Expect the tunnel not to be established")
+	default:
+	}
+	if _, err := os.Stat(readyFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expect no tunnel ready file, got %v", err)
+	}
+}
+
+func TestListenAddrWithPort(t *testing.T) {
+	tests := []struct {
+		listenAddr string
+		port       string
+		want       string
+		wantErr    bool
+	}{
+		{listenAddr: DefaultListenAddr, port: "16150", want: "0.0.0.0:16150"},
+		{listenAddr: "127.0.0.1:15150", port: "15151", want: "127.0.0.1:15151"},
+		{listenAddr: "[::]:15150", port: "16150", want: "[::]:16150"},
+		{listenAddr: DefaultListenAddr, port: "0", wantErr: true},
+		{listenAddr: DefaultListenAddr, port: "65536", wantErr: true},
+		{listenAddr: DefaultListenAddr, port: "http", wantErr: true},
+		{listenAddr: "0.0.0.0", port: "16150", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ListenAddrWithPort(tt.listenAddr, tt.port)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ListenAddrWithPort(%q, %q): expect error %v, got %v", tt.listenAddr, tt.port, tt.wantErr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ListenAddrWithPort(%q, %q): expect %q, got %q", tt.listenAddr, tt.port, tt.want, got)
+		}
+	}
+}
+
+type mockPodNode struct {
+	setupErr error
+}
 
 func (n *mockPodNode) Setup() error {
-	return nil
+	return n.setupErr
 }
 
 func (n *mockPodNode) Teardown() error {
 	return nil
 }
+
+func TestNewCAPrecedence(t *testing.T) {
+
+	config := &Config{TLSClientCA: "userdata-ca"}
+
+	tlsConfig := tlsutil.TLSConfig{ExtraCAFile: "/etc/ssl/extra.pem"}
+	NewDaemon(config, DefaultListenAddr, &tlsConfig, newMockInterceptor(), &mockPodNode{})
+	if string(tlsConfig.CAData) != "userdata-ca" {
+		t.Fatalf("Expect the CA from userData, got %q", tlsConfig.CAData)
+	}
+	if tlsConfig.ExtraCAFile != "/etc/ssl/extra.pem" {
+		t.Fatalf("Expect the extra CA file to be kept, got %q", tlsConfig.ExtraCAFile)
+	}
+
+	tlsConfig = tlsutil.TLSConfig{CAFile: "/etc/ssl/ca.pem"}
+	NewDaemon(config, DefaultListenAddr, &tlsConfig, newMockInterceptor(), &mockPodNode{})
+	if len(tlsConfig.CAData) != 0 {
+		t.Fatalf("Expect the CA file to replace the CA from userData, got %q", tlsConfig.CAData)
+	}
+}
@@ -25,18 +25,26 @@ const (
 	volumeTargetPathKey = "io.confidentialcontainers.org.peerpodvolumes.target_path"
 	volumeCheckInterval = 5 * time.Second
 	volumeCheckTimeout  = 3 * time.Minute
+
+	// agentCheckTimeout bounds how long the forwarder waits for the kata agent at startup
+	agentCheckTimeout = time.Minute
 )
 
 var logger = log.New(log.Writer(), "[forwarder/interceptor] ", log.LstdFlags|log.Lmsgprefix)
 
 type Interceptor interface {
 	agentproto.Redirector
+
+	// CheckAgent returns an error if the kata agent socket doesn't accept connections
+	CheckAgent(ctx context.Context) error
 }
 
 type interceptor struct {
 	agentproto.Redirector
 
-	nsPath string
+	agentSocket string
+	agentDialer func(ctx context.Context) (net.Conn, error)
+	nsPath      string
 }
 
 func dial(ctx context.Context, agentSocket string) (net.Conn, error) {
@@ -72,14 +80,36 @@ func NewInterceptor(agentSocket, nsPath string) Interceptor {
 		return dial(ctx, agentSocket)
 	}
 
+	return newInterceptor(agentSocket, nsPath, agentDialer)
+}
+
+func newInterceptor(agentSocket, nsPath string, agentDialer func(ctx context.Context) (net.Conn, error)) *interceptor {
+
 	redirector := agentproto.NewRedirector(agentDialer)
 
 	return &interceptor{
-		Redirector: redirector,
-		nsPath:     nsPath,
+		Redirector:  redirector,
+		agentSocket: agentSocket,
+		agentDialer: agentDialer,
+		nsPath:      nsPath,
 	}
 }
 
+// CheckAgent dials the agent socket, retrying until agentCheckTimeout, so that a forwarder
+// started without a running agent fails instead of accepting requests it can't forward
+func (i *interceptor) CheckAgent(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, agentCheckTimeout)
+	defer cancel()
+
+	conn, err := i.agentDialer(ctx)
+	if err != nil {
+		return fmt.Errorf("kata agent is not reachable at %s, check that it is running: %w", i.agentSocket, err)
+	}
+	conn.Close()
+
+	return nil
+}
+
 func (i *interceptor) CreateContainer(ctx context.Context, req *pb.CreateContainerRequest) (*emptypb.Empty, error) {
 
 	logger.Printf("CreateContainer: containerID:%s", req.ContainerId)
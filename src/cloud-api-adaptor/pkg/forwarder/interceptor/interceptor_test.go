@@ -4,6 +4,9 @@
 package interceptor
 
 import (
+	"context"
+	"errors"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,3 +30,44 @@ func TestIsTargetPath(t *testing.T) {
 	assert.False(t, isTargetPath(path, "mock path"))
 	assert.True(t, isTargetPath(path, "/path/to/target"))
 }
+
+func TestCheckAgent(t *testing.T) {
+
+	errRefused := errors.New("connection refused")
+
+	tests := []struct {
+		name    string
+		dialer  func(ctx context.Context) (net.Conn, error)
+		wantErr bool
+	}{
+		{
+			name: "reachable",
+			dialer: func(ctx context.Context) (net.Conn, error) {
+				client, server := net.Pipe()
+				server.Close()
+				return client, nil
+			},
+		},
+		{
+			name: "unreachable",
+			dialer: func(ctx context.Context) (net.Conn, error) {
+				return nil, errRefused
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newInterceptor("agent.sock", "", tt.dialer)
+
+			err := i.CheckAgent(context.Background())
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, errRefused)
+			assert.Contains(t, err.Error(), "agent.sock")
+		})
+	}
+}
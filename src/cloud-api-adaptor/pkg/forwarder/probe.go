@@ -0,0 +1,154 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/containerd/ttrpc"
+	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+)
+
+const DefaultTunnelProbeFailureThreshold = 3
+
+// TunnelProber sends a trivial request through the established tunnel, returning an error if
+// it doesn't go through
+type TunnelProber func(ctx context.Context) error
+
+// WithTunnelProbe makes the daemon run prober every interval once it is ready, and report itself
+// unhealthy after failureThreshold consecutive failures until a probe succeeds again. This
+// catches a tunnel that broke silently, which the pod network setup alone doesn't.
+func WithTunnelProbe(prober TunnelProber, interval time.Duration, failureThreshold int) DaemonOption {
+	return func(d *daemon) {
+		if failureThreshold < 1 {
+			failureThreshold = DefaultTunnelProbeFailureThreshold
+		}
+		d.prober = prober
+		d.probeInterval = interval
+		d.probeFailureThreshold = failureThreshold
+	}
+}
+
+// WithListenerProbe makes the daemon probe itself end to end: it dials its own listener, with
+// TLS when configured, and sends a health check that goes through the interceptor to the kata
+// agent. The interval and failureThreshold are the ones of WithTunnelProbe.
+func WithListenerProbe(interval time.Duration, failureThreshold int) DaemonOption {
+	return func(d *daemon) {
+		WithTunnelProbe(d.probeListener, interval, failureThreshold)(d)
+		d.listenerProbe = true
+	}
+}
+
+// probeListener sends a health check to the kata agent through the listener of the daemon
+func (d *daemon) probeListener(ctx context.Context) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, d.listenNetwork, d.listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to dial the forwarder listener at %s: %w", d.listenAddr, err)
+	}
+	if d.probeTLSConfig != nil {
+		tlsConn := tls.Client(conn, d.probeTLSConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return fmt.Errorf("TLS handshake with the forwarder listener at %s failed: %w", d.listenAddr, err)
+		}
+		conn = tlsConn
+	}
+
+	client := ttrpc.NewClient(conn)
+	defer client.Close()
+
+	if _, err := pb.NewHealthClient(client).Check(ctx, &pb.CheckRequest{}); err != nil {
+		return fmt.Errorf("health check through the forwarder listener at %s failed: %w", d.listenAddr, err)
+	}
+	return nil
+}
+
+// newProbeTLSConfig returns the client TLS configuration of the listener probe. The probe
+// presents a self-signed client certificate generated here, which is added to the client CAs
+// of serverConfig, and only accepts the certificate of serverConfig from the listener, since
+// the daemon doesn't have the CA that issued it.
+func newProbeTLSConfig(serverConfig *tls.Config) (*tls.Config, error) {
+	if len(serverConfig.Certificates) == 0 {
+		return nil, errors.New("no server certificate to probe the listener with")
+	}
+	serverCert := serverConfig.Certificates[0].Certificate[0]
+
+	certPEM, keyPEM, err := tlsutil.NewClientCertificate("agent-protocol-forwarder")
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverConfig.ClientCAs != nil {
+		// RootCAs shares the pool, which must not trust the probe certificate
+		serverConfig.ClientCAs = serverConfig.ClientCAs.Clone()
+		serverConfig.ClientCAs.AppendCertsFromPEM(certPEM)
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		// The chain isn't verified, the listener must present the very server certificate
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], serverCert) {
+				return errors.New("the listener didn't present the forwarder server certificate")
+			}
+			return nil
+		},
+	}, nil
+}
+
+// probeTunnel runs the prober until ctx is canceled or the daemon is shut down
+func (d *daemon) probeTunnel(ctx context.Context) {
+	ticker := time.NewTicker(d.probeInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, d.probeInterval)
+		err := d.prober(probeCtx)
+		cancel()
+
+		if err == nil {
+			if failures >= d.probeFailureThreshold {
+				logger.Printf("tunnel probe succeeded, forwarder is healthy again")
+			}
+			failures = 0
+			d.unhealthy.Store(false)
+			continue
+		}
+
+		failures++
+		logger.Printf("tunnel probe failed (%d/%d): %v", failures, d.probeFailureThreshold, err)
+		if failures == d.probeFailureThreshold {
+			logger.Printf("tunnel probe failed %d times in a row, marking the forwarder unhealthy", failures)
+			d.unhealthy.Store(true)
+		}
+	}
+}
+
+func (d *daemon) Healthy() bool {
+	return !d.unhealthy.Load()
+}
@@ -0,0 +1,201 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/tlsutil"
+)
+
+// mockProber fails while its err is set, and counts the probes
+type mockProber struct {
+	err    atomic.Pointer[error]
+	probes atomic.Int32
+}
+
+func (m *mockProber) setErr(err error) {
+	m.err.Store(&err)
+}
+
+func (m *mockProber) probe(ctx context.Context) error {
+	m.probes.Add(1)
+	if err := m.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// healthInterceptor answers the health checks itself, failing while its err is set
+type healthInterceptor struct {
+	*mockInterceptor
+	mockProber
+}
+
+func (h *healthInterceptor) Check(ctx context.Context, req *pb.CheckRequest) (*pb.HealthCheckResponse, error) {
+	if err := h.probe(ctx); err != nil {
+		return nil, err
+	}
+	return &pb.HealthCheckResponse{Status: pb.HealthCheckResponse_SERVING}, nil
+}
+
+// waitForHealth waits until the daemon health is want, or fails the test
+func waitForHealth(t *testing.T, d Daemon, want bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for d.Healthy() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expect healthy %v", want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTunnelProbe(t *testing.T) {
+
+	prober := &mockProber{}
+	prober.setErr(nil)
+	d := NewDaemon(&Config{}, "127.0.0.1:0", nil, newMockInterceptor(), &mockPodNode{}, WithTunnelProbe(prober.probe, time.Millisecond, 3))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error)
+	go func() {
+		defer close(errCh)
+
+		if err := d.Start(ctx); err != nil {
+			errCh <- err
+		}
+	}()
+	<-d.Ready()
+
+	for prober.probes.Load() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if !d.Healthy() {
+		t.Fatal("Expect the daemon to be healthy while the probe succeeds")
+	}
+
+	// Repeated failures make it unhealthy
+	prober.setErr(errors.New("tunnel is down"))
+	waitForHealth(t, d, false)
+
+	// A single success makes it healthy again
+	prober.setErr(nil)
+	waitForHealth(t, d, true)
+
+	if err := d.Shutdown(); err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+}
+
+func TestListenerProbe(t *testing.T) {
+
+	ca, err := tlsutil.NewCAService("test")
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	certPEM, keyPEM, err := ca.Issue("localhost")
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+	clientCertPEM, _, err := tlsutil.NewClientCertificate("test")
+	if err != nil {
+		t.Fatalf("Expect no error, got %q", err)
+	}
+
+	for name, tlsConfig := range map[string]*tlsutil.TLSConfig{
+		"plain": nil,
+		"TLS": {
+			CAData:   clientCertPEM,
+			CertData: certPEM,
+			KeyData:  keyPEM,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			interceptor := &healthInterceptor{mockInterceptor: newMockInterceptor()}
+			interceptor.setErr(nil)
+			d := NewDaemon(&Config{}, "127.0.0.1:0", tlsConfig, interceptor, &mockPodNode{}, WithListenerProbe(10*time.Millisecond, 2))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			errCh := make(chan error)
+			go func() {
+				defer close(errCh)
+
+				if err := d.Start(ctx); err != nil {
+					errCh <- err
+				}
+			}()
+			<-d.Ready()
+
+			// The health checks reach the interceptor through the listener
+			for interceptor.probes.Load() < 3 {
+				time.Sleep(time.Millisecond)
+			}
+			if !d.Healthy() {
+				t.Fatal("Expect the daemon to be healthy while the agent answers")
+			}
+
+			interceptor.setErr(errors.New("agent is down"))
+			waitForHealth(t, d, false)
+
+			interceptor.setErr(nil)
+			waitForHealth(t, d, true)
+
+			if err := d.Shutdown(); err != nil {
+				t.Fatalf("Expect no error, got %q", err)
+			}
+			if err := <-errCh; err != nil {
+				t.Fatalf("Expect no error, got %q", err)
+			}
+		})
+	}
+}
+
+func TestTunnelProbeFailureThreshold(t *testing.T) {
+
+	d := &daemon{
+		stopCh:                make(chan struct{}),
+		probeInterval:         time.Millisecond,
+		probeFailureThreshold: 5,
+	}
+	failures := make(chan struct{})
+	d.prober = func(ctx context.Context) error {
+		failures <- struct{}{}
+		return errors.New("tunnel is down")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.probeTunnel(ctx)
+
+	// At most 4 probes returned once the 4th one started
+	for i := 0; i < 4; i++ {
+		<-failures
+	}
+	if !d.Healthy() {
+		t.Fatal("Expect the daemon to be healthy after 4 failures")
+	}
+
+	// The 5th one returned once the 6th one started
+	<-failures
+	<-failures
+	if d.Healthy() {
+		t.Fatal("Expect the daemon to be unhealthy after 5 failures")
+	}
+	close(d.stopCh)
+}
@@ -0,0 +1,150 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"slices"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
+)
+
+const (
+	minMTU     = 68 // RFC 791
+	maxMTU     = 65535
+	maxVXLANID = 1<<24 - 1
+)
+
+// Validate checks that the config is structurally valid and internally consistent,
+// without touching the network. All problems found are returned joined together.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.ListenPort != "" {
+		if err := ValidatePort(c.ListenPort); err != nil {
+			errs = append(errs, fmt.Errorf("listen-port: %w", err))
+		}
+	}
+
+	if c.KataAgentNamespace != "" && !filepath.IsAbs(c.KataAgentNamespace) {
+		errs = append(errs, fmt.Errorf("kata-agent-namespace: %q is not an absolute path", c.KataAgentNamespace))
+	}
+
+	if c.PodNetwork == nil {
+		errs = append(errs, errors.New("pod-network is not specified"))
+	} else {
+		errs = append(errs, validatePodNetwork(c.PodNetwork)...)
+	}
+
+	return errors.Join(errs...)
+}
+
+func validatePodNetwork(config *tunneler.Config) []error {
+	var errs []error
+
+	if config.InterfaceName == "" {
+		errs = append(errs, errors.New("pod-network: interface is not specified"))
+	}
+
+	if _, err := tunneler.PodNodeTunneler(config.TunnelType); err != nil {
+		errs = append(errs, fmt.Errorf("pod-network: %w", err))
+	}
+
+	podIP := config.PodIP
+	if !podIP.IsValid() {
+		errs = append(errs, errors.New("pod-network: podip is not specified"))
+	}
+	if !config.WorkerNodeIP.IsValid() {
+		errs = append(errs, errors.New("pod-network: worker-node-ip is not specified"))
+	}
+
+	if config.PodHwAddr != "" {
+		if _, err := net.ParseMAC(config.PodHwAddr); err != nil {
+			errs = append(errs, fmt.Errorf("pod-network: pod-hw-addr: %w", err))
+		}
+	}
+
+	if config.MTU < minMTU || config.MTU > maxMTU {
+		errs = append(errs, fmt.Errorf("pod-network: mtu %d is out of range [%d, %d]", config.MTU, minMTU, maxMTU))
+	}
+	if config.VXLANPort < 0 || config.VXLANPort > 65535 {
+		errs = append(errs, fmt.Errorf("pod-network: vxlan-port %d is out of range", config.VXLANPort))
+	}
+	if config.VXLANID < 0 || config.VXLANID > maxVXLANID {
+		errs = append(errs, fmt.Errorf("pod-network: vxlan-id %d is out of range", config.VXLANID))
+	}
+
+	for _, cidr := range config.EgressAllowCIDRs {
+		if !cidr.Addr().Is4() {
+			errs = append(errs, fmt.Errorf("pod-network: egress-allow-cidrs: %s is not an IPv4 CIDR", cidr))
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(config.Sysctls)) {
+		if err := tunneler.ValidateSysctl(key, config.Sysctls[key]); err != nil {
+			errs = append(errs, fmt.Errorf("pod-network: sysctls: %w", err))
+		}
+	}
+
+	// Routes without a gateway make their destination reachable on link
+	var onLink []netip.Prefix
+	if podIP.IsValid() {
+		onLink = append(onLink, podIP.Masked())
+	}
+	for i, route := range config.Routes {
+		if route == nil {
+			errs = append(errs, fmt.Errorf("pod-network: route %d is null", i))
+			continue
+		}
+		if !route.GW.IsValid() && route.Dst.IsValid() {
+			onLink = append(onLink, route.Dst)
+		}
+	}
+
+	for i, route := range config.Routes {
+		if route == nil {
+			continue
+		}
+		if route.Dst.IsValid() && podIP.IsValid() && route.Dst.Addr().Is4() != podIP.Addr().Is4() {
+			errs = append(errs, fmt.Errorf("pod-network: route %d: dst %s and podip %s are of different address families", i, route.Dst, podIP))
+		}
+		if !route.GW.IsValid() {
+			continue
+		}
+		if !reachable(route.GW, onLink) {
+			errs = append(errs, fmt.Errorf("pod-network: route %d: gw %s is not reachable from podip %s or an on-link route", i, route.GW, podIP))
+		}
+	}
+
+	for i, neighbor := range config.Neighbors {
+		if neighbor == nil {
+			errs = append(errs, fmt.Errorf("pod-network: neighbor %d is null", i))
+			continue
+		}
+		if !neighbor.IP.IsValid() {
+			errs = append(errs, fmt.Errorf("pod-network: neighbor %d: ip is not specified", i))
+		}
+		if neighbor.HardwareAddr != "" {
+			if _, err := net.ParseMAC(neighbor.HardwareAddr); err != nil {
+				errs = append(errs, fmt.Errorf("pod-network: neighbor %d: hw-addr: %w", i, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+func reachable(addr netip.Addr, prefixes []netip.Prefix) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
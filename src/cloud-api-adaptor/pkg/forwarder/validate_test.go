@@ -0,0 +1,169 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package forwarder
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const validPodNetwork = `{
+	"podip": "10.244.1.5/24",
+	"pod-hw-addr": "0e:8f:62:f3:81:ad",
+	"interface": "eth0",
+	"worker-node-ip": "192.168.122.10/24",
+	"tunnel-type": "vxlan",
+	"routes": [
+		{"dst": "0.0.0.0/0", "gw": "10.244.1.1", "dev": "eth0"},
+		{"dst": "169.254.1.1/32", "dev": "eth0", "scope": "link"},
+		{"dst": "10.96.0.0/12", "gw": "169.254.1.1", "dev": "eth0"}
+	],
+	"neighbors": [
+		{"ip": "10.244.1.1", "hw-addr": "ee:ee:ee:ee:ee:ee", "dev": "eth0"}
+	],
+	"mtu": 1450,
+	"vxlan-port": 4789,
+	"vxlan-id": 555000
+}`
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c map[string]any)
+		errs   []string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:   "missing pod network",
+			modify: func(c map[string]any) { delete(c, "pod-network") },
+			errs:   []string{"pod-network is not specified"},
+		},
+		{
+			name:   "invalid listen port",
+			modify: func(c map[string]any) { c["listen-port"] = "0" },
+			errs:   []string{"listen-port"},
+		},
+		{
+			name:   "relative kata agent namespace",
+			modify: func(c map[string]any) { c["kata-agent-namespace"] = "netns/podns" },
+			errs:   []string{"kata-agent-namespace"},
+		},
+		{
+			name: "missing addresses",
+			modify: func(c map[string]any) {
+				network := c["pod-network"].(map[string]any)
+				delete(network, "podip")
+				delete(network, "worker-node-ip")
+				delete(network, "routes")
+			},
+			errs: []string{"podip is not specified", "worker-node-ip is not specified"},
+		},
+		{
+			name: "unknown tunnel type",
+			modify: func(c map[string]any) {
+				c["pod-network"].(map[string]any)["tunnel-type"] = "gre"
+			},
+			errs: []string{`unknown tunnel type: "gre"`},
+		},
+		{
+			name: "allowed sysctl",
+			modify: func(c map[string]any) {
+				c["pod-network"].(map[string]any)["sysctls"] = map[string]any{"net.ipv4.tcp_keepalive_time": "600"}
+			},
+		},
+		{
+			name: "disallowed sysctl",
+			modify: func(c map[string]any) {
+				c["pod-network"].(map[string]any)["sysctls"] = map[string]any{"net.ipv4.ip_forward": "1"}
+			},
+			errs: []string{`sysctls: sysctl "net.ipv4.ip_forward" is not allowed`},
+		},
+		{
+			name: "mtu out of range",
+			modify: func(c map[string]any) {
+				c["pod-network"].(map[string]any)["mtu"] = 0
+			},
+			errs: []string{"mtu 0 is out of range"},
+		},
+		{
+			name: "unreachable gateway",
+			modify: func(c map[string]any) {
+				network := c["pod-network"].(map[string]any)
+				network["routes"] = []any{
+					map[string]any{"dst": "0.0.0.0/0", "gw": "10.0.0.1", "dev": "eth0"},
+				}
+			},
+			errs: []string{"gw 10.0.0.1 is not reachable"},
+		},
+		{
+			name: "mixed address families",
+			modify: func(c map[string]any) {
+				network := c["pod-network"].(map[string]any)
+				network["routes"] = []any{
+					map[string]any{"dst": "fd00::/64", "dev": "eth0"},
+				}
+			},
+			errs: []string{"different address families"},
+		},
+		{
+			name: "invalid neighbor hardware address",
+			modify: func(c map[string]any) {
+				network := c["pod-network"].(map[string]any)
+				network["neighbors"] = []any{
+					map[string]any{"ip": "10.244.1.1", "hw-addr": "not-a-mac"},
+				}
+			},
+			errs: []string{"neighbor 0: hw-addr"},
+		},
+		{
+			name: "several problems",
+			modify: func(c map[string]any) {
+				network := c["pod-network"].(map[string]any)
+				network["interface"] = ""
+				network["vxlan-id"] = 1 << 24
+			},
+			errs: []string{"interface is not specified", "vxlan-id 16777216 is out of range"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var podNetwork map[string]any
+			if err := json.Unmarshal([]byte(validPodNetwork), &podNetwork); err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+			raw := map[string]any{"pod-name": "test-pod", "pod-network": podNetwork}
+			if tt.modify != nil {
+				tt.modify(raw)
+			}
+			data, err := json.Marshal(raw)
+			if err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+			var config Config
+			if err := json.Unmarshal(data, &config); err != nil {
+				t.Fatalf("Expect no error, got %v", err)
+			}
+
+			err = config.Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("Expect no error, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expect errors %q, got nil", tt.errs)
+			}
+			for _, e := range tt.errs {
+				if !strings.Contains(err.Error(), e) {
+					t.Errorf("Expect error containing %q, got %v", e, err)
+				}
+			}
+		})
+	}
+}
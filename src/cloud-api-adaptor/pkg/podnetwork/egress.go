@@ -0,0 +1,96 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package podnetwork
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/coreos/go-iptables/iptables"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
+)
+
+const (
+	egressTable     = "filter"
+	egressBaseChain = "OUTPUT"
+	egressChainName = "peerpod-EGRESS"
+)
+
+// parseEgressAllowCIDRs validates the configured egress allowlist.
+// Only IPv4 is supported, since the pod network tunnel is IPv4 only.
+func parseEgressAllowCIDRs(cidrs []string) ([]netip.Prefix, error) {
+
+	var prefixes []netip.Prefix
+
+	for _, cidr := range cidrs {
+		if cidr == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid egress allow CIDR %q: %w", cidr, err)
+		}
+		if !prefix.Addr().Is4() {
+			return nil, fmt.Errorf("invalid egress allow CIDR %q: only IPv4 is supported", cidr)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// egressRules returns the rule specs of the egress chain. Loopback traffic and replies to
+// connections initiated from outside the pod are always accepted, new connections only
+// when the destination is in one of the allowed CIDRs. Everything else is rejected so
+// that applications fail fast instead of waiting for a timeout.
+func egressRules(cidrs []netip.Prefix) [][]string {
+
+	comment := "peerpod egress allowlist"
+
+	rules := [][]string{
+		{"-m", "comment", "--comment", comment, "-o", "lo", "-j", "ACCEPT"},
+		{"-m", "comment", "--comment", comment, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+	}
+
+	for _, cidr := range cidrs {
+		rules = append(rules, []string{"-m", "comment", "--comment", comment, "-d", cidr.String(), "-j", "ACCEPT"})
+	}
+
+	rules = append(rules, []string{"-m", "comment", "--comment", comment, "-j", "REJECT"})
+
+	return rules
+}
+
+// setupEgressAllowlist installs the egress chain in the pod network namespace.
+// No teardown is needed, since the rules go away together with the namespace.
+func setupEgressAllowlist(podNS netops.Namespace, cidrs []netip.Prefix) error {
+
+	return podNS.Run(func() error {
+
+		ipt, err := iptables.New(iptables.IPFamily(iptables.ProtocolIPv4))
+		if err != nil {
+			return fmt.Errorf("failed to initialize iptables: %w", err)
+		}
+
+		// Start from an empty chain, so that the rules are in the expected order
+		if err := ipt.ClearChain(egressTable, egressChainName); err != nil {
+			return fmt.Errorf("failed to create iptables chain %s on table %s: %w", egressChainName, egressTable, err)
+		}
+
+		for _, spec := range egressRules(cidrs) {
+			if err := ipt.Append(egressTable, egressChainName, spec...); err != nil {
+				return fmt.Errorf("failed to add iptables rule \"-t %s -A %s %s\": %w", egressTable, egressChainName, strings.Join(spec, " "), err)
+			}
+		}
+
+		// Add "-A OUTPUT -j <chain>"
+		if err := ipt.AppendUnique(egressTable, egressBaseChain, "-j", egressChainName); err != nil {
+			return fmt.Errorf("failed to add iptables rule \"-t %s -A %s -j %s\": %w", egressTable, egressBaseChain, egressChainName, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,65 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package podnetwork
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEgressAllowCIDRs(t *testing.T) {
+
+	prefixes, err := parseEgressAllowCIDRs([]string{"10.96.0.0/12", "", "192.168.1.10/24"})
+	require.NoError(t, err)
+	require.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.96.0.0/12"),
+		netip.MustParsePrefix("192.168.1.0/24"),
+	}, prefixes)
+
+	prefixes, err = parseEgressAllowCIDRs(nil)
+	require.NoError(t, err)
+	require.Empty(t, prefixes)
+
+	_, err = parseEgressAllowCIDRs([]string{"10.96.0.0"})
+	require.Error(t, err)
+
+	_, err = parseEgressAllowCIDRs([]string{"fd00::/64"})
+	require.ErrorContains(t, err, "only IPv4")
+}
+
+func TestEgressRules(t *testing.T) {
+
+	cidrs := []netip.Prefix{
+		netip.MustParsePrefix("10.96.0.0/12"),
+		netip.MustParsePrefix("203.0.113.5/32"),
+	}
+
+	var rules []string
+	for _, spec := range egressRules(cidrs) {
+		require.Equal(t, []string{"-m", "comment", "--comment", "peerpod egress allowlist"}, spec[:4])
+		rules = append(rules, strings.Join(spec[4:], " "))
+	}
+
+	require.Equal(t, []string{
+		"-o lo -j ACCEPT",
+		"-m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+		"-d 10.96.0.0/12 -j ACCEPT",
+		"-d 203.0.113.5/32 -j ACCEPT",
+		"-j REJECT",
+	}, rules)
+
+	// Without allowed CIDRs only loopback and replies are accepted
+	rules = nil
+	for _, spec := range egressRules(nil) {
+		rules = append(rules, strings.Join(spec[4:], " "))
+	}
+	require.Equal(t, []string{
+		"-o lo -j ACCEPT",
+		"-m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+		"-j REJECT",
+	}, rules)
+}
@@ -14,6 +14,7 @@ import (
 	testutils "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/internal/testing"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tuntest"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
 )
 
 type mockWorkerNodeTunneler struct{}
@@ -240,3 +241,51 @@ func TestPluginDetectHostInterface(t *testing.T) {
 		t.Fatalf("Expect %q, got %q", e, a)
 	}
 }
+
+// fakeRouter routes to the first prefix containing the destination
+type fakeRouter []*netops.Route
+
+func (r fakeRouter) RouteGet(dst netip.Addr) (*netops.Route, error) {
+	for _, route := range r {
+		if route.Destination.Contains(dst) {
+			return route, nil
+		}
+	}
+	return nil, fmt.Errorf("no route to %s", dst)
+}
+
+func TestFindInterfaceByAddr(t *testing.T) {
+	routes := fakeRouter{
+		{Destination: netip.MustParsePrefix("192.168.10.0/24"), Device: "eth1"},
+		{Destination: netip.MustParsePrefix("172.16.0.0/16"), Gateway: netip.MustParseAddr("192.168.10.254"), Device: "eth1"},
+		{Destination: netip.MustParsePrefix("10.10.0.0/16")},
+		{Destination: netip.MustParsePrefix("0.0.0.0/0"), Gateway: netip.MustParseAddr("10.0.0.1"), Device: "eth0"},
+	}
+
+	for addr, e := range map[string]string{
+		"192.168.10.1": "eth1",
+		// A worker node on another subnet behind a gateway of eth1
+		"172.16.0.1": "eth1",
+		"8.8.8.8":    "eth0",
+	} {
+		name, err := findInterfaceByAddr(routes, netip.MustParseAddr(addr))
+		if err != nil {
+			t.Fatalf("Expect nil, got %v", err)
+		}
+		if a := name; e != a {
+			t.Fatalf("Expect %q for %s, got %q", e, addr, a)
+		}
+	}
+
+	if _, err := findInterfaceByAddr(routes, netip.MustParseAddr("10.10.0.1")); err == nil {
+		t.Fatal("Expect an error when the route has no interface, got nil")
+	}
+
+	if _, err := findInterfaceByAddr(routes, netip.Addr{}); err == nil {
+		t.Fatal("Expect an error without a worker node IP, got nil")
+	}
+
+	if _, err := findInterfaceByAddr(fakeRouter{}, netip.MustParseAddr("192.168.10.1")); err == nil {
+		t.Fatal("Expect an error without a route, got nil")
+	}
+}
@@ -17,6 +17,10 @@ type PodNode interface {
 	Teardown() error
 }
 
+// HostInterfaceAuto is the host interface name that selects the interface routing to the worker
+// node IP, for pod VMs with more than one network interface
+const HostInterfaceAuto = "auto"
+
 type podNode struct {
 	config        *tunneler.Config
 	nsPath        string
@@ -64,8 +68,14 @@ func (n *podNode) Setup() error {
 	podNodeIPs := []netip.Addr{primaryPodNodeIP}
 
 	hostInterface := n.hostInterface
-	if hostInterface == "" {
+	switch hostInterface {
+	case "":
 		hostInterface = hostPrimaryInterface
+	case HostInterfaceAuto:
+		if hostInterface, err = findInterfaceByAddr(hostNS, n.config.WorkerNodeIP.Addr()); err != nil {
+			return err
+		}
+		logger.Printf("Detected host interface %s routing to worker node IP %s", hostInterface, n.config.WorkerNodeIP.Addr())
 	}
 
 	if n.config.Dedicated {
@@ -151,6 +161,20 @@ func (n *podNode) Setup() error {
 		}
 	}
 
+	if len(n.config.EgressAllowCIDRs) > 0 {
+		if err := setupEgressAllowlist(podNS, n.config.EgressAllowCIDRs); err != nil {
+			return fmt.Errorf("failed to restrict egress traffic on pod network namespace %s: %w", podNS.Path(), err)
+		}
+		logger.Printf("restricted egress traffic on pod network namespace %s to %v", podNS.Path(), n.config.EgressAllowCIDRs)
+	}
+
+	if len(n.config.Sysctls) > 0 {
+		if err := setupSysctls(podNS, n.config.Sysctls); err != nil {
+			return fmt.Errorf("failed to set sysctls on pod network namespace %s: %w", podNS.Path(), err)
+		}
+		logger.Printf("set sysctls %v on pod network namespace %s", n.config.Sysctls, podNS.Path())
+	}
+
 	if n.config.ExternalNetViaPodVM {
 		err = setupExternalNetwork(hostNS, hostPrimaryInterface, podNS)
 		if err != nil {
@@ -179,12 +203,17 @@ func (n *podNode) Teardown() error {
 	}()
 
 	hostInterface := n.hostInterface
-	if hostInterface == "" {
+	switch hostInterface {
+	case "":
 		hostPrimaryInterface, _, err := findPrimaryInterface(hostNS)
 		if err != nil {
 			return fmt.Errorf("failed to identify the host primary interface: %w", err)
 		}
 		hostInterface = hostPrimaryInterface
+	case HostInterfaceAuto:
+		if hostInterface, err = findInterfaceByAddr(hostNS, n.config.WorkerNodeIP.Addr()); err != nil {
+			return err
+		}
 	}
 
 	if err := tun.Teardown(n.nsPath, hostInterface, n.config); err != nil {
@@ -194,6 +223,28 @@ func (n *podNode) Teardown() error {
 	return nil
 }
 
+type routeGetter interface {
+	RouteGet(dst netip.Addr) (*netops.Route, error)
+}
+
+// findInterfaceByAddr returns the interface of the route the kernel selects to reach addr, which
+// also covers a worker node on another subnet reached through a gateway.
+func findInterfaceByAddr(ns routeGetter, addr netip.Addr) (string, error) {
+	if !addr.IsValid() {
+		return "", fmt.Errorf("no worker node IP to detect the host interface from")
+	}
+
+	route, err := ns.RouteGet(addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the route to worker node IP %s: %w", addr, err)
+	}
+	if route.Device == "" {
+		return "", fmt.Errorf("the route to worker node IP %s has no interface", addr)
+	}
+
+	return route.Device, nil
+}
+
 func detectPrimaryInterface(hostNS netops.Namespace, timeout time.Duration) (string, error) {
 
 	timeoutCh := time.After(timeout)
@@ -0,0 +1,55 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package podnetwork
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/util/netops"
+)
+
+const procSysPath = "/proc/sys"
+
+// validateSysctls checks the sysctls of the pod network namespace against tunneler.AllowedSysctls
+func validateSysctls(sysctls map[string]string) error {
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(sysctls)) {
+		if err := tunneler.ValidateSysctl(key, sysctls[key]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeSysctls writes sysctls to their files under procSys. Nothing is written unless
+// all of them are allowed.
+func writeSysctls(procSys string, sysctls map[string]string) error {
+	if err := validateSysctls(sysctls); err != nil {
+		return err
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(sysctls)) {
+		path := filepath.Join(procSys, strings.ReplaceAll(key, ".", "/"))
+		if err := os.WriteFile(path, []byte(sysctls[key]), 0644); err != nil {
+			return fmt.Errorf("failed to set sysctl %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// setupSysctls sets sysctls on the pod network namespace. No teardown is needed, since
+// /proc/sys/net is per namespace and goes away together with it.
+func setupSysctls(podNS netops.Namespace, sysctls map[string]string) error {
+
+	return podNS.Run(func() error {
+		return writeSysctls(procSysPath, sysctls)
+	})
+}
@@ -0,0 +1,62 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package podnetwork
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newProcSys(t *testing.T, keys ...string) string {
+	procSys := t.TempDir()
+	for _, key := range keys {
+		path := filepath.Join(procSys, key)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("0"), 0644))
+	}
+	return procSys
+}
+
+func TestWriteSysctls(t *testing.T) {
+
+	procSys := newProcSys(t, "net/ipv4/tcp_keepalive_time", "net/ipv4/ip_local_port_range")
+
+	err := writeSysctls(procSys, map[string]string{
+		"net.ipv4.tcp_keepalive_time":  "600",
+		"net.ipv4.ip_local_port_range": "1024 65000",
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(procSys, "net/ipv4/tcp_keepalive_time"))
+	require.NoError(t, err)
+	require.Equal(t, "600", string(data))
+
+	data, err = os.ReadFile(filepath.Join(procSys, "net/ipv4/ip_local_port_range"))
+	require.NoError(t, err)
+	require.Equal(t, "1024 65000", string(data))
+}
+
+func TestWriteSysctlsDisallowed(t *testing.T) {
+
+	procSys := newProcSys(t, "net/ipv4/tcp_keepalive_time", "net/ipv4/ip_forward")
+
+	err := writeSysctls(procSys, map[string]string{
+		"net.ipv4.tcp_keepalive_time": "600",
+		"net.ipv4.ip_forward":         "1",
+	})
+	require.ErrorContains(t, err, `sysctl "net.ipv4.ip_forward" is not allowed`)
+
+	// Nothing is written when any of the sysctls is rejected
+	for _, key := range []string{"net/ipv4/tcp_keepalive_time", "net/ipv4/ip_forward"} {
+		data, err := os.ReadFile(filepath.Join(procSys, key))
+		require.NoError(t, err)
+		require.Equal(t, "0", string(data))
+	}
+
+	require.ErrorContains(t, writeSysctls(procSys, map[string]string{"net.ipv4.tcp_keepalive_time": "600\n1"}), "invalid value")
+	require.ErrorContains(t, writeSysctls(procSys, map[string]string{"../../etc/passwd": "x"}), "is not allowed")
+}
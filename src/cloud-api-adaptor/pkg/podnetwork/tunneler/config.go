@@ -3,7 +3,10 @@
 
 package tunneler
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 type TunnelerConfigurator interface {
 	Tunneler
@@ -16,6 +19,8 @@ type NetworkConfig struct {
 	VXLAN               VXLANConfig
 	ExternalNetViaPodVM bool
 	PodSubnetCIDRs      SubnetCIDRs
+	EgressAllowCIDRs    SubnetCIDRs
+	Sysctls             Sysctls
 }
 
 type VXLANConfig struct {
@@ -37,3 +42,28 @@ func (i *SubnetCIDRs) Set(value string) error {
 	}
 	return nil
 }
+
+// Sysctls are key=value pairs of sysctls, e.g. net.ipv4.tcp_keepalive_time=600
+type Sysctls map[string]string
+
+func (s *Sysctls) String() string {
+	var pairs []string
+	for k, v := range *s {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func (s *Sysctls) Set(value string) error {
+	if *s == nil {
+		*s = Sysctls{}
+	}
+	for _, part := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("invalid sysctl %q, expected key=value", part)
+		}
+		(*s)[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return nil
+}
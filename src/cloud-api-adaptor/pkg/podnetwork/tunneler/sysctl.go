@@ -0,0 +1,35 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package tunneler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// AllowedSysctls are the sysctls that can be set on the pod network namespace. They only
+// affect the namespace, following the safe sysctls of Kubernetes.
+var AllowedSysctls = []string{
+	"net.ipv4.ip_local_port_range",
+	"net.ipv4.ip_local_reserved_ports",
+	"net.ipv4.ip_unprivileged_port_start",
+	"net.ipv4.ping_group_range",
+	"net.ipv4.tcp_fin_timeout",
+	"net.ipv4.tcp_keepalive_intvl",
+	"net.ipv4.tcp_keepalive_probes",
+	"net.ipv4.tcp_keepalive_time",
+	"net.ipv4.tcp_syncookies",
+}
+
+// ValidateSysctl checks that key is one of AllowedSysctls and value can be written to it
+func ValidateSysctl(key, value string) error {
+	if !slices.Contains(AllowedSysctls, key) {
+		return fmt.Errorf("sysctl %q is not allowed, only %s are", key, strings.Join(AllowedSysctls, ", "))
+	}
+	if strings.TrimSpace(value) == "" || strings.ContainsFunc(value, func(r rune) bool { return r < ' ' && r != '\t' }) {
+		return fmt.Errorf("sysctl %q: invalid value %q", key, value)
+	}
+	return nil
+}
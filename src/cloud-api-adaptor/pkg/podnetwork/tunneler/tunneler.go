@@ -29,6 +29,12 @@ type Config struct {
 	VXLANID             int          `json:"vxlan-id,omitempty"`
 	Dedicated           bool         `json:"dedicated"`
 	ExternalNetViaPodVM bool         `json:"external-net-via-pod-vm"`
+	// EgressAllowCIDRs restricts the traffic leaving the pod to these destinations. Empty means unrestricted.
+	EgressAllowCIDRs []netip.Prefix `json:"egress-allow-cidrs,omitempty"`
+	// Sysctls are set on the pod network namespace, only the keys of AllowedSysctls are accepted
+	Sysctls map[string]string `json:"sysctls,omitempty"`
+	// DiscoverMTU lowers the MTU of the tunnel on the pod VM to fit the path MTU to the worker node
+	DiscoverMTU bool `json:"discover-mtu,omitempty"`
 }
 
 type Route struct {
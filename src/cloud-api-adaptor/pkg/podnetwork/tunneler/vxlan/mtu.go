@@ -0,0 +1,100 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package vxlan
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// vxlanOverhead is the size of the outer Ethernet, IPv4, UDP and VXLAN headers
+	vxlanOverhead = 50
+	// minMTU is the smallest MTU accepted from the discovery, the minimum MTU of IPv6
+	minMTU = 1280
+)
+
+// discoverPathMTU returns the MTU of the path to dst known by the kernel, i.e. the MTU of the
+// route to dst lowered by the ICMP "fragmentation needed" messages received from the routers
+// in between. It is a variable to be replaced in tests.
+var discoverPathMTU = func(dst netip.Addr, port int) (int, error) {
+
+	// No packet is sent, connecting a UDP socket only looks up the route
+	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(netip.AddrPortFrom(dst, uint16(port))))
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up the route to %s: %w", dst, err)
+	}
+	defer conn.Close()
+
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	level, opt := unix.IPPROTO_IP, unix.IP_MTU
+	if dst.Is6() && !dst.Is4In6() {
+		level, opt = unix.IPPROTO_IPV6, unix.IPV6_MTU
+	}
+
+	var mtu int
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		mtu, sockErr = unix.GetsockoptInt(int(fd), level, opt)
+	}); err != nil {
+		return 0, err
+	}
+	if sockErr != nil {
+		return 0, fmt.Errorf("failed to get the path MTU to %s: %w", dst, sockErr)
+	}
+	return mtu, nil
+}
+
+// tunnelMTU returns the MTU of the VXLAN interface. It is the configured MTU, at most maxMTU,
+// lowered to fit the discovered path MTU to the worker node once encapsulated. A pathMTU of 0
+// means that the discovery is disabled or failed, and a path MTU too small to carry the
+// encapsulated minMTU is ignored.
+func tunnelMTU(configured, pathMTU int) int {
+
+	mtu := configured
+	if mtu > maxMTU {
+		mtu = maxMTU
+	}
+
+	if pathMTU <= 0 {
+		return mtu
+	}
+
+	discovered := pathMTU - vxlanOverhead
+	if discovered < minMTU {
+		logger.Printf("Ignoring the path MTU %d to the worker node, using MTU %d", pathMTU, mtu)
+		return mtu
+	}
+	if discovered < mtu {
+		logger.Printf("Lowering the tunnel MTU from %d to %d to fit the path MTU %d to the worker node", mtu, discovered, pathMTU)
+		return discovered
+	}
+	return mtu
+}
+
+// podNodeMTU returns the MTU of the VXLAN interface to the worker node nodeAddr, discovering
+// the path MTU if enabled
+func podNodeMTU(configured int, discover bool, nodeAddr netip.Addr, port int) int {
+
+	if !discover {
+		return tunnelMTU(configured, 0)
+	}
+
+	if port == 0 {
+		port = DefaultVXLANPort
+	}
+	pathMTU, err := discoverPathMTU(nodeAddr, port)
+	if err != nil {
+		logger.Printf("Path MTU discovery to %s failed, using the configured MTU: %v", nodeAddr, err)
+		return tunnelMTU(configured, 0)
+	}
+	return tunnelMTU(configured, pathMTU)
+}
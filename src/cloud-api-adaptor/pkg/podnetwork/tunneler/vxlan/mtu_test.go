@@ -0,0 +1,66 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package vxlan
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestTunnelMTU(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		configured int
+		pathMTU    int
+		want       int
+	}{
+		{name: "no discovery", configured: 1400, pathMTU: 0, want: 1400},
+		{name: "no discovery above max", configured: 9000, pathMTU: 0, want: maxMTU},
+		{name: "path fits configured", configured: 1400, pathMTU: 1500, want: 1400},
+		{name: "path lowers configured", configured: 1450, pathMTU: 1400, want: 1350},
+		{name: "jumbo path keeps max", configured: 9000, pathMTU: 9001, want: maxMTU},
+		{name: "path lowers capped configured", configured: 9000, pathMTU: 1450, want: 1400},
+		{name: "path too small", configured: 1450, pathMTU: 1200, want: 1450},
+		{name: "path at min", configured: 1450, pathMTU: minMTU + vxlanOverhead, want: minMTU},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tunnelMTU(tc.configured, tc.pathMTU); got != tc.want {
+				t.Errorf("tunnelMTU(%d, %d) = %d, want %d", tc.configured, tc.pathMTU, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPodNodeMTU(t *testing.T) {
+	saved := discoverPathMTU
+	defer func() { discoverPathMTU = saved }()
+
+	nodeAddr := netip.MustParseAddr("192.168.0.10")
+
+	var pathMTU int
+	var discoverErr error
+	var discovered bool
+	discoverPathMTU = func(dst netip.Addr, port int) (int, error) {
+		discovered = true
+		if dst != nodeAddr || port != DefaultVXLANPort {
+			t.Errorf("discoverPathMTU(%s, %d), want (%s, %d)", dst, port, nodeAddr, DefaultVXLANPort)
+		}
+		return pathMTU, discoverErr
+	}
+
+	pathMTU = 1400
+	if got := podNodeMTU(1450, false, nodeAddr, DefaultVXLANPort); got != 1450 || discovered {
+		t.Errorf("podNodeMTU() = %d with discovery disabled, want the configured MTU 1450 without discovery", got)
+	}
+
+	if got := podNodeMTU(1450, true, nodeAddr, DefaultVXLANPort); got != 1350 {
+		t.Errorf("podNodeMTU() = %d, want the discovered MTU 1350", got)
+	}
+
+	discoverErr = errors.New("no route to host")
+	if got := podNodeMTU(1450, true, nodeAddr, 0); got != 1450 {
+		t.Errorf("podNodeMTU() = %d after a failed discovery, want the configured MTU 1450", got)
+	}
+}
@@ -82,10 +82,7 @@ func (t *podNodeTunneler) Setup(nsPath string, podNodeIPs []netip.Addr, config *
 		return fmt.Errorf("failed to set pod HW address %s on %s: %w", config.PodHwAddr, podVxlanInterface, err)
 	}
 
-	mtu := int(config.MTU)
-	if mtu > maxMTU {
-		mtu = maxMTU
-	}
+	mtu := podNodeMTU(config.MTU, config.DiscoverMTU, nodeAddr.Addr(), config.VXLANPort)
 	if err := vxlan.SetMTU(mtu); err != nil {
 		return fmt.Errorf("failed to set MTU of %s to %d on %s: %w", podVxlanInterface, mtu, nsPath, err)
 	}
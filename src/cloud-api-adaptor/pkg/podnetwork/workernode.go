@@ -22,7 +22,8 @@ type WorkerNode interface {
 
 type workerNode struct {
 	*tunneler.NetworkConfig
-	tunneler tunneler.TunnelerConfigurator
+	tunneler         tunneler.TunnelerConfigurator
+	egressAllowCIDRs []netip.Prefix
 }
 
 // TODO: Pod index is reset when this process restarts.
@@ -55,9 +56,19 @@ func NewWorkerNode(networkConfig *tunneler.NetworkConfig) (WorkerNode, error) {
 		return nil, fmt.Errorf("internal error: Configure is not defined: %T", t)
 	}
 
+	egressAllowCIDRs, err := parseEgressAllowCIDRs(networkConfig.EgressAllowCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateSysctls(networkConfig.Sysctls); err != nil {
+		return nil, err
+	}
+
 	wn := &workerNode{
-		NetworkConfig: networkConfig,
-		tunneler:      tun,
+		NetworkConfig:    networkConfig,
+		tunneler:         tun,
+		egressAllowCIDRs: egressAllowCIDRs,
 	}
 
 	return wn, nil
@@ -69,6 +80,8 @@ func (n *workerNode) Inspect(nsPath string) (*tunneler.Config, error) {
 		TunnelType:          n.TunnelType,
 		Index:               podIndexManager.Get(),
 		ExternalNetViaPodVM: n.ExternalNetViaPodVM,
+		EgressAllowCIDRs:    n.egressAllowCIDRs,
+		Sysctls:             n.Sysctls,
 	}
 
 	hostNS, err := netops.OpenCurrentNamespace()
@@ -13,6 +13,13 @@ type kvPair struct {
 	v string
 }
 
+const (
+	awsImdsTokenHeader    = "X-aws-ec2-metadata-token"
+	awsImdsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	// Long enough for the provisioning, which requests a new token for each fetch anyway
+	awsImdsTokenTTL = "300"
+)
+
 func imdsGet(ctx context.Context, url string, b64 bool, headers []kvPair) ([]byte, error) {
 	// If url is empty then return empty string
 	if url == "" {
@@ -61,3 +68,39 @@ func imdsGet(ctx context.Context, url string, b64 bool, headers []kvPair) ([]byt
 	}
 	return decoded, nil
 }
+
+// awsImdsToken requests an IMDSv2 session token from the AWS instance metadata service
+func awsImdsToken(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %s", err)
+	}
+	req.Header.Set(awsImdsTokenTTLHeader, awsImdsTokenTTL)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send token request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("endpoint %s returned != 200 status code: %s", url, resp.Status)
+	}
+	token, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token response body: %s", err)
+	}
+	return string(token), nil
+}
+
+// awsImdsGet gets url from the AWS instance metadata service with an IMDSv2 session token
+// requested from tokenURL. Instances launched with HttpTokens required reject the requests
+// without a token, the others accept it too.
+func awsImdsGet(ctx context.Context, tokenURL, url string) ([]byte, error) {
+	token, err := awsImdsToken(ctx, tokenURL)
+	if err != nil {
+		return nil, err
+	}
+	return imdsGet(ctx, url, false, []kvPair{{awsImdsTokenHeader, token}})
+}
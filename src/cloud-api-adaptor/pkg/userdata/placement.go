@@ -0,0 +1,155 @@
+package userdata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Placement describes where the pod VM runs. The JSON keys match forwarder.Placement,
+// which reads it back from the "placement" key of the forwarder config.
+type Placement struct {
+	Provider   string `json:"provider"`
+	Region     string `json:"region,omitempty"`
+	Zone       string `json:"zone,omitempty"`
+	InstanceID string `json:"instance-id,omitempty"`
+}
+
+const placementConfigKey = "placement"
+
+// PlacementProvider is implemented by the user data providers that can also read the
+// placement of the pod VM from the instance metadata service
+type PlacementProvider interface {
+	GetPlacement(ctx context.Context) (*Placement, error)
+}
+
+func (a AzureUserDataProvider) GetPlacement(ctx context.Context) (*Placement, error) {
+	return azurePlacement(ctx, AzureImdsUrl)
+}
+
+func (a AWSUserDataProvider) GetPlacement(ctx context.Context) (*Placement, error) {
+	return awsPlacement(ctx, AWSImdsTokenUrl, AWSImdsUrl)
+}
+
+func (g GCPUserDataProvider) GetPlacement(ctx context.Context) (*Placement, error) {
+	return gcpPlacement(ctx, GcpImdsUrl)
+}
+
+func (a AlibabaCloudDataProvider) GetPlacement(ctx context.Context) (*Placement, error) {
+	return alibabaCloudPlacement(ctx, AlibabaCloudImdsUrl)
+}
+
+func azurePlacement(ctx context.Context, url string) (*Placement, error) {
+	body, err := imdsGet(ctx, url, false, []kvPair{{"Metadata", "true"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var compute struct {
+		Location string `json:"location"`
+		Zone     string `json:"zone"`
+		VMID     string `json:"vmId"`
+	}
+	if err := json.Unmarshal(body, &compute); err != nil {
+		return nil, fmt.Errorf("failed to parse Azure instance metadata: %w", err)
+	}
+
+	return &Placement{Provider: "azure", Region: compute.Location, Zone: compute.Zone, InstanceID: compute.VMID}, nil
+}
+
+func awsPlacement(ctx context.Context, tokenURL, url string) (*Placement, error) {
+	body, err := awsImdsGet(ctx, tokenURL, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var document struct {
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+		InstanceID       string `json:"instanceId"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse AWS instance identity document: %w", err)
+	}
+
+	return &Placement{Provider: "aws", Region: document.Region, Zone: document.AvailabilityZone, InstanceID: document.InstanceID}, nil
+}
+
+func gcpPlacement(ctx context.Context, url string) (*Placement, error) {
+	headers := []kvPair{{"Metadata-Flavor", "Google"}}
+
+	// The zone is returned as projects/<project number>/zones/<zone>
+	zone, err := imdsGet(ctx, url+"/zone", false, headers)
+	if err != nil {
+		return nil, err
+	}
+	id, err := imdsGet(ctx, url+"/id", false, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	placement := &Placement{Provider: "gcp", Zone: path.Base(string(zone)), InstanceID: string(id)}
+	// Zones are named <region>-<letter>
+	if i := strings.LastIndex(placement.Zone, "-"); i > 0 {
+		placement.Region = placement.Zone[:i]
+	}
+
+	return placement, nil
+}
+
+func alibabaCloudPlacement(ctx context.Context, url string) (*Placement, error) {
+	body, err := imdsGet(ctx, url, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var document struct {
+		RegionID   string `json:"region-id"`
+		ZoneID     string `json:"zone-id"`
+		InstanceID string `json:"instance-id"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse Alibaba Cloud instance identity document: %w", err)
+	}
+
+	return &Placement{Provider: "alibabacloud", Region: document.RegionID, Zone: document.ZoneID, InstanceID: document.InstanceID}, nil
+}
+
+// addPlacement adds the placement to the forwarder config written from the user data.
+// Other keys of the config are kept as they are, and the copies of the config are updated
+// along with it.
+func addPlacement(configPath string, placement *Placement, copies ...string) error {
+	data, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Printf("%s not found, skipping the placement metadata\n", configPath)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", configPath, err)
+	}
+
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", configPath, err)
+	}
+
+	value, err := json.Marshal(placement)
+	if err != nil {
+		return fmt.Errorf("failed to marshal placement: %w", err)
+	}
+	config[placementConfigKey] = value
+
+	data, err = json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", configPath, err)
+	}
+
+	if len(copies) > 0 {
+		return writeFilesAtomically(append([]string{configPath}, copies...), data)
+	}
+	return writeFile(configPath, data)
+}
@@ -0,0 +1,201 @@
+package userdata
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const awsTestTokenPath = "/latest/api/token"
+
+// startPlacementServer simulates an instance metadata service answering the given paths
+func startPlacementServer(t *testing.T, header string, responses map[string]string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header != "" && r.Header.Get(header) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		serveResponse(w, r, responses)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// startAWSIMDSv2Server simulates an AWS instance metadata service requiring IMDSv2: the
+// session token is issued by a PUT to awsTestTokenPath and required on the other requests
+func startAWSIMDSv2Server(t *testing.T, responses map[string]string) *httptest.Server {
+	const token = "AQAEAFTo-test-token"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == awsTestTokenPath {
+			if r.Method != http.MethodPut || r.Header.Get(awsImdsTokenTTLHeader) == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(token))
+			return
+		}
+		if r.Header.Get(awsImdsTokenHeader) != token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		serveResponse(w, r, responses)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func serveResponse(w http.ResponseWriter, r *http.Request, responses map[string]string) {
+	body, ok := responses[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write([]byte(body))
+}
+
+func TestGetPlacement(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		imdsv2    bool
+		responses map[string]string
+		get       func(ctx context.Context, url string) (*Placement, error)
+		want      *Placement
+	}{
+		{
+			name:   "azure",
+			header: "Metadata",
+			responses: map[string]string{
+				"/metadata/instance/compute": `{"location":"eastus","zone":"2","vmId":"02aab8a4-74ef-476e-8182-f6d2ba4166a6","name":"podvm"}`,
+			},
+			get: func(ctx context.Context, url string) (*Placement, error) {
+				return azurePlacement(ctx, url+"/metadata/instance/compute")
+			},
+			want: &Placement{Provider: "azure", Region: "eastus", Zone: "2", InstanceID: "02aab8a4-74ef-476e-8182-f6d2ba4166a6"},
+		},
+		{
+			name:   "aws",
+			imdsv2: true,
+			responses: map[string]string{
+				"/latest/dynamic/instance-identity/document": `{"region":"us-east-2","availabilityZone":"us-east-2b","instanceId":"i-1234567890abcdef0","instanceType":"m6a.large"}`,
+			},
+			get: func(ctx context.Context, url string) (*Placement, error) {
+				return awsPlacement(ctx, url+awsTestTokenPath, url+"/latest/dynamic/instance-identity/document")
+			},
+			want: &Placement{Provider: "aws", Region: "us-east-2", Zone: "us-east-2b", InstanceID: "i-1234567890abcdef0"},
+		},
+		{
+			name:   "gcp",
+			header: "Metadata-Flavor",
+			responses: map[string]string{
+				"/computeMetadata/v1/instance/zone": "projects/123456789/zones/us-central1-a",
+				"/computeMetadata/v1/instance/id":   "4520031799277581759",
+			},
+			get: func(ctx context.Context, url string) (*Placement, error) {
+				return gcpPlacement(ctx, url+"/computeMetadata/v1/instance")
+			},
+			want: &Placement{Provider: "gcp", Region: "us-central1", Zone: "us-central1-a", InstanceID: "4520031799277581759"},
+		},
+		{
+			name: "alibabacloud",
+			responses: map[string]string{
+				"/latest/dynamic/instance-identity/document": `{"region-id":"cn-hangzhou","zone-id":"cn-hangzhou-i","instance-id":"i-bp1abcdefg"}`,
+			},
+			get: func(ctx context.Context, url string) (*Placement, error) {
+				return alibabaCloudPlacement(ctx, url+"/latest/dynamic/instance-identity/document")
+			},
+			want: &Placement{Provider: "alibabacloud", Region: "cn-hangzhou", Zone: "cn-hangzhou-i", InstanceID: "i-bp1abcdefg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var srv *httptest.Server
+			if tt.imdsv2 {
+				srv = startAWSIMDSv2Server(t, tt.responses)
+			} else {
+				srv = startPlacementServer(t, tt.header, tt.responses)
+			}
+
+			got, err := tt.get(context.Background(), srv.URL)
+			if err != nil {
+				t.Fatalf("failed to get placement: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got placement %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPlacementInvalidDocument(t *testing.T) {
+	srv := startAWSIMDSv2Server(t, map[string]string{"/document": "not json"})
+
+	if _, err := awsPlacement(context.Background(), srv.URL+awsTestTokenPath, srv.URL+"/document"); err == nil {
+		t.Fatal("expected an error for an invalid identity document")
+	}
+}
+
+func TestAWSIMDSGet(t *testing.T) {
+	srv := startAWSIMDSv2Server(t, map[string]string{"/latest/user-data": "write_files: []"})
+	ctx := context.Background()
+
+	// IMDSv1 requests are rejected
+	if _, err := imdsGet(ctx, srv.URL+"/latest/user-data", false, nil); err == nil {
+		t.Fatal("expected an error for a request without a session token")
+	}
+
+	userData, err := awsImdsGet(ctx, srv.URL+awsTestTokenPath, srv.URL+"/latest/user-data")
+	if err != nil {
+		t.Fatalf("failed to get user data: %v", err)
+	}
+	if string(userData) != "write_files: []" {
+		t.Errorf("got user data %q, want %q", userData, "write_files: []")
+	}
+
+	if _, err := awsImdsGet(ctx, srv.URL+"/missing", srv.URL+"/latest/user-data"); err == nil {
+		t.Fatal("expected an error when no session token is issued")
+	}
+}
+
+func TestAddPlacement(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "apf.json")
+	if err := os.WriteFile(configPath, []byte(testAPFConfig), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	placement := &Placement{Provider: "aws", Region: "us-east-2", Zone: "us-east-2b", InstanceID: "i-1234567890abcdef0"}
+	if err := addPlacement(configPath, placement); err != nil {
+		t.Fatalf("failed to add placement: %v", err)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	var config struct {
+		PodName   string     `json:"pod-name"`
+		Placement *Placement `json:"placement"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	if config.PodName != "nginx-866fdb5bfb-b98nw" {
+		t.Errorf("expected the existing keys to be kept, got pod-name %q", config.PodName)
+	}
+	if !reflect.DeepEqual(config.Placement, placement) {
+		t.Errorf("got placement %+v, want %+v", config.Placement, placement)
+	}
+
+	// A missing forwarder config is not an error
+	if err := addPlacement(filepath.Join(tempDir, "missing.json"), placement); err != nil {
+		t.Errorf("expected no error for a missing config, got %v", err)
+	}
+}
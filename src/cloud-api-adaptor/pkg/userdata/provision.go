@@ -23,6 +23,8 @@ const (
 	// Ref: https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instance-identity-documents.html
 	AWSImdsUrl         = "http://169.254.169.254/latest/dynamic/instance-identity/document"
 	AWSUserDataImdsUrl = "http://169.254.169.254/latest/user-data"
+	// Ref: https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/configuring-instance-metadata-service.html
+	AWSImdsTokenUrl = "http://169.254.169.254/latest/api/token"
 	// Ref: https://docs.microsoft.com/en-us/azure/virtual-machines/linux/instance-metadata-service
 	AzureImdsUrl         = "http://169.254.169.254/metadata/instance/compute?api-version=2021-01-01"
 	AzureUserDataImdsUrl = "http://169.254.169.254/metadata/instance/compute/userData?api-version=2021-01-01&format=text"
@@ -39,22 +41,29 @@ var WriteFilesList = []string{AACfgPath, CDHCfgPath, ForwarderCfgPath, AuthFileP
 var InitdDataFilesList = []string{AACfgPath, CDHCfgPath, PolicyPath}
 
 type Config struct {
-	fetchTimeout  int
-	digestPath    string
-	initdataPath  string
-	parentPath    string
-	writeFiles    []string
-	initdataFiles []string
+	fetchTimeout     int
+	digestPath       string
+	initdataPath     string
+	parentPath       string
+	forwarderCfgPath string
+	// The forwarder config is also written to these paths, for images expecting it elsewhere
+	forwarderCfgCopies []string
+	writeFiles         []string
+	initdataFiles      []string
 }
 
-func NewConfig(fetchTimeout int) *Config {
+// NewConfig returns the config of the provisioning. The forwarder config is written to
+// ForwarderCfgPath and to forwarderCfgCopies, all of them or none.
+func NewConfig(fetchTimeout int, forwarderCfgCopies ...string) *Config {
 	return &Config{
-		fetchTimeout:  fetchTimeout,
-		parentPath:    ConfigParent,
-		initdataPath:  InitDataPath,
-		digestPath:    DigestPath,
-		writeFiles:    WriteFilesList,
-		initdataFiles: InitdDataFilesList,
+		fetchTimeout:       fetchTimeout,
+		parentPath:         ConfigParent,
+		initdataPath:       InitDataPath,
+		digestPath:         DigestPath,
+		forwarderCfgPath:   ForwarderCfgPath,
+		forwarderCfgCopies: forwarderCfgCopies,
+		writeFiles:         WriteFilesList,
+		initdataFiles:      InitdDataFilesList,
 	}
 }
 
@@ -65,6 +74,9 @@ type WriteFile struct {
 
 type CloudConfig struct {
 	WriteFiles []WriteFile `yaml:"write_files"`
+	// UserDataURL points to the actual cloud config when it's too large for the userData,
+	// e.g. a read-only SAS URL of an Azure storage blob
+	UserDataURL string `yaml:"userdata_url,omitempty"`
 }
 
 type UserDataProvider interface {
@@ -92,7 +104,7 @@ func (a AWSUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
 	url := AWSUserDataImdsUrl
 	logger.Printf("provider: AWS, userDataUrl: %s\n", url)
 	// aws user data is not base64 encoded
-	return imdsGet(ctx, url, false, nil)
+	return awsImdsGet(ctx, AWSImdsTokenUrl, url)
 }
 
 type GCPUserDataProvider struct{ DefaultRetry }
@@ -167,6 +179,20 @@ func retrieveCloudConfig(ctx context.Context, provider UserDataProvider) (*Cloud
 			if err != nil {
 				return fmt.Errorf("failed to parse user data: %w", err)
 			}
+
+			if parsed.UserDataURL != "" {
+				logger.Printf("user data is stored out of band, fetching it\n")
+				ud, err = imdsGet(ctx, parsed.UserDataURL, false, nil)
+				if err != nil {
+					return fmt.Errorf("failed to get user data from userdata_url: %w", err)
+				}
+				if parsed, err = parseUserData(ud); err != nil {
+					return fmt.Errorf("failed to parse user data from userdata_url: %w", err)
+				}
+				if parsed.UserDataURL != "" {
+					return retry.Unrecoverable(errors.New("user data from userdata_url points to another url"))
+				}
+			}
 			cc = *parsed
 
 			// Valid user data, stop retrying
@@ -208,6 +234,98 @@ func writeFile(path string, bytes []byte) error {
 	return nil
 }
 
+// writeFilesAtomically writes bytes to all the paths or to none of them. The content is staged
+// next to each path first and then renamed over them. If a rename fails, the paths already
+// replaced get their previous content back.
+func writeFilesAtomically(paths []string, bytes []byte) error {
+	var staged []string
+	defer func() {
+		for _, tmpPath := range staged {
+			if tmpPath != "" {
+				os.Remove(tmpPath)
+			}
+		}
+	}()
+
+	seen := map[string]bool{}
+	var destinations []string
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		tmpPath, err := stageFile(path, bytes)
+		if err != nil {
+			return err
+		}
+		staged = append(staged, tmpPath)
+		destinations = append(destinations, path)
+	}
+
+	type previousFile struct {
+		path    string
+		bytes   []byte
+		existed bool
+	}
+	var replaced []previousFile
+	for i, path := range destinations {
+		previous, err := os.ReadFile(path)
+		existed := err == nil
+
+		if err := os.Rename(staged[i], path); err != nil {
+			for _, file := range replaced {
+				var restoreErr error
+				if file.existed {
+					restoreErr = os.WriteFile(file.path, file.bytes, 0644)
+				} else {
+					restoreErr = os.Remove(file.path)
+				}
+				if restoreErr != nil {
+					logger.Printf("failed to restore %s: %v\n", file.path, restoreErr)
+				}
+			}
+			return fmt.Errorf("failed to write file %s: %w", path, err)
+		}
+		staged[i] = ""
+		replaced = append(replaced, previousFile{path: path, bytes: previous, existed: existed})
+	}
+
+	for _, path := range destinations {
+		logger.Printf("Wrote %s\n", path)
+	}
+	return nil
+}
+
+// stageFile writes bytes to a temporary file in the directory of path and returns its path
+func stageFile(path string, bytes []byte) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return "", fmt.Errorf("failed to stage file %s: %w", path, err)
+	}
+	_, err = file.Write(bytes)
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to stage file %s: %w", path, err)
+	}
+	return file.Name(), nil
+}
+
+// forwarderCfgPaths returns all the paths the forwarder config is written to
+func (cfg *Config) forwarderCfgPaths() []string {
+	return append([]string{cfg.forwarderCfgPath}, cfg.forwarderCfgCopies...)
+}
+
 func isAllowed(path string, filesList []string) bool {
 	for _, listedFile := range filesList {
 		if listedFile == path {
@@ -222,7 +340,13 @@ func processCloudConfig(cfg *Config, cc *CloudConfig) error {
 		path := wf.Path
 		bytes := []byte(wf.Content)
 		if isAllowed(path, cfg.writeFiles) {
-			if err := writeFile(path, bytes); err != nil {
+			var err error
+			if path == cfg.forwarderCfgPath && len(cfg.forwarderCfgCopies) > 0 {
+				err = writeFilesAtomically(cfg.forwarderCfgPaths(), bytes)
+			} else {
+				err = writeFile(path, bytes)
+			}
+			if err != nil {
 				return fmt.Errorf("failed to write config file %s: %w", path, err)
 			}
 		} else {
@@ -317,6 +441,16 @@ func ProvisionFiles(cfg *Config) error {
 		if err = processCloudConfig(cfg, cc); err != nil {
 			return fmt.Errorf("failed to process cloud config: %w", err)
 		}
+
+		// The placement is informational, so failing to get it doesn't fail the provisioning
+		if pp, ok := provider.(PlacementProvider); ok {
+			placement, err := pp.GetPlacement(ctx)
+			if err != nil {
+				logger.Printf("failed to get the placement metadata: %v\n", err)
+			} else if err := addPlacement(cfg.forwarderCfgPath, placement, cfg.forwarderCfgCopies...); err != nil {
+				logger.Printf("failed to add the placement metadata: %v\n", err)
+			}
+		}
 	} else {
 		logger.Printf("unsupported user data provider, we extract and calculate initdata hash only.\n")
 	}
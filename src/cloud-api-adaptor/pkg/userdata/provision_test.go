@@ -319,6 +319,35 @@ write_files:
 	}
 }
 
+// TestRetrieveCloudConfigFromURL tests a cloud config stored out of band
+func TestRetrieveCloudConfigFromURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/userdata":
+			_, _ = w.Write([]byte("#cloud-config\nwrite_files:\n- path: /test\n  content: test\n"))
+		case "/loop":
+			_, _ = w.Write([]byte("userdata_url: http://127.0.0.1/loop\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	provider := TestProvider{content: "#cloud-config\nuserdata_url: \"" + srv.URL + "/userdata?sig=abc\"\n"}
+	cc, err := retrieveCloudConfig(context.TODO(), &provider)
+	if err != nil {
+		t.Fatalf("couldn't retrieve cloud config from url: %v", err)
+	}
+	if len(cc.WriteFiles) != 1 || cc.WriteFiles[0].Path != "/test" {
+		t.Fatalf("unexpected cloud config: %+v", cc)
+	}
+
+	provider = TestProvider{content: "userdata_url: " + srv.URL + "/loop\n"}
+	if _, err := retrieveCloudConfig(context.TODO(), &provider); err == nil {
+		t.Fatal("expected an error for a cloud config pointing to another url")
+	}
+}
+
 func indentTextBlock(text string, by int) string {
 	whiteSpace := strings.Repeat(" ", by)
 	split := strings.Split(text, "\n")
@@ -679,3 +708,77 @@ func TestExtractInitdataWithMalicious(t *testing.T) {
 		t.Fatalf("Should not read malicious file but got %s", string(bytes))
 	}
 }
+
+func TestProcessCloudConfigForwarderCfgCopies(t *testing.T) {
+	tempDir := t.TempDir()
+
+	apfCfgPath := filepath.Join(tempDir, "apf.json")
+	copyPath := filepath.Join(tempDir, "etc", "daemon.json")
+
+	content := fmt.Sprintf(`#cloud-config
+write_files:
+- path: %s
+  content: |
+%s
+`, apfCfgPath, indentTextBlock(testAPFConfig, 4))
+
+	cc, err := retrieveCloudConfig(context.TODO(), &TestProvider{content: content})
+	if err != nil {
+		t.Fatalf("couldn't retrieve cloud config: %v", err)
+	}
+
+	cfg := Config{
+		forwarderCfgPath:   apfCfgPath,
+		forwarderCfgCopies: []string{copyPath},
+		writeFiles:         []string{apfCfgPath},
+	}
+	if err := processCloudConfig(&cfg, cc); err != nil {
+		t.Fatalf("failed to process cloud config file: %v", err)
+	}
+
+	for _, path := range []string{apfCfgPath, copyPath} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		if string(data) != testAPFConfig {
+			t.Fatalf("file content of %s does not match apf config fixture: got %q", path, string(data))
+		}
+	}
+}
+
+func TestWriteFilesAtomicallyRollback(t *testing.T) {
+	tempDir := t.TempDir()
+
+	existingPath := filepath.Join(tempDir, "apf.json")
+	newPath := filepath.Join(tempDir, "new.json")
+	if err := os.WriteFile(existingPath, []byte("previous"), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", existingPath, err)
+	}
+	// A non-empty directory can't be replaced by a file, so the last rename fails
+	dirPath := filepath.Join(tempDir, "dir")
+	if err := os.MkdirAll(filepath.Join(dirPath, "child"), 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", dirPath, err)
+	}
+
+	if err := writeFilesAtomically([]string{existingPath, newPath, dirPath}, []byte("new")); err == nil {
+		t.Fatal("expected an error writing over a directory")
+	}
+
+	data, err := os.ReadFile(existingPath)
+	if err != nil || string(data) != "previous" {
+		t.Errorf("expected %s to be restored, got %q, %v", existingPath, string(data), err)
+	}
+	if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", newPath, err)
+	}
+
+	// No staged file is left behind
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", tempDir, err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected only apf.json and dir in %s, got %v", tempDir, entries)
+	}
+}
@@ -5,7 +5,6 @@ package agentproto
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -23,13 +22,18 @@ type Redirector interface {
 
 	Connect(ctx context.Context) error
 	Close() error
+
+	// Disconnected returns a channel that is closed when the current agent connection
+	// drops. The next call to Connect establishes a new connection.
+	Disconnected() <-chan struct{}
 }
 
 type redirector struct {
 	agentClient *client
 	ttrpcClient *ttrpc.Client
 	dialer      func(context.Context) (net.Conn, error)
-	once        sync.Once
+	closedCh    chan struct{}
+	mutex       sync.Mutex
 }
 
 type client struct {
@@ -45,38 +49,60 @@ func NewRedirector(dialer func(context.Context) (net.Conn, error)) Redirector {
 }
 
 func (s *redirector) Connect(ctx context.Context) error {
+	_, err := s.connect(ctx)
+	return err
+}
 
-	var err error
-
-	s.once.Do(func() {
-
-		conn, e := s.dialer(ctx)
-		if e != nil {
-			err = e
-			return
-		}
+// connect returns the client of the current agent connection, and dials a new one if the
+// connection is not established yet or has dropped
+func (s *redirector) connect(ctx context.Context) (*client, error) {
 
-		s.ttrpcClient = ttrpc.NewClient(conn)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-		s.agentClient = &client{
-			AgentServiceService: pb.NewAgentServiceClient(s.ttrpcClient),
-			HealthService:       pb.NewHealthClient(s.ttrpcClient),
-		}
-	})
+	if s.agentClient != nil && !isClosed(s.closedCh) {
+		return s.agentClient, nil
+	}
 
+	conn, err := s.dialer(ctx)
 	if err != nil {
-		return fmt.Errorf("agent connection is not established: %w", err)
+		return nil, fmt.Errorf("agent connection is not established: %w", err)
 	}
 
-	if s.agentClient == nil {
-		return errors.New("agent connection is not established")
+	closedCh := make(chan struct{})
+	s.closedCh = closedCh
+	s.ttrpcClient = ttrpc.NewClient(conn, ttrpc.WithOnClose(func() { close(closedCh) }))
+
+	s.agentClient = &client{
+		AgentServiceService: pb.NewAgentServiceClient(s.ttrpcClient),
+		HealthService:       pb.NewHealthClient(s.ttrpcClient),
 	}
 
-	return nil
+	return s.agentClient, nil
+}
+
+func (s *redirector) Disconnected() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// A nil channel blocks forever until the first connection is established
+	return s.closedCh
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
 }
 
 func (s *redirector) Close() error {
+	s.mutex.Lock()
 	client := s.ttrpcClient
+	s.mutex.Unlock()
+
 	if client == nil {
 		return nil
 	}
@@ -87,345 +113,388 @@ func (s *redirector) Close() error {
 
 func (s *redirector) CreateContainer(ctx context.Context, req *pb.CreateContainerRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.CreateContainer(ctx, req)
+	return agent.CreateContainer(ctx, req)
 }
 
 func (s *redirector) StartContainer(ctx context.Context, req *pb.StartContainerRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.StartContainer(ctx, req)
+	return agent.StartContainer(ctx, req)
 }
 
 func (s *redirector) RemoveContainer(ctx context.Context, req *pb.RemoveContainerRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.RemoveContainer(ctx, req)
+	return agent.RemoveContainer(ctx, req)
 }
 
 func (s *redirector) ExecProcess(ctx context.Context, req *pb.ExecProcessRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.ExecProcess(ctx, req)
+	return agent.ExecProcess(ctx, req)
 }
 
 func (s *redirector) SignalProcess(ctx context.Context, req *pb.SignalProcessRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.SignalProcess(ctx, req)
+	return agent.SignalProcess(ctx, req)
 }
 
 func (s *redirector) WaitProcess(ctx context.Context, req *pb.WaitProcessRequest) (res *pb.WaitProcessResponse, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.WaitProcess(ctx, req)
+	return agent.WaitProcess(ctx, req)
 }
 
 func (s *redirector) UpdateContainer(ctx context.Context, req *pb.UpdateContainerRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.UpdateContainer(ctx, req)
+	return agent.UpdateContainer(ctx, req)
 }
 
 func (s *redirector) UpdateEphemeralMounts(ctx context.Context, req *pb.UpdateEphemeralMountsRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.UpdateEphemeralMounts(ctx, req)
+	return agent.UpdateEphemeralMounts(ctx, req)
 }
 
 func (s *redirector) StatsContainer(ctx context.Context, req *pb.StatsContainerRequest) (res *pb.StatsContainerResponse, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.StatsContainer(ctx, req)
+	return agent.StatsContainer(ctx, req)
 }
 
 func (s *redirector) PauseContainer(ctx context.Context, req *pb.PauseContainerRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.PauseContainer(ctx, req)
+	return agent.PauseContainer(ctx, req)
 }
 
 func (s *redirector) ResumeContainer(ctx context.Context, req *pb.ResumeContainerRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.ResumeContainer(ctx, req)
+	return agent.ResumeContainer(ctx, req)
 }
 
 func (s *redirector) RemoveStaleVirtiofsShareMounts(ctx context.Context, req *pb.RemoveStaleVirtiofsShareMountsRequest) (res *emptypb.Empty, err error) {
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.RemoveStaleVirtiofsShareMounts(ctx, req)
+	return agent.RemoveStaleVirtiofsShareMounts(ctx, req)
 }
 
 func (s *redirector) WriteStdin(ctx context.Context, req *pb.WriteStreamRequest) (res *pb.WriteStreamResponse, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.WriteStdin(ctx, req)
+	return agent.WriteStdin(ctx, req)
 }
 
 func (s *redirector) ReadStdout(ctx context.Context, req *pb.ReadStreamRequest) (res *pb.ReadStreamResponse, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.ReadStdout(ctx, req)
+	return agent.ReadStdout(ctx, req)
 }
 
 func (s *redirector) ReadStderr(ctx context.Context, req *pb.ReadStreamRequest) (res *pb.ReadStreamResponse, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.ReadStderr(ctx, req)
+	return agent.ReadStderr(ctx, req)
 }
 
 func (s *redirector) CloseStdin(ctx context.Context, req *pb.CloseStdinRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.CloseStdin(ctx, req)
+	return agent.CloseStdin(ctx, req)
 }
 
 func (s *redirector) TtyWinResize(ctx context.Context, req *pb.TtyWinResizeRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.TtyWinResize(ctx, req)
+	return agent.TtyWinResize(ctx, req)
 }
 
 func (s *redirector) UpdateInterface(ctx context.Context, req *pb.UpdateInterfaceRequest) (res *protocols.Interface, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.UpdateInterface(ctx, req)
+	return agent.UpdateInterface(ctx, req)
 }
 
 func (s *redirector) UpdateRoutes(ctx context.Context, req *pb.UpdateRoutesRequest) (res *pb.Routes, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.UpdateRoutes(ctx, req)
+	return agent.UpdateRoutes(ctx, req)
 }
 
 func (s *redirector) ListInterfaces(ctx context.Context, req *pb.ListInterfacesRequest) (res *pb.Interfaces, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.ListInterfaces(ctx, req)
+	return agent.ListInterfaces(ctx, req)
 }
 
 func (s *redirector) ListRoutes(ctx context.Context, req *pb.ListRoutesRequest) (res *pb.Routes, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.ListRoutes(ctx, req)
+	return agent.ListRoutes(ctx, req)
 }
 
 func (s *redirector) AddARPNeighbors(ctx context.Context, req *pb.AddARPNeighborsRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.AddARPNeighbors(ctx, req)
+	return agent.AddARPNeighbors(ctx, req)
 }
 
 func (s *redirector) GetIPTables(ctx context.Context, req *pb.GetIPTablesRequest) (res *pb.GetIPTablesResponse, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.GetIPTables(ctx, req)
+	return agent.GetIPTables(ctx, req)
 }
 
 func (s *redirector) SetIPTables(ctx context.Context, req *pb.SetIPTablesRequest) (res *pb.SetIPTablesResponse, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.SetIPTables(ctx, req)
+	return agent.SetIPTables(ctx, req)
 }
 
 func (s *redirector) GetMetrics(ctx context.Context, req *pb.GetMetricsRequest) (res *pb.Metrics, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.GetMetrics(ctx, req)
+	return agent.GetMetrics(ctx, req)
 }
 
 func (s *redirector) MemAgentMemcgSet(ctx context.Context, req *pb.MemAgentMemcgConfig) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.MemAgentMemcgSet(ctx, req)
+	return agent.MemAgentMemcgSet(ctx, req)
 }
 
 func (s *redirector) MemAgentCompactSet(ctx context.Context, req *pb.MemAgentCompactConfig) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.MemAgentCompactSet(ctx, req)
+	return agent.MemAgentCompactSet(ctx, req)
 }
 
 func (s *redirector) CreateSandbox(ctx context.Context, req *pb.CreateSandboxRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.CreateSandbox(ctx, req)
+	return agent.CreateSandbox(ctx, req)
 }
 
 func (s *redirector) DestroySandbox(ctx context.Context, req *pb.DestroySandboxRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.DestroySandbox(ctx, req)
+	return agent.DestroySandbox(ctx, req)
 }
 
 func (s *redirector) OnlineCPUMem(ctx context.Context, req *pb.OnlineCPUMemRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.OnlineCPUMem(ctx, req)
+	return agent.OnlineCPUMem(ctx, req)
 }
 
 func (s *redirector) ReseedRandomDev(ctx context.Context, req *pb.ReseedRandomDevRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.ReseedRandomDev(ctx, req)
+	return agent.ReseedRandomDev(ctx, req)
 }
 
 func (s *redirector) GetGuestDetails(ctx context.Context, req *pb.GuestDetailsRequest) (res *pb.GuestDetailsResponse, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.GetGuestDetails(ctx, req)
+	return agent.GetGuestDetails(ctx, req)
 }
 
 func (s *redirector) MemHotplugByProbe(ctx context.Context, req *pb.MemHotplugByProbeRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.MemHotplugByProbe(ctx, req)
+	return agent.MemHotplugByProbe(ctx, req)
 }
 
 func (s *redirector) SetGuestDateTime(ctx context.Context, req *pb.SetGuestDateTimeRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.SetGuestDateTime(ctx, req)
+	return agent.SetGuestDateTime(ctx, req)
 }
 
 func (s *redirector) CopyFile(ctx context.Context, req *pb.CopyFileRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.CopyFile(ctx, req)
+	return agent.CopyFile(ctx, req)
 }
 
 func (s *redirector) GetOOMEvent(ctx context.Context, req *pb.GetOOMEventRequest) (res *pb.OOMEvent, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.GetOOMEvent(ctx, req)
+	return agent.GetOOMEvent(ctx, req)
 }
 
 func (s *redirector) AddSwap(ctx context.Context, req *pb.AddSwapRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.AddSwap(ctx, req)
+	return agent.AddSwap(ctx, req)
 }
 
 func (s *redirector) AddSwapPath(ctx context.Context, req *pb.AddSwapPathRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.AddSwapPath(ctx, req)
+	return agent.AddSwapPath(ctx, req)
 }
 
 func (s *redirector) GetVolumeStats(ctx context.Context, req *pb.VolumeStatsRequest) (res *pb.VolumeStatsResponse, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.GetVolumeStats(ctx, req)
+	return agent.GetVolumeStats(ctx, req)
 }
 
 func (s *redirector) ResizeVolume(ctx context.Context, req *pb.ResizeVolumeRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.ResizeVolume(ctx, req)
+	return agent.ResizeVolume(ctx, req)
 }
 
 func (s *redirector) SetPolicy(ctx context.Context, req *pb.SetPolicyRequest) (res *emptypb.Empty, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.SetPolicy(ctx, req)
+	return agent.SetPolicy(ctx, req)
 }
 
 // HealthService methods
 
 func (s *redirector) Check(ctx context.Context, req *pb.CheckRequest) (res *pb.HealthCheckResponse, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.Check(ctx, req)
+	return agent.Check(ctx, req)
 }
 
 func (s *redirector) Version(ctx context.Context, req *pb.CheckRequest) (res *pb.VersionCheckResponse, err error) {
 
-	if err := s.Connect(ctx); err != nil {
+	agent, err := s.connect(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return s.agentClient.Version(ctx, req)
+	return agent.Version(ctx, req)
 }
@@ -8,6 +8,14 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
 	cri "github.com/containerd/containerd/pkg/cri/annotations"
 	hypannotations "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/annotations"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	mebibyte = 1024 * 1024
+	// The CPU shares of a pod without CPU requests, as set by the kubelet
+	minCPUShares = 2
 )
 
 func GetPodName(annotations map[string]string) string {
@@ -63,8 +71,7 @@ func GetPodvmResourcesFromAnnotation(annotations map[string]string) (int64, int6
 
 	memory, ok := annotations[hypannotations.DefaultMemory]
 	if ok {
-		// Use strconv.ParseInt to convert string to int64
-		memoryInt, err = strconv.ParseInt(memory, 10, 64)
+		memoryInt, err = parseMemoryMiB(memory)
 		if err != nil {
 			fmt.Printf("Error converting memory to int64. Defaulting to 0: %v\n", err)
 			memoryInt = 0
@@ -89,6 +96,43 @@ func GetPodvmResourcesFromAnnotation(annotations map[string]string) (int64, int6
 	return vcpuInt, memoryInt, gpuInt
 }
 
+// GetPodResourcesFromAnnotation returns the aggregate resources of the pod from the sandbox
+// annotations of the CRI runtime, set by containerd since Kubernetes 1.23. The CPU is the sum
+// of the container requests, derived from the CPU shares. The CRI only passes the sum of the
+// container memory limits, which is used as the memory.
+func GetPodResourcesFromAnnotation(annotations map[string]string) v1.ResourceList {
+	resources := v1.ResourceList{}
+
+	if shares, err := strconv.ParseInt(annotations[cri.SandboxCPUShares], 10, 64); err == nil && shares > minCPUShares {
+		// The kubelet sets the shares to the millicores * 1024 / 1000
+		resources[v1.ResourceCPU] = *resource.NewMilliQuantity(shares*1000/1024, resource.DecimalSI)
+	}
+	if memory, err := strconv.ParseInt(annotations[cri.SandboxMem], 10, 64); err == nil && memory > 0 {
+		resources[v1.ResourceMemory] = *resource.NewQuantity(memory, resource.BinarySI)
+	}
+
+	return resources
+}
+
+// parseMemoryMiB parses a memory annotation in MiB. A raw integer is taken as MiB, as kata
+// does, otherwise the value is parsed as a quantity with a unit suffix, e.g. 8Gi or 512Mi,
+// and rounded up to the next MiB.
+func parseMemoryMiB(memory string) (int64, error) {
+	if mib, err := strconv.ParseInt(memory, 10, 64); err == nil {
+		return mib, nil
+	}
+
+	quantity, err := resource.ParseQuantity(memory)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory %q: %w", memory, err)
+	}
+	if quantity.Sign() < 0 {
+		return 0, fmt.Errorf("invalid memory %q: negative value", memory)
+	}
+
+	return (quantity.Value() + mebibyte - 1) / mebibyte, nil
+}
+
 // Method to get initdata from annotation. Initdata is delivered as raw
 // string by kata runtime, so we want to compress and base64 it again.
 func GetInitdataFromAnnotation(annotations map[string]string) (string, error) {
@@ -3,7 +3,10 @@ package util
 import (
 	"testing"
 
+	cri "github.com/containerd/containerd/pkg/cri/annotations"
 	hypannotations "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/annotations"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func TestGetPodvmResourcesFromAnnotation(t *testing.T) {
@@ -80,6 +83,18 @@ func TestGetPodvmResourcesFromAnnotation(t *testing.T) {
 			want1: 2048,
 			want2: 1,
 		},
+		// Add test cases with annotations for memory with a unit suffix
+		{
+			name: "memory with a unit suffix",
+			args: args{
+				annotations: map[string]string{
+					hypannotations.DefaultMemory: "8Gi",
+				},
+			},
+			want:  0,
+			want1: 8192,
+			want2: 0,
+		},
 
 		// Add test cases with annotations with invalid values
 		{
@@ -112,6 +127,109 @@ func TestGetPodvmResourcesFromAnnotation(t *testing.T) {
 	}
 }
 
+func TestParseMemoryMiB(t *testing.T) {
+	tests := []struct {
+		memory  string
+		want    int64
+		wantErr bool
+	}{
+		{memory: "8192", want: 8192},
+		{memory: "8Gi", want: 8192},
+		{memory: "512Mi", want: 512},
+		{memory: "1G", want: 954},
+		{memory: "1.5Gi", want: 1536},
+		{memory: "invalid", wantErr: true},
+		{memory: "-1Gi", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.memory, func(t *testing.T) {
+			got, err := parseMemoryMiB(tt.memory)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMemoryMiB() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseMemoryMiB() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPodResourcesFromAnnotation(t *testing.T) {
+	type args struct {
+		annotations map[string]string
+	}
+	tests := []struct {
+		name string
+		args args
+		want v1.ResourceList
+	}{
+		{
+			name: "no annotations",
+			args: args{
+				annotations: map[string]string{},
+			},
+			want: v1.ResourceList{},
+		},
+		{
+			name: "cpu and memory",
+			args: args{
+				annotations: map[string]string{
+					cri.SandboxCPUShares: "2048",
+					cri.SandboxMem:       "4294967296",
+				},
+			},
+			want: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("2"),
+				v1.ResourceMemory: resource.MustParse("4Gi"),
+			},
+		},
+		{
+			name: "millicores",
+			args: args{
+				annotations: map[string]string{
+					cri.SandboxCPUShares: "512",
+				},
+			},
+			want: v1.ResourceList{
+				v1.ResourceCPU: resource.MustParse("500m"),
+			},
+		},
+		{
+			name: "minimum cpu shares without request",
+			args: args{
+				annotations: map[string]string{
+					cri.SandboxCPUShares: "2",
+					cri.SandboxMem:       "0",
+				},
+			},
+			want: v1.ResourceList{},
+		},
+		{
+			name: "invalid values",
+			args: args{
+				annotations: map[string]string{
+					cri.SandboxCPUShares: "abc",
+					cri.SandboxMem:       "1Gi",
+				},
+			},
+			want: v1.ResourceList{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GetPodResourcesFromAnnotation(tt.args.annotations)
+			if len(got) != len(tt.want) {
+				t.Fatalf("GetPodResourcesFromAnnotation() = %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if q, ok := got[name]; !ok || q.Cmp(want) != 0 {
+					t.Errorf("GetPodResourcesFromAnnotation()[%s] = %v, want %v", name, got[name], want.String())
+				}
+			}
+		})
+	}
+}
+
 func TestGetInstanceTypeFromAnnotation(t *testing.T) {
 	type args struct {
 		annotations map[string]string
@@ -34,6 +34,7 @@ type Namespace interface {
 	RouteDel(route *Route) error
 	GetDefaultRoutes() ([]*Route, error)
 	RouteList(filters ...*Route) ([]*Route, error)
+	RouteGet(dst netip.Addr) (*Route, error)
 	RuleAdd(rule *Rule) error
 	RuleDel(rule *Rule) error
 	RuleList(rule *Rule) ([]*Rule, error)
@@ -552,31 +553,10 @@ func (ns *namespace) RouteList(filters ...*Route) ([]*Route, error) {
 		}
 
 		for _, r := range nlRoutes {
-
-			var dev string
-			if r.LinkIndex > 0 {
-				link, err := ns.handle.LinkByIndex(r.LinkIndex)
-				if err != nil {
-					return nil, fmt.Errorf("failed to get a link with index %d of a route: %w", r.LinkIndex, err)
-				}
-				dev = link.Attrs().Name
-			}
-
-			onlink := r.Flags&int(netlink.FLAG_ONLINK) != 0
-
-			route := &Route{
-				Destination: toPrefix(r.Dst),
-				Source:      toAddr(r.Src),
-				Gateway:     toAddr(r.Gw),
-				Device:      dev,
-				Priority:    r.Priority,
-				Table:       r.Table,
-				Type:        r.Type,
-				Protocol:    RouteProtocol(r.Protocol),
-				Scope:       RouteScope(r.Scope),
-				Onlink:      onlink,
+			route, err := ns.toRoute(r)
+			if err != nil {
+				return nil, err
 			}
-
 			routes = append(routes, route)
 		}
 	}
@@ -588,6 +568,47 @@ func (ns *namespace) RouteList(filters ...*Route) ([]*Route, error) {
 	return routes, nil
 }
 
+// RouteGet gets the route the kernel selects to reach dst
+func (ns *namespace) RouteGet(dst netip.Addr) (*Route, error) {
+
+	nlRoutes, err := ns.handle.RouteGet(toIP(dst))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a route to %s on namespace %q: %w", dst, ns.Path(), err)
+	}
+	if len(nlRoutes) == 0 {
+		return nil, fmt.Errorf("no route to %s on namespace %q", dst, ns.Path())
+	}
+
+	return ns.toRoute(&nlRoutes[0])
+}
+
+func (ns *namespace) toRoute(r *netlink.Route) (*Route, error) {
+
+	var dev string
+	if r.LinkIndex > 0 {
+		link, err := ns.handle.LinkByIndex(r.LinkIndex)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get a link with index %d of a route: %w", r.LinkIndex, err)
+		}
+		dev = link.Attrs().Name
+	}
+
+	onlink := r.Flags&int(netlink.FLAG_ONLINK) != 0
+
+	return &Route{
+		Destination: toPrefix(r.Dst),
+		Source:      toAddr(r.Src),
+		Gateway:     toAddr(r.Gw),
+		Device:      dev,
+		Priority:    r.Priority,
+		Table:       r.Table,
+		Type:        r.Type,
+		Protocol:    RouteProtocol(r.Protocol),
+		Scope:       RouteScope(r.Scope),
+		Onlink:      onlink,
+	}, nil
+}
+
 // Return default routes if present
 func (ns *namespace) GetDefaultRoutes() ([]*Route, error) {
 
@@ -4,6 +4,7 @@
 package netops
 
 import (
+	"net/netip"
 	"runtime"
 	"testing"
 
@@ -54,3 +55,21 @@ func TestRouteList(t *testing.T) {
 		t.Logf("Route: dst:%s, gw:%s, dev:%s, prio: %d", route.Destination.String(), route.Gateway.String(), route.Device, route.Priority)
 	}
 }
+
+func TestRouteGet(t *testing.T) {
+	testutils.SkipTestIfNotRoot(t)
+
+	ns, err := OpenCurrentNamespace()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	defer ns.Close()
+
+	route, err := ns.RouteGet(netip.MustParseAddr("127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if e, a := "lo", route.Device; e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+}
@@ -21,6 +21,11 @@ type TLSConfig struct {
 	CAData   []byte // Bytes of the PEM-encoded server trusted root certificates. Supercedes CAFile.
 	CertData []byte // Bytes of the PEM-encoded client certificate. Supercedes CertFile.
 	KeyData  []byte // Bytes of the PEM-encoded client key. Supercedes KeyFile.
+
+	// ExtraCAFile is the path of a PEM-encoded bundle whose certificates are appended to the
+	// ones of CAData or CAFile, e.g. node-local intermediate CAs. Unlike CAFile it never
+	// replaces the other CA source, and it's only valid together with one of them.
+	ExtraCAFile string
 }
 
 // HasCA returns whether the configuration has a certificate authority or not.
@@ -89,6 +94,22 @@ func rootCertPool(caData []byte) (*x509.CertPool, error) {
 	return certPool, nil
 }
 
+// appendExtraCAFile appends all the certificates of the bundle at path to certPool. Intermediate
+// CAs are added as trust anchors, so peers whose chain stops at an intermediate verify as well.
+func appendExtraCAFile(certPool *x509.CertPool, path string) error {
+	if len(path) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read extra CA bundle: %w", err)
+	}
+	if ok := certPool.AppendCertsFromPEM(data); !ok {
+		return fmt.Errorf("unable to load extra CA bundle %s: %w", path, createErrorParsingCAData(data))
+	}
+	return nil
+}
+
 // createErrorParsingCAData ALWAYS returns an error.  We call it because know we failed to AppendCertsFromPEM
 // but we don't know the specific error because that API is just true/false
 func createErrorParsingCAData(pemCerts []byte) error {
@@ -113,12 +134,15 @@ func createErrorParsingCAData(pemCerts []byte) error {
 // GetTLSConfigFor returns a tls.Config that will provide the transport level security defined
 // by the provided Config. Will return nil if no transport level security is requested.
 func GetTLSConfigFor(t *TLSConfig) (*tls.Config, error) {
-	if !(t.HasCA() || t.HasCertAuth() || t.SkipVerify) {
+	if !(t.HasCA() || t.HasCertAuth() || t.SkipVerify || len(t.ExtraCAFile) > 0) {
 		return nil, nil
 	}
 	if t.HasCA() && t.SkipVerify {
 		return nil, fmt.Errorf("specifying a root certificates file with the insecure flag is not allowed")
 	}
+	if len(t.ExtraCAFile) > 0 && !t.HasCA() {
+		return nil, fmt.Errorf("extra CA bundle %s requires root certificates to append to", t.ExtraCAFile)
+	}
 	if err := loadTLSFiles(t); err != nil {
 		return nil, err
 	}
@@ -136,6 +160,9 @@ func GetTLSConfigFor(t *TLSConfig) (*tls.Config, error) {
 		if err != nil {
 			return nil, fmt.Errorf("unable to load root certificates: %w", err)
 		}
+		if err := appendExtraCAFile(rootCAs, t.ExtraCAFile); err != nil {
+			return nil, err
+		}
 		tlsConfig.RootCAs = rootCAs
 
 		// Enable mutual authentication
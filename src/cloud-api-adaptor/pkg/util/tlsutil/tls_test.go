@@ -0,0 +1,108 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package tlsutil
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseCertificatePEM(t *testing.T, certPEM []byte) *x509.Certificate {
+	block, _ := pem.Decode(certPEM)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	return cert
+}
+
+func verifies(pool *x509.CertPool, certPEM []byte) bool {
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+	_, err = cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	return err == nil
+}
+
+func TestExtraCAFile(t *testing.T) {
+
+	userDataCA, err := NewCAService("userdata")
+	require.NoError(t, err)
+	userDataCertPEM, _, err := userDataCA.Issue("podvm-server")
+	require.NoError(t, err)
+
+	// A node-local root with an intermediate CA, of which only the intermediate is in the bundle
+	nodeRoot, err := NewCAService("node")
+	require.NoError(t, err)
+	root := nodeRoot.(*caService)
+	intermediateCertPEM, intermediateKeyPEM, err := generateCertificate("node", "", root.certPEM, root.keyPEM, false, true)
+	require.NoError(t, err)
+	require.True(t, parseCertificatePEM(t, intermediateCertPEM).IsCA)
+	nodeCertPEM, _, err := generateCertificate("node", "podvm-server", intermediateCertPEM, intermediateKeyPEM, false, false)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "bundle.pem")
+	require.NoError(t, os.WriteFile(bundle, intermediateCertPEM, 0600))
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, nodeRoot.RootCertificate(), 0600))
+
+	t.Run("appended to CAData", func(t *testing.T) {
+		tlsConfig, err := GetTLSConfigFor(&TLSConfig{CAData: userDataCA.RootCertificate(), ExtraCAFile: bundle})
+		require.NoError(t, err)
+
+		assert.True(t, verifies(tlsConfig.ClientCAs, userDataCertPEM))
+		assert.True(t, verifies(tlsConfig.ClientCAs, nodeCertPEM))
+		assert.True(t, verifies(tlsConfig.RootCAs, nodeCertPEM))
+	})
+
+	t.Run("without extra CA file", func(t *testing.T) {
+		tlsConfig, err := GetTLSConfigFor(&TLSConfig{CAData: userDataCA.RootCertificate()})
+		require.NoError(t, err)
+
+		assert.True(t, verifies(tlsConfig.ClientCAs, userDataCertPEM))
+		assert.False(t, verifies(tlsConfig.ClientCAs, nodeCertPEM))
+	})
+
+	t.Run("CAData supersedes CAFile", func(t *testing.T) {
+		tlsConfig, err := GetTLSConfigFor(&TLSConfig{CAData: userDataCA.RootCertificate(), CAFile: caFile})
+		require.NoError(t, err)
+
+		assert.True(t, verifies(tlsConfig.ClientCAs, userDataCertPEM))
+		assert.False(t, verifies(tlsConfig.ClientCAs, nodeCertPEM))
+	})
+
+	t.Run("appended to CAFile", func(t *testing.T) {
+		tlsConfig, err := GetTLSConfigFor(&TLSConfig{CAFile: caFile, ExtraCAFile: bundle})
+		require.NoError(t, err)
+
+		assert.False(t, verifies(tlsConfig.ClientCAs, userDataCertPEM))
+		assert.True(t, verifies(tlsConfig.ClientCAs, nodeCertPEM))
+	})
+
+	t.Run("without CA", func(t *testing.T) {
+		_, err := GetTLSConfigFor(&TLSConfig{ExtraCAFile: bundle})
+		assert.ErrorContains(t, err, "requires root certificates")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := GetTLSConfigFor(&TLSConfig{CAData: userDataCA.RootCertificate(), ExtraCAFile: filepath.Join(dir, "missing.pem")})
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid bundle", func(t *testing.T) {
+		invalid := filepath.Join(dir, "invalid.pem")
+		require.NoError(t, os.WriteFile(invalid, []byte("not a certificate"), 0600))
+
+		_, err := GetTLSConfigFor(&TLSConfig{CAData: userDataCA.RootCertificate(), ExtraCAFile: invalid})
+		assert.ErrorContains(t, err, "unable to load extra CA bundle")
+	})
+}
@@ -351,9 +351,10 @@ func (p *alibabaCloudProvider) CreateInstance(ctx context.Context, podName, sand
 	}
 
 	instance := &provider.Instance{
-		ID:   instanceID,
-		Name: instanceName,
-		IPs:  ips,
+		ID:    instanceID,
+		Name:  instanceName,
+		IPs:   ips,
+		State: provider.InstanceStateRunning,
 	}
 
 	return instance, nil
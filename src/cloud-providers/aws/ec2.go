@@ -10,11 +10,47 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
-// TODO: Use IAM role
+// The session name of the assumed role, which identifies the adaptor in CloudTrail
+const roleSessionName = "cloud-api-adaptor"
+
+// NewEC2Client returns a client using the static credentials, if set, or the shared profile
 func NewEC2Client(cloudCfg Config) (*ec2.Client, error) {
+	cfg, err := loadConfig(cloudCfg)
+	if err != nil {
+		return nil, err
+	}
+	return ec2.NewFromConfig(cfg), nil
+}
+
+// NewEC2ClientWithSTS returns a client using the credentials of the role RoleARN, assumed
+// with the static credentials or the shared profile, e.g. to manage the instances of another
+// account. The credentials are refreshed before they expire.
+func NewEC2ClientWithSTS(cloudCfg Config) (*ec2.Client, error) {
+	if cloudCfg.RoleARN == "" {
+		return nil, fmt.Errorf("a role ARN is required to use STS")
+	}
+
+	cfg, err := loadConfig(cloudCfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Credentials = aws.NewCredentialsCache(newAssumeRoleProvider(sts.NewFromConfig(cfg), cloudCfg.RoleARN))
+	return ec2.NewFromConfig(cfg), nil
+}
+
+func newAssumeRoleProvider(client stscreds.AssumeRoleAPIClient, roleARN string) *stscreds.AssumeRoleProvider {
+	return stscreds.NewAssumeRoleProvider(client, roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = roleSessionName
+	})
+}
+
+// loadConfig loads the AWS config with the static credentials, if set, or the shared profile
+func loadConfig(cloudCfg Config) (aws.Config, error) {
 
 	var cfg aws.Config
 	var err error
@@ -23,7 +59,7 @@ func NewEC2Client(cloudCfg Config) (*ec2.Client, error) {
 		cfg, err = config.LoadDefaultConfig(context.TODO(),
 			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cloudCfg.AccessKeyId, cloudCfg.SecretKey, cloudCfg.SessionToken)), config.WithRegion(cloudCfg.Region))
 		if err != nil {
-			return nil, fmt.Errorf("configuration error when using creds: %s", err)
+			return cfg, fmt.Errorf("configuration error when using creds: %s", err)
 		}
 
 	} else {
@@ -32,9 +68,8 @@ func NewEC2Client(cloudCfg Config) (*ec2.Client, error) {
 			config.WithRegion(cloudCfg.Region),
 			config.WithSharedConfigProfile(cloudCfg.LoginProfile))
 		if err != nil {
-			return nil, fmt.Errorf("configuration error when using shared profile: %s", err)
+			return cfg, fmt.Errorf("configuration error when using shared profile: %s", err)
 		}
 	}
-	client := ec2.NewFromConfig(cfg)
-	return client, nil
+	return cfg, nil
 }
@@ -0,0 +1,57 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package aws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// mockSTSClient records the AssumeRole input
+type mockSTSClient struct {
+	input *sts.AssumeRoleInput
+}
+
+func (m *mockSTSClient) AssumeRole(ctx context.Context, params *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	m.input = params
+	return &sts.AssumeRoleOutput{
+		Credentials: &types.Credentials{
+			AccessKeyId:     aws.String("assumed-access-key"),
+			SecretAccessKey: aws.String("assumed-secret-key"),
+			SessionToken:    aws.String("assumed-session-token"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+func TestNewAssumeRoleProvider(t *testing.T) {
+	roleARN := "arn:aws:iam::123456789012:role/peerpods"
+	client := &mockSTSClient{}
+
+	creds, err := newAssumeRoleProvider(client, roleARN).Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+
+	if got := aws.ToString(client.input.RoleArn); got != roleARN {
+		t.Errorf("AssumeRole() RoleArn = %q, want %q", got, roleARN)
+	}
+	if got := aws.ToString(client.input.RoleSessionName); got != roleSessionName {
+		t.Errorf("AssumeRole() RoleSessionName = %q, want %q", got, roleSessionName)
+	}
+	if creds.AccessKeyID != "assumed-access-key" {
+		t.Errorf("Retrieve() AccessKeyID = %q, want the assumed role credentials", creds.AccessKeyID)
+	}
+}
+
+func TestNewEC2ClientWithSTSNoRole(t *testing.T) {
+	if _, err := NewEC2ClientWithSTS(Config{UseSTS: true, Region: "us-east-1"}); err == nil {
+		t.Error("NewEC2ClientWithSTS() error = nil, want an error without a role ARN")
+	}
+}
@@ -47,7 +47,7 @@ func (r MetadataRetriever) get(path string) (string, error) {
 
 func retrieveMissingConfig(cfg *Config) error {
 	mdr := newMetadataRetriever()
-	if cfg.SubnetId == "" {
+	if cfg.SubnetId == "" && len(cfg.SubnetIds) == 0 {
 		logger.Printf("SubnetId was not provided, trying to fetch it from IMDS")
 		subnetIdPath := fmt.Sprintf("network/interfaces/macs/%s/subnet-id", mdr.mac)
 		subnetId, err := mdr.get(subnetIdPath)
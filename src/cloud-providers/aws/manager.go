@@ -7,6 +7,7 @@ import (
 	"flag"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 )
 
 var awscfg Config
@@ -24,6 +25,8 @@ func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
 	flags.StringVar(&awscfg.SessionToken, "aws-session-token", "", "Session Token, defaults to `AWS_SESSION_TOKEN`")
 	flags.StringVar(&awscfg.Region, "aws-region", "", "Region")
 	flags.StringVar(&awscfg.LoginProfile, "aws-profile", "", "AWS Login Profile")
+	flags.BoolVar(&awscfg.UseSTS, "use-sts", false, "Assume the role -role-arn with STS to manage the Pod VMs, using the access key or the profile")
+	flags.StringVar(&awscfg.RoleARN, "role-arn", "", "ARN of the role assumed with -use-sts, e.g. in the account of the Pod VMs")
 	flags.StringVar(&awscfg.LaunchTemplateName, "aws-lt-name", "kata", "AWS Launch Template Name")
 	flags.BoolVar(&awscfg.UseLaunchTemplate, "use-lt", false, "Use EC2 Launch Template for the Pod VMs")
 	flags.StringVar(&awscfg.ImageId, "imageid", "", "Pod VM ami id")
@@ -31,15 +34,28 @@ func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
 	flags.Var(&awscfg.SecurityGroupIds, "securitygroupids", "Security Group Ids to be used for the Pod VM, comma separated")
 	flags.StringVar(&awscfg.KeyName, "keyname", "", "SSH Keypair name to be used with the Pod VM")
 	flags.StringVar(&awscfg.SubnetId, "subnetid", "", "Subnet ID to be used for the Pod VMs")
+	flags.Var(&awscfg.SubnetIds, "subnetids", "Subnet IDs to be used for the Pod VMs, comma separated, tried in order when the availability zone of a subnet lacks capacity. Takes precedence over -subnetid")
 	// Add a List parameter to indicate differet type of instance types to be used for the Pod VMs
 	flags.Var(&awscfg.InstanceTypes, "instance-types", "Instance types to be used for the Pod VMs, comma separated")
 	// Add a key value list parameter to indicate custom tags to be used for the Pod VMs
 	flags.Var(&awscfg.Tags, "tags", "Custom tags (key=value pairs) to be used for the Pod VMs, comma separated")
+	flags.StringVar(&awscfg.TagPrefix, "tag-prefix", provider.PodTagPrefix, "Prefix of the tags recording the pod name, namespace and sandbox ID of the Pod VMs")
 	flags.BoolVar(&awscfg.UsePublicIP, "use-public-ip", false, "Use Public IP for connecting to the kata-agent inside the Pod VM")
 	// Add a parameter to indicate the root volume size for the Pod VMs
 	// Default is 30GiBs for free tier. Hence use it as default
 	flags.IntVar(&awscfg.RootVolumeSize, "root-volume-size", 30, "Root volume size (in GiB) for the Pod VMs")
+	flags.StringVar(&awscfg.RootVolumeType, "root-volume-type", "", "Root volume type for the Pod VMs, e.g. gp3 or io2. Default is gp3")
+	flags.IntVar(&awscfg.RootVolumeIops, "root-volume-iops", 0, "Provisioned IOPS of the root volume, required for the io1 and io2 volume types")
 	flags.BoolVar(&awscfg.DisableCVM, "disable-cvm", false, "Use non-CVMs for peer pods")
+	flags.StringVar(&awscfg.UserDataFormat, "userdata-format", cloudinit.UserDataFormatCloudInit, "Format of the Pod VM userData, cloud-init or ignition")
+	flags.BoolVar(&awscfg.UseSpotInstances, "use-spot-instances", false, "Launch the Pod VMs as spot instances, which AWS can interrupt")
+	flags.IntVar(&awscfg.RunInstancesAttempts, "run-instances-attempts", 3, "Maximum number of RunInstances calls to create a Pod VM, retrying on transient and capacity errors")
+	flags.DurationVar(&awscfg.RunInstancesRetryDelay, "run-instances-retry-delay", provider.DefaultRetryInitialDelay, "Delay before the first RunInstances retry, doubled on each retry")
+	flags.DurationVar(&awscfg.InstanceReadyTimeout, "instance-ready-timeout", maxWaitTime, "Maximum time to wait for a Pod VM to be running, e.g. before reading its private IP or attaching a NIC")
+	flags.BoolVar(&awscfg.RequireIMDSv2, "require-imdsv2", false, "Require IMDSv2 session tokens for the instance metadata requests of the Pod VMs")
+	flags.StringVar(&awscfg.PlacementGroupName, "placement-group-name", "", "Name of the placement group to launch the Pod VMs in")
+	flags.StringVar(&awscfg.IAMInstanceProfile, "iam-instance-profile", "", "Name or ARN of the IAM instance profile of the Pod VMs")
+	flags.StringVar(&awscfg.SpotMaxPrice, "spot-max-price", "", "Maximum hourly price in USD of the spot instances, defaults to the on-demand price")
 
 }
 
@@ -33,7 +33,12 @@ func TestManager_ParseCmd(t *testing.T) {
 				"-instance-types=t2.micro,t3.small",
 				"-tags=key1=value1,key2=value2",
 				"-root-volume-size=60",
+				"-root-volume-type=io2",
+				"-root-volume-iops=5000",
 				"-disable-cvm=false",
+				"-userdata-format=ignition",
+				"-use-sts=true",
+				"-role-arn=arn:aws:iam::123456789012:role/peerpods",
 			},
 			expected: Config{
 				AccessKeyId:        "test-access-key",
@@ -51,7 +56,12 @@ func TestManager_ParseCmd(t *testing.T) {
 				Tags:               map[string]string{"key1": "value1", "key2": "value2"},
 				UsePublicIP:        true,
 				RootVolumeSize:     60,
+				RootVolumeType:     "io2",
+				RootVolumeIops:     5000,
 				DisableCVM:         false,
+				UserDataFormat:     "ignition",
+				UseSTS:             true,
+				RoleARN:            "arn:aws:iam::123456789012:role/peerpods",
 			},
 		},
 		{
@@ -74,6 +84,7 @@ func TestManager_ParseCmd(t *testing.T) {
 				UsePublicIP:        false,
 				RootVolumeSize:     30,
 				DisableCVM:         false,
+				UserDataFormat:     "cloud-init",
 			},
 		},
 	}
@@ -228,11 +239,38 @@ func comparestructs(expected, actual Config) bool {
 		return false
 	}
 
+	if expected.RootVolumeType != actual.RootVolumeType {
+		// Print the expected and actual values to the console if they do not match
+		fmt.Printf("Expected RootVolumeType: %s, but got: %s\n", expected.RootVolumeType, actual.RootVolumeType)
+		return false
+	}
+
+	if expected.RootVolumeIops != actual.RootVolumeIops {
+		// Print the expected and actual values to the console if they do not match
+		fmt.Printf("Expected RootVolumeIops: %d, but got: %d\n", expected.RootVolumeIops, actual.RootVolumeIops)
+		return false
+	}
+
 	if expected.DisableCVM != actual.DisableCVM {
 		// Print the expected and actual values to the console if they do not match
 		fmt.Printf("Expected DisableCVM: %t, but got: %t\n", expected.DisableCVM, actual.DisableCVM)
 		return false
 	}
+	if expected.UserDataFormat != actual.UserDataFormat {
+		// Print the expected and actual values to the console if they do not match
+		fmt.Printf("Expected UserDataFormat: %s, but got: %s\n", expected.UserDataFormat, actual.UserDataFormat)
+		return false
+	}
+	if expected.UseSTS != actual.UseSTS {
+		// Print the expected and actual values to the console if they do not match
+		fmt.Printf("Expected UseSTS: %t, but got: %t\n", expected.UseSTS, actual.UseSTS)
+		return false
+	}
+	if expected.RoleARN != actual.RoleARN {
+		// Print the expected and actual values to the console if they do not match
+		fmt.Printf("Expected RoleARN: %s, but got: %s\n", expected.RoleARN, actual.RoleARN)
+		return false
+	}
 
 	return true
 }
@@ -5,16 +5,22 @@ package aws
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	smithyrand "github.com/aws/smithy-go/rand"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
@@ -36,6 +42,9 @@ const (
 	maxInstanceNameLen = 63
 	maxWaitTime        = 120 * time.Second
 	maxInt32           = 1<<31 - 1
+
+	// How long terminating an instance that failed to get ready may take
+	terminateTimeout = 2 * time.Minute
 )
 
 // Make ec2Client a mockable interface
@@ -102,6 +111,11 @@ type awsProvider struct {
 	// Make waiter a mockable interface
 	waiter        instanceRunningWaiter
 	serviceConfig *Config
+	// Instances that may not be visible to TerminateInstances yet
+	recentInstances *provider.RecentInstances
+	// Worker node the adaptor runs on, tagged on the instances for Reconcile
+	nodeName string
+	clock    provider.Clock // nil uses the system clock
 }
 
 func NewProvider(config *Config) (provider.Provider, error) {
@@ -111,7 +125,12 @@ func NewProvider(config *Config) (provider.Provider, error) {
 		logger.Printf("Failed to retrieve configuration, some fields may still be missing: %v", err)
 	}
 
-	ec2Client, err := NewEC2Client(*config)
+	newEC2Client := NewEC2Client
+	if config.UseSTS {
+		logger.Printf("Assuming role %s with STS", config.RoleARN)
+		newEC2Client = NewEC2ClientWithSTS
+	}
+	ec2Client, err := newEC2Client(*config)
 	if err != nil {
 		return nil, err
 	}
@@ -119,13 +138,16 @@ func NewProvider(config *Config) (provider.Provider, error) {
 	waiter := ec2.NewInstanceRunningWaiter(ec2Client)
 
 	provider := &awsProvider{
-		ec2Client:     ec2Client,
-		waiter:        waiter,
-		serviceConfig: config,
+		ec2Client:       ec2Client,
+		waiter:          waiter,
+		serviceConfig:   config,
+		recentInstances: provider.NewRecentInstances(provider.DefaultNotFoundRetryWindow),
+		nodeName:        os.Getenv("NODE_NAME"),
 	}
 
-	// If root volume size is set, then get the device name from the AMI and update the serviceConfig
-	if config.RootVolumeSize > 0 {
+	// If root volume size or type is set, then get the device name from the AMI and update the serviceConfig.
+	// The launch template defines its own root volume.
+	if !config.UseLaunchTemplate && (config.RootVolumeSize > 0 || config.RootVolumeType != "") {
 		// Get the device name from the AMI
 		deviceName, deviceSize, err := provider.getDeviceNameAndSize(config.ImageId)
 		if err != nil {
@@ -182,19 +204,103 @@ func getIPs(instance types.Instance) ([]netip.Addr, error) {
 	return podNodeIPs, nil
 }
 
+// instanceIPs returns the private IPs of a new instance and the instance they were read from.
+// RunInstances returns some instance types before their private IP is assigned, the IPs are then
+// described once the instance is running.
+func (p *awsProvider) instanceIPs(ctx context.Context, instance types.Instance) ([]netip.Addr, types.Instance, error) {
+	ips, err := getIPs(instance)
+	if !errors.Is(err, errNotReady) {
+		return ips, instance, err
+	}
+
+	instanceID := aws.ToString(instance.InstanceId)
+	logger.Printf("instance %s has no private IP yet, waiting for it to be running", instanceID)
+
+	describeInstanceInput := &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	}
+	if err := p.waiter.Wait(ctx, describeInstanceInput, p.instanceReadyTimeout()); err != nil {
+		return nil, instance, fmt.Errorf("waiting for instance %s to be running: %w", instanceID, err)
+	}
+
+	var output *ec2.DescribeInstancesOutput
+	err = provider.WithCloudRetry(ctx, func(ctx context.Context) error {
+		var err error
+		output, err = p.ec2Client.DescribeInstances(ctx, describeInstanceInput)
+		return err
+	}, provider.RetryOptions{
+		Retryable: newInstanceRetryClassifier.Retryable,
+		Timer:     p.getClock(),
+	})
+	if err != nil {
+		return nil, instance, fmt.Errorf("describing instance %s: %w", instanceID, err)
+	}
+	if len(output.Reservations) == 0 || len(output.Reservations[0].Instances) == 0 {
+		return nil, instance, fmt.Errorf("describing instance %s: %w", instanceID, errNotReady)
+	}
+
+	described := output.Reservations[0].Instances[0]
+	ips, err = getIPs(described)
+	return ips, described, err
+}
+
+// instanceReadyTimeout returns how long to wait for an instance to be running
+func (p *awsProvider) instanceReadyTimeout() time.Duration {
+	if p.serviceConfig.InstanceReadyTimeout <= 0 {
+		return maxWaitTime
+	}
+	return p.serviceConfig.InstanceReadyTimeout
+}
+
+// getInstanceState maps the EC2 instance state to the provider instance state.
+// RunInstances reports new instances as pending, which is also assumed when the state is missing.
+func getInstanceState(instance types.Instance) string {
+	if instance.State == nil {
+		return provider.InstanceStatePending
+	}
+
+	switch instance.State.Name {
+	case types.InstanceStateNameRunning:
+		return provider.InstanceStateRunning
+	case types.InstanceStateNameStopping, types.InstanceStateNameStopped:
+		return provider.InstanceStateStopped
+	case types.InstanceStateNameShuttingDown, types.InstanceStateNameTerminated:
+		return provider.InstanceStateTerminated
+	default:
+		return provider.InstanceStatePending
+	}
+}
+
 func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
 	// Public IP address
 	var publicIPAddr netip.Addr
 
 	instanceName := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
 
-	cloudConfigData, err := cloudConfig.Generate()
+	pod := provider.PodIdentityFromContext(ctx)
+	if pod.Name == "" {
+		pod.Name = podName
+	}
+	if pod.SandboxID == "" {
+		pod.SandboxID = sandboxID
+	}
+	ctx = provider.WithPodIdentity(ctx, pod)
+
+	userDataGenerator, err := cloudinit.NewUserDataGenerator(p.serviceConfig.UserDataFormat, cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudConfigData, err := userDataGenerator.Generate()
 	if err != nil {
 		return nil, err
 	}
 
 	// Convert userData to base64
-	b64EncData := base64.StdEncoding.EncodeToString([]byte(cloudConfigData))
+	b64EncData, err := provider.UserDataEncoder{MaxSize: provider.AWSUserDataMaxSize}.Encode(cloudConfigData)
+	if err != nil {
+		return nil, err
+	}
 
 	instanceType, err := p.selectInstanceType(ctx, spec)
 	if err != nil {
@@ -208,6 +314,13 @@ func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 		},
 	}
 
+	if p.nodeName != "" {
+		instanceTags = append(instanceTags, types.Tag{
+			Key:   aws.String(provider.NodeNameTag),
+			Value: aws.String(p.nodeName),
+		})
+	}
+
 	// Add custom tags (k=v) from serviceConfig.Tags to the instance
 	for k, v := range p.serviceConfig.Tags {
 		instanceTags = append(instanceTags, types.Tag{
@@ -215,6 +328,7 @@ func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 			Value: aws.String(v),
 		})
 	}
+	instanceTags = append(instanceTags, p.podTags(ctx)...)
 
 	// Create TagSpecifications for the instance
 	tagSpecifications := []types.TagSpecification{
@@ -291,34 +405,79 @@ func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 		}
 	}
 
-	// Add block device mappings to the instance to set the root volume size
-	if p.serviceConfig.RootVolumeSize > 0 {
+	// Add block device mappings to the instance to set the root volume size and type.
+	// The launch template defines its own root volume.
+	if !p.serviceConfig.UseLaunchTemplate && p.serviceConfig.RootDeviceName != "" {
 		input.BlockDeviceMappings = []types.BlockDeviceMapping{
 			{
 				DeviceName: aws.String(p.serviceConfig.RootDeviceName),
-				Ebs: &types.EbsBlockDevice{
-					// We have already ensured RootVolumeSize is not more than max int32 in NewProvider
-					// Hence we can safely convert it to int32
-					VolumeSize: aws.Int32(int32(p.serviceConfig.RootVolumeSize)),
-				},
+				Ebs:        p.rootVolume(),
 			},
 		}
 	}
 
+	if p.serviceConfig.UseSpotInstances {
+		input.InstanceMarketOptions = p.spotMarketOptions()
+	}
+
+	// Also overrides the metadata options of the launch template
+	if p.serviceConfig.RequireIMDSv2 {
+		input.MetadataOptions = &types.InstanceMetadataOptionsRequest{
+			HttpTokens:   types.HttpTokensStateRequired,
+			HttpEndpoint: types.InstanceMetadataEndpointStateEnabled,
+		}
+	}
+
+	if p.serviceConfig.PlacementGroupName != "" {
+		input.Placement = &types.Placement{
+			GroupName: aws.String(p.serviceConfig.PlacementGroupName),
+		}
+	}
+
+	if profile := p.serviceConfig.IAMInstanceProfile; profile != "" {
+		input.IamInstanceProfile = &types.IamInstanceProfileSpecification{}
+		if strings.HasPrefix(profile, "arn:") {
+			input.IamInstanceProfile.Arn = aws.String(profile)
+		} else {
+			input.IamInstanceProfile.Name = aws.String(profile)
+		}
+	}
+
 	logger.Printf("Creating instance %s for sandbox %s", instanceName, sandboxID)
 
-	result, err := p.ec2Client.RunInstances(ctx, input)
+	start := p.getClock().Now()
+	var result *ec2.RunInstancesOutput
+	clientTokens := map[string]string{}
+	err = provider.WithCloudRetry(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = p.runInstancesInSubnets(ctx, instanceName, input, clientTokens)
+		if err != nil && isRetryableRunInstancesError(err) {
+			logger.Printf("creating instance %s failed, retrying unless out of attempts: %v", instanceName, err)
+		}
+		return err
+	}, provider.RetryOptions{
+		Attempts:     max(1, p.serviceConfig.RunInstancesAttempts),
+		InitialDelay: p.serviceConfig.RunInstancesRetryDelay,
+		Retryable:    isRetryableRunInstancesError,
+		Timer:        p.getClock(),
+	})
 	if err != nil {
+		if p.serviceConfig.UseSpotInstances && isSpotCapacityError(err) {
+			return nil, fmt.Errorf("%w: no spot capacity for instance %s of type %s: %w", provider.ErrCapacityUnavailable, instanceName, instanceType, err)
+		}
 		return nil, fmt.Errorf("creating instance %s (%v): %w", instanceName, result, err)
 	}
 
 	instanceID := *result.Instances[0].InstanceId
+	p.recentInstances.Add(instanceID)
 
 	logger.Printf("Created instance %s (%s) for sandbox %s", instanceName, instanceID, sandboxID)
 
-	ips, err := getIPs(result.Instances[0])
+	ips, launched, err := p.instanceIPs(ctx, result.Instances[0])
 	if err != nil {
 		logger.Printf("Failed to get IPs for instance %s: %v ", instanceID, err)
+		// Nothing tracks the instance yet, it would be left running
+		p.terminateLaunched(ctx, instanceID)
 		return nil, err
 	}
 
@@ -334,7 +493,12 @@ func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 	}
 
 	if spec.MultiNic {
-		nIfaceId, err := p.createAddonNICforInstance(ctx, instanceID)
+		// The NIC must be in the availability zone of the instance
+		subnetID := aws.ToString(launched.SubnetId)
+		if subnetID == "" {
+			subnetID = p.subnets()[0]
+		}
+		nIfaceId, err := p.createAddonNICforInstance(ctx, instanceID, subnetID)
 		if err != nil {
 			return nil, err
 		}
@@ -348,14 +512,30 @@ func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 	}
 
 	instance := &provider.Instance{
-		ID:   instanceID,
-		Name: instanceName,
-		IPs:  ips,
+		ID:    instanceID,
+		Name:  instanceName,
+		IPs:   ips,
+		State: getInstanceState(launched),
+	}
+	if placement := launched.Placement; placement != nil {
+		instance.Zone = aws.ToString(placement.AvailabilityZone)
 	}
+	instance.CreationDuration = p.getClock().Now().Sub(start)
 
 	return instance, nil
 }
 
+// terminateLaunched terminates, best-effort, an instance that CreateInstance launched but fails
+// to return. The context of the create may be done, e.g. after a timeout, so it isn't used.
+func (p *awsProvider) terminateLaunched(ctx context.Context, instanceID string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), terminateTimeout)
+	defer cancel()
+
+	if err := p.DeleteInstance(ctx, instanceID); err != nil {
+		logger.Printf("failed to terminate instance %s, it must be terminated manually: %v", instanceID, err)
+	}
+}
+
 func (p *awsProvider) DeleteInstance(ctx context.Context, instanceID string) error {
 
 	err := p.deleteElasticIPforInstance(ctx, instanceID)
@@ -371,9 +551,15 @@ func (p *awsProvider) DeleteInstance(ctx context.Context, instanceID string) err
 
 	logger.Printf("Deleting instance %s", instanceID)
 
-	resp, err := p.ec2Client.TerminateInstances(ctx, terminateInput)
+	// EC2 is eventually consistent, so a just created instance can be reported as not found
+	err = p.recentInstances.DeleteWithNotFoundRetry(ctx, instanceID, func(ctx context.Context) error {
+		resp, err := p.ec2Client.TerminateInstances(ctx, terminateInput)
+		if err != nil && !isInstanceNotFoundError(err) {
+			logger.Printf("failed to delete instance %v: %v and the response is %v", instanceID, err, resp)
+		}
+		return err
+	}, isInstanceNotFoundError)
 	if err != nil {
-		logger.Printf("failed to delete instance %v: %v and the response is %v", instanceID, err, resp)
 		return err
 	}
 
@@ -382,6 +568,159 @@ func (p *awsProvider) DeleteInstance(ctx context.Context, instanceID string) err
 	return nil
 }
 
+// spotMarketOptions requests a one-time spot instance, terminated when interrupted
+func (p *awsProvider) spotMarketOptions() *types.InstanceMarketOptionsRequest {
+	options := &types.InstanceMarketOptionsRequest{
+		MarketType: types.MarketTypeSpot,
+		SpotOptions: &types.SpotMarketOptions{
+			SpotInstanceType:             types.SpotInstanceTypeOneTime,
+			InstanceInterruptionBehavior: types.InstanceInterruptionBehaviorTerminate,
+		},
+	}
+	if p.serviceConfig.SpotMaxPrice != "" {
+		options.SpotOptions.MaxPrice = aws.String(p.serviceConfig.SpotMaxPrice)
+	}
+	return options
+}
+
+// subnets returns the subnets of the instances in order of preference
+func (p *awsProvider) subnets() []string {
+	if len(p.serviceConfig.SubnetIds) > 0 {
+		return p.serviceConfig.SubnetIds
+	}
+	return []string{p.serviceConfig.SubnetId}
+}
+
+// runInstancesInSubnets calls RunInstances in each subnet in turn, until the availability zone
+// of one has the capacity for the instance. With a launch template, the subnet of the template
+// is used.
+//
+// The SDK sets the client token of input on the first call and keeps it, but AWS rejects a token
+// reused with another subnet. Each subnet therefore gets its own token in clientTokens, which the
+// retries of the caller reuse, so that a retried request doesn't launch a second instance.
+func (p *awsProvider) runInstancesInSubnets(ctx context.Context, instanceName string, input *ec2.RunInstancesInput, clientTokens map[string]string) (*ec2.RunInstancesOutput, error) {
+	if p.serviceConfig.UseLaunchTemplate {
+		return p.ec2Client.RunInstances(ctx, input)
+	}
+
+	subnets := p.subnets()
+	for i, subnet := range subnets {
+		// With a public IP, the subnet is set on the network interface
+		if len(input.NetworkInterfaces) > 0 {
+			input.NetworkInterfaces[0].SubnetId = aws.String(subnet)
+		} else {
+			input.SubnetId = aws.String(subnet)
+		}
+
+		token, ok := clientTokens[subnet]
+		if !ok {
+			var err error
+			if token, err = smithyrand.NewUUID(smithyrand.Reader).GetUUID(); err != nil {
+				return nil, fmt.Errorf("generating a client token: %w", err)
+			}
+			clientTokens[subnet] = token
+		}
+		input.ClientToken = aws.String(token)
+
+		result, err := p.ec2Client.RunInstances(ctx, input)
+		if err == nil || i == len(subnets)-1 || !isZonalCapacityError(err) {
+			return result, err
+		}
+		logger.Printf("no capacity in subnet %s for instance %s, trying subnet %s: %v", subnet, instanceName, subnets[i+1], err)
+	}
+	return nil, errors.New("no subnet configured")
+}
+
+// isZonalCapacityError returns whether err reports the lack of capacity for the instance type in
+// an availability zone, which may be available in another zone or later
+func isZonalCapacityError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.ErrorCode() == "InsufficientInstanceCapacity" || apiErr.ErrorCode() == "InsufficientHostCapacity"
+}
+
+// isRetryableRunInstancesError returns whether RunInstances may succeed if called again: the
+// transient errors, and the lack of capacity for the instance type, which AWS recommends retrying
+func isRetryableRunInstancesError(err error) bool {
+	return isZonalCapacityError(err) || provider.DefaultRetryClassifier.Retryable(err)
+}
+
+// getClock returns the clock of the provider, the system clock if unset
+func (p *awsProvider) getClock() provider.Clock {
+	if p.clock == nil {
+		return provider.RealClock{}
+	}
+	return p.clock
+}
+
+// newInstanceRetryClassifier classifies the errors of describing an instance RunInstances just
+// returned, which EC2 may not report yet: the not found errors are eventual consistency there only
+var newInstanceRetryClassifier = provider.DefaultRetryClassifier.WithCodes(map[string]provider.RetryClass{
+	"InvalidInstanceID.NotFound": provider.RetryClassEventualConsistency,
+})
+
+// isSpotCapacityError returns whether err is a spot request that can't be fulfilled now,
+// for which an on-demand instance may still be launched
+func isSpotCapacityError(err error) bool {
+	return provider.DefaultRetryClassifier.Classify(err) == provider.RetryClassCapacity
+}
+
+// isInstanceNotFoundError returns true when the EC2 API reports that the instance doesn't exist
+func isInstanceNotFoundError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidInstanceID.NotFound"
+}
+
+// DeleteInstanceByName terminates the instances whose Name tag is name
+func (p *awsProvider) DeleteInstanceByName(ctx context.Context, name string) error {
+	input := &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag:Name"),
+				Values: []string{name},
+			},
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running", "stopping", "stopped"},
+			},
+		},
+	}
+
+	var instanceIDs []string
+	for {
+		output, err := p.ec2Client.DescribeInstances(ctx, input)
+		if err != nil {
+			return fmt.Errorf("finding instance %s: %w", name, err)
+		}
+		for _, reservation := range output.Reservations {
+			for _, instance := range reservation.Instances {
+				if id := aws.ToString(instance.InstanceId); id != "" {
+					instanceIDs = append(instanceIDs, id)
+				}
+			}
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	if len(instanceIDs) == 0 {
+		logger.Printf("No instance named %s, assuming it is already deleted", name)
+		return nil
+	}
+
+	var errs []error
+	for _, instanceID := range instanceIDs {
+		if err := p.DeleteInstance(ctx, instanceID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (p *awsProvider) Teardown() error {
 	return nil
 }
@@ -390,7 +729,24 @@ func (p *awsProvider) ConfigVerifier() error {
 	if len(p.serviceConfig.ImageId) == 0 {
 		return errNoImageID
 	}
-	return nil
+	if p.serviceConfig.SpotMaxPrice != "" {
+		if price, err := strconv.ParseFloat(p.serviceConfig.SpotMaxPrice, 64); err != nil || price <= 0 {
+			return fmt.Errorf("invalid spot max price %q, expected a price in USD", p.serviceConfig.SpotMaxPrice)
+		}
+	}
+	if volumeType := types.VolumeType(p.serviceConfig.RootVolumeType); volumeType != "" {
+		if !slices.Contains(volumeType.Values(), volumeType) {
+			return fmt.Errorf("invalid root volume type %q, expected one of %v", volumeType, volumeType.Values())
+		}
+		if (volumeType == types.VolumeTypeIo1 || volumeType == types.VolumeTypeIo2) && p.serviceConfig.RootVolumeIops <= 0 {
+			return fmt.Errorf("root volume type %s requires the provisioned IOPS", volumeType)
+		}
+	}
+	// The aws: prefix is reserved for the tags set by AWS
+	if strings.HasPrefix(strings.ToLower(p.serviceConfig.TagPrefix), "aws:") {
+		return fmt.Errorf("invalid tag prefix %q, the aws: prefix is reserved", p.serviceConfig.TagPrefix)
+	}
+	return cloudinit.ValidateUserDataFormat(p.serviceConfig.UserDataFormat)
 }
 
 // Add SelectInstanceType method to select an instance type based on the memory and vcpu requirements
@@ -475,7 +831,7 @@ func (p *awsProvider) getPublicIP(ctx context.Context, instanceID string) (netip
 	}
 
 	// Wait for instance to be ready before getting the public IP address
-	if err := p.waiter.Wait(ctx, describeInstanceInput, maxWaitTime); err != nil {
+	if err := p.waiter.Wait(ctx, describeInstanceInput, p.instanceReadyTimeout()); err != nil {
 		logger.Printf("failed to wait for instance %s to be ready: %v", instanceID, err)
 		return netip.Addr{}, err
 	}
@@ -504,24 +860,67 @@ func (p *awsProvider) getPublicIP(ctx context.Context, instanceID string) (netip
 	return netip.ParseAddr(*publicIP)
 }
 
+// rootVolume returns the EBS settings of the root volume, of type gp3 unless configured
+func (p *awsProvider) rootVolume() *types.EbsBlockDevice {
+	volumeType := types.VolumeTypeGp3
+	if p.serviceConfig.RootVolumeType != "" {
+		volumeType = types.VolumeType(p.serviceConfig.RootVolumeType)
+	}
+
+	ebs := &types.EbsBlockDevice{
+		VolumeType: volumeType,
+	}
+	if p.serviceConfig.RootVolumeSize > 0 {
+		// We have already ensured RootVolumeSize is not more than max int32 in NewProvider
+		// Hence we can safely convert it to int32
+		ebs.VolumeSize = aws.Int32(int32(p.serviceConfig.RootVolumeSize))
+	}
+	if p.serviceConfig.RootVolumeIops > 0 {
+		ebs.Iops = aws.Int32(int32(min(p.serviceConfig.RootVolumeIops, maxInt32)))
+	}
+	return ebs
+}
+
+// podTags returns the tags recording the pod of ctx, for cost attribution and debugging.
+// The keys use TagPrefix if set, and the tags set by the user take precedence.
+func (p *awsProvider) podTags(ctx context.Context) []types.Tag {
+	podTags := provider.PodIdentityFromContext(ctx).Tags()
+
+	var tags []types.Tag
+	for _, k := range slices.Sorted(maps.Keys(podTags)) {
+		key := k
+		if p.serviceConfig.TagPrefix != "" {
+			key = p.serviceConfig.TagPrefix + strings.TrimPrefix(k, provider.PodTagPrefix)
+		}
+		if _, ok := p.serviceConfig.Tags[key]; ok {
+			continue
+		}
+		tags = append(tags, types.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(podTags[k]),
+		})
+	}
+	return tags
+}
+
 // Create a NIC and attach it to the instance
-func (p *awsProvider) createAddonNICforInstance(ctx context.Context, instanceID string) (nIfaceId *string, err error) {
+func (p *awsProvider) createAddonNICforInstance(ctx context.Context, instanceID, subnetID string) (nIfaceId *string, err error) {
 	// Create network interface
 	// Add create network interface input
 	nicName := fmt.Sprintf("nic-%s", instanceID)
 	createNetworkInterfaceInput := &ec2.CreateNetworkInterfaceInput{
-		SubnetId: aws.String(p.serviceConfig.SubnetId),
+		SubnetId: aws.String(subnetID),
 		Groups:   p.serviceConfig.SecurityGroupIds,
 
 		TagSpecifications: []types.TagSpecification{
 			{
 				ResourceType: types.ResourceTypeNetworkInterface,
-				Tags: []types.Tag{
+				Tags: append([]types.Tag{
 					{
 						Key:   aws.String("Name"),
 						Value: aws.String(nicName),
 					},
-				},
+				}, p.podTags(ctx)...),
 			},
 		},
 	}
@@ -537,7 +936,7 @@ func (p *awsProvider) createAddonNICforInstance(ctx context.Context, instanceID
 	describeInstanceInput := &ec2.DescribeInstancesInput{
 		InstanceIds: []string{instanceID},
 	}
-	err = p.waiter.Wait(ctx, describeInstanceInput, maxWaitTime)
+	err = p.waiter.Wait(ctx, describeInstanceInput, p.instanceReadyTimeout())
 	if err != nil {
 		logger.Printf("failed to wait for the instance to be ready : %v ", err)
 		return nil, err
@@ -614,7 +1013,7 @@ func (p *awsProvider) createElasticIPforInstance(ctx context.Context, instanceID
 	describeInstanceInput := &ec2.DescribeInstancesInput{
 		InstanceIds: []string{instanceID},
 	}
-	err = p.waiter.Wait(ctx, describeInstanceInput, maxWaitTime)
+	err = p.waiter.Wait(ctx, describeInstanceInput, p.instanceReadyTimeout())
 	if err != nil {
 		logger.Printf("failed to wait for the instance to be ready : %v ", err)
 		return err
@@ -5,6 +5,8 @@ package aws
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/netip"
 	"reflect"
@@ -14,7 +16,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/providertest"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 )
 
@@ -38,6 +42,8 @@ func (m mockEC2Client) RunInstances(ctx context.Context,
 		Instances: []types.Instance{
 			{
 				InstanceId: &mockInstanceID,
+				State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+				Placement:  &types.Placement{AvailabilityZone: aws.String("us-east-1a")},
 				// Add public DNS name
 				PublicDnsName: aws.String("ec2-192-168-100-1.compute-1.amazonaws.com"),
 				// Add private IP address to mock instance
@@ -62,6 +68,56 @@ func (m mockEC2Client) TerminateInstances(ctx context.Context,
 	return &ec2.TerminateInstancesOutput{}, nil
 }
 
+// Mock EC2 API for an instance that no longer exists
+type mockEC2ClientInstanceNotFound struct {
+	mockEC2Client
+}
+
+func (m mockEC2ClientInstanceNotFound) TerminateInstances(ctx context.Context,
+	params *ec2.TerminateInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+
+	return nil, &smithy.GenericAPIError{
+		Code:    "InvalidInstanceID.NotFound",
+		Message: fmt.Sprintf("The instance ID '%s' does not exist", params.InstanceIds[0]),
+	}
+}
+
+// Mock EC2 API that doesn't see a just created instance on the first terminate call
+type mockEC2ClientEventuallyConsistent struct {
+	mockEC2Client
+	calls *int
+}
+
+func (m mockEC2ClientEventuallyConsistent) TerminateInstances(ctx context.Context,
+	params *ec2.TerminateInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+
+	*m.calls++
+	if *m.calls == 1 {
+		return nil, &smithy.GenericAPIError{
+			Code:    "InvalidInstanceID.NotFound",
+			Message: fmt.Sprintf("The instance ID '%s' does not exist", params.InstanceIds[0]),
+		}
+	}
+	return &ec2.TerminateInstancesOutput{}, nil
+}
+
+// Mock EC2 API failing to terminate an instance
+type mockEC2ClientTerminateFailure struct {
+	mockEC2Client
+}
+
+func (m mockEC2ClientTerminateFailure) TerminateInstances(ctx context.Context,
+	params *ec2.TerminateInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+
+	return nil, &smithy.GenericAPIError{
+		Code:    "UnauthorizedOperation",
+		Message: "You are not authorized to perform this operation",
+	}
+}
+
 // Create a mock EC2 DescribeInstanceTypes method
 func (m mockEC2Client) DescribeInstanceTypes(ctx context.Context,
 	params *ec2.DescribeInstanceTypesInput,
@@ -386,9 +442,11 @@ func TestCreateInstance(t *testing.T) {
 				spec:        provider.InstanceTypeSpec{InstanceType: "t2.small"},
 			},
 			want: &provider.Instance{
-				ID:   "i-1234567890abcdef0",
-				Name: "podvm-podtest-123",
-				IPs:  []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				ID:    "i-1234567890abcdef0",
+				Name:  "podvm-podtest-123",
+				IPs:   []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				State: provider.InstanceStatePending,
+				Zone:  "us-east-1a",
 			},
 			// Test should not return an error
 			wantErr: false,
@@ -413,9 +471,11 @@ func TestCreateInstance(t *testing.T) {
 				spec:        provider.InstanceTypeSpec{InstanceType: "t2.small"},
 			},
 			want: &provider.Instance{
-				ID:   "i-1234567890abcdef0",
-				Name: "podvm-podpublicip-123",
-				IPs:  []netip.Addr{netip.MustParseAddr("192.168.100.1")},
+				ID:    "i-1234567890abcdef0",
+				Name:  "podvm-podpublicip-123",
+				IPs:   []netip.Addr{netip.MustParseAddr("192.168.100.1")},
+				State: provider.InstanceStatePending,
+				Zone:  "us-east-1a",
 			},
 			// Test should not return an error
 			wantErr: false,
@@ -486,9 +546,11 @@ func TestCreateInstance(t *testing.T) {
 				spec:        provider.InstanceTypeSpec{InstanceType: ""},
 			},
 			want: &provider.Instance{
-				ID:   "i-1234567890abcdef0",
-				Name: "podvm-podemptyinstance-123",
-				IPs:  []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				ID:    "i-1234567890abcdef0",
+				Name:  "podvm-podemptyinstance-123",
+				IPs:   []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				State: provider.InstanceStatePending,
+				Zone:  "us-east-1a",
 			},
 			// Test should not return an error
 			wantErr: false,
@@ -514,9 +576,11 @@ func TestCreateInstance(t *testing.T) {
 				spec:        provider.InstanceTypeSpec{InstanceType: ""},
 			},
 			want: &provider.Instance{
-				ID:   "i-1234567890abcdef0",
-				Name: "podvm-podemptyinstance-123",
-				IPs:  []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				ID:    "i-1234567890abcdef0",
+				Name:  "podvm-podemptyinstance-123",
+				IPs:   []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				State: provider.InstanceStatePending,
+				Zone:  "us-east-1a",
 			},
 			// Test should not return an error
 			wantErr: false,
@@ -530,6 +594,7 @@ func TestCreateInstance(t *testing.T) {
 				ec2Client:     tt.fields.ec2Client,
 				waiter:        tt.fields.waiter,
 				serviceConfig: tt.fields.serviceConfig,
+				clock:         providertest.NewFakeClock(),
 			}
 
 			got, err := p.CreateInstance(tt.args.ctx, tt.args.podName, tt.args.sandboxID, tt.args.cloudConfig, tt.args.spec)
@@ -537,6 +602,11 @@ func TestCreateInstance(t *testing.T) {
 				t.Errorf("awsProvider.CreateInstance() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if got != nil {
+				if got.FromPool {
+					t.Errorf("awsProvider.CreateInstance() FromPool = true, want a fresh instance")
+				}
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("awsProvider.CreateInstance() = %v, want %v", got, tt.want)
 			}
@@ -544,6 +614,820 @@ func TestCreateInstance(t *testing.T) {
 	}
 }
 
+// Mock EC2 client recording the userData of the instances it runs
+type mockEC2ClientUserData struct {
+	mockEC2Client
+	userData *string
+}
+
+func (m mockEC2ClientUserData) RunInstances(ctx context.Context,
+	params *ec2.RunInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+
+	*m.userData = aws.ToString(params.UserData)
+	return m.mockEC2Client.RunInstances(ctx, params, optFns...)
+}
+
+// Mock EC2 client recording the tags of the instances it runs
+type mockEC2ClientTags struct {
+	mockEC2Client
+	tags map[string]string
+}
+
+func (m mockEC2ClientTags) RunInstances(ctx context.Context,
+	params *ec2.RunInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+
+	for _, spec := range params.TagSpecifications {
+		for _, tag := range spec.Tags {
+			m.tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
+	return m.mockEC2Client.RunInstances(ctx, params, optFns...)
+}
+
+func TestCreateInstancePodTags(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		tags      map[string]string
+		tagPrefix string
+		want      map[string]string
+	}{
+		{
+			name: "pod identity",
+			ctx:  provider.WithPodIdentity(context.Background(), provider.PodIdentity{Name: "web-0", Namespace: "team-a", SandboxID: "abc"}),
+			want: map[string]string{provider.PodNameTag: "web-0", provider.PodNamespaceTag: "team-a", provider.PodSandboxTag: "abc"},
+		},
+		{
+			name: "no pod identity",
+			ctx:  context.Background(),
+			want: map[string]string{provider.PodNameTag: "podtest", provider.PodSandboxTag: "123"},
+		},
+		{
+			name: "user tags first",
+			ctx:  provider.WithPodNamespace(context.Background(), "team-a"),
+			tags: map[string]string{provider.PodNamespaceTag: "billing"},
+			want: map[string]string{provider.PodNameTag: "podtest", provider.PodNamespaceTag: "billing", provider.PodSandboxTag: "123"},
+		},
+		{
+			name:      "tag prefix",
+			ctx:       provider.WithPodIdentity(context.Background(), provider.PodIdentity{Name: "web-0", Namespace: "team-a", SandboxID: "abc"}),
+			tagPrefix: "acme:peerpod.",
+			want:      map[string]string{"acme:peerpod.pod": "web-0", "acme:peerpod.namespace": "team-a", "acme:peerpod.sandbox": "abc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := *serviceConfig
+			config.Tags = tt.tags
+			config.TagPrefix = tt.tagPrefix
+
+			client := mockEC2ClientTags{tags: map[string]string{}}
+			p := &awsProvider{
+				ec2Client:     client,
+				waiter:        newMockAWSInstanceWaiter(),
+				serviceConfig: &config,
+			}
+
+			if _, err := p.CreateInstance(tt.ctx, "podtest", "123", &mockCloudConfig{}, provider.InstanceTypeSpec{InstanceType: "t2.small"}); err != nil {
+				t.Fatalf("awsProvider.CreateInstance() error = %v", err)
+			}
+			for k, v := range tt.want {
+				if got := client.tags[k]; got != v {
+					t.Errorf("tag %s = %q, want %q", k, got, v)
+				}
+			}
+			for _, k := range []string{provider.PodNameTag, provider.PodNamespaceTag, provider.PodSandboxTag} {
+				if _, ok := tt.want[k]; !ok {
+					if got, ok := client.tags[k]; ok {
+						t.Errorf("tag %s = %q, want no tag", k, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+// Mock EC2 client recording the input of the instances it runs, failing with err if set
+type mockEC2ClientRunInput struct {
+	mockEC2Client
+	input **ec2.RunInstancesInput
+	err   error
+}
+
+func (m mockEC2ClientRunInput) RunInstances(ctx context.Context,
+	params *ec2.RunInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+
+	*m.input = params
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.mockEC2Client.RunInstances(ctx, params, optFns...)
+}
+
+// wantSpot checks the spot market options of a RunInstances input
+func wantSpot(maxPrice *string) func(*testing.T, *ec2.RunInstancesInput) {
+	return func(t *testing.T, input *ec2.RunInstancesInput) {
+		options := input.InstanceMarketOptions
+		if options == nil || options.MarketType != types.MarketTypeSpot || options.SpotOptions == nil {
+			t.Fatalf("InstanceMarketOptions = %+v, want spot options", options)
+		}
+		if options.SpotOptions.SpotInstanceType != types.SpotInstanceTypeOneTime {
+			t.Errorf("SpotInstanceType = %v, want %v", options.SpotOptions.SpotInstanceType, types.SpotInstanceTypeOneTime)
+		}
+		if !reflect.DeepEqual(options.SpotOptions.MaxPrice, maxPrice) {
+			t.Errorf("MaxPrice = %v, want %v", aws.ToString(options.SpotOptions.MaxPrice), aws.ToString(maxPrice))
+		}
+	}
+}
+
+// wantRootVolume checks the root volume mapping of a RunInstances input, which must have none if
+// want is nil
+func wantRootVolume(want *types.EbsBlockDevice) func(*testing.T, *ec2.RunInstancesInput) {
+	return func(t *testing.T, input *ec2.RunInstancesInput) {
+		if want == nil {
+			if input.BlockDeviceMappings != nil {
+				t.Errorf("BlockDeviceMappings = %v, want none", input.BlockDeviceMappings)
+			}
+			return
+		}
+		if len(input.BlockDeviceMappings) != 1 {
+			t.Fatalf("BlockDeviceMappings = %v, want the root volume", input.BlockDeviceMappings)
+		}
+		if got := aws.ToString(input.BlockDeviceMappings[0].DeviceName); got != "/dev/xvda" {
+			t.Errorf("DeviceName = %q, want /dev/xvda", got)
+		}
+		if got := input.BlockDeviceMappings[0].Ebs; !reflect.DeepEqual(got, want) {
+			t.Errorf("Ebs = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestCreateInstanceRunInput(t *testing.T) {
+	imdsv2 := &types.InstanceMetadataOptionsRequest{
+		HttpTokens:   types.HttpTokensStateRequired,
+		HttpEndpoint: types.InstanceMetadataEndpointStateEnabled,
+	}
+
+	tests := []struct {
+		name   string
+		config func(*Config)
+		check  func(*testing.T, *ec2.RunInstancesInput)
+	}{
+		{
+			name:   "default",
+			config: func(c *Config) {},
+			check: func(t *testing.T, input *ec2.RunInstancesInput) {
+				if input.InstanceMarketOptions != nil {
+					t.Errorf("InstanceMarketOptions = %+v, want none for on-demand instances", input.InstanceMarketOptions)
+				}
+				if input.BlockDeviceMappings != nil {
+					t.Errorf("BlockDeviceMappings = %v, want none", input.BlockDeviceMappings)
+				}
+				if input.MetadataOptions != nil {
+					t.Errorf("MetadataOptions = %+v, want none", input.MetadataOptions)
+				}
+				if input.Placement != nil {
+					t.Errorf("Placement = %+v, want none", input.Placement)
+				}
+				if input.IamInstanceProfile != nil {
+					t.Errorf("IamInstanceProfile = %+v, want none", input.IamInstanceProfile)
+				}
+			},
+		},
+		{
+			name:   "spot",
+			config: func(c *Config) { c.UseSpotInstances = true },
+			check:  wantSpot(nil),
+		},
+		{
+			name: "spot with max price",
+			config: func(c *Config) {
+				c.UseSpotInstances = true
+				c.SpotMaxPrice = "0.05"
+			},
+			check: wantSpot(aws.String("0.05")),
+		},
+		{
+			name: "root volume of the default type",
+			config: func(c *Config) {
+				c.RootDeviceName = "/dev/xvda"
+				c.RootVolumeSize = 30
+			},
+			check: wantRootVolume(&types.EbsBlockDevice{VolumeType: types.VolumeTypeGp3, VolumeSize: aws.Int32(30)}),
+		},
+		{
+			name: "io2 root volume",
+			config: func(c *Config) {
+				c.RootDeviceName = "/dev/xvda"
+				c.RootVolumeSize = 100
+				c.RootVolumeType = "io2"
+				c.RootVolumeIops = 5000
+			},
+			check: wantRootVolume(&types.EbsBlockDevice{VolumeType: types.VolumeTypeIo2, VolumeSize: aws.Int32(100), Iops: aws.Int32(5000)}),
+		},
+		{
+			name: "root volume of the image size",
+			config: func(c *Config) {
+				c.RootDeviceName = "/dev/xvda"
+				c.RootVolumeType = "gp2"
+			},
+			check: wantRootVolume(&types.EbsBlockDevice{VolumeType: types.VolumeTypeGp2}),
+		},
+		{
+			name: "root volume with launch template",
+			config: func(c *Config) {
+				c.RootDeviceName = "/dev/xvda"
+				c.RootVolumeSize = 30
+				c.RootVolumeType = "io2"
+				c.RootVolumeIops = 5000
+				c.UseLaunchTemplate = true
+				c.LaunchTemplateName = "kata"
+			},
+			check: wantRootVolume(nil),
+		},
+		{
+			name:   "IMDSv2 required",
+			config: func(c *Config) { c.RequireIMDSv2 = true },
+			check: func(t *testing.T, input *ec2.RunInstancesInput) {
+				if !reflect.DeepEqual(input.MetadataOptions, imdsv2) {
+					t.Errorf("MetadataOptions = %+v, want %+v", input.MetadataOptions, imdsv2)
+				}
+			},
+		},
+		{
+			name: "IMDSv2 required with launch template",
+			config: func(c *Config) {
+				c.RequireIMDSv2 = true
+				c.UseLaunchTemplate = true
+				c.LaunchTemplateName = "kata"
+			},
+			check: func(t *testing.T, input *ec2.RunInstancesInput) {
+				if !reflect.DeepEqual(input.MetadataOptions, imdsv2) {
+					t.Errorf("MetadataOptions = %+v, want %+v", input.MetadataOptions, imdsv2)
+				}
+			},
+		},
+		{
+			name:   "placement group",
+			config: func(c *Config) { c.PlacementGroupName = "low-latency" },
+			check: func(t *testing.T, input *ec2.RunInstancesInput) {
+				want := &types.Placement{GroupName: aws.String("low-latency")}
+				if !reflect.DeepEqual(input.Placement, want) {
+					t.Errorf("Placement = %+v, want %+v", input.Placement, want)
+				}
+			},
+		},
+		{
+			name:   "instance profile name",
+			config: func(c *Config) { c.IAMInstanceProfile = "peerpod-secrets" },
+			check: func(t *testing.T, input *ec2.RunInstancesInput) {
+				want := &types.IamInstanceProfileSpecification{Name: aws.String("peerpod-secrets")}
+				if !reflect.DeepEqual(input.IamInstanceProfile, want) {
+					t.Errorf("IamInstanceProfile = %+v, want %+v", input.IamInstanceProfile, want)
+				}
+			},
+		},
+		{
+			name:   "instance profile ARN",
+			config: func(c *Config) { c.IAMInstanceProfile = "arn:aws:iam::123456789012:instance-profile/peerpod-secrets" },
+			check: func(t *testing.T, input *ec2.RunInstancesInput) {
+				want := &types.IamInstanceProfileSpecification{Arn: aws.String("arn:aws:iam::123456789012:instance-profile/peerpod-secrets")}
+				if !reflect.DeepEqual(input.IamInstanceProfile, want) {
+					t.Errorf("IamInstanceProfile = %+v, want %+v", input.IamInstanceProfile, want)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := *serviceConfig
+			tt.config(&config)
+
+			var input *ec2.RunInstancesInput
+			p := &awsProvider{
+				ec2Client:     mockEC2ClientRunInput{input: &input},
+				waiter:        newMockAWSInstanceWaiter(),
+				serviceConfig: &config,
+			}
+
+			if _, err := p.CreateInstance(context.Background(), "podtest", "123", &mockCloudConfig{}, provider.InstanceTypeSpec{InstanceType: "t2.small"}); err != nil {
+				t.Fatalf("awsProvider.CreateInstance() error = %v", err)
+			}
+
+			tt.check(t, input)
+		})
+	}
+}
+
+func TestCreateInstanceSpotCapacity(t *testing.T) {
+	config := *serviceConfig
+	config.UseSpotInstances = true
+
+	var input *ec2.RunInstancesInput
+	p := &awsProvider{
+		ec2Client: mockEC2ClientRunInput{
+			input: &input,
+			err:   &smithy.GenericAPIError{Code: "InsufficientInstanceCapacity", Message: "no spot capacity"},
+		},
+		waiter:        newMockAWSInstanceWaiter(),
+		serviceConfig: &config,
+	}
+
+	_, err := p.CreateInstance(context.Background(), "podtest", "123", &mockCloudConfig{}, provider.InstanceTypeSpec{InstanceType: "t2.small"})
+	if !errors.Is(err, provider.ErrCapacityUnavailable) {
+		t.Errorf("awsProvider.CreateInstance() error = %v, want %v", err, provider.ErrCapacityUnavailable)
+	}
+}
+
+// Mock EC2 client failing the RunInstances calls with errs, in order, then succeeding
+type mockEC2ClientFlaky struct {
+	mockEC2Client
+	errs  []error
+	calls *int
+}
+
+func (m mockEC2ClientFlaky) RunInstances(ctx context.Context,
+	params *ec2.RunInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+
+	*m.calls++
+	if *m.calls <= len(m.errs) {
+		return nil, m.errs[*m.calls-1]
+	}
+	return m.mockEC2Client.RunInstances(ctx, params, optFns...)
+}
+
+func TestCreateInstanceRetry(t *testing.T) {
+	capacityErr := &smithy.GenericAPIError{Code: "InsufficientInstanceCapacity", Message: "no capacity"}
+	throttledErr := &smithy.GenericAPIError{Code: "RequestLimitExceeded", Message: "slow down"}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "succeeds after a capacity error",
+			errs:      []error{capacityErr},
+			wantCalls: 2,
+		},
+		{
+			name:      "succeeds after throttling",
+			errs:      []error{throttledErr, capacityErr},
+			wantCalls: 3,
+		},
+		{
+			name:      "out of attempts",
+			errs:      []error{capacityErr, capacityErr, capacityErr},
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			name:      "not retryable",
+			errs:      []error{&smithy.GenericAPIError{Code: "UnauthorizedOperation", Message: "denied"}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := *serviceConfig
+			config.RunInstancesAttempts = 3
+			config.RunInstancesRetryDelay = 5 * time.Second
+
+			calls := 0
+			clock := &providertest.FakeClock{AutoAdvance: true}
+			p := &awsProvider{
+				ec2Client:     mockEC2ClientFlaky{errs: tt.errs, calls: &calls},
+				waiter:        newMockAWSInstanceWaiter(),
+				serviceConfig: &config,
+				clock:         clock,
+			}
+
+			instance, err := p.CreateInstance(context.Background(), "podtest", "123", &mockCloudConfig{}, provider.InstanceTypeSpec{InstanceType: "t2.small"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("awsProvider.CreateInstance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("RunInstances called %d times, want %d", calls, tt.wantCalls)
+			}
+			waits := clock.Waits()
+			if len(waits) != tt.wantCalls-1 {
+				t.Fatalf("waited %d times, want %d", len(waits), tt.wantCalls-1)
+			}
+			if len(waits) > 0 && waits[0] < config.RunInstancesRetryDelay {
+				t.Errorf("first retry after %v, want at least %v", waits[0], config.RunInstancesRetryDelay)
+			}
+
+			// The creation took the retry delays, the clock only moved for them
+			if instance != nil {
+				var want time.Duration
+				for _, wait := range waits {
+					want += wait
+				}
+				if instance.CreationDuration != want {
+					t.Errorf("CreationDuration = %v, want %v", instance.CreationDuration, want)
+				}
+			}
+		})
+	}
+}
+
+// Mock EC2 client failing RunInstances with the error of the subnet, if any, and recording the
+// subnets it was called with
+type mockEC2ClientSubnets struct {
+	mockEC2Client
+	errs    map[string]error
+	subnets *[]string
+	tokens  *[]string
+}
+
+func (m mockEC2ClientSubnets) RunInstances(ctx context.Context,
+	params *ec2.RunInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+
+	subnet := aws.ToString(params.SubnetId)
+	if len(params.NetworkInterfaces) > 0 {
+		subnet = aws.ToString(params.NetworkInterfaces[0].SubnetId)
+	}
+	*m.subnets = append(*m.subnets, subnet)
+	if m.tokens != nil {
+		*m.tokens = append(*m.tokens, aws.ToString(params.ClientToken))
+	}
+	if err := m.errs[subnet]; err != nil {
+		return nil, err
+	}
+	return m.mockEC2Client.RunInstances(ctx, params, optFns...)
+}
+
+func TestCreateInstanceSubnetFailover(t *testing.T) {
+	capacityErr := &smithy.GenericAPIError{Code: "InsufficientInstanceCapacity", Message: "no capacity"}
+
+	tests := []struct {
+		name        string
+		subnetIds   []string
+		usePublicIP bool
+		errs        map[string]error
+		wantSubnets []string
+		wantErr     bool
+	}{
+		{
+			name:        "second subnet",
+			subnetIds:   []string{"subnet-a", "subnet-b", "subnet-c"},
+			errs:        map[string]error{"subnet-a": capacityErr},
+			wantSubnets: []string{"subnet-a", "subnet-b"},
+		},
+		{
+			name:        "second subnet with public IP",
+			subnetIds:   []string{"subnet-a", "subnet-b"},
+			usePublicIP: true,
+			errs:        map[string]error{"subnet-a": capacityErr},
+			wantSubnets: []string{"subnet-a", "subnet-b"},
+		},
+		{
+			name:        "no capacity in any subnet",
+			subnetIds:   []string{"subnet-a", "subnet-b"},
+			errs:        map[string]error{"subnet-a": capacityErr, "subnet-b": capacityErr},
+			wantSubnets: []string{"subnet-a", "subnet-b"},
+			wantErr:     true,
+		},
+		{
+			name:        "not a capacity error",
+			subnetIds:   []string{"subnet-a", "subnet-b"},
+			errs:        map[string]error{"subnet-a": &smithy.GenericAPIError{Code: "UnauthorizedOperation", Message: "denied"}},
+			wantSubnets: []string{"subnet-a"},
+			wantErr:     true,
+		},
+		{
+			name:        "single subnet",
+			wantSubnets: []string{serviceConfig.SubnetId},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := *serviceConfig
+			config.SubnetIds = tt.subnetIds
+			config.UsePublicIP = tt.usePublicIP
+
+			var subnets []string
+			p := &awsProvider{
+				ec2Client:     mockEC2ClientSubnets{errs: tt.errs, subnets: &subnets},
+				waiter:        newMockAWSInstanceWaiter(),
+				serviceConfig: &config,
+			}
+
+			_, err := p.CreateInstance(context.Background(), "podtest", "123", &mockCloudConfig{}, provider.InstanceTypeSpec{InstanceType: "t2.small"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("awsProvider.CreateInstance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(subnets, tt.wantSubnets) {
+				t.Errorf("RunInstances called in subnets %v, want %v", subnets, tt.wantSubnets)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceSubnetClientTokens(t *testing.T) {
+	capacityErr := &smithy.GenericAPIError{Code: "InsufficientInstanceCapacity", Message: "no capacity"}
+
+	config := *serviceConfig
+	config.SubnetIds = []string{"subnet-a", "subnet-b"}
+	config.RunInstancesAttempts = 2
+
+	var subnets, tokens []string
+	p := &awsProvider{
+		ec2Client:     mockEC2ClientSubnets{errs: map[string]error{"subnet-a": capacityErr, "subnet-b": capacityErr}, subnets: &subnets, tokens: &tokens},
+		waiter:        newMockAWSInstanceWaiter(),
+		serviceConfig: &config,
+		clock:         &providertest.FakeClock{AutoAdvance: true},
+	}
+
+	if _, err := p.CreateInstance(context.Background(), "podtest", "123", &mockCloudConfig{}, provider.InstanceTypeSpec{InstanceType: "t2.small"}); err == nil {
+		t.Fatal("CreateInstance() error = nil, want the capacity error")
+	}
+
+	// Each subnet has its own token, reused when retrying in the same subnet
+	if want := []string{"subnet-a", "subnet-b", "subnet-a", "subnet-b"}; !reflect.DeepEqual(subnets, want) {
+		t.Fatalf("RunInstances called in subnets %v, want %v", subnets, want)
+	}
+	if tokens[0] == "" || tokens[0] == tokens[1] {
+		t.Errorf("expected a distinct client token per subnet, got %v", tokens)
+	}
+	if tokens[0] != tokens[2] || tokens[1] != tokens[3] {
+		t.Errorf("expected the retries to reuse the client token of the subnet, got %v", tokens)
+	}
+}
+
+func TestConfigVerifierSpotMaxPrice(t *testing.T) {
+	for price, wantErr := range map[string]bool{"": false, "0.05": false, "0": true, "cheap": true} {
+		config := *serviceConfig
+		config.SpotMaxPrice = price
+		p := &awsProvider{serviceConfig: &config}
+
+		if err := p.ConfigVerifier(); (err != nil) != wantErr {
+			t.Errorf("ConfigVerifier() with spot max price %q error = %v, wantErr %v", price, err, wantErr)
+		}
+	}
+}
+
+// Mock EC2 API returning a new instance before its private IP is assigned
+type mockEC2ClientPendingIP struct {
+	mockEC2Client
+	describeCalls *int
+	terminated    *[]string
+	// notFound is the number of DescribeInstances calls not seeing the instance yet
+	notFound int
+}
+
+func (m mockEC2ClientPendingIP) TerminateInstances(ctx context.Context,
+	params *ec2.TerminateInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+
+	*m.terminated = append(*m.terminated, params.InstanceIds...)
+	return m.mockEC2Client.TerminateInstances(ctx, params, optFns...)
+}
+
+func (m mockEC2ClientPendingIP) RunInstances(ctx context.Context,
+	params *ec2.RunInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+
+	return &ec2.RunInstancesOutput{
+		Instances: []types.Instance{
+			{
+				InstanceId:        aws.String("i-1234567890abcdef0"),
+				State:             &types.InstanceState{Name: types.InstanceStateNamePending},
+				NetworkInterfaces: []types.InstanceNetworkInterface{{}},
+			},
+		},
+	}, nil
+}
+
+func (m mockEC2ClientPendingIP) DescribeInstances(ctx context.Context,
+	params *ec2.DescribeInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+
+	*m.describeCalls++
+	if *m.describeCalls <= m.notFound {
+		return nil, &smithy.GenericAPIError{
+			Code:    "InvalidInstanceID.NotFound",
+			Message: fmt.Sprintf("The instance ID '%s' does not exist", params.InstanceIds[0]),
+		}
+	}
+	return &ec2.DescribeInstancesOutput{
+		Reservations: []types.Reservation{
+			{
+				Instances: []types.Instance{
+					{
+						InstanceId: aws.String(params.InstanceIds[0]),
+						State:      &types.InstanceState{Name: types.InstanceStateNameRunning},
+						Placement:  &types.Placement{AvailabilityZone: aws.String("us-east-1b")},
+						NetworkInterfaces: []types.InstanceNetworkInterface{
+							{
+								PrivateIpAddress: aws.String("10.0.0.7"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// Mock instanceRunningWaiter recording the waits
+type recordingInstanceWaiter struct {
+	timeouts []time.Duration
+	err      error
+}
+
+func (w *recordingInstanceWaiter) Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceRunningWaiterOptions)) error {
+	w.timeouts = append(w.timeouts, maxWaitDur)
+	return w.err
+}
+
+func TestCreateInstanceWaitForIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		client         func(describeCalls *int, terminated *[]string) ec2Client
+		waitErr        error
+		wantWaits      int
+		wantDescribes  int
+		wantIP         string
+		wantState      string
+		wantErr        bool
+		wantTerminated []string
+	}{
+		{
+			name:      "IP returned by RunInstances",
+			client:    func(*int, *[]string) ec2Client { return newMockEC2Client() },
+			wantIP:    "10.0.0.2",
+			wantState: provider.InstanceStatePending,
+		},
+		{
+			name: "IP not assigned yet",
+			client: func(calls *int, terminated *[]string) ec2Client {
+				return mockEC2ClientPendingIP{describeCalls: calls, terminated: terminated}
+			},
+			wantWaits:     1,
+			wantDescribes: 1,
+			wantIP:        "10.0.0.7",
+			wantState:     provider.InstanceStateRunning,
+		},
+		{
+			name: "instance not visible yet",
+			client: func(calls *int, terminated *[]string) ec2Client {
+				return mockEC2ClientPendingIP{describeCalls: calls, terminated: terminated, notFound: 2}
+			},
+			wantWaits:     1,
+			wantDescribes: 3,
+			wantIP:        "10.0.0.7",
+			wantState:     provider.InstanceStateRunning,
+		},
+		{
+			name: "instance not running in time",
+			client: func(calls *int, terminated *[]string) ec2Client {
+				return mockEC2ClientPendingIP{describeCalls: calls, terminated: terminated}
+			},
+			waitErr:   errors.New("exceeded max wait time for InstanceRunning waiter"),
+			wantWaits: 1,
+			wantErr:   true,
+			// Not left running
+			wantTerminated: []string{"i-1234567890abcdef0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := *serviceConfig
+			config.InstanceReadyTimeout = 5 * time.Minute
+
+			describeCalls := 0
+			var terminated []string
+			waiter := &recordingInstanceWaiter{err: tt.waitErr}
+			p := &awsProvider{
+				ec2Client:     tt.client(&describeCalls, &terminated),
+				waiter:        waiter,
+				serviceConfig: &config,
+				clock:         &providertest.FakeClock{AutoAdvance: true},
+			}
+
+			instance, err := p.CreateInstance(context.Background(), "podtest", "123", &mockCloudConfig{}, provider.InstanceTypeSpec{InstanceType: "t2.small"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("awsProvider.CreateInstance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(waiter.timeouts) != tt.wantWaits {
+				t.Errorf("waited %d times, want %d", len(waiter.timeouts), tt.wantWaits)
+			}
+			for _, timeout := range waiter.timeouts {
+				if timeout != config.InstanceReadyTimeout {
+					t.Errorf("waited up to %s, want %s", timeout, config.InstanceReadyTimeout)
+				}
+			}
+			if describeCalls != tt.wantDescribes {
+				t.Errorf("DescribeInstances called %d times, want %d", describeCalls, tt.wantDescribes)
+			}
+			if !reflect.DeepEqual(terminated, tt.wantTerminated) {
+				t.Errorf("terminated %v, want %v", terminated, tt.wantTerminated)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(instance.IPs) != 1 || instance.IPs[0].String() != tt.wantIP {
+				t.Errorf("IPs = %v, want %s", instance.IPs, tt.wantIP)
+			}
+			if instance.State != tt.wantState {
+				t.Errorf("State = %s, want %s", instance.State, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestConfigVerifierRootVolumeType(t *testing.T) {
+	tests := []struct {
+		volumeType string
+		iops       int
+		wantErr    bool
+	}{
+		{volumeType: ""},
+		{volumeType: "gp3"},
+		{volumeType: "io2", iops: 5000},
+		{volumeType: "io2", wantErr: true},
+		{volumeType: "ssd", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		config := *serviceConfig
+		config.RootVolumeType = tt.volumeType
+		config.RootVolumeIops = tt.iops
+		p := &awsProvider{serviceConfig: &config}
+
+		if err := p.ConfigVerifier(); (err != nil) != tt.wantErr {
+			t.Errorf("ConfigVerifier() with root volume type %q and %d IOPS error = %v, wantErr %v", tt.volumeType, tt.iops, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConfigVerifierTagPrefix(t *testing.T) {
+	for prefix, wantErr := range map[string]bool{"": false, "acme:": false, "aws:": true, "AWS:peerpod-": true} {
+		config := *serviceConfig
+		config.TagPrefix = prefix
+		p := &awsProvider{serviceConfig: &config}
+
+		if err := p.ConfigVerifier(); (err != nil) != wantErr {
+			t.Errorf("ConfigVerifier() with tag prefix %q error = %v, wantErr %v", prefix, err, wantErr)
+		}
+	}
+}
+
+func TestCreateInstanceUserDataFormat(t *testing.T) {
+	cloudConfig := &cloudinit.CloudConfig{
+		WriteFiles: []cloudinit.WriteFile{{Path: "/peerpod/apf.json", Content: "{}\n"}},
+	}
+
+	for _, format := range []string{cloudinit.UserDataFormatCloudInit, cloudinit.UserDataFormatIgnition} {
+		t.Run(format, func(t *testing.T) {
+			config := *serviceConfig
+			config.UserDataFormat = format
+
+			var userData string
+			p := &awsProvider{
+				ec2Client:     mockEC2ClientUserData{userData: &userData},
+				waiter:        newMockAWSInstanceWaiter(),
+				serviceConfig: &config,
+			}
+
+			if _, err := p.CreateInstance(context.Background(), "podtest", "123", cloudConfig, provider.InstanceTypeSpec{InstanceType: "t2.small"}); err != nil {
+				t.Fatalf("awsProvider.CreateInstance() error = %v", err)
+			}
+
+			generator, err := cloudinit.NewUserDataGenerator(format, cloudConfig)
+			if err != nil {
+				t.Fatalf("NewUserDataGenerator() error = %v", err)
+			}
+			expected, err := generator.Generate()
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			decoded, err := base64.StdEncoding.DecodeString(userData)
+			if err != nil {
+				t.Fatalf("decoding userData error = %v", err)
+			}
+			if string(decoded) != expected {
+				t.Errorf("userData = %q, want %q", decoded, expected)
+			}
+		})
+	}
+}
+
 func TestDeleteInstance(t *testing.T) {
 	type fields struct {
 		ec2Client     ec2Client
@@ -573,6 +1457,34 @@ func TestDeleteInstance(t *testing.T) {
 			// Test should not return an error
 			wantErr: false,
 		},
+		// Test deleting an instance that was already deleted
+		{
+			name: "DeleteInstanceNotFound",
+			fields: fields{
+				ec2Client:     mockEC2ClientInstanceNotFound{},
+				serviceConfig: serviceConfig,
+			},
+			args: args{
+				ctx:        context.Background(),
+				instanceID: "i-1234567890abcdef0",
+			},
+			// Test should not return an error
+			wantErr: false,
+		},
+		// Test failing to delete an instance
+		{
+			name: "DeleteInstanceFailure",
+			fields: fields{
+				ec2Client:     mockEC2ClientTerminateFailure{},
+				serviceConfig: serviceConfig,
+			},
+			args: args{
+				ctx:        context.Background(),
+				instanceID: "i-1234567890abcdef0",
+			},
+			// Test should return an error
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -726,3 +1638,67 @@ func TestConfigVerifier(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteInstanceEventualConsistency(t *testing.T) {
+	instanceID := "i-1234567890abcdef0"
+
+	calls := 0
+	p := &awsProvider{
+		ec2Client:       mockEC2ClientEventuallyConsistent{calls: &calls},
+		serviceConfig:   &Config{},
+		recentInstances: provider.NewRecentInstances(provider.DefaultNotFoundRetryWindow),
+	}
+	p.recentInstances.Add(instanceID)
+
+	if err := p.DeleteInstance(context.Background(), instanceID); err != nil {
+		t.Fatalf("awsProvider.DeleteInstance() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected TerminateInstances to be retried once, got %d calls", calls)
+	}
+	if p.recentInstances.IsRecent(instanceID) {
+		t.Errorf("expected deleted instance to be forgotten")
+	}
+}
+
+func TestGetInstanceState(t *testing.T) {
+	tests := []struct {
+		name     string
+		instance types.Instance
+		want     string
+	}{
+		{
+			name:     "fresh instance",
+			instance: types.Instance{State: &types.InstanceState{Name: types.InstanceStateNamePending}},
+			want:     provider.InstanceStatePending,
+		},
+		{
+			name:     "running instance",
+			instance: types.Instance{State: &types.InstanceState{Name: types.InstanceStateNameRunning}},
+			want:     provider.InstanceStateRunning,
+		},
+		{
+			name:     "stopped instance",
+			instance: types.Instance{State: &types.InstanceState{Name: types.InstanceStateNameStopped}},
+			want:     provider.InstanceStateStopped,
+		},
+		{
+			name:     "terminated instance",
+			instance: types.Instance{State: &types.InstanceState{Name: types.InstanceStateNameShuttingDown}},
+			want:     provider.InstanceStateTerminated,
+		},
+		{
+			name:     "missing state",
+			instance: types.Instance{},
+			want:     provider.InstanceStatePending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getInstanceState(tt.instance); got != tt.want {
+				t.Errorf("getInstanceState() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+// Reconcile terminates the instances tagged with the node name of this adaptor that no sandbox uses
+func (p *awsProvider) Reconcile(ctx context.Context, inUse map[string]bool) error {
+	if p.nodeName == "" {
+		return errors.New("NODE_NAME is not set, the instances of this node can't be told apart")
+	}
+
+	input := &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag:" + provider.NodeNameTag),
+				Values: []string{p.nodeName},
+			},
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running", "stopping", "stopped"},
+			},
+		},
+	}
+
+	now := p.getClock().Now()
+	var errs []error
+	for {
+		output, err := p.ec2Client.DescribeInstances(ctx, input)
+		if err != nil {
+			return fmt.Errorf("listing instances: %w", err)
+		}
+
+		for _, reservation := range output.Reservations {
+			for _, instance := range reservation.Instances {
+				instanceID := aws.ToString(instance.InstanceId)
+				if instanceID == "" || inUse[instanceID] {
+					continue
+				}
+				if instance.LaunchTime == nil || now.Sub(*instance.LaunchTime) < provider.ReconcileGracePeriod {
+					continue
+				}
+
+				logger.Printf("Reconcile: terminating instance %s, launched at %s, which no sandbox uses", instanceID, instance.LaunchTime)
+				if err := p.DeleteInstance(ctx, instanceID); err != nil {
+					errs = append(errs, fmt.Errorf("terminating orphaned instance %s: %w", instanceID, err))
+				}
+			}
+		}
+
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	return errors.Join(errs...)
+}
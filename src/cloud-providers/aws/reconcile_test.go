@@ -0,0 +1,136 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package aws
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/providertest"
+)
+
+// Mock EC2 API listing the instances of a worker node
+type mockEC2ClientReconcile struct {
+	mockEC2Client
+	instances  []types.Instance
+	filters    *[]types.Filter
+	terminated *[]string
+}
+
+func (m mockEC2ClientReconcile) DescribeInstances(ctx context.Context,
+	params *ec2.DescribeInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+
+	*m.filters = params.Filters
+	return &ec2.DescribeInstancesOutput{
+		Reservations: []types.Reservation{{Instances: m.instances}},
+	}, nil
+}
+
+func (m mockEC2ClientReconcile) TerminateInstances(ctx context.Context,
+	params *ec2.TerminateInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+
+	*m.terminated = append(*m.terminated, params.InstanceIds...)
+	return &ec2.TerminateInstancesOutput{}, nil
+}
+
+func TestReconcile(t *testing.T) {
+	clock := providertest.NewFakeClock()
+	old := clock.Now().Add(-provider.ReconcileGracePeriod)
+	recent := clock.Now().Add(-provider.ReconcileGracePeriod + time.Second)
+
+	var filters []types.Filter
+	var terminated []string
+	client := mockEC2ClientReconcile{
+		instances: []types.Instance{
+			{InstanceId: aws.String("i-inuse"), LaunchTime: &old},
+			{InstanceId: aws.String("i-orphan"), LaunchTime: &old},
+			{InstanceId: aws.String("i-creating"), LaunchTime: &recent},
+		},
+		filters:    &filters,
+		terminated: &terminated,
+	}
+
+	p := &awsProvider{
+		ec2Client:     client,
+		serviceConfig: serviceConfig,
+		nodeName:      "worker-1",
+		clock:         clock,
+	}
+
+	if err := p.Reconcile(context.Background(), map[string]bool{"i-inuse": true}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	sort.Strings(terminated)
+	if want := []string{"i-orphan"}; !reflect.DeepEqual(terminated, want) {
+		t.Errorf("Reconcile() terminated %v, want %v", terminated, want)
+	}
+
+	// Only the instances of this worker node are listed
+	found := false
+	for _, filter := range filters {
+		if aws.ToString(filter.Name) == "tag:"+provider.NodeNameTag {
+			found = reflect.DeepEqual(filter.Values, []string{"worker-1"})
+		}
+	}
+	if !found {
+		t.Errorf("Reconcile() didn't filter on the node name tag, filters %v", filters)
+	}
+}
+
+func TestReconcileWithoutNodeName(t *testing.T) {
+	p := &awsProvider{
+		ec2Client:     newMockEC2Client(),
+		serviceConfig: serviceConfig,
+	}
+
+	if err := p.Reconcile(context.Background(), nil); err == nil {
+		t.Error("Reconcile() expected an error without a node name")
+	}
+}
+
+func TestDeleteInstanceByName(t *testing.T) {
+	var filters []types.Filter
+	var terminated []string
+	client := mockEC2ClientReconcile{
+		instances:  []types.Instance{{InstanceId: aws.String("i-named")}},
+		filters:    &filters,
+		terminated: &terminated,
+	}
+	p := &awsProvider{
+		ec2Client:       client,
+		serviceConfig:   &Config{},
+		recentInstances: provider.NewRecentInstances(time.Minute),
+	}
+
+	if err := p.DeleteInstanceByName(context.Background(), "podvm-test-123"); err != nil {
+		t.Fatalf("DeleteInstanceByName() error = %v", err)
+	}
+	if !reflect.DeepEqual(terminated, []string{"i-named"}) {
+		t.Errorf("expected i-named to be terminated, got %v", terminated)
+	}
+	if len(filters) == 0 || aws.ToString(filters[0].Name) != "tag:Name" || !reflect.DeepEqual(filters[0].Values, []string{"podvm-test-123"}) {
+		t.Errorf("expected the instances to be filtered by name, got %v", filters)
+	}
+
+	// No instance has the name anymore
+	terminated = nil
+	client.instances = nil
+	p.ec2Client = client
+	if err := p.DeleteInstanceByName(context.Background(), "podvm-test-123"); err != nil {
+		t.Fatalf("DeleteInstanceByName() error = %v", err)
+	}
+	if len(terminated) != 0 {
+		t.Errorf("expected no instance to be terminated, got %v", terminated)
+	}
+}
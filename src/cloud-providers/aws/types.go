@@ -5,6 +5,7 @@ package aws
 
 import (
 	"strings"
+	"time"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
@@ -21,6 +22,17 @@ func (i *securityGroupIds) Set(value string) error {
 	return nil
 }
 
+type subnetIds []string
+
+func (i *subnetIds) String() string {
+	return strings.Join(*i, ", ")
+}
+
+func (i *subnetIds) Set(value string) error {
+	*i = append(*i, strings.Split(value, ",")...)
+	return nil
+}
+
 type instanceTypes []string
 
 func (i *instanceTypes) String() string {
@@ -47,6 +59,7 @@ type Config struct {
 	InstanceType         string
 	KeyName              string
 	SubnetId             string
+	SubnetIds            subnetIds
 	SecurityGroupIds     securityGroupIds
 	UseLaunchTemplate    bool
 	InstanceTypes        instanceTypes
@@ -54,8 +67,38 @@ type Config struct {
 	Tags                 provider.KeyValueFlag
 	UsePublicIP          bool
 	RootVolumeSize       int
+	RootVolumeType       string
+	RootVolumeIops       int
 	RootDeviceName       string
 	DisableCVM           bool
+	UserDataFormat       string
+	// Spot instances are cheaper but can be interrupted, SpotMaxPrice is the maximum
+	// hourly price in USD, the on-demand price if empty
+	UseSpotInstances bool
+	SpotMaxPrice     string
+	// Replaces provider.PodTagPrefix in the keys of the pod name, namespace and sandbox tags,
+	// for organizations whose tag policies require their own prefix
+	TagPrefix string
+	// RunInstances is retried on transient and capacity errors, with an exponential backoff from
+	// RunInstancesRetryDelay, until it was called RunInstancesAttempts times
+	RunInstancesAttempts   int
+	RunInstancesRetryDelay time.Duration
+	// RequireIMDSv2 makes the instance metadata service of the Pod VMs accept session token
+	// requests only, which SSRF attacks from the workload can't forge
+	RequireIMDSv2 bool
+	// How long to wait for an instance to be running, e.g. before reading a private IP that
+	// RunInstances didn't return yet
+	InstanceReadyTimeout time.Duration
+	// The placement group the Pod VMs are launched in, e.g. a cluster placement group for a
+	// low network latency between the pods
+	PlacementGroupName string
+	// The name or ARN of the instance profile of the Pod VMs, whose role grants the workload
+	// access to AWS services without static credentials
+	IAMInstanceProfile string
+	// Manage the instances with the credentials of the role RoleARN, assumed with STS, e.g. for
+	// the instances of another account
+	UseSTS  bool
+	RoleARN string
 }
 
 func (c Config) Redact() Config {
@@ -0,0 +1,151 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
+)
+
+// dedicatedHostClient reads the VM sizes a dedicated host, or the hosts of a host group, can run
+type dedicatedHostClient interface {
+	allocatableSizes(ctx context.Context) ([]string, error)
+}
+
+type azureDedicatedHostClient struct {
+	hosts             *armcompute.DedicatedHostsClient
+	groups            *armcompute.DedicatedHostGroupsClient
+	resourceGroupName string
+	hostGroupName     string
+	// Empty for a host group
+	hostName string
+}
+
+// newDedicatedHostClient returns a client for hostID, a dedicated host resource ID if it has a
+// host group parent, a host group resource ID otherwise
+func newDedicatedHostClient(hostID string, credential azcore.TokenCredential, options *arm.ClientOptions) (dedicatedHostClient, error) {
+	id, err := arm.ParseResourceID(hostID)
+	if err != nil {
+		return nil, fmt.Errorf("parsing dedicated host id %q: %w", hostID, err)
+	}
+
+	c := &azureDedicatedHostClient{resourceGroupName: id.ResourceGroupName}
+	switch {
+	case strings.EqualFold(id.ResourceType.String(), "Microsoft.Compute/hostGroups/hosts") && id.Parent != nil:
+		c.hostGroupName, c.hostName = id.Parent.Name, id.Name
+		c.hosts, err = armcompute.NewDedicatedHostsClient(id.SubscriptionID, credential, options)
+	case strings.EqualFold(id.ResourceType.String(), "Microsoft.Compute/hostGroups"):
+		c.hostGroupName = id.Name
+		c.groups, err = armcompute.NewDedicatedHostGroupsClient(id.SubscriptionID, credential, options)
+	default:
+		return nil, fmt.Errorf("%q is neither a dedicated host nor a host group id", hostID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating dedicated hosts client: %w", err)
+	}
+	return c, nil
+}
+
+func (c *azureDedicatedHostClient) allocatableSizes(ctx context.Context) ([]string, error) {
+	var capacities []*armcompute.DedicatedHostAvailableCapacity
+	if c.hosts != nil {
+		resp, err := c.hosts.Get(ctx, c.resourceGroupName, c.hostGroupName, c.hostName,
+			&armcompute.DedicatedHostsClientGetOptions{Expand: to.Ptr(armcompute.InstanceViewTypesInstanceView)})
+		if err != nil {
+			return nil, fmt.Errorf("getting dedicated host %q: %w", c.hostName, err)
+		}
+		if resp.Properties != nil && resp.Properties.InstanceView != nil {
+			capacities = append(capacities, resp.Properties.InstanceView.AvailableCapacity)
+		}
+	} else {
+		resp, err := c.groups.Get(ctx, c.resourceGroupName, c.hostGroupName,
+			&armcompute.DedicatedHostGroupsClientGetOptions{Expand: to.Ptr(armcompute.InstanceViewTypesInstanceView)})
+		if err != nil {
+			return nil, fmt.Errorf("getting host group %q: %w", c.hostGroupName, err)
+		}
+		if resp.Properties != nil && resp.Properties.InstanceView != nil {
+			for _, host := range resp.Properties.InstanceView.Hosts {
+				if host != nil {
+					capacities = append(capacities, host.AvailableCapacity)
+				}
+			}
+		}
+	}
+
+	// A size is listed even when the host is full, with a zero count
+	seen := map[string]bool{}
+	var sizes []string
+	for _, capacity := range capacities {
+		if capacity == nil {
+			continue
+		}
+		for _, vm := range capacity.AllocatableVMs {
+			if vm == nil || vm.VMSize == nil || seen[strings.ToLower(*vm.VMSize)] {
+				continue
+			}
+			seen[strings.ToLower(*vm.VMSize)] = true
+			sizes = append(sizes, *vm.VMSize)
+		}
+	}
+	sort.Strings(sizes)
+	return sizes, nil
+}
+
+// dedicatedHostID returns the dedicated host or host group the VMs are placed on, empty if none
+func (c *Config) dedicatedHostID() string {
+	if c.DedicatedHostId != "" {
+		return c.DedicatedHostId
+	}
+	return c.HostGroupId
+}
+
+// checkDedicatedHostSizes returns an error listing the sizes that the dedicated host or host
+// group hostID can't run, given the sizes it can
+func checkDedicatedHostSizes(hostID string, allocatable, sizes []string) error {
+	var incompatible []string
+	for _, size := range sizes {
+		found := false
+		for _, a := range allocatable {
+			if strings.EqualFold(a, size) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			incompatible = append(incompatible, size)
+		}
+	}
+	if len(incompatible) == 0 {
+		return nil
+	}
+	return fmt.Errorf("VM sizes %s can't be placed on dedicated host %q, which runs %s: select sizes of the host SKU family or another host",
+		strings.Join(incompatible, ","), hostID, strings.Join(allocatable, ","))
+}
+
+// preflightDedicatedHostCheck verifies that the dedicated host or host group can run all the
+// configured instance sizes. As for the image check, lookup failures are only logged.
+func (p *azureProvider) preflightDedicatedHostCheck(ctx context.Context, client dedicatedHostClient) error {
+	allocatable, err := client.allocatableSizes(ctx)
+	if err != nil {
+		logger.Printf("skipping dedicated host and VM size compatibility check: %v", err)
+		return nil
+	}
+	if len(allocatable) == 0 {
+		logger.Printf("no allocatable VM sizes reported for dedicated host %q, skipping compatibility check", p.serviceConfig.dedicatedHostID())
+		return nil
+	}
+
+	sizes := p.serviceConfig.InstanceSizes
+	if len(sizes) == 0 {
+		sizes = []string{p.serviceConfig.Size}
+	}
+	return checkDedicatedHostSizes(p.serviceConfig.dedicatedHostID(), allocatable, sizes)
+}
@@ -0,0 +1,140 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+const (
+	testHostGroupID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/hostGroups/group"
+	testHostID      = testHostGroupID + "/hosts/host"
+)
+
+type mockDedicatedHostClient struct {
+	sizes []string
+	err   error
+}
+
+func (m *mockDedicatedHostClient) allocatableSizes(ctx context.Context) ([]string, error) {
+	return m.sizes, m.err
+}
+
+func TestGetVMParametersDedicatedHost(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        Config
+		wantHost      string
+		wantHostGroup string
+	}{
+		{
+			name: "no dedicated host",
+		},
+		{
+			name:     "dedicated host",
+			config:   Config{DedicatedHostId: testHostID},
+			wantHost: testHostID,
+		},
+		{
+			name:          "host group",
+			config:        Config{HostGroupId: testHostGroupID},
+			wantHostGroup: testHostGroupID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.SSHUserName = "peerpod"
+			p := &azureProvider{serviceConfig: &config}
+
+			vm, err := p.getVMParameters("Standard_DC2as_v5", "disk", "", []byte("ssh-rsa key"), "podvm", "nic", "image")
+			if err != nil {
+				t.Fatalf("getVMParameters() error = %v", err)
+			}
+
+			if got := vm.Properties.Host; (got == nil) != (tt.wantHost == "") || (got != nil && *got.ID != tt.wantHost) {
+				t.Errorf("Host = %+v, want %q", got, tt.wantHost)
+			}
+			if got := vm.Properties.HostGroup; (got == nil) != (tt.wantHostGroup == "") || (got != nil && *got.ID != tt.wantHostGroup) {
+				t.Errorf("HostGroup = %+v, want %q", got, tt.wantHostGroup)
+			}
+		})
+	}
+}
+
+func TestConfigVerifierDedicatedHost(t *testing.T) {
+	p := &azureProvider{serviceConfig: &Config{ImageId: "image", DedicatedHostId: testHostID, HostGroupId: testHostGroupID}}
+	if err := p.ConfigVerifier(); err == nil {
+		t.Error("ConfigVerifier() error = nil, want an error for both a host and a host group")
+	}
+
+	p.serviceConfig.HostGroupId = ""
+	if err := p.ConfigVerifier(); err != nil {
+		t.Errorf("ConfigVerifier() error = %v", err)
+	}
+}
+
+func TestNewDedicatedHostClient(t *testing.T) {
+	for id, wantErr := range map[string]bool{
+		testHostID:      false,
+		testHostGroupID: false,
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm": true,
+		"host": true,
+	} {
+		if _, err := newDedicatedHostClient(id, nil, nil); (err != nil) != wantErr {
+			t.Errorf("newDedicatedHostClient(%q) error = %v, wantErr %v", id, err, wantErr)
+		}
+	}
+}
+
+func TestPreflightDedicatedHostCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		client  *mockDedicatedHostClient
+		wantErr bool
+	}{
+		{
+			name:   "compatible size",
+			config: Config{Size: "Standard_DC2as_v5"},
+			client: &mockDedicatedHostClient{sizes: []string{"Standard_DC2as_v5", "Standard_DC4as_v5"}},
+		},
+		{
+			name:   "sizes match case insensitively",
+			config: Config{InstanceSizes: instanceSizes{"standard_dc2as_v5", "Standard_DC4as_v5"}},
+			client: &mockDedicatedHostClient{sizes: []string{"Standard_DC2as_v5", "Standard_DC4as_v5"}},
+		},
+		{
+			name:    "incompatible size",
+			config:  Config{InstanceSizes: instanceSizes{"Standard_DC2as_v5", "Standard_D2s_v5"}},
+			client:  &mockDedicatedHostClient{sizes: []string{"Standard_DC2as_v5"}},
+			wantErr: true,
+		},
+		{
+			name:   "lookup failure",
+			config: Config{Size: "Standard_D2s_v5"},
+			client: &mockDedicatedHostClient{err: errors.New("forbidden")},
+		},
+		{
+			name:   "no capacity reported",
+			config: Config{Size: "Standard_D2s_v5"},
+			client: &mockDedicatedHostClient{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.DedicatedHostId = testHostID
+			p := &azureProvider{serviceConfig: &config}
+
+			if err := p.preflightDedicatedHostCheck(context.Background(), tt.client); (err != nil) != tt.wantErr {
+				t.Errorf("preflightDedicatedHostCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
+)
+
+const (
+	// The OS disk of a pod VM is named after the VM, with this suffix
+	diskNameSuffix = "-disk"
+	// Prefix of the pod VM names, see util.GenerateInstanceName
+	instanceNamePrefix = "podvm-"
+
+	// An unattached disk younger than this may belong to a VM still being created
+	orphanedDiskMinAge = time.Hour
+)
+
+// disksClient lists, tags and deletes the managed disks of the resource group
+type disksClient interface {
+	list(ctx context.Context) ([]*armcompute.Disk, error)
+	updateTags(ctx context.Context, name string, tags map[string]*string) error
+	delete(ctx context.Context, name string) error
+}
+
+type azureDisksClient struct {
+	client            *armcompute.DisksClient
+	resourceGroupName string
+}
+
+func newDisksClient(subscriptionID, resourceGroupName string, credential azcore.TokenCredential, options *arm.ClientOptions) (disksClient, error) {
+	client, err := armcompute.NewDisksClient(subscriptionID, credential, options)
+	if err != nil {
+		return nil, fmt.Errorf("creating disks client: %w", err)
+	}
+
+	return &azureDisksClient{
+		client:            client,
+		resourceGroupName: resourceGroupName,
+	}, nil
+}
+
+func (c *azureDisksClient) list(ctx context.Context) ([]*armcompute.Disk, error) {
+	var disks []*armcompute.Disk
+	pager := c.client.NewListByResourceGroupPager(c.resourceGroupName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing disks: %w", err)
+		}
+		disks = append(disks, page.Value...)
+	}
+	return disks, nil
+}
+
+func (c *azureDisksClient) updateTags(ctx context.Context, name string, tags map[string]*string) error {
+	poller, err := c.client.BeginUpdate(ctx, c.resourceGroupName, name, armcompute.DiskUpdate{Tags: tags}, nil)
+	if err == nil {
+		_, err = poller.PollUntilDone(ctx, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("tagging disk %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *azureDisksClient) delete(ctx context.Context, name string) error {
+	poller, err := c.client.BeginDelete(ctx, c.resourceGroupName, name, nil)
+	if err == nil {
+		_, err = poller.PollUntilDone(ctx, nil)
+	}
+	if err != nil && !isNotFoundError(err) {
+		return fmt.Errorf("deleting disk %s: %w", name, err)
+	}
+	return nil
+}
+
+// isOrphanedDisk returns whether disk is the OS disk of a pod VM of this adaptor, or node, that
+// no VM uses any longer. The OS disks don't inherit the tags of their VM, an untagged disk may
+// belong to another adaptor and is never deleted.
+func (p *azureProvider) isOrphanedDisk(disk *armcompute.Disk, now time.Time) bool {
+	if disk.Name == nil || !strings.HasSuffix(*disk.Name, diskNameSuffix) || disk.ManagedBy != nil {
+		return false
+	}
+	if disk.Properties == nil || disk.Properties.DiskState == nil || *disk.Properties.DiskState != armcompute.DiskStateUnattached {
+		return false
+	}
+	if disk.Properties.TimeCreated == nil || now.Sub(*disk.Properties.TimeCreated) < orphanedDiskMinAge {
+		return false
+	}
+
+	return strings.HasPrefix(*disk.Name, instanceNamePrefix) && p.ownsTags(disk.Tags)
+}
+
+// tagLeftoverDisk marks the OS disk a failed VM create may have left behind as owned by this
+// adaptor, since the OS disks created along with their VM don't get its tags. This is
+// best-effort: an untagged disk is never cleaned up.
+func (p *azureProvider) tagLeftoverDisk(ctx context.Context, client disksClient, name string) {
+	if err := client.updateTags(ctx, name, p.getResourceTags()); err != nil && !isNotFoundError(err) {
+		logger.Printf("%v", err)
+	}
+}
+
+// deleteOrphanedDisks deletes the pod VM OS disks left behind by failed creates or crashes.
+// Disks are deleted along with their VM, so these are not attached to any.
+func (p *azureProvider) deleteOrphanedDisks(ctx context.Context, client disksClient) error {
+	disks, err := client.list(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := p.getClock().Now()
+	var errs []error
+	deleted := 0
+	for _, disk := range disks {
+		if !p.isOrphanedDisk(disk, now) {
+			continue
+		}
+		// Stopped by Close
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := client.delete(ctx, *disk.Name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		logger.Printf("deleted orphaned disk %s", *disk.Name)
+		deleted++
+	}
+
+	if deleted > 0 {
+		logger.Printf("deleted %d orphaned pod VM disks", deleted)
+	}
+	return errors.Join(errs...)
+}
+
+// cleanupOrphanedDisks deletes the orphaned pod VM disks of the resource group when enabled. With
+// RetainOSDiskOnDelete, the disks of the deleted VMs can't be told apart from the orphaned
+// ones and are all kept.
+func (p *azureProvider) cleanupOrphanedDisks(ctx context.Context) error {
+	if !p.serviceConfig.CleanupOrphanedDisks || p.serviceConfig.RetainOSDiskOnDelete {
+		return nil
+	}
+	client, err := newDisksClient(p.serviceConfig.SubscriptionId, p.serviceConfig.ResourceGroupName, p.azureClient, p.clientOptions)
+	if err != nil {
+		return err
+	}
+	return p.deleteOrphanedDisks(ctx, client)
+}
@@ -0,0 +1,191 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/providertest"
+)
+
+type mockDisksClient struct {
+	disks     []*armcompute.Disk
+	listErr   error
+	deleteErr error
+	deleted   []string
+	tags      map[string]map[string]*string
+}
+
+func (m *mockDisksClient) list(ctx context.Context) ([]*armcompute.Disk, error) {
+	return m.disks, m.listErr
+}
+
+func (m *mockDisksClient) updateTags(ctx context.Context, name string, tags map[string]*string) error {
+	if m.tags == nil {
+		m.tags = map[string]map[string]*string{}
+	}
+	m.tags[name] = tags
+	return nil
+}
+
+func (m *mockDisksClient) delete(ctx context.Context, name string) error {
+	if m.deleteErr != nil {
+		return m.deleteErr
+	}
+	m.deleted = append(m.deleted, name)
+	return nil
+}
+
+// testDisk returns a disk created age before providertest.FakeClockStart
+func testDisk(name string, state armcompute.DiskState, age time.Duration, tags map[string]string) *armcompute.Disk {
+	disk := &armcompute.Disk{
+		Name: to.Ptr(name),
+		Properties: &armcompute.DiskProperties{
+			DiskState:   to.Ptr(state),
+			TimeCreated: to.Ptr(providertest.FakeClockStart.Add(-age)),
+		},
+		Tags: map[string]*string{},
+	}
+	for k, v := range tags {
+		disk.Tags[k] = to.Ptr(v)
+	}
+	if state == armcompute.DiskStateAttached {
+		disk.ManagedBy = to.Ptr(vmIDPrefix + name)
+	}
+	return disk
+}
+
+func TestDeleteOrphanedDisks(t *testing.T) {
+	owned := map[string]string{ownerTag: ownerTagValue, provider.NodeNameTag: "worker-1"}
+
+	client := &mockDisksClient{
+		disks: []*armcompute.Disk{
+			// Possibly another adaptor's
+			testDisk("podvm-a-disk", armcompute.DiskStateUnattached, 2*time.Hour, nil),
+			testDisk("podvm-b-disk", armcompute.DiskStateAttached, 2*time.Hour, owned),
+			testDisk("podvm-c-disk", armcompute.DiskStateUnattached, orphanedDiskMinAge-time.Second, owned),
+			testDisk("podvm-d-disk", armcompute.DiskStateUnattached, orphanedDiskMinAge, owned),
+			testDisk("podvm-e-disk", armcompute.DiskStateUnattached, 2*time.Hour, map[string]string{ownerTag: ownerTagValue, provider.NodeNameTag: "worker-2"}),
+			testDisk("db-disk", armcompute.DiskStateUnattached, 2*time.Hour, nil),
+			testDisk("data-disk", armcompute.DiskStateUnattached, 2*time.Hour, owned),
+			testDisk("podvm-f-data", armcompute.DiskStateUnattached, 2*time.Hour, owned),
+			testDisk("podvm-g-disk", armcompute.DiskStateReserved, 2*time.Hour, owned),
+		},
+	}
+	p := &azureProvider{serviceConfig: &Config{}, nodeName: "worker-1", clock: providertest.NewFakeClock()}
+
+	if err := p.deleteOrphanedDisks(context.Background(), client); err != nil {
+		t.Fatalf("deleteOrphanedDisks() error = %v", err)
+	}
+	if want := []string{"podvm-d-disk"}; !reflect.DeepEqual(client.deleted, want) {
+		t.Errorf("expected %v to be deleted, got %v", want, client.deleted)
+	}
+}
+
+func TestDeleteOrphanedDisksErrors(t *testing.T) {
+	p := &azureProvider{serviceConfig: &Config{}, clock: providertest.NewFakeClock()}
+
+	client := &mockDisksClient{listErr: errors.New("forbidden")}
+	if err := p.deleteOrphanedDisks(context.Background(), client); err == nil {
+		t.Error("deleteOrphanedDisks() error = nil, want the list error")
+	}
+
+	client = &mockDisksClient{
+		disks:     []*armcompute.Disk{testDisk("podvm-a-disk", armcompute.DiskStateUnattached, 2*time.Hour, map[string]string{ownerTag: ownerTagValue})},
+		deleteErr: errors.New("conflict"),
+	}
+	if err := p.deleteOrphanedDisks(context.Background(), client); err == nil {
+		t.Error("deleteOrphanedDisks() error = nil, want the delete error")
+	}
+}
+
+func TestCleanupOrphanedDisksSkipped(t *testing.T) {
+	// No client is created: the cleanup is opt-in, and the disks of the deleted VMs are kept
+	for _, config := range []*Config{{}, {CleanupOrphanedDisks: true, RetainOSDiskOnDelete: true}} {
+		p := &azureProvider{serviceConfig: config}
+		if err := p.cleanupOrphanedDisks(context.Background()); err != nil {
+			t.Errorf("cleanupOrphanedDisks() error = %v", err)
+		}
+	}
+}
+
+func TestTagLeftoverDisk(t *testing.T) {
+	client := &mockDisksClient{}
+	p := &azureProvider{serviceConfig: &Config{}, nodeName: "worker-1"}
+
+	p.tagLeftoverDisk(context.Background(), client, "podvm-a-disk")
+
+	leftover := testDisk("podvm-a-disk", armcompute.DiskStateUnattached, 2*time.Hour, nil)
+	leftover.Tags = client.tags["podvm-a-disk"]
+	if !p.isOrphanedDisk(leftover, providertest.FakeClockStart) {
+		t.Errorf("expected the tagged disk to be orphaned, got tags %v", leftover.Tags)
+	}
+}
+
+// hangingTransport holds every request until it is canceled, reporting each one on requests
+type hangingTransport struct {
+	requests chan struct{}
+}
+
+func (t *hangingTransport) Do(req *http.Request) (*http.Response, error) {
+	t.requests <- struct{}{}
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestCloseStopsOrphanedDiskCleanup(t *testing.T) {
+	transport := &hangingTransport{requests: make(chan struct{}, 10)}
+	p := &azureProvider{
+		azureClient:   &fake.TokenCredential{},
+		clientOptions: &arm.ClientOptions{ClientOptions: policy.ClientOptions{Transport: transport}},
+		serviceConfig: &Config{SubscriptionId: "sub", ResourceGroupName: "rg", CleanupOrphanedDisks: true},
+	}
+
+	// The adaptor closes the providers implementing provider.Closer
+	closer, ok := provider.Provider(p).(provider.Closer)
+	if !ok {
+		t.Fatal("the Azure provider doesn't implement provider.Closer")
+	}
+
+	p.startOrphanedDiskCleanup()
+	// The disks are being listed
+	<-transport.requests
+
+	closed := make(chan error)
+	go func() {
+		closed <- closer.Close()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close() didn't stop the orphaned disk cleanup")
+	}
+
+	select {
+	case <-p.cleanupDone:
+	default:
+		t.Error("the orphaned disk cleanup is still running after Close()")
+	}
+}
+
+func TestCloseWithoutOrphanedDiskCleanup(t *testing.T) {
+	p := &azureProvider{serviceConfig: &Config{}}
+	if err := p.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
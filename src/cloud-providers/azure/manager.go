@@ -7,41 +7,70 @@ import (
 	"flag"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 )
 
 var azurecfg Config
 
-type Manager struct{}
+type Manager struct {
+	// Flag set of the cloud-api-adaptor, which also defines the tunnel ports
+	flags *flag.FlagSet
+}
 
 func init() {
 	provider.AddCloudProvider("azure", &Manager{})
 }
 
-func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
+func (m *Manager) ParseCmd(flags *flag.FlagSet) {
+	m.flags = flags
 	flags.StringVar(&azurecfg.ClientId, "clientid", "", "Client Id, defaults to `AZURE_CLIENT_ID`")
 	flags.StringVar(&azurecfg.ClientSecret, "secret", "", "Client Secret, defaults to `AZURE_CLIENT_SECRET`")
 	flags.StringVar(&azurecfg.TenantId, "tenantid", "", "Tenant Id, defaults to `AZURE_TENANT_ID`")
 	flags.StringVar(&azurecfg.ResourceGroupName, "resourcegroup", "", "Resource Group")
-	flags.StringVar(&azurecfg.Zone, "zone", "", "Zone")
+	flags.StringVar(&azurecfg.Zone, "zone", "", "Availability zone, or comma separated zones to spread the pod VMs across")
 	flags.StringVar(&azurecfg.Region, "region", "", "Region")
 	flags.StringVar(&azurecfg.SubnetId, "subnetid", "", "Network Subnet Id")
 	flags.StringVar(&azurecfg.SecurityGroupId, "securitygroupid", "", "Security Group Id")
 	flags.StringVar(&azurecfg.Size, "instance-size", "Standard_DC2as_v5", "Instance size")
-	flags.StringVar(&azurecfg.ImageId, "imageid", "", "Image Id")
+	flags.StringVar(&azurecfg.ImageId, "imageid", "", "Image Id: an image resource ID, a community gallery image ID or a marketplace image URN (publisher:offer:sku:version)")
 	flags.StringVar(&azurecfg.SubscriptionId, "subscriptionid", "", "Subscription ID")
 	flags.StringVar(&azurecfg.SSHKeyPath, "ssh-key-path", "", "Path to SSH public key")
+	flags.StringVar(&azurecfg.SSHPubKey, "ssh-public-key", "", "SSH public key in authorized_keys format, used instead of -ssh-key-path. Defaults to AZURE_SSH_PUBLIC_KEY")
 	flags.StringVar(&azurecfg.SSHUserName, "ssh-username", "peerpod", "SSH User Name")
 	flags.BoolVar(&azurecfg.DisableCVM, "disable-cvm", false, "Use non-CVMs for peer pods")
 	// Add a List parameter to indicate different types of instance sizes to be used for the Pod VMs
 	flags.Var(&azurecfg.InstanceSizes, "instance-sizes", "Instance sizes to be used for the Pod VMs, comma separated")
 	// Add a key value list parameter to indicate custom tags to be used for the Pod VMs
 	flags.Var(&azurecfg.Tags, "tags", "Custom tags (key=value pairs) to be used for the Pod VMs, comma separated")
+	flags.Var(&azurecfg.SecurityType, "security-type", "Security type of the Pod VMs: ConfidentialVM, TrustedLaunch or Standard. Defaults to ConfidentialVM, or Standard with -disable-cvm")
 	flags.BoolVar(&azurecfg.EnableSecureBoot, "enable-secure-boot", false, "Enable secure boot for the VMs")
+	flags.BoolVar(&azurecfg.DisableVTPM, "disable-vtpm", false, "Disable the vTPM of the trusted launch VMs, for images that don't support it. Confidential VMs require the vTPM")
+	flags.BoolVar(&azurecfg.RetainOSDiskOnDelete, "retain-os-disk-on-delete", false, "Keep the OS disks of the deleted Pod VMs, which are then not cleaned up either")
+	flags.StringVar(&azurecfg.DedicatedHostId, "dedicated-host-id", "", "Resource ID of the dedicated host to place the Pod VMs on")
+	flags.StringVar(&azurecfg.HostGroupId, "host-group-id", "", "Resource ID of the dedicated host group to place the Pod VMs on, with automatic host placement")
+	flags.Var(&azurecfg.ApplicationSecurityGroupIds, "application-security-group-ids", "Resource IDs of the application security groups of the Pod VM NICs, comma separated")
+	flags.BoolVar(&azurecfg.UseSpot, "use-spot", false, "Create the Pod VMs as Spot VMs, which Azure can evict. Only for workloads that tolerate losing their pod")
+	flags.Float64Var(&azurecfg.SpotMaxPrice, "spot-max-price", spotMaxPriceUncapped, "Max price of the Spot VMs in USD per hour, raised at startup if below the current spot price. -1 to never evict because of the price")
+	flags.StringVar(&azurecfg.SpotEvictionPolicy, "spot-eviction-policy", "Delete", "What to do with an evicted Spot VM, Delete or Deallocate")
+	flags.BoolVar(&azurecfg.EnableAcceleratedNetworking, "enable-accelerated-networking", false, "Enable accelerated networking on the Pod VM NICs. The VM sizes must support it, or the Pod VM creation fails")
 	flags.BoolVar(&azurecfg.UsePublicIP, "use-public-ip", false, "Assign public IP to the PoD VM and use to connect to kata-agent")
 	flags.IntVar(&azurecfg.RootVolumeSize, "root-volume-size", 0, "Root volume size in GB. Default is 0, which implies the default image disk size")
+	flags.StringVar(&azurecfg.RootVolumeType, "root-volume-type", "", "Storage account type of the root volume, e.g. StandardSSD_LRS or Premium_ZRS. Default is Premium_LRS")
+	flags.BoolVar(&azurecfg.DisableVMAgent, "disable-vm-agent", false, "Don't provision the Azure VM guest agent, implies -disable-extension-operations")
+	flags.BoolVar(&azurecfg.DisableExtensionOperations, "disable-extension-operations", false, "Don't allow VM extensions such as guest configuration on the Pod VMs")
+	flags.BoolVar(&azurecfg.DisableBootDiagnostics, "disable-boot-diagnostics", false, "Disable boot diagnostics for the Pod VMs")
+	flags.BoolVar(&azurecfg.EnsureNSGRules, "ensure-nsg-rules", false, "Create the security group rules allowing the forwarder and VXLAN tunnel traffic at startup")
+	flags.StringVar(&azurecfg.NSGRuleSourcePrefix, "nsg-rule-source-prefix", defaultNSGRuleSourcePrefix, "Address prefix or service tag allowed by the security group rules created with -ensure-nsg-rules")
+	flags.StringVar(&azurecfg.UserDataStorageAccount, "userdata-storage-account", "", "Storage account keeping the userData over the Azure size limit, which the Pod VMs then fetch with a read-only SAS. Disabled if empty")
+	flags.StringVar(&azurecfg.UserDataStorageContainer, "userdata-storage-container", defaultUserDataContainer, "Blob container for the userData over the Azure size limit, created if missing")
+	flags.BoolVar(&azurecfg.UseHibernation, "use-hibernation", false, "Enable the hibernation capability on the Pod VMs. The VM sizes and the image must support hibernation, which confidential VMs don't")
+	flags.StringVar(&azurecfg.UserDataFormat, "userdata-format", cloudinit.UserDataFormatCloudInit, "Format of the Pod VM userData, cloud-init or ignition")
+	flags.BoolVar(&azurecfg.DisablePodTags, "disable-pod-tags", false, "Don't tag the Pod VMs with the name, namespace and sandbox ID of their pod")
+	flags.BoolVar(&azurecfg.TeardownDeleteVMs, "teardown-delete-vms", false, "On shutdown, delete all the Pod VMs created from this node, found by their tags, including the ones no pod uses, and the pod VM NICs failed creates left on the subnet more than 10 minutes ago. Use it only to tear down the environment")
+	flags.BoolVar(&azurecfg.CleanupOrphanedDisks, "cleanup-orphaned-disks", false, "At startup and shutdown, delete the Pod VM OS disks failed creates from this node left behind more than an hour ago, found by their tags")
 }
 
-func (_ *Manager) LoadEnv() {
+func (m *Manager) LoadEnv() {
 	provider.DefaultToEnv(&azurecfg.ClientId, "AZURE_CLIENT_ID", "")
 	provider.DefaultToEnv(&azurecfg.ClientSecret, "AZURE_CLIENT_SECRET", "")
 	provider.DefaultToEnv(&azurecfg.TenantId, "AZURE_TENANT_ID", "")
@@ -49,6 +78,26 @@ func (_ *Manager) LoadEnv() {
 	provider.DefaultToEnv(&azurecfg.Region, "AZURE_REGION", "")
 	provider.DefaultToEnv(&azurecfg.ResourceGroupName, "AZURE_RESOURCE_GROUP", "")
 	provider.DefaultToEnv(&azurecfg.Size, "AZURE_INSTANCE_SIZE", "Standard_DC2as_v5")
+	provider.DefaultToEnv(&azurecfg.SSHPubKey, "AZURE_SSH_PUBLIC_KEY", "")
+	// Used for the security group rules. The environment is only a fallback for when the
+	// flags of the cloud-api-adaptor aren't parsed, e.g. in the peerpod controller.
+	provider.DefaultToEnv(&azurecfg.ForwarderPort, "FORWARDER_PORT", defaultForwarderPort)
+	provider.DefaultToEnv(&azurecfg.VXLANPort, "VXLAN_PORT", defaultVXLANPort)
+	tunnelPortsFromFlags(&azurecfg, m.flags)
+}
+
+// tunnelPortsFromFlags sets the tunnel ports of the security group rules to the values of the
+// -forwarder-port and -vxlan-port flags of the cloud-api-adaptor, when flags defines them
+func tunnelPortsFromFlags(config *Config, flags *flag.FlagSet) {
+	if flags == nil {
+		return
+	}
+	if f := flags.Lookup("forwarder-port"); f != nil {
+		config.ForwarderPort = f.Value.String()
+	}
+	if f := flags.Lookup("vxlan-port"); f != nil {
+		config.VXLANPort = f.Value.String()
+	}
 }
 
 func (_ *Manager) NewProvider() (provider.Provider, error) {
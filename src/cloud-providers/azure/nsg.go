@@ -0,0 +1,154 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	armnetwork "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+)
+
+const (
+	// Defaults of the agent protocol forwarder port and the VXLAN port used by the pod network tunnel
+	defaultForwarderPort = "15150"
+	defaultVXLANPort     = "4789"
+
+	defaultNSGRuleSourcePrefix = "VirtualNetwork"
+	nsgRulePriorityBase        = 3000
+)
+
+// securityRulesClient reads and writes the rules of a network security group
+type securityRulesClient interface {
+	// get returns nil when the rule doesn't exist
+	get(ctx context.Context, ruleName string) (*armnetwork.SecurityRule, error)
+	createOrUpdate(ctx context.Context, ruleName string, rule armnetwork.SecurityRule) error
+}
+
+type azureSecurityRulesClient struct {
+	client            *armnetwork.SecurityRulesClient
+	resourceGroupName string
+	nsgName           string
+}
+
+func newSecurityRulesClient(nsgID string, credential azcore.TokenCredential, options *arm.ClientOptions) (securityRulesClient, error) {
+	id, err := arm.ParseResourceID(nsgID)
+	if err != nil {
+		return nil, fmt.Errorf("parsing network security group id %q: %w", nsgID, err)
+	}
+
+	client, err := armnetwork.NewSecurityRulesClient(id.SubscriptionID, credential, options)
+	if err != nil {
+		return nil, fmt.Errorf("creating security rules client: %w", err)
+	}
+
+	return &azureSecurityRulesClient{
+		client:            client,
+		resourceGroupName: id.ResourceGroupName,
+		nsgName:           id.Name,
+	}, nil
+}
+
+func (c *azureSecurityRulesClient) get(ctx context.Context, ruleName string) (*armnetwork.SecurityRule, error) {
+	resp, err := c.client.Get(ctx, c.resourceGroupName, c.nsgName, ruleName, nil)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("getting security rule %q: %w", ruleName, err)
+	}
+	return &resp.SecurityRule, nil
+}
+
+func (c *azureSecurityRulesClient) createOrUpdate(ctx context.Context, ruleName string, rule armnetwork.SecurityRule) error {
+	poller, err := c.client.BeginCreateOrUpdate(ctx, c.resourceGroupName, c.nsgName, ruleName, rule, nil)
+	if err != nil {
+		return fmt.Errorf("creating security rule %q: %w", ruleName, err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("waiting for security rule %q: %w", ruleName, err)
+	}
+	return nil
+}
+
+// tunnelSecurityRules returns the rules that allow the worker nodes to reach the
+// agent protocol forwarder and the VXLAN tunnel traffic in both directions
+func tunnelSecurityRules(config *Config) map[string]armnetwork.SecurityRule {
+	prefix := config.NSGRuleSourcePrefix
+	if prefix == "" {
+		prefix = defaultNSGRuleSourcePrefix
+	}
+
+	rule := func(priority int32, direction armnetwork.SecurityRuleDirection, protocol armnetwork.SecurityRuleProtocol, port string) armnetwork.SecurityRule {
+		return armnetwork.SecurityRule{
+			Properties: &armnetwork.SecurityRulePropertiesFormat{
+				Access:                   to.Ptr(armnetwork.SecurityRuleAccessAllow),
+				Direction:                to.Ptr(direction),
+				Protocol:                 to.Ptr(protocol),
+				Priority:                 to.Ptr(priority),
+				SourceAddressPrefix:      to.Ptr(prefix),
+				SourcePortRange:          to.Ptr("*"),
+				DestinationAddressPrefix: to.Ptr(prefix),
+				DestinationPortRange:     to.Ptr(port),
+				Description:              to.Ptr("Managed by cloud-api-adaptor for the peer pod network tunnel"),
+			},
+		}
+	}
+
+	return map[string]armnetwork.SecurityRule{
+		"peerpods-forwarder-inbound": rule(nsgRulePriorityBase, armnetwork.SecurityRuleDirectionInbound, armnetwork.SecurityRuleProtocolTCP, config.ForwarderPort),
+		"peerpods-vxlan-inbound":     rule(nsgRulePriorityBase+1, armnetwork.SecurityRuleDirectionInbound, armnetwork.SecurityRuleProtocolUDP, config.VXLANPort),
+		"peerpods-vxlan-outbound":    rule(nsgRulePriorityBase, armnetwork.SecurityRuleDirectionOutbound, armnetwork.SecurityRuleProtocolUDP, config.VXLANPort),
+	}
+}
+
+// securityRuleMatches returns true when the existing rule already has the wanted properties
+func securityRuleMatches(existing, wanted *armnetwork.SecurityRule) bool {
+	e, w := existing.Properties, wanted.Properties
+	if e == nil {
+		return false
+	}
+	equal := func(a, b *string) bool { return a != nil && b != nil && *a == *b }
+
+	return e.Access != nil && *e.Access == *w.Access &&
+		e.Direction != nil && *e.Direction == *w.Direction &&
+		e.Protocol != nil && *e.Protocol == *w.Protocol &&
+		e.Priority != nil && *e.Priority == *w.Priority &&
+		equal(e.SourceAddressPrefix, w.SourceAddressPrefix) &&
+		equal(e.SourcePortRange, w.SourcePortRange) &&
+		equal(e.DestinationAddressPrefix, w.DestinationAddressPrefix) &&
+		equal(e.DestinationPortRange, w.DestinationPortRange)
+}
+
+// ensureTunnelSecurityRules creates or fixes the tunnel rules on the configured network
+// security group. Rules that already match are left untouched, so it is safe to run on every start.
+func (p *azureProvider) ensureTunnelSecurityRules(ctx context.Context, client securityRulesClient) error {
+	for name, wanted := range tunnelSecurityRules(p.serviceConfig) {
+		existing, err := client.get(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if existing != nil && securityRuleMatches(existing, &wanted) {
+			logger.Printf("network security group rule %s is up to date", name)
+			continue
+		}
+
+		if existing == nil {
+			logger.Printf("creating network security group rule %s allowing %s %s port %s", name,
+				*wanted.Properties.Direction, *wanted.Properties.Protocol, *wanted.Properties.DestinationPortRange)
+		} else {
+			logger.Printf("updating network security group rule %s to allow %s %s port %s", name,
+				*wanted.Properties.Direction, *wanted.Properties.Protocol, *wanted.Properties.DestinationPortRange)
+		}
+		if err := client.createOrUpdate(ctx, name, wanted); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"flag"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	armnetwork "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+)
+
+// Mock security rules client keeping the rules in memory
+type mockSecurityRulesClient struct {
+	rules   map[string]armnetwork.SecurityRule
+	creates []string
+}
+
+func (m *mockSecurityRulesClient) get(ctx context.Context, ruleName string) (*armnetwork.SecurityRule, error) {
+	rule, ok := m.rules[ruleName]
+	if !ok {
+		return nil, nil
+	}
+	return &rule, nil
+}
+
+func (m *mockSecurityRulesClient) createOrUpdate(ctx context.Context, ruleName string, rule armnetwork.SecurityRule) error {
+	m.creates = append(m.creates, ruleName)
+	m.rules[ruleName] = rule
+	return nil
+}
+
+func TestEnsureTunnelSecurityRules(t *testing.T) {
+	p := &azureProvider{
+		serviceConfig: &Config{
+			ForwarderPort: "15150",
+			VXLANPort:     "4789",
+		},
+	}
+	client := &mockSecurityRulesClient{rules: map[string]armnetwork.SecurityRule{}}
+
+	if err := p.ensureTunnelSecurityRules(context.Background(), client); err != nil {
+		t.Fatalf("ensureTunnelSecurityRules() error = %v", err)
+	}
+	if len(client.creates) != 3 {
+		t.Fatalf("expected 3 rules to be created, got %v", client.creates)
+	}
+
+	forwarder := client.rules["peerpods-forwarder-inbound"]
+	if *forwarder.Properties.DestinationPortRange != "15150" || *forwarder.Properties.Protocol != armnetwork.SecurityRuleProtocolTCP {
+		t.Errorf("unexpected forwarder rule %+v", forwarder.Properties)
+	}
+	if *forwarder.Properties.SourceAddressPrefix != defaultNSGRuleSourcePrefix {
+		t.Errorf("expected source prefix %s, got %s", defaultNSGRuleSourcePrefix, *forwarder.Properties.SourceAddressPrefix)
+	}
+
+	// Running again with the rules in place must not touch them
+	client.creates = nil
+	if err := p.ensureTunnelSecurityRules(context.Background(), client); err != nil {
+		t.Fatalf("ensureTunnelSecurityRules() error = %v", err)
+	}
+	if len(client.creates) != 0 {
+		t.Errorf("expected no rules to be updated, got %v", client.creates)
+	}
+
+	// A rule changed out of band is fixed
+	drifted := client.rules["peerpods-vxlan-inbound"]
+	drifted.Properties.DestinationPortRange = to.Ptr("8472")
+	client.rules["peerpods-vxlan-inbound"] = drifted
+
+	if err := p.ensureTunnelSecurityRules(context.Background(), client); err != nil {
+		t.Fatalf("ensureTunnelSecurityRules() error = %v", err)
+	}
+	if len(client.creates) != 1 || client.creates[0] != "peerpods-vxlan-inbound" {
+		t.Errorf("expected only the drifted rule to be updated, got %v", client.creates)
+	}
+	if port := *client.rules["peerpods-vxlan-inbound"].Properties.DestinationPortRange; port != "4789" {
+		t.Errorf("expected VXLAN port 4789, got %s", port)
+	}
+}
+
+func TestTunnelPortsFromFlags(t *testing.T) {
+	config := &Config{ForwarderPort: defaultForwarderPort, VXLANPort: defaultVXLANPort}
+
+	// Without the flags of the cloud-api-adaptor, the ports from the environment are kept
+	tunnelPortsFromFlags(config, nil)
+	tunnelPortsFromFlags(config, flag.NewFlagSet("test", flag.ContinueOnError))
+	if config.ForwarderPort != defaultForwarderPort || config.VXLANPort != defaultVXLANPort {
+		t.Fatalf("ports = %s, %s, want the defaults", config.ForwarderPort, config.VXLANPort)
+	}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.String("forwarder-port", "15150", "")
+	flags.Int("vxlan-port", 4789, "")
+	if err := flags.Parse([]string{"-forwarder-port", "16000", "-vxlan-port", "4790"}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tunnelPortsFromFlags(config, flags)
+	if config.ForwarderPort != "16000" || config.VXLANPort != "4790" {
+		t.Errorf("ports = %s, %s, want 16000, 4790 from the flags", config.ForwarderPort, config.VXLANPort)
+	}
+}
@@ -0,0 +1,268 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+)
+
+// imageInfo holds the image properties that determine which VM sizes it can run on
+type imageInfo struct {
+	// HyperVGeneration is either "V1" or "V2"
+	HyperVGeneration string
+	// ConfidentialVM is true when the image is published with a ConfidentialVM security type
+	ConfidentialVM bool
+	// Hibernation is true when the image can be used for VMs with hibernation enabled
+	Hibernation bool
+}
+
+// sizeInfo holds the VM size capabilities that are matched against an image
+type sizeInfo struct {
+	// HyperVGenerations lists the supported generations, nil when unknown
+	HyperVGenerations []string
+	// ConfidentialVM is true when the size supports confidential computing
+	ConfidentialVM bool
+	// Hibernation is true when the size supports hibernation
+	Hibernation bool
+}
+
+// imageMetadataClient retrieves the image and VM size metadata used by the preflight check
+type imageMetadataClient interface {
+	getImageInfo(ctx context.Context, imageID string) (*imageInfo, error)
+	getSizeInfo(ctx context.Context, sizes []string) (map[string]*sizeInfo, error)
+}
+
+var (
+	communityGalleryImageRe = regexp.MustCompile(`^/CommunityGalleries/([^/]+)/Images/([^/]+)(/Versions/[^/]+)?$`)
+	galleryImageRe          = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/([^/]+)/providers/Microsoft\.Compute/galleries/([^/]+)/images/([^/]+)(/versions/[^/]+)?$`)
+	managedImageRe          = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/([^/]+)/providers/Microsoft\.Compute/images/([^/]+)$`)
+)
+
+type azureImageMetadataClient struct {
+	credential     azcore.TokenCredential
+	subscriptionID string
+	region         string
+}
+
+func newImageMetadataClient(config *Config, credential azcore.TokenCredential) imageMetadataClient {
+	return &azureImageMetadataClient{
+		credential:     credential,
+		subscriptionID: config.SubscriptionId,
+		region:         config.Region,
+	}
+}
+
+func (c *azureImageMetadataClient) getImageInfo(ctx context.Context, imageID string) (*imageInfo, error) {
+	if match := communityGalleryImageRe.FindStringSubmatch(imageID); match != nil {
+		client, err := armcompute.NewCommunityGalleryImagesClient(c.subscriptionID, c.credential, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating community gallery images client: %w", err)
+		}
+		resp, err := client.Get(ctx, c.region, match[1], match[2], nil)
+		if err != nil {
+			return nil, fmt.Errorf("getting community gallery image %q: %w", imageID, err)
+		}
+		if resp.Properties == nil {
+			return nil, fmt.Errorf("community gallery image %q has no properties", imageID)
+		}
+		return newGalleryImageInfo(resp.Properties.HyperVGeneration, resp.Properties.Features), nil
+	}
+
+	if match := galleryImageRe.FindStringSubmatch(imageID); match != nil {
+		client, err := armcompute.NewGalleryImagesClient(c.subscriptionID, c.credential, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating gallery images client: %w", err)
+		}
+		resp, err := client.Get(ctx, match[1], match[2], match[3], nil)
+		if err != nil {
+			return nil, fmt.Errorf("getting gallery image %q: %w", imageID, err)
+		}
+		if resp.Properties == nil {
+			return nil, fmt.Errorf("gallery image %q has no properties", imageID)
+		}
+		return newGalleryImageInfo(resp.Properties.HyperVGeneration, resp.Properties.Features), nil
+	}
+
+	if match := managedImageRe.FindStringSubmatch(imageID); match != nil {
+		client, err := armcompute.NewImagesClient(c.subscriptionID, c.credential, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating images client: %w", err)
+		}
+		resp, err := client.Get(ctx, match[1], match[2], nil)
+		if err != nil {
+			return nil, fmt.Errorf("getting image %q: %w", imageID, err)
+		}
+		info := &imageInfo{HyperVGeneration: string(armcompute.HyperVGenerationTypesV1)}
+		if resp.Properties != nil && resp.Properties.HyperVGeneration != nil {
+			info.HyperVGeneration = string(*resp.Properties.HyperVGeneration)
+		}
+		// Managed images can't carry a security type, so they are never CVM capable.
+		// Unlike gallery images, they don't have to declare hibernation support.
+		info.Hibernation = true
+		return info, nil
+	}
+
+	if ref, err := imageReference(imageID); err == nil && ref.Publisher != nil {
+		return nil, fmt.Errorf("looking up marketplace image %q is not supported", imageID)
+	}
+
+	return nil, fmt.Errorf("unrecognized image id format %q", imageID)
+}
+
+func newGalleryImageInfo(generation *armcompute.HyperVGeneration, features []*armcompute.GalleryImageFeature) *imageInfo {
+	// Gallery images default to generation V1 when it isn't set
+	info := &imageInfo{HyperVGeneration: string(armcompute.HyperVGenerationV1)}
+	if generation != nil {
+		info.HyperVGeneration = string(*generation)
+	}
+
+	for _, feature := range features {
+		if feature == nil || feature.Name == nil || feature.Value == nil {
+			continue
+		}
+		// The SecurityType feature is one of ConfidentialVM, ConfidentialVMSupported,
+		// TrustedLaunchAndConfidentialVmSupported, TrustedLaunch or TrustedLaunchSupported
+		if strings.EqualFold(*feature.Name, "SecurityType") &&
+			strings.Contains(strings.ToLower(*feature.Value), "confidentialvm") {
+			info.ConfidentialVM = true
+		}
+		if strings.EqualFold(*feature.Name, "IsHibernateSupported") && strings.EqualFold(*feature.Value, "true") {
+			info.Hibernation = true
+		}
+	}
+	return info
+}
+
+func (c *azureImageMetadataClient) getSizeInfo(ctx context.Context, sizes []string) (map[string]*sizeInfo, error) {
+	client, err := armcompute.NewResourceSKUsClient(c.subscriptionID, c.credential, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating resource SKUs client: %w", err)
+	}
+
+	result := make(map[string]*sizeInfo)
+
+	pager := client.NewListPager(&armcompute.ResourceSKUsClientListOptions{
+		Filter: to.Ptr(fmt.Sprintf("location eq '%s'", c.region)),
+	})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting next page of resource SKUs: %w", err)
+		}
+		for _, sku := range page.Value {
+			if sku == nil || sku.Name == nil || sku.ResourceType == nil {
+				continue
+			}
+			if *sku.ResourceType != "virtualMachines" || !util.Contains(sizes, *sku.Name) {
+				continue
+			}
+			result[*sku.Name] = newSizeInfo(sku.Capabilities)
+		}
+	}
+
+	return result, nil
+}
+
+func newSizeInfo(capabilities []*armcompute.ResourceSKUCapabilities) *sizeInfo {
+	info := &sizeInfo{}
+	for _, capability := range capabilities {
+		if capability == nil || capability.Name == nil || capability.Value == nil {
+			continue
+		}
+		switch *capability.Name {
+		case "HyperVGenerations":
+			for _, gen := range strings.Split(*capability.Value, ",") {
+				info.HyperVGenerations = append(info.HyperVGenerations, strings.TrimSpace(gen))
+			}
+		case "ConfidentialComputingType":
+			info.ConfidentialVM = *capability.Value != ""
+		case "HibernationSupported":
+			info.Hibernation = strings.EqualFold(*capability.Value, "true")
+		}
+	}
+	return info
+}
+
+// checkImageSizeCompatibility returns an error describing how to fix the configuration
+// when the image can't be deployed on the VM size
+func checkImageSizeCompatibility(imageID string, image *imageInfo, size string, capabilities *sizeInfo, cvm, hibernation bool) error {
+	if len(capabilities.HyperVGenerations) > 0 && !util.Contains(capabilities.HyperVGenerations, image.HyperVGeneration) {
+		return fmt.Errorf("image %q is Hyper-V generation %s, but VM size %q only supports %s: select a VM size supporting %s or use an image built for %s",
+			imageID, image.HyperVGeneration, size, strings.Join(capabilities.HyperVGenerations, ","),
+			image.HyperVGeneration, strings.Join(capabilities.HyperVGenerations, " or "))
+	}
+
+	if hibernation && !capabilities.Hibernation {
+		return fmt.Errorf("VM size %q does not support hibernation: select a VM size supporting hibernation or unset -use-hibernation", size)
+	}
+	if hibernation && !image.Hibernation {
+		return fmt.Errorf("image %q does not have the IsHibernateSupported feature: use an image supporting hibernation or unset -use-hibernation", imageID)
+	}
+
+	if !cvm {
+		return nil
+	}
+
+	if !capabilities.ConfidentialVM {
+		return fmt.Errorf("VM size %q does not support confidential VMs: select a confidential VM size (e.g. Standard_DC2as_v5) or set -disable-cvm", size)
+	}
+	if image.HyperVGeneration != string(armcompute.HyperVGenerationV2) {
+		return fmt.Errorf("image %q is Hyper-V generation %s, but confidential VMs require a V2 image: use a V2 image or set -disable-cvm", imageID, image.HyperVGeneration)
+	}
+	if !image.ConfidentialVM {
+		return fmt.Errorf("image %q does not have a ConfidentialVM security type: use a CVM capable image or set -disable-cvm", imageID)
+	}
+
+	return nil
+}
+
+// preflightImageSizeCheck verifies the configured image against all configured instance sizes.
+// Metadata lookup failures are only logged, since the image or SKU details might not be
+// readable with the permissions granted to the adaptor.
+func (p *azureProvider) preflightImageSizeCheck(ctx context.Context) error {
+	imageID := p.serviceConfig.ImageId
+	if imageID == "" {
+		return nil
+	}
+
+	sizes := p.serviceConfig.InstanceSizes
+	if len(sizes) == 0 {
+		sizes = []string{p.serviceConfig.Size}
+	}
+
+	image, err := p.metadataClient.getImageInfo(ctx, imageID)
+	if err != nil {
+		logger.Printf("skipping image and VM size compatibility check: %v", err)
+		return nil
+	}
+
+	sizeInfos, err := p.metadataClient.getSizeInfo(ctx, sizes)
+	if err != nil {
+		logger.Printf("skipping image and VM size compatibility check: %v", err)
+		return nil
+	}
+
+	var errs []error
+	for _, size := range sizes {
+		capabilities, ok := sizeInfos[size]
+		if !ok {
+			logger.Printf("no capabilities found for VM size %q in region %q, skipping compatibility check", size, p.serviceConfig.Region)
+			continue
+		}
+		if err := checkImageSizeCompatibility(imageID, image, size, capabilities, p.serviceConfig.vmSecurityType() == securityTypeConfidentialVM, p.serviceConfig.UseHibernation); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
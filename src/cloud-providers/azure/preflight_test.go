@@ -0,0 +1,216 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
+)
+
+// Mock image metadata client
+type mockImageMetadataClient struct {
+	images   map[string]*imageInfo
+	sizes    map[string]*sizeInfo
+	imageErr error
+}
+
+func (m *mockImageMetadataClient) getImageInfo(ctx context.Context, imageID string) (*imageInfo, error) {
+	if m.imageErr != nil {
+		return nil, m.imageErr
+	}
+	info, ok := m.images[imageID]
+	if !ok {
+		return nil, fmt.Errorf("image %q not found", imageID)
+	}
+	return info, nil
+}
+
+func (m *mockImageMetadataClient) getSizeInfo(ctx context.Context, sizes []string) (map[string]*sizeInfo, error) {
+	return m.sizes, nil
+}
+
+const (
+	gen1Image = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/images/gen1"
+	gen2Image = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/images/gen2"
+	cvmImage  = "/CommunityGalleries/cococommunity/Images/podvm/Versions/latest"
+	// gallery image with the IsHibernateSupported feature
+	hibernateImage = "/CommunityGalleries/cococommunity/Images/podvm-hibernate/Versions/latest"
+)
+
+func newMockImageMetadataClient() *mockImageMetadataClient {
+	return &mockImageMetadataClient{
+		images: map[string]*imageInfo{
+			gen1Image:      {HyperVGeneration: "V1", Hibernation: true},
+			gen2Image:      {HyperVGeneration: "V2", Hibernation: true},
+			cvmImage:       {HyperVGeneration: "V2", ConfidentialVM: true},
+			hibernateImage: {HyperVGeneration: "V2", Hibernation: true},
+		},
+		sizes: map[string]*sizeInfo{
+			"Standard_DC2as_v5": {HyperVGenerations: []string{"V2"}, ConfidentialVM: true},
+			"Standard_D2as_v5":  {HyperVGenerations: []string{"V1", "V2"}, Hibernation: true},
+			"Standard_A2_v2":    {HyperVGenerations: []string{"V1"}},
+		},
+	}
+}
+
+func TestPreflightImageSizeCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		imageID     string
+		sizes       []string
+		disableCVM  bool
+		hibernation bool
+		imageErr    error
+		wantErr     bool
+	}{
+		{
+			name:    "cvm image on cvm size",
+			imageID: cvmImage,
+			sizes:   []string{"Standard_DC2as_v5"},
+		},
+		{
+			name:       "gen2 image on gen1 and gen2 size",
+			imageID:    gen2Image,
+			sizes:      []string{"Standard_D2as_v5"},
+			disableCVM: true,
+		},
+		{
+			name:       "gen1 image on gen1 size",
+			imageID:    gen1Image,
+			sizes:      []string{"Standard_A2_v2"},
+			disableCVM: true,
+		},
+		{
+			name:       "gen2 image on gen1 only size",
+			imageID:    gen2Image,
+			sizes:      []string{"Standard_A2_v2"},
+			disableCVM: true,
+			wantErr:    true,
+		},
+		{
+			name:       "gen1 image on gen2 only size",
+			imageID:    gen1Image,
+			sizes:      []string{"Standard_DC2as_v5"},
+			disableCVM: true,
+			wantErr:    true,
+		},
+		{
+			name:    "cvm image on non confidential size",
+			imageID: cvmImage,
+			sizes:   []string{"Standard_D2as_v5"},
+			wantErr: true,
+		},
+		{
+			name:    "non cvm image on cvm size",
+			imageID: gen2Image,
+			sizes:   []string{"Standard_DC2as_v5"},
+			wantErr: true,
+		},
+		{
+			name:    "one incompatible size in the list",
+			imageID: cvmImage,
+			sizes:   []string{"Standard_DC2as_v5", "Standard_D2as_v5"},
+			wantErr: true,
+		},
+		{
+			name:        "hibernation on supported size and image",
+			imageID:     hibernateImage,
+			sizes:       []string{"Standard_D2as_v5"},
+			disableCVM:  true,
+			hibernation: true,
+		},
+		{
+			name:        "hibernation on unsupported size",
+			imageID:     gen1Image,
+			sizes:       []string{"Standard_A2_v2"},
+			disableCVM:  true,
+			hibernation: true,
+			wantErr:     true,
+		},
+		{
+			name:        "hibernation with unsupported image",
+			imageID:     cvmImage,
+			sizes:       []string{"Standard_D2as_v5"},
+			disableCVM:  true,
+			hibernation: true,
+			wantErr:     true,
+		},
+		{
+			name:    "unknown size is skipped",
+			imageID: cvmImage,
+			sizes:   []string{"Standard_Unknown"},
+		},
+		{
+			name:     "image lookup failure is skipped",
+			imageID:  cvmImage,
+			sizes:    []string{"Standard_A2_v2"},
+			imageErr: fmt.Errorf("authorization failed"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newMockImageMetadataClient()
+			client.imageErr = tt.imageErr
+			p := &azureProvider{
+				serviceConfig: &Config{
+					ImageId:        tt.imageID,
+					InstanceSizes:  tt.sizes,
+					DisableCVM:     tt.disableCVM,
+					UseHibernation: tt.hibernation,
+				},
+				metadataClient: client,
+			}
+
+			err := p.preflightImageSizeCheck(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("preflightImageSizeCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewGalleryImageInfo(t *testing.T) {
+	info := newGalleryImageInfo(to.Ptr(armcompute.HyperVGenerationV2), []*armcompute.GalleryImageFeature{
+		{Name: to.Ptr("SecurityType"), Value: to.Ptr("ConfidentialVMSupported")},
+	})
+	if info.HyperVGeneration != "V2" || !info.ConfidentialVM {
+		t.Errorf("newGalleryImageInfo() = %+v, want V2 confidential image", info)
+	}
+
+	info = newGalleryImageInfo(nil, []*armcompute.GalleryImageFeature{
+		{Name: to.Ptr("SecurityType"), Value: to.Ptr("TrustedLaunch")},
+	})
+	if info.HyperVGeneration != "V1" || info.ConfidentialVM {
+		t.Errorf("newGalleryImageInfo() = %+v, want V1 non confidential image", info)
+	}
+
+	info = newGalleryImageInfo(nil, []*armcompute.GalleryImageFeature{
+		{Name: to.Ptr("IsHibernateSupported"), Value: to.Ptr("True")},
+	})
+	if !info.Hibernation {
+		t.Errorf("newGalleryImageInfo() = %+v, want image supporting hibernation", info)
+	}
+}
+
+func TestNewSizeInfo(t *testing.T) {
+	info := newSizeInfo([]*armcompute.ResourceSKUCapabilities{
+		{Name: to.Ptr("HyperVGenerations"), Value: to.Ptr("V1,V2")},
+		{Name: to.Ptr("ConfidentialComputingType"), Value: to.Ptr("SNP")},
+	})
+	if len(info.HyperVGenerations) != 2 || !info.ConfidentialVM {
+		t.Errorf("newSizeInfo() = %+v, want V1,V2 confidential size", info)
+	}
+
+	info = newSizeInfo([]*armcompute.ResourceSKUCapabilities{
+		{Name: to.Ptr("HibernationSupported"), Value: to.Ptr("True")},
+	})
+	if !info.Hibernation {
+		t.Errorf("newSizeInfo() = %+v, want size supporting hibernation", info)
+	}
+}
@@ -7,17 +7,22 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/netip"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
 	armnetwork "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
@@ -31,13 +36,68 @@ var logger = log.New(log.Writer(), "[adaptor/cloud/azure] ", log.LstdFlags|log.L
 var errNotReady = errors.New("address not ready")
 var errNotFound = errors.New("VM name not found")
 
+// Error code of the VM creations with accelerated networking on a VM size not supporting it
+const errCodeAcceleratedNetworkingNotPermitted = "VMSizeIsNotPermittedToEnableAcceleratedNetworking"
+
+// The private IPs of a new VM are polled about every ipPollInterval while they aren't assigned,
+// at most ipPollAttempts times
+const (
+	ipPollInterval = 5 * time.Second
+	ipPollAttempts = 12
+)
+
+// How long deleting a VM that failed to get ready may take
+const deleteCreatedTimeout = 2 * time.Minute
+
 const (
 	maxInstanceNameLen = 63
+	maxComputerNameLen = 63  // Length of a hostname label
+	maxTagValueLen     = 256 // Length of an Azure tag value
 )
 
+var nonHostnameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Characters Azure doesn't allow in tag names, also rejected by some services in values
+var invalidTagChars = regexp.MustCompile(`[<>%&\\?/]+`)
+
+// computerName returns the hostname of the VM named instanceName. Azure VM names may contain
+// upper case letters, dots and underscores, and be 64 characters long, which are not all valid
+// in a hostname label (RFC 1123), so the name is converted and truncated.
+func computerName(instanceName string) string {
+	name := nonHostnameChars.ReplaceAllString(strings.ToLower(instanceName), "-")
+	if len(name) > maxComputerNameLen {
+		name = name[:maxComputerNameLen]
+	}
+	name = strings.Trim(name, "-")
+
+	// Azure rejects purely numeric Linux computer names
+	if strings.Trim(name, "0123456789") == "" {
+		name = strings.Trim("podvm-"+name, "-")
+		if len(name) > maxComputerNameLen {
+			name = name[:maxComputerNameLen]
+		}
+	}
+	return name
+}
+
 type azureProvider struct {
-	azureClient   azcore.TokenCredential
-	serviceConfig *Config
+	azureClient     azcore.TokenCredential
+	clientOptions   *arm.ClientOptions // nil uses the SDK defaults, set in tests to fake the transport
+	serviceConfig   *Config
+	metadataClient  imageMetadataClient
+	spotPriceClient spotPriceClient
+	zones           []string
+	nextZoneIndex   atomic.Uint64
+	userDataStore   userDataStore // nil when oversized userData is not supported
+	nodeName        string        // Worker node of the adaptor, recorded in the tags of the VMs
+
+	readFile     func(string) ([]byte, error) // nil uses os.ReadFile, set in tests to count the reads
+	sshKeyMutex  sync.Mutex
+	sshPublicKey []byte
+	clock        provider.Clock // nil uses the system clock
+
+	stopCleanup context.CancelFunc // Stops the orphaned disk cleanup, nil if disabled
+	cleanupDone chan struct{}      // Closed when the orphaned disk cleanup has stopped
 }
 
 func NewProvider(config *Config) (provider.Provider, error) {
@@ -56,17 +116,133 @@ func NewProvider(config *Config) (provider.Provider, error) {
 	}
 
 	provider := &azureProvider{
-		azureClient:   azureClient,
-		serviceConfig: config,
+		azureClient:     azureClient,
+		serviceConfig:   config,
+		metadataClient:  newImageMetadataClient(config, azureClient),
+		spotPriceClient: newSpotPriceClient(),
+		zones:           parseZones(config.Zone),
+		nodeName:        os.Getenv("NODE_NAME"),
 	}
 
 	if err = provider.updateInstanceSizeSpecList(); err != nil {
 		return nil, err
 	}
 
+	// Read the SSH public key up front. On failure it is read again on the next create.
+	if config.SSHPubKey == "" && config.SSHKeyPath != "" {
+		if _, err := provider.getSSHPublicKey(); err != nil {
+			logger.Printf("loading SSH public key: %v", err)
+		}
+	}
+
+	if err = provider.preflightImageSizeCheck(context.Background()); err != nil {
+		return nil, fmt.Errorf("image and VM size compatibility check: %w", err)
+	}
+
+	if config.UseSpot {
+		config.SpotMaxPrice = provider.preflightSpotPrice(context.Background(), config.SpotMaxPrice)
+	}
+
+	if hostID := config.dedicatedHostID(); hostID != "" {
+		hostClient, err := newDedicatedHostClient(hostID, azureClient, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := provider.preflightDedicatedHostCheck(context.Background(), hostClient); err != nil {
+			return nil, fmt.Errorf("dedicated host and VM size compatibility check: %w", err)
+		}
+	}
+
+	// Only warn, as the worker node may be reachable through routes the check can't see
+	if config.SubnetId != "" {
+		vnetClient, err := newVirtualNetworkClient(config.SubnetId, azureClient, nil)
+		if err == nil {
+			err = provider.validateSubnetReachability(context.Background(), vnetClient, os.Getenv("NODE_IP"))
+		}
+		if err != nil {
+			logger.Printf("subnet reachability check: %v", err)
+		}
+	}
+
+	if config.UserDataStorageAccount != "" {
+		store, err := newBlobUserDataStore(azureClient, blobServiceURL(config.UserDataStorageAccount), config.UserDataStorageContainer, nil)
+		if err != nil {
+			return nil, fmt.Errorf("userData storage: %w", err)
+		}
+		if err := store.ensureContainer(context.Background()); err != nil {
+			return nil, fmt.Errorf("userData storage: %w", err)
+		}
+		provider.userDataStore = store
+	}
+
+	if config.EnsureNSGRules {
+		if config.SecurityGroupId == "" {
+			return nil, fmt.Errorf("-ensure-nsg-rules requires -securitygroupid")
+		}
+		rulesClient, err := newSecurityRulesClient(config.SecurityGroupId, azureClient, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := provider.ensureTunnelSecurityRules(context.Background(), rulesClient); err != nil {
+			return nil, fmt.Errorf("ensuring network security group rules: %w", err)
+		}
+	}
+
+	if config.CleanupOrphanedDisks {
+		provider.startOrphanedDiskCleanup()
+	}
+
 	return provider, nil
 }
 
+// startOrphanedDiskCleanup deletes the disks leaked by failed creates in the background not to
+// delay the startup, until it is done or Close is called
+func (p *azureProvider) startOrphanedDiskCleanup() {
+	var ctx context.Context
+	ctx, p.stopCleanup = context.WithTimeout(context.Background(), teardownTimeout)
+	p.cleanupDone = make(chan struct{})
+
+	go func() {
+		defer close(p.cleanupDone)
+		if err := p.cleanupOrphanedDisks(ctx); err != nil {
+			logger.Printf("deleting orphaned disks: %v", err)
+		}
+	}()
+}
+
+// Close stops the orphaned disk cleanup
+func (p *azureProvider) Close() error {
+	if p.stopCleanup != nil {
+		p.stopCleanup()
+		<-p.cleanupDone
+	}
+	return nil
+}
+
+// osDiskStorageAccountTypes returns the storage account types Azure accepts for OS disks.
+// Premium SSD v2 and Ultra disks can only be data disks.
+func osDiskStorageAccountTypes() []armcompute.StorageAccountTypes {
+	return slices.DeleteFunc(armcompute.PossibleStorageAccountTypesValues(), func(t armcompute.StorageAccountTypes) bool {
+		return t == armcompute.StorageAccountTypesPremiumV2LRS || t == armcompute.StorageAccountTypesUltraSSDLRS
+	})
+}
+
+// osDiskStorageAccountType returns the storage account type of the OS disks, Premium SSD by default
+func (p *azureProvider) osDiskStorageAccountType() armcompute.StorageAccountTypes {
+	if p.serviceConfig.RootVolumeType != "" {
+		return armcompute.StorageAccountTypes(p.serviceConfig.RootVolumeType)
+	}
+	return armcompute.StorageAccountTypesPremiumLRS
+}
+
+// osDiskDeleteOption returns what happens to the OS disk of a VM when the VM is deleted
+func (p *azureProvider) osDiskDeleteOption() armcompute.DiskDeleteOptionTypes {
+	if p.serviceConfig.RetainOSDiskOnDelete {
+		return armcompute.DiskDeleteOptionTypesDetach
+	}
+	return armcompute.DiskDeleteOptionTypesDelete
+}
+
 func parseIP(addr string) (*netip.Addr, error) {
 	if addr == "" || addr == "0.0.0.0" {
 		return nil, errNotReady
@@ -111,7 +287,7 @@ func generateSSHPublicKey() ([]byte, error) {
 }
 
 func (p *azureProvider) getIPs(ctx context.Context, vm *armcompute.VirtualMachine) ([]netip.Addr, error) {
-	nicClient, err := armnetwork.NewInterfacesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+	nicClient, err := armnetwork.NewInterfacesClient(p.serviceConfig.SubscriptionId, p.azureClient, p.clientOptions)
 	if err != nil {
 		return nil, fmt.Errorf("create network interfaces client: %w", err)
 	}
@@ -134,7 +310,7 @@ func (p *azureProvider) getIPs(ctx context.Context, vm *armcompute.VirtualMachin
 
 	// we add the public ip addresses as first elements, if available
 	if p.serviceConfig.UsePublicIP {
-		publicIPClient, err := armnetwork.NewPublicIPAddressesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+		publicIPClient, err := armnetwork.NewPublicIPAddressesClient(p.serviceConfig.SubscriptionId, p.azureClient, p.clientOptions)
 		if err != nil {
 			return nil, fmt.Errorf("create public ip client: %w", err)
 		}
@@ -164,7 +340,7 @@ func (p *azureProvider) getIPs(ctx context.Context, vm *armcompute.VirtualMachin
 	for i, ipc := range ipcs {
 		addr := ipc.Properties.PrivateIPAddress
 		if addr == nil {
-			return nil, fmt.Errorf("private IP address not found in IP configuration %d", i)
+			return nil, fmt.Errorf("private IP address not found in IP configuration %d: %w", i, errNotReady)
 		}
 		ip, err := parseIP(*addr)
 		if err != nil {
@@ -177,22 +353,54 @@ func (p *azureProvider) getIPs(ctx context.Context, vm *armcompute.VirtualMachin
 	return ips, nil
 }
 
-func (p *azureProvider) create(ctx context.Context, parameters *armcompute.VirtualMachine) (*armcompute.VirtualMachine, error) {
-	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+// instanceIPs returns the IPs of the new VM vm, getting them again while its private IPs
+// aren't assigned yet
+func (p *azureProvider) instanceIPs(ctx context.Context, vm *armcompute.VirtualMachine) ([]netip.Addr, error) {
+	var ips []netip.Addr
+	err := provider.WithCloudRetry(ctx, func(ctx context.Context) error {
+		var err error
+		ips, err = p.getIPs(ctx, vm)
+		if errors.Is(err, errNotReady) {
+			logger.Printf("VM %s has no private IP yet", *vm.ID)
+		}
+		return err
+	}, provider.RetryOptions{
+		Attempts:     ipPollAttempts,
+		InitialDelay: ipPollInterval,
+		MaxDelay:     ipPollInterval,
+		Retryable: func(err error) bool {
+			return errors.Is(err, errNotReady)
+		},
+		Timer: p.getClock(),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("creating VM client: %w", err)
+		return nil, err
 	}
+	return ips, nil
+}
+
+// getClock returns the clock of the provider, the system clock if unset
+func (p *azureProvider) getClock() provider.Clock {
+	if p.clock == nil {
+		return provider.RealClock{}
+	}
+	return p.clock
+}
 
-	vmName := *parameters.Properties.OSProfile.ComputerName
+func (p *azureProvider) create(ctx context.Context, vmName string, parameters *armcompute.VirtualMachine) (*armcompute.VirtualMachine, error) {
+	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, p.clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("creating VM client: %w", err)
+	}
 
 	pollerResponse, err := vmClient.BeginCreateOrUpdate(ctx, p.serviceConfig.ResourceGroupName, vmName, *parameters, nil)
 	if err != nil {
-		return nil, fmt.Errorf("beginning VM creation or update: %w", err)
+		return nil, fmt.Errorf("beginning VM creation or update: %w", p.createError(err, parameters))
 	}
 
 	resp, err := pollerResponse.PollUntilDone(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("waiting for the VM creation: %w", err)
+		return nil, fmt.Errorf("waiting for the VM creation: %w", p.createError(err, parameters))
 	}
 
 	logger.Printf("created VM successfully: %s", *resp.ID)
@@ -200,6 +408,17 @@ func (p *azureProvider) create(ctx context.Context, parameters *armcompute.Virtu
 	return &resp.VirtualMachine, nil
 }
 
+// createError turns the error of a VM creation into an actionable error when its cause is a
+// known misconfiguration or a lack of capacity
+func (p *azureProvider) createError(err error, parameters *armcompute.VirtualMachine) error {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) && respErr.ErrorCode == errCodeAcceleratedNetworkingNotPermitted {
+		return fmt.Errorf("VM size %s does not support accelerated networking: configure a VM size supporting it or unset -enable-accelerated-networking: %w",
+			vmSize(parameters), err)
+	}
+	return p.quotaError(err, parameters)
+}
+
 func (p *azureProvider) buildNetworkConfig(nicName string) *armcompute.VirtualMachineNetworkInterfaceConfiguration {
 	ipConfig := armcompute.VirtualMachineNetworkInterfaceIPConfiguration{
 		Name: to.Ptr("ip-config"),
@@ -210,6 +429,12 @@ func (p *azureProvider) buildNetworkConfig(nicName string) *armcompute.VirtualMa
 		},
 	}
 
+	for _, id := range p.serviceConfig.ApplicationSecurityGroupIds {
+		ipConfig.Properties.ApplicationSecurityGroups = append(ipConfig.Properties.ApplicationSecurityGroups, &armcompute.SubResource{
+			ID: to.Ptr(id),
+		})
+	}
+
 	if p.serviceConfig.UsePublicIP {
 		publicIpConfig := armcompute.VirtualMachinePublicIPAddressConfiguration{
 			Name: to.Ptr(nicName),
@@ -228,6 +453,11 @@ func (p *azureProvider) buildNetworkConfig(nicName string) *armcompute.VirtualMa
 		},
 	}
 
+	// Only some VM sizes support it, Azure rejects the VM otherwise
+	if p.serviceConfig.EnableAcceleratedNetworking {
+		config.Properties.EnableAcceleratedNetworking = to.Ptr(true)
+	}
+
 	if p.serviceConfig.SecurityGroupId != "" {
 		config.Properties.NetworkSecurityGroup = &armcompute.SubResource{
 			ID: to.Ptr(p.serviceConfig.SecurityGroupId),
@@ -241,7 +471,21 @@ func (p *azureProvider) CreateInstance(ctx context.Context, podName, sandboxID s
 
 	instanceName := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
 
-	cloudConfigData, err := cloudConfig.Generate()
+	pod := provider.PodIdentityFromContext(ctx)
+	if pod.Name == "" {
+		pod.Name = podName
+	}
+	if pod.SandboxID == "" {
+		pod.SandboxID = sandboxID
+	}
+	ctx = provider.WithPodIdentity(ctx, pod)
+
+	userDataGenerator, err := cloudinit.NewUserDataGenerator(p.serviceConfig.UserDataFormat, cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudConfigData, err := userDataGenerator.Generate()
 	if err != nil {
 		return nil, err
 	}
@@ -251,29 +495,13 @@ func (p *azureProvider) CreateInstance(ctx context.Context, podName, sandboxID s
 		return nil, err
 	}
 
-	diskName := fmt.Sprintf("%s-disk", instanceName)
-	nicName := fmt.Sprintf("%s-net", instanceName)
+	diskName := instanceName + diskNameSuffix
+	nicName := instanceName + nicNameSuffix
 
-	sshPublicKeyPath := os.ExpandEnv(p.serviceConfig.SSHKeyPath)
-	var sshBytes []byte
-	if sshPublicKeyPath != "" {
-		// SSH key path provided, read the key
-		logger.Printf("Using existing SSH public key from %s", sshPublicKeyPath)
-		sshBytes, err = os.ReadFile(sshPublicKeyPath)
-		if err != nil {
-			err = fmt.Errorf("reading ssh public key file: %w", err)
-			logger.Printf("%v", err)
-			return nil, err
-		}
-	} else {
-		// SSH key path is empty, generate a new key automatically in memory
-		logger.Printf("SSH public key path is empty, generating new public key")
-		sshBytes, err = generateSSHPublicKey()
-		if err != nil {
-			err = fmt.Errorf("failed to generate SSH public key: %w", err)
-			logger.Printf("%v", err)
-			return nil, err
-		}
+	sshBytes, err := p.getSSHPublicKey()
+	if err != nil {
+		logger.Printf("%v", err)
+		return nil, err
 	}
 
 	imageId := p.serviceConfig.ImageId
@@ -283,35 +511,98 @@ func (p *azureProvider) CreateInstance(ctx context.Context, podName, sandboxID s
 		imageId = spec.Image
 	}
 
-	vmParameters, err := p.getVMParameters(instanceSize, diskName, cloudConfigData, sshBytes, instanceName, nicName, imageId)
+	userData, err := p.userDataFor(ctx, instanceName, cloudConfigData)
+	if err != nil {
+		return nil, err
+	}
+
+	vmParameters, err := p.getVMParameters(instanceSize, diskName, userData, sshBytes, instanceName, nicName, imageId)
 	if err != nil {
 		return nil, err
 	}
 
-	logger.Printf("CreateInstance: name: %q", instanceName)
+	if !p.serviceConfig.DisablePodTags {
+		p.addPodTags(vmParameters.Tags, pod)
+	}
+
+	zone := p.nextZone()
+	if zone != "" {
+		vmParameters.Zones = []*string{to.Ptr(zone)}
+	}
+
+	logger.Printf("CreateInstance: name: %q, zone: %q", instanceName, zone)
 
-	vm, err := p.create(ctx, vmParameters)
+	start := p.getClock().Now()
+	vm, err := p.create(ctx, instanceName, vmParameters)
 	if err != nil {
-		return nil, fmt.Errorf("Creating instance (%v): %s", vm, err)
+		p.cleanupFailedCreate(ctx, nil, instanceName, nicName, diskName)
+		return nil, fmt.Errorf("Creating instance (%v): %w", vm, err)
 	}
 
-	ips, err := p.getIPs(ctx, vm)
+	ips, err := p.instanceIPs(ctx, vm)
 	if err != nil {
 		logger.Printf("getting IPs for the instance : %v ", err)
+		// Nothing tracks the VM yet, it would be left running
+		p.cleanupFailedCreate(ctx, vm, instanceName, nicName, diskName)
 		return nil, err
 	}
 
 	instance := &provider.Instance{
-		ID:   *vm.ID,
-		Name: instanceName,
-		IPs:  ips,
+		ID:    *vm.ID,
+		Name:  instanceName,
+		IPs:   ips,
+		State: provider.InstanceStateRunning,
+		Zone:  zone,
 	}
+	instance.CreationDuration = p.getClock().Now().Sub(start)
 
 	return instance, nil
 }
 
+// cleanupFailedCreate removes, best-effort, what a CreateInstance that fails left behind: the
+// VM vm when it was created, and the userData of instanceName. The NIC and the OS disk of a
+// failed create may outlive it, they are tagged for the teardown. The context of the create
+// may be done, e.g. after a timeout, so it isn't used.
+func (p *azureProvider) cleanupFailedCreate(ctx context.Context, vm *armcompute.VirtualMachine, instanceName, nicName, diskName string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deleteCreatedTimeout)
+	defer cancel()
+
+	if vm != nil && vm.ID != nil {
+		if err := p.DeleteInstance(ctx, *vm.ID); err != nil {
+			logger.Printf("failed to delete VM %s, it must be deleted manually: %v", *vm.ID, err)
+		}
+	}
+	p.deleteUserData(ctx, instanceName)
+	p.tagLeftoverNIC(ctx, nicName)
+	if client, err := newDisksClient(p.serviceConfig.SubscriptionId, p.serviceConfig.ResourceGroupName, p.azureClient, p.clientOptions); err == nil {
+		p.tagLeftoverDisk(ctx, client, diskName)
+	}
+}
+
+// parseZones splits a comma separated list of availability zones
+func parseZones(zone string) []string {
+	var zones []string
+	for _, z := range strings.Split(zone, ",") {
+		if z = strings.TrimSpace(z); z != "" {
+			zones = append(zones, z)
+		}
+	}
+	return zones
+}
+
+// nextZone returns the availability zone for the next pod VM. When several
+// zones are configured the VMs are spread across them round-robin, so that
+// a single zone outage doesn't take down all the pod VMs.
+func (p *azureProvider) nextZone() string {
+	if len(p.zones) == 0 {
+		return ""
+	}
+	i := p.nextZoneIndex.Add(1) - 1
+	return p.zones[i%uint64(len(p.zones))]
+}
+
 func (p *azureProvider) DeleteInstance(ctx context.Context, instanceID string) error {
-	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, p.clientOptions)
 	if err != nil {
 		return fmt.Errorf("creating VM client: %w", err)
 	}
@@ -328,19 +619,111 @@ func (p *azureProvider) DeleteInstance(ctx context.Context, instanceID string) e
 
 	pollerResponse, err := vmClient.BeginDelete(ctx, p.serviceConfig.ResourceGroupName, vmName, nil)
 	if err != nil {
+		if isNotFoundError(err) {
+			logger.Printf("VM %s not found, assuming it is already deleted", vmName)
+			return nil
+		}
 		return fmt.Errorf("beginning VM deletion: %w", err)
 	}
 
 	if _, err = pollerResponse.PollUntilDone(ctx, nil); err != nil {
+		if isNotFoundError(err) {
+			logger.Printf("VM %s not found, assuming it is already deleted", vmName)
+			return nil
+		}
 		return fmt.Errorf("waiting for the VM deletion: %w", err)
 	}
 
 	logger.Printf("deleted VM successfully: %s", vmName)
+	p.deleteUserData(ctx, vmName)
 	return nil
 }
 
+// deleteUserData removes the userData blob of a VM, if userData is stored out of band
+func (p *azureProvider) deleteUserData(ctx context.Context, instanceName string) {
+	if p.userDataStore == nil {
+		return
+	}
+	if err := p.userDataStore.delete(ctx, instanceName); err != nil {
+		logger.Printf("deleting userData of %s: %v", instanceName, err)
+	}
+}
+
+// isNotFoundError returns true when an Azure API call failed because the resource doesn't exist
+func isNotFoundError(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// DeleteInstanceByName deletes the VM named name from the resource group of the provider
+func (p *azureProvider) DeleteInstanceByName(ctx context.Context, name string) error {
+	instanceID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s",
+		p.serviceConfig.SubscriptionId, p.serviceConfig.ResourceGroupName, name)
+	return p.DeleteInstance(ctx, instanceID)
+}
+
 func (p *azureProvider) Teardown() error {
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), teardownTimeout)
+	defer cancel()
+
+	if !p.serviceConfig.TeardownDeleteVMs {
+		return p.cleanupOrphanedDisks(ctx)
+	}
+	// The disks of the VMs are deleted along with them, unless retained, the orphaned ones are left
+	return errors.Join(p.deleteOwnedVMs(ctx), p.deleteOrphanedNICs(ctx), p.cleanupOrphanedDisks(ctx))
+}
+
+// getSSHPublicKey returns the SSH public key of the pod VMs. The inline key takes precedence
+// over the key file. A key file is read and validated once and then cached; if reading it
+// fails, the next call tries again. Without either, a new key is generated in memory for
+// every pod VM.
+func (p *azureProvider) getSSHPublicKey() ([]byte, error) {
+	if p.serviceConfig.SSHPubKey != "" {
+		return parseInlineSSHPublicKey(p.serviceConfig.SSHPubKey)
+	}
+
+	sshPublicKeyPath := os.ExpandEnv(p.serviceConfig.SSHKeyPath)
+	if sshPublicKeyPath == "" {
+		logger.Printf("SSH public key path is empty, generating new public key")
+		sshBytes, err := generateSSHPublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate SSH public key: %w", err)
+		}
+		return sshBytes, nil
+	}
+
+	p.sshKeyMutex.Lock()
+	defer p.sshKeyMutex.Unlock()
+
+	if p.sshPublicKey != nil {
+		return p.sshPublicKey, nil
+	}
+
+	readFile := p.readFile
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
+
+	logger.Printf("Using existing SSH public key from %s", sshPublicKeyPath)
+	sshBytes, err := readFile(sshPublicKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading ssh public key file: %w", err)
+	}
+	if _, _, _, _, err := ssh.ParseAuthorizedKey(sshBytes); err != nil {
+		return nil, fmt.Errorf("parsing ssh public key file %s: %w", sshPublicKeyPath, err)
+	}
+
+	p.sshPublicKey = sshBytes
+	return sshBytes, nil
+}
+
+// parseInlineSSHPublicKey validates an SSH public key given in the config
+func parseInlineSSHPublicKey(key string) ([]byte, error) {
+	sshBytes := []byte(strings.TrimSpace(key))
+	if _, _, _, _, err := ssh.ParseAuthorizedKey(sshBytes); err != nil {
+		return nil, fmt.Errorf("parsing the inline ssh public key: %w", err)
+	}
+	return sshBytes, nil
 }
 
 func (p *azureProvider) ConfigVerifier() error {
@@ -349,9 +732,46 @@ func (p *azureProvider) ConfigVerifier() error {
 		return fmt.Errorf("ImageId is empty")
 	}
 
-	// If defined, verify it's an SSH key file with the right permissions
-	// If empty, it means the SSH key is generated in memory
-	if p.serviceConfig.SSHKeyPath != "" {
+	if p.serviceConfig.SecurityType == securityTypeConfidentialVM && p.serviceConfig.DisableCVM {
+		return fmt.Errorf("-security-type %s and -disable-cvm are mutually exclusive", securityTypeConfidentialVM)
+	}
+
+	if p.serviceConfig.DisableVTPM && p.serviceConfig.vmSecurityType() == securityTypeConfidentialVM {
+		return fmt.Errorf("confidential VMs require the vTPM: set -security-type %s or unset -disable-vtpm", securityTypeTrustedLaunch)
+	}
+
+	if p.serviceConfig.UseHibernation && p.serviceConfig.vmSecurityType() == securityTypeConfidentialVM {
+		return fmt.Errorf("hibernation is not supported on confidential VMs: set -disable-cvm or unset -use-hibernation")
+	}
+
+	if p.serviceConfig.DedicatedHostId != "" && p.serviceConfig.HostGroupId != "" {
+		return fmt.Errorf("-dedicated-host-id and -host-group-id are mutually exclusive: the host implies its group")
+	}
+
+	if p.serviceConfig.UseSpot {
+		switch armcompute.VirtualMachineEvictionPolicyTypes(p.serviceConfig.SpotEvictionPolicy) {
+		case armcompute.VirtualMachineEvictionPolicyTypesDelete, armcompute.VirtualMachineEvictionPolicyTypesDeallocate:
+		default:
+			return fmt.Errorf("invalid spot eviction policy %q: must be Delete or Deallocate", p.serviceConfig.SpotEvictionPolicy)
+		}
+	}
+
+	if err := cloudinit.ValidateUserDataFormat(p.serviceConfig.UserDataFormat); err != nil {
+		return err
+	}
+
+	if rootVolumeType := p.serviceConfig.RootVolumeType; rootVolumeType != "" &&
+		!slices.Contains(osDiskStorageAccountTypes(), armcompute.StorageAccountTypes(rootVolumeType)) {
+		return fmt.Errorf("invalid root volume type %q: must be one of %v", rootVolumeType, osDiskStorageAccountTypes())
+	}
+
+	// The inline key is used over the key file, which must have the right permissions.
+	// Without either, the SSH key is generated in memory.
+	if p.serviceConfig.SSHPubKey != "" {
+		if _, err := parseInlineSSHPublicKey(p.serviceConfig.SSHPubKey); err != nil {
+			return fmt.Errorf("SSH key is invalid: %s", err)
+		}
+	} else if p.serviceConfig.SSHKeyPath != "" {
 		if err := provider.VerifySSHKeyFile(p.serviceConfig.SSHKeyPath); err != nil {
 			return fmt.Errorf("SSH key is invalid: %s", err)
 		}
@@ -370,7 +790,7 @@ func (p *azureProvider) selectInstanceType(ctx context.Context, spec provider.In
 func (p *azureProvider) updateInstanceSizeSpecList() error {
 
 	// Create a new instance of the Virtual Machine Sizes client
-	vmSizesClient, err := armcompute.NewVirtualMachineSizesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+	vmSizesClient, err := armcompute.NewVirtualMachineSizesClient(p.serviceConfig.SubscriptionId, p.azureClient, p.clientOptions)
 	if err != nil {
 		return fmt.Errorf("creating VM sizes client: %w", err)
 	}
@@ -409,7 +829,12 @@ func (p *azureProvider) updateInstanceSizeSpecList() error {
 }
 
 func (p *azureProvider) getResourceTags() map[string]*string {
-	tags := map[string]*string{}
+	tags := map[string]*string{
+		ownerTag: to.Ptr(ownerTagValue),
+	}
+	if p.nodeName != "" {
+		tags[provider.NodeNameTag] = to.Ptr(p.nodeName)
+	}
 
 	// Add custom tags from serviceConfig.Tags
 	for k, v := range p.serviceConfig.Tags {
@@ -418,20 +843,66 @@ func (p *azureProvider) getResourceTags() map[string]*string {
 	return tags
 }
 
-func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig string, sshBytes []byte, instanceName, nicName string, imageId string) (*armcompute.VirtualMachine, error) {
-	userDataB64 := base64.StdEncoding.EncodeToString([]byte(cloudConfig))
+// addPodTags adds the name, namespace and sandbox ID of the pod to the tags of its VM, for
+// cost attribution and debugging. The tags set by the user take precedence.
+func (p *azureProvider) addPodTags(tags map[string]*string, pod provider.PodIdentity) {
+	for k, v := range pod.Tags() {
+		if _, ok := tags[k]; ok {
+			continue
+		}
+		tags[k] = to.Ptr(sanitizeTagValue(v))
+	}
+}
+
+// sanitizeTagValue replaces the characters Azure doesn't allow in tags and truncates v
+// to the maximum length of a tag value
+func sanitizeTagValue(v string) string {
+	v = invalidTagChars.ReplaceAllString(v, "-")
+	if len(v) > maxTagValueLen {
+		v = v[:maxTagValueLen]
+	}
+	return v
+}
+
+// imageReference returns the reference to imageId, which is either a community gallery image ID,
+// a marketplace image URN (publisher:offer:sku:version) or the resource ID of an image
+func imageReference(imageId string) (*armcompute.ImageReference, error) {
+	if strings.HasPrefix(imageId, "/CommunityGalleries/") {
+		return &armcompute.ImageReference{
+			CommunityGalleryImageID: to.Ptr(imageId),
+		}, nil
+	}
 
-	// Azure limits the base64 encrypted userData to 64KB.
-	// Ref: https://learn.microsoft.com/en-us/azure/virtual-machines/user-data
-	// If the b64EncData is greater than 64KB then return an error
-	if len(userDataB64) > 64*1024 {
-		return nil, fmt.Errorf("base64 encoded userData is greater than 64KB")
+	if !strings.HasPrefix(imageId, "/") && strings.Contains(imageId, ":") {
+		parts := strings.Split(imageId, ":")
+		if len(parts) != 4 || slices.Contains(parts, "") {
+			return nil, fmt.Errorf("invalid marketplace image URN %q, expected publisher:offer:sku:version", imageId)
+		}
+		return &armcompute.ImageReference{
+			Publisher: to.Ptr(parts[0]),
+			Offer:     to.Ptr(parts[1]),
+			SKU:       to.Ptr(parts[2]),
+			Version:   to.Ptr(parts[3]),
+		}, nil
+	}
+
+	return &armcompute.ImageReference{
+		ID: to.Ptr(imageId),
+	}, nil
+}
+
+func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig string, sshBytes []byte, instanceName, nicName string, imageId string) (*armcompute.VirtualMachine, error) {
+	userDataB64, err := provider.UserDataEncoder{MaxEncodedSize: provider.AzureUserDataMaxEncodedSize}.Encode(cloudConfig)
+	if err != nil {
+		return nil, err
 	}
+
 	var managedDiskParams *armcompute.ManagedDiskParameters
 	var securityProfile *armcompute.SecurityProfile
-	if !p.serviceConfig.DisableCVM {
+	switch p.serviceConfig.vmSecurityType() {
+	case securityTypeConfidentialVM:
 		managedDiskParams = &armcompute.ManagedDiskParameters{
-			StorageAccountType: to.Ptr(armcompute.StorageAccountTypesPremiumLRS),
+			StorageAccountType: to.Ptr(p.osDiskStorageAccountType()),
 			SecurityProfile: &armcompute.VMDiskSecurityProfile{
 				SecurityEncryptionType: to.Ptr(armcompute.SecurityEncryptionTypesVMGuestStateOnly),
 			},
@@ -441,24 +912,35 @@ func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig stri
 			SecurityType: to.Ptr(armcompute.SecurityTypesConfidentialVM),
 			UefiSettings: &armcompute.UefiSettings{
 				SecureBootEnabled: to.Ptr(p.serviceConfig.EnableSecureBoot),
-				VTpmEnabled:       to.Ptr(true),
+				// Azure requires the vTPM of confidential VMs
+				VTpmEnabled: to.Ptr(true),
 			},
 		}
-	} else {
+	case securityTypeTrustedLaunch:
+		// The same UEFI settings as confidential VMs, without the encryption of the guest state,
+		// except that the vTPM can be disabled
 		managedDiskParams = &armcompute.ManagedDiskParameters{
-			StorageAccountType: to.Ptr(armcompute.StorageAccountTypesPremiumLRS),
+			StorageAccountType: to.Ptr(p.osDiskStorageAccountType()),
+		}
+
+		securityProfile = &armcompute.SecurityProfile{
+			SecurityType: to.Ptr(armcompute.SecurityTypesTrustedLaunch),
+			UefiSettings: &armcompute.UefiSettings{
+				SecureBootEnabled: to.Ptr(p.serviceConfig.EnableSecureBoot),
+				VTpmEnabled:       to.Ptr(!p.serviceConfig.DisableVTPM),
+			},
+		}
+	default:
+		managedDiskParams = &armcompute.ManagedDiskParameters{
+			StorageAccountType: to.Ptr(p.osDiskStorageAccountType()),
 		}
 
 		securityProfile = nil
 	}
 
-	imgRef := &armcompute.ImageReference{
-		ID: to.Ptr(imageId),
-	}
-	if strings.HasPrefix(imageId, "/CommunityGalleries/") {
-		imgRef = &armcompute.ImageReference{
-			CommunityGalleryImageID: to.Ptr(imageId),
-		}
+	imgRef, err := imageReference(imageId)
+	if err != nil {
+		return nil, err
 	}
 
 	networkConfig := p.buildNetworkConfig(nicName)
@@ -468,7 +950,7 @@ func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig stri
 		Name:         to.Ptr(diskName),
 		CreateOption: to.Ptr(armcompute.DiskCreateOptionTypesFromImage),
 		Caching:      to.Ptr(armcompute.CachingTypesReadWrite),
-		DeleteOption: to.Ptr(armcompute.DiskDeleteOptionTypesDelete),
+		DeleteOption: to.Ptr(p.osDiskDeleteOption()),
 		ManagedDisk:  managedDiskParams,
 	}
 
@@ -478,6 +960,30 @@ func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig stri
 		logger.Printf("Setting root volume size to %d GB", p.serviceConfig.RootVolumeSize)
 	}
 
+	osProfile := &armcompute.OSProfile{
+		AdminUsername: to.Ptr(p.serviceConfig.SSHUserName),
+		ComputerName:  to.Ptr(computerName(instanceName)),
+		LinuxConfiguration: &armcompute.LinuxConfiguration{
+			DisablePasswordAuthentication: to.Ptr(true),
+			//TBD: replace with a suitable mechanism to use precreated SSH key
+			SSH: &armcompute.SSHConfiguration{
+				PublicKeys: []*armcompute.SSHPublicKey{{
+					Path:    to.Ptr(fmt.Sprintf("/home/%s/.ssh/authorized_keys", p.serviceConfig.SSHUserName)),
+					KeyData: to.Ptr(string(sshBytes)),
+				}},
+			},
+		},
+	}
+
+	// Leave the settings unset unless disabled to keep the Azure defaults.
+	// Extensions are run by the guest agent, so they can't be allowed without it.
+	if p.serviceConfig.DisableVMAgent {
+		osProfile.LinuxConfiguration.ProvisionVMAgent = to.Ptr(false)
+	}
+	if p.serviceConfig.DisableVMAgent || p.serviceConfig.DisableExtensionOperations {
+		osProfile.AllowExtensionOperations = to.Ptr(false)
+	}
+
 	vmParameters := armcompute.VirtualMachine{
 		Location: to.Ptr(p.serviceConfig.Region),
 		Properties: &armcompute.VirtualMachineProperties{
@@ -488,20 +994,7 @@ func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig stri
 				ImageReference: imgRef,
 				OSDisk:         osDisk,
 			},
-			OSProfile: &armcompute.OSProfile{
-				AdminUsername: to.Ptr(p.serviceConfig.SSHUserName),
-				ComputerName:  to.Ptr(instanceName),
-				LinuxConfiguration: &armcompute.LinuxConfiguration{
-					DisablePasswordAuthentication: to.Ptr(true),
-					//TBD: replace with a suitable mechanism to use precreated SSH key
-					SSH: &armcompute.SSHConfiguration{
-						PublicKeys: []*armcompute.SSHPublicKey{{
-							Path:    to.Ptr(fmt.Sprintf("/home/%s/.ssh/authorized_keys", p.serviceConfig.SSHUserName)),
-							KeyData: to.Ptr(string(sshBytes)),
-						}},
-					},
-				},
-			},
+			OSProfile: osProfile,
 			NetworkProfile: &armcompute.NetworkProfile{
 				NetworkAPIVersion:              to.Ptr(armcompute.NetworkAPIVersionTwoThousandTwenty1101),
 				NetworkInterfaceConfigurations: []*armcompute.VirtualMachineNetworkInterfaceConfiguration{networkConfig},
@@ -509,7 +1002,7 @@ func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig stri
 			SecurityProfile: securityProfile,
 			DiagnosticsProfile: &armcompute.DiagnosticsProfile{
 				BootDiagnostics: &armcompute.BootDiagnostics{
-					Enabled: to.Ptr(true),
+					Enabled: to.Ptr(!p.serviceConfig.DisableBootDiagnostics),
 				},
 			},
 			UserData: to.Ptr(userDataB64),
@@ -517,5 +1010,24 @@ func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig stri
 		Tags: p.getResourceTags(),
 	}
 
+	if p.serviceConfig.UseHibernation {
+		vmParameters.Properties.AdditionalCapabilities = &armcompute.AdditionalCapabilities{
+			HibernationEnabled: to.Ptr(true),
+		}
+	}
+
+	// Regular VMs keep the priority unset, as before spot support
+	if p.serviceConfig.UseSpot {
+		vmParameters.Properties.Priority = to.Ptr(armcompute.VirtualMachinePriorityTypesSpot)
+		vmParameters.Properties.EvictionPolicy = to.Ptr(armcompute.VirtualMachineEvictionPolicyTypes(p.serviceConfig.SpotEvictionPolicy))
+		vmParameters.Properties.BillingProfile = &armcompute.BillingProfile{MaxPrice: to.Ptr(p.serviceConfig.SpotMaxPrice)}
+	}
+
+	if p.serviceConfig.DedicatedHostId != "" {
+		vmParameters.Properties.Host = &armcompute.SubResource{ID: to.Ptr(p.serviceConfig.DedicatedHostId)}
+	} else if p.serviceConfig.HostGroupId != "" {
+		vmParameters.Properties.HostGroup = &armcompute.SubResource{ID: to.Ptr(p.serviceConfig.HostGroupId)}
+	}
+
 	return &vmParameters, nil
 }
@@ -0,0 +1,1276 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
+	armnetwork "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/providertest"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+// statusTransport answers every Azure API request with the given status code, and body
+// or a not found error
+type statusTransport struct {
+	statusCode int
+	body       string
+	requests   int
+	lastPath   string
+}
+
+func (t *statusTransport) Do(req *http.Request) (*http.Response, error) {
+	t.requests++
+	t.lastPath = req.URL.Path
+	body := t.body
+	if body == "" {
+		body = `{"error":{"code":"ResourceNotFound","message":"not found"}}`
+	}
+	return &http.Response{
+		StatusCode: t.statusCode,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func newTestProvider(transport *statusTransport) *azureProvider {
+	return &azureProvider{
+		azureClient: &fake.TokenCredential{},
+		clientOptions: &arm.ClientOptions{
+			ClientOptions: policy.ClientOptions{
+				Transport: transport,
+			},
+		},
+		serviceConfig: &Config{
+			SubscriptionId:    "sub",
+			ResourceGroupName: "rg",
+		},
+	}
+}
+
+func TestNextZone(t *testing.T) {
+	p := &azureProvider{
+		serviceConfig: &Config{Zone: "1, 2,3"},
+		zones:         parseZones("1, 2,3"),
+	}
+
+	var got []string
+	counts := map[string]int{}
+	for i := 0; i < 6; i++ {
+		zone := p.nextZone()
+		got = append(got, zone)
+		counts[zone]++
+	}
+
+	want := []string{"1", "2", "3", "1", "2", "3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nextZone() sequence = %v, want %v", got, want)
+	}
+	for _, zone := range []string{"1", "2", "3"} {
+		if counts[zone] != 2 {
+			t.Errorf("zone %s got %d VMs, want 2", zone, counts[zone])
+		}
+	}
+}
+
+func TestNextZoneNoZones(t *testing.T) {
+	p := &azureProvider{
+		serviceConfig: &Config{},
+		zones:         parseZones(""),
+	}
+	if zone := p.nextZone(); zone != "" {
+		t.Errorf("nextZone() = %q, want empty zone", zone)
+	}
+}
+
+func TestDeleteInstanceIdempotent(t *testing.T) {
+	instanceID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/podvm-test"
+
+	tests := []struct {
+		name       string
+		statusCode int
+		wantErr    bool
+	}{
+		{
+			name:       "already deleted VM",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "server error",
+			statusCode: http.StatusBadRequest,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &statusTransport{statusCode: tt.statusCode}
+			p := newTestProvider(transport)
+
+			// Deleting twice must behave the same
+			for i := 0; i < 2; i++ {
+				err := p.DeleteInstance(context.Background(), instanceID)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("DeleteInstance() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			}
+			if transport.requests == 0 {
+				t.Error("expected DeleteInstance to call the Azure API")
+			}
+		})
+	}
+}
+
+func TestDeleteInstanceByName(t *testing.T) {
+	transport := &statusTransport{statusCode: http.StatusNotFound}
+	p := newTestProvider(transport)
+
+	if err := p.DeleteInstanceByName(context.Background(), "podvm-test"); err != nil {
+		t.Fatalf("DeleteInstanceByName() error = %v, want nil for a missing VM", err)
+	}
+	if want := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/podvm-test"; transport.lastPath != want {
+		t.Errorf("deleted %q, want %q", transport.lastPath, want)
+	}
+}
+
+func TestIsNotFoundError(t *testing.T) {
+	if !isNotFoundError(&azcore.ResponseError{StatusCode: http.StatusNotFound}) {
+		t.Error("expected 404 response error to be a not found error")
+	}
+	if isNotFoundError(&azcore.ResponseError{StatusCode: http.StatusConflict}) {
+		t.Error("expected 409 response error not to be a not found error")
+	}
+	if isNotFoundError(errNotFound) {
+		t.Error("expected non response error not to be a not found error")
+	}
+}
+
+func TestGetVMParametersGuestAgent(t *testing.T) {
+	tests := []struct {
+		name                   string
+		config                 Config
+		wantProvisionVMAgent   *bool
+		wantAllowExtensionOps  *bool
+		wantBootDiagnosticsOff bool
+	}{
+		{
+			name:   "defaults",
+			config: Config{},
+		},
+		{
+			name:                  "agent disabled",
+			config:                Config{DisableVMAgent: true},
+			wantProvisionVMAgent:  to.Ptr(false),
+			wantAllowExtensionOps: to.Ptr(false),
+		},
+		{
+			name:                  "extensions disabled",
+			config:                Config{DisableExtensionOperations: true},
+			wantAllowExtensionOps: to.Ptr(false),
+		},
+		{
+			name:                   "boot diagnostics disabled",
+			config:                 Config{DisableBootDiagnostics: true},
+			wantBootDiagnosticsOff: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.SSHUserName = "peerpod"
+			p := &azureProvider{serviceConfig: &config}
+
+			vm, err := p.getVMParameters("Standard_DC2as_v5", "disk", "", []byte("ssh-rsa key"), "podvm", "nic", "image")
+			if err != nil {
+				t.Fatalf("getVMParameters() error = %v", err)
+			}
+
+			osProfile := vm.Properties.OSProfile
+			if !reflect.DeepEqual(osProfile.LinuxConfiguration.ProvisionVMAgent, tt.wantProvisionVMAgent) {
+				t.Errorf("ProvisionVMAgent = %v, want %v", osProfile.LinuxConfiguration.ProvisionVMAgent, tt.wantProvisionVMAgent)
+			}
+			if !reflect.DeepEqual(osProfile.AllowExtensionOperations, tt.wantAllowExtensionOps) {
+				t.Errorf("AllowExtensionOperations = %v, want %v", osProfile.AllowExtensionOperations, tt.wantAllowExtensionOps)
+			}
+			if enabled := *vm.Properties.DiagnosticsProfile.BootDiagnostics.Enabled; enabled == tt.wantBootDiagnosticsOff {
+				t.Errorf("BootDiagnostics.Enabled = %v, want %v", enabled, !tt.wantBootDiagnosticsOff)
+			}
+		})
+	}
+}
+
+func TestGetSSHPublicKeyCached(t *testing.T) {
+	key, err := generateSSHPublicKey()
+	if err != nil {
+		t.Fatalf("generating SSH public key: %v", err)
+	}
+
+	reads := 0
+	fail := true
+	p := &azureProvider{
+		serviceConfig: &Config{SSHKeyPath: "/root/.ssh/id_rsa.pub"},
+		readFile: func(path string) ([]byte, error) {
+			reads++
+			if fail {
+				return nil, errors.New("read failed")
+			}
+			return key, nil
+		},
+	}
+
+	// A failed read is not cached, the key is read again on the next call
+	if _, err := p.getSSHPublicKey(); err == nil {
+		t.Fatal("expected an error when the key file cannot be read")
+	}
+
+	fail = false
+	for i := 0; i < 3; i++ {
+		got, err := p.getSSHPublicKey()
+		if err != nil {
+			t.Fatalf("getSSHPublicKey() error = %v", err)
+		}
+		if string(got) != string(key) {
+			t.Errorf("getSSHPublicKey() = %q, want %q", got, key)
+		}
+	}
+
+	if reads != 2 {
+		t.Errorf("expected the key file to be read twice, got %d reads", reads)
+	}
+}
+
+func TestGetSSHPublicKeyInvalid(t *testing.T) {
+	p := &azureProvider{
+		serviceConfig: &Config{SSHKeyPath: "/root/.ssh/id_rsa.pub"},
+		readFile: func(path string) ([]byte, error) {
+			return []byte("not a key"), nil
+		},
+	}
+
+	if _, err := p.getSSHPublicKey(); err == nil {
+		t.Fatal("expected an error for an invalid public key")
+	}
+	if p.sshPublicKey != nil {
+		t.Error("expected an invalid key not to be cached")
+	}
+}
+
+func TestGetSSHPublicKeyPrecedence(t *testing.T) {
+	fileKey, err := generateSSHPublicKey()
+	if err != nil {
+		t.Fatalf("generateSSHPublicKey() error = %v", err)
+	}
+	inlineKey, err := generateSSHPublicKey()
+	if err != nil {
+		t.Fatalf("generateSSHPublicKey() error = %v", err)
+	}
+	// The surrounding whitespace of an inline key, e.g. from an env file, is trimmed
+	inlineKey = []byte(strings.TrimSpace(string(inlineKey)))
+
+	tests := []struct {
+		name      string
+		config    Config
+		want      []byte
+		wantReads int
+	}{
+		{
+			name:   "inline key",
+			config: Config{SSHPubKey: string(inlineKey) + "\n"},
+			want:   inlineKey,
+		},
+		{
+			name:   "inline key over key file",
+			config: Config{SSHPubKey: string(inlineKey), SSHKeyPath: "/root/.ssh/id_rsa.pub"},
+			want:   inlineKey,
+		},
+		{
+			name:      "key file",
+			config:    Config{SSHKeyPath: "/root/.ssh/id_rsa.pub"},
+			want:      fileKey,
+			wantReads: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reads := 0
+			config := tt.config
+			p := &azureProvider{
+				serviceConfig: &config,
+				readFile: func(path string) ([]byte, error) {
+					reads++
+					return fileKey, nil
+				},
+			}
+
+			got, err := p.getSSHPublicKey()
+			if err != nil {
+				t.Fatalf("getSSHPublicKey() error = %v", err)
+			}
+			if string(got) != string(tt.want) {
+				t.Errorf("getSSHPublicKey() = %q, want %q", got, tt.want)
+			}
+			if reads != tt.wantReads {
+				t.Errorf("expected %d key file reads, got %d", tt.wantReads, reads)
+			}
+		})
+	}
+
+	// Without either, a key is generated for every call
+	p := &azureProvider{serviceConfig: &Config{}}
+	first, err := p.getSSHPublicKey()
+	if err != nil {
+		t.Fatalf("getSSHPublicKey() error = %v", err)
+	}
+	second, err := p.getSSHPublicKey()
+	if err != nil {
+		t.Fatalf("getSSHPublicKey() error = %v", err)
+	}
+	if string(first) == string(second) {
+		t.Error("expected a new key to be generated for every call")
+	}
+}
+
+func TestGetSSHPublicKeyInlineInvalid(t *testing.T) {
+	p := &azureProvider{serviceConfig: &Config{SSHPubKey: "not a key", ImageId: "image"}}
+
+	if _, err := p.getSSHPublicKey(); err == nil {
+		t.Fatal("expected an error for an invalid inline public key")
+	}
+	if err := p.ConfigVerifier(); err == nil {
+		t.Error("ConfigVerifier() error = nil, want an error for an invalid inline public key")
+	}
+}
+
+func TestComputerName(t *testing.T) {
+	tests := []struct {
+		name         string
+		instanceName string
+		want         string
+	}{
+		{
+			name:         "valid hostname",
+			instanceName: "podvm-nginx-1a2b3c4d",
+			want:         "podvm-nginx-1a2b3c4d",
+		},
+		{
+			name:         "upper case, dots and underscores",
+			instanceName: "PodVM_My.App-1a2b3c4d",
+			want:         "podvm-my-app-1a2b3c4d",
+		},
+		{
+			name:         "too long for a hostname",
+			instanceName: "podvm-" + strings.Repeat("a", 57) + "b",
+			want:         "podvm-" + strings.Repeat("a", 57),
+		},
+		{
+			name:         "trailing hyphen after truncation",
+			instanceName: "podvm-" + strings.Repeat("a", 56) + "-b",
+			want:         "podvm-" + strings.Repeat("a", 56),
+		},
+		{
+			name:         "leading underscore",
+			instanceName: "_podvm",
+			want:         "podvm",
+		},
+		{
+			name:         "numeric",
+			instanceName: "12345",
+			want:         "podvm-12345",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computerName(tt.instanceName)
+			if got != tt.want {
+				t.Errorf("computerName(%q) = %q, want %q", tt.instanceName, got, tt.want)
+			}
+			if len(got) > maxComputerNameLen {
+				t.Errorf("computerName(%q) is %d characters long", tt.instanceName, len(got))
+			}
+		})
+	}
+}
+
+func TestGetVMParametersComputerName(t *testing.T) {
+	p := &azureProvider{serviceConfig: &Config{SSHUserName: "peerpod"}}
+
+	// A valid Azure VM name, but not a valid hostname
+	instanceName := "podvm_My.App-" + strings.Repeat("x", 51)
+
+	vm, err := p.getVMParameters("Standard_DC2as_v5", "disk", "", []byte("ssh-rsa key"), instanceName, "nic", "image")
+	if err != nil {
+		t.Fatalf("getVMParameters() error = %v", err)
+	}
+	if got, want := *vm.Properties.OSProfile.ComputerName, "podvm-my-app-"+strings.Repeat("x", 50); got != want {
+		t.Errorf("ComputerName = %q, want %q", got, want)
+	}
+}
+
+func TestGetVMParametersHibernation(t *testing.T) {
+	for _, useHibernation := range []bool{false, true} {
+		p := &azureProvider{serviceConfig: &Config{SSHUserName: "peerpod", DisableCVM: true, UseHibernation: useHibernation}}
+
+		vm, err := p.getVMParameters("Standard_D2as_v5", "disk", "", []byte("ssh-rsa key"), "podvm", "nic", "image")
+		if err != nil {
+			t.Fatalf("getVMParameters() error = %v", err)
+		}
+
+		capabilities := vm.Properties.AdditionalCapabilities
+		if !useHibernation {
+			if capabilities != nil {
+				t.Errorf("AdditionalCapabilities = %+v, want nil", capabilities)
+			}
+			continue
+		}
+		if capabilities == nil || capabilities.HibernationEnabled == nil || !*capabilities.HibernationEnabled {
+			t.Errorf("AdditionalCapabilities = %+v, want hibernation enabled", capabilities)
+		}
+	}
+}
+
+func TestConfigVerifierVTPM(t *testing.T) {
+	p := &azureProvider{serviceConfig: &Config{ImageId: "image", DisableVTPM: true}}
+	if err := p.ConfigVerifier(); err == nil {
+		t.Error("ConfigVerifier() error = nil, want an error for confidential VMs without the vTPM")
+	}
+
+	p.serviceConfig.SecurityType = securityTypeTrustedLaunch
+	if err := p.ConfigVerifier(); err != nil {
+		t.Errorf("ConfigVerifier() error = %v", err)
+	}
+}
+
+func TestConfigVerifierHibernation(t *testing.T) {
+	p := &azureProvider{serviceConfig: &Config{ImageId: "image", UseHibernation: true}}
+	if err := p.ConfigVerifier(); err == nil {
+		t.Error("ConfigVerifier() error = nil, want an error for hibernation on confidential VMs")
+	}
+
+	p.serviceConfig.DisableCVM = true
+	if err := p.ConfigVerifier(); err != nil {
+		t.Errorf("ConfigVerifier() error = %v", err)
+	}
+}
+
+func TestGetVMParametersSpot(t *testing.T) {
+	for _, useSpot := range []bool{false, true} {
+		p := &azureProvider{serviceConfig: &Config{
+			SSHUserName:        "peerpod",
+			UseSpot:            useSpot,
+			SpotMaxPrice:       0.05,
+			SpotEvictionPolicy: "Deallocate",
+		}}
+
+		vm, err := p.getVMParameters("Standard_DC2as_v5", "disk", "", []byte("ssh-rsa key"), "podvm", "nic", "image")
+		if err != nil {
+			t.Fatalf("getVMParameters() error = %v", err)
+		}
+
+		props := vm.Properties
+		if !useSpot {
+			if props.Priority != nil || props.EvictionPolicy != nil || props.BillingProfile != nil {
+				t.Errorf("Priority = %v, EvictionPolicy = %v, BillingProfile = %+v, want them unset", props.Priority, props.EvictionPolicy, props.BillingProfile)
+			}
+			continue
+		}
+		if props.Priority == nil || *props.Priority != armcompute.VirtualMachinePriorityTypesSpot {
+			t.Errorf("Priority = %v, want Spot", props.Priority)
+		}
+		if props.EvictionPolicy == nil || *props.EvictionPolicy != armcompute.VirtualMachineEvictionPolicyTypesDeallocate {
+			t.Errorf("EvictionPolicy = %v, want Deallocate", props.EvictionPolicy)
+		}
+		if props.BillingProfile == nil || props.BillingProfile.MaxPrice == nil || *props.BillingProfile.MaxPrice != 0.05 {
+			t.Errorf("BillingProfile = %+v, want max price 0.05", props.BillingProfile)
+		}
+	}
+}
+
+func TestConfigVerifierSpotEvictionPolicy(t *testing.T) {
+	p := &azureProvider{serviceConfig: &Config{ImageId: "image", UseSpot: true, SpotEvictionPolicy: "Stop"}}
+	if err := p.ConfigVerifier(); err == nil {
+		t.Error("ConfigVerifier() error = nil, want an error for an invalid eviction policy")
+	}
+
+	p.serviceConfig.SpotEvictionPolicy = "Delete"
+	if err := p.ConfigVerifier(); err != nil {
+		t.Errorf("ConfigVerifier() error = %v", err)
+	}
+}
+
+// vmRequestTransport records the VM passed to the create requests, and fails them
+type vmRequestTransport struct {
+	statusTransport
+	vm armcompute.VirtualMachine
+}
+
+func (t *vmRequestTransport) Do(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodPut && req.Body != nil {
+		if err := json.NewDecoder(req.Body).Decode(&t.vm); err != nil {
+			return nil, err
+		}
+	}
+	return t.statusTransport.Do(req)
+}
+
+// tagTransport fails the VM create and records the tags set on the NICs and disks
+type tagTransport struct {
+	statusTransport
+	tags map[string]map[string]string
+}
+
+func (t *tagTransport) Do(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodPatch {
+		var tags armnetwork.TagsObject
+		if err := json.NewDecoder(req.Body).Decode(&tags); err != nil {
+			return nil, err
+		}
+		t.tags[path.Base(req.URL.Path)] = map[string]string{}
+		for k, v := range tags.Tags {
+			t.tags[path.Base(req.URL.Path)][k] = *v
+		}
+	}
+	return t.statusTransport.Do(req)
+}
+
+func TestCreateInstanceTagsLeftovers(t *testing.T) {
+	transport := &tagTransport{statusTransport: statusTransport{statusCode: http.StatusConflict}, tags: map[string]map[string]string{}}
+	p := &azureProvider{
+		azureClient:   &fake.TokenCredential{},
+		clientOptions: &arm.ClientOptions{ClientOptions: policy.ClientOptions{Transport: transport}},
+		serviceConfig: &Config{
+			SubscriptionId:    "sub",
+			ResourceGroupName: "rg",
+			Size:              "Standard_DC2as_v5",
+			ImageId:           "image",
+			SSHUserName:       "peerpod",
+		},
+		nodeName: "worker-1",
+		clock:    providertest.NewFakeClock(),
+	}
+
+	if _, err := p.CreateInstance(context.Background(), "podtest", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{}); err == nil {
+		t.Fatal("CreateInstance() error = nil, want the create request to fail")
+	}
+
+	tags, ok := transport.tags["podvm-podtest-123-net"]
+	if !ok {
+		t.Fatalf("expected the leftover NIC to be tagged, got %v", transport.tags)
+	}
+	if tags[ownerTag] != ownerTagValue || tags[provider.NodeNameTag] != "worker-1" {
+		t.Errorf("expected the owner and node tags, got %v", tags)
+	}
+	if want := providertest.FakeClockStart.Format(time.RFC3339); tags[leftoverTag] != want {
+		t.Errorf("expected %s to be %s, got %q", leftoverTag, want, tags[leftoverTag])
+	}
+
+	tags, ok = transport.tags["podvm-podtest-123-disk"]
+	if !ok || tags[ownerTag] != ownerTagValue || tags[provider.NodeNameTag] != "worker-1" {
+		t.Errorf("expected the leftover disk to have the owner and node tags, got %v", transport.tags)
+	}
+}
+
+func TestCreateInstanceUserDataFormat(t *testing.T) {
+	cloudConfig := &cloudinit.CloudConfig{
+		WriteFiles: []cloudinit.WriteFile{{Path: "/peerpod/apf.json", Content: "{}\n"}},
+	}
+
+	for _, format := range []string{cloudinit.UserDataFormatCloudInit, cloudinit.UserDataFormatIgnition} {
+		t.Run(format, func(t *testing.T) {
+			transport := &vmRequestTransport{statusTransport: statusTransport{statusCode: http.StatusBadRequest}}
+			p := &azureProvider{
+				azureClient: &fake.TokenCredential{},
+				clientOptions: &arm.ClientOptions{
+					ClientOptions: policy.ClientOptions{Transport: transport},
+				},
+				serviceConfig: &Config{
+					SubscriptionId:    "sub",
+					ResourceGroupName: "rg",
+					Size:              "Standard_DC2as_v5",
+					ImageId:           "image",
+					SSHUserName:       "peerpod",
+					UserDataFormat:    format,
+				},
+			}
+
+			if _, err := p.CreateInstance(context.Background(), "podtest", "123", cloudConfig, provider.InstanceTypeSpec{}); err == nil {
+				t.Fatal("CreateInstance() error = nil, want the create request to fail")
+			}
+			if transport.vm.Properties == nil || transport.vm.Properties.UserData == nil {
+				t.Fatal("expected a VM create request with userData")
+			}
+
+			generator, err := cloudinit.NewUserDataGenerator(format, cloudConfig)
+			if err != nil {
+				t.Fatalf("NewUserDataGenerator() error = %v", err)
+			}
+			want, err := generator.Generate()
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			got, err := base64.StdEncoding.DecodeString(*transport.vm.Properties.UserData)
+			if err != nil {
+				t.Fatalf("decoding userData error = %v", err)
+			}
+			if string(got) != want {
+				t.Errorf("userData = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestConfigVerifierUserDataFormat(t *testing.T) {
+	p := &azureProvider{serviceConfig: &Config{ImageId: "image", UserDataFormat: "shell"}}
+	if err := p.ConfigVerifier(); err == nil {
+		t.Error("ConfigVerifier() error = nil, want an error for an unknown userData format")
+	}
+}
+
+func TestAddPodTags(t *testing.T) {
+	p := &azureProvider{
+		serviceConfig: &Config{Tags: map[string]string{"app": "peerpods", provider.PodNamespaceTag: "billing"}},
+		nodeName:      "worker-1",
+	}
+
+	tags := p.getResourceTags()
+	p.addPodTags(tags, provider.PodIdentity{Name: "web/0?" + strings.Repeat("x", 300), Namespace: "default", SandboxID: "123"})
+
+	want := map[string]string{
+		ownerTag:                 ownerTagValue,
+		"peerpod-node":           "worker-1",
+		"app":                    "peerpods",
+		provider.PodNameTag:      "web-0-" + strings.Repeat("x", maxTagValueLen-6),
+		provider.PodNamespaceTag: "billing", // set by the user
+		provider.PodSandboxTag:   "123",
+	}
+	if len(tags) != len(want) {
+		t.Errorf("got %d tags, want %d", len(tags), len(want))
+	}
+	for k, v := range want {
+		if got := tags[k]; got == nil || *got != v {
+			t.Errorf("tag %s = %v, want %s", k, got, v)
+		}
+	}
+}
+
+func TestCreateInstancePodTags(t *testing.T) {
+	for _, disablePodTags := range []bool{false, true} {
+		transport := &vmRequestTransport{statusTransport: statusTransport{statusCode: http.StatusBadRequest}}
+		p := &azureProvider{
+			azureClient: &fake.TokenCredential{},
+			clientOptions: &arm.ClientOptions{
+				ClientOptions: policy.ClientOptions{Transport: transport},
+			},
+			serviceConfig: &Config{
+				SubscriptionId:    "sub",
+				ResourceGroupName: "rg",
+				Size:              "Standard_DC2as_v5",
+				ImageId:           "image",
+				SSHUserName:       "peerpod",
+				DisablePodTags:    disablePodTags,
+			},
+		}
+
+		ctx := provider.WithPodNamespace(context.Background(), "team-a")
+		if _, err := p.CreateInstance(ctx, "web", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{}); err == nil {
+			t.Fatal("CreateInstance() error = nil, want the create request to fail")
+		}
+
+		tags := transport.vm.Tags
+		for k, v := range map[string]string{provider.PodNameTag: "web", provider.PodNamespaceTag: "team-a", provider.PodSandboxTag: "123"} {
+			got, ok := tags[k]
+			if disablePodTags {
+				if ok {
+					t.Errorf("tag %s = %v, want no tag with -disable-pod-tags", k, got)
+				}
+				continue
+			}
+			if got == nil || *got != v {
+				t.Errorf("tag %s = %v, want %s", k, got, v)
+			}
+		}
+	}
+}
+
+func TestImageReference(t *testing.T) {
+	tests := []struct {
+		name    string
+		imageId string
+		want    *armcompute.ImageReference
+		wantErr bool
+	}{
+		{
+			name:    "resource ID",
+			imageId: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/podvm/versions/1.0.0",
+			want:    &armcompute.ImageReference{ID: to.Ptr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/podvm/versions/1.0.0")},
+		},
+		{
+			name:    "community gallery",
+			imageId: "/CommunityGalleries/cococommunity-42d8482d/Images/peerpod-podvm-fedora/Versions/latest",
+			want:    &armcompute.ImageReference{CommunityGalleryImageID: to.Ptr("/CommunityGalleries/cococommunity-42d8482d/Images/peerpod-podvm-fedora/Versions/latest")},
+		},
+		{
+			name:    "marketplace URN",
+			imageId: "Canonical:0001-com-ubuntu-confidential-vm-jammy:22_04-lts-cvm:latest",
+			want: &armcompute.ImageReference{
+				Publisher: to.Ptr("Canonical"),
+				Offer:     to.Ptr("0001-com-ubuntu-confidential-vm-jammy"),
+				SKU:       to.Ptr("22_04-lts-cvm"),
+				Version:   to.Ptr("latest"),
+			},
+		},
+		{
+			name:    "URN missing the version",
+			imageId: "Canonical:0001-com-ubuntu-confidential-vm-jammy:22_04-lts-cvm",
+			wantErr: true,
+		},
+		{
+			name:    "URN with an empty field",
+			imageId: "Canonical::22_04-lts-cvm:latest",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := imageReference(tt.imageId)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("imageReference() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("imageReference() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetVMParametersUefiSettings(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         Config
+		wantSecureBoot bool
+		wantVTPM       bool
+	}{
+		{
+			name:     "defaults",
+			config:   Config{},
+			wantVTPM: true,
+		},
+		{
+			name:           "secure boot",
+			config:         Config{EnableSecureBoot: true},
+			wantSecureBoot: true,
+			wantVTPM:       true,
+		},
+		{
+			name:   "vTPM disabled",
+			config: Config{SecurityType: securityTypeTrustedLaunch, DisableVTPM: true},
+		},
+		{
+			name:           "secure boot without vTPM",
+			config:         Config{SecurityType: securityTypeTrustedLaunch, EnableSecureBoot: true, DisableVTPM: true},
+			wantSecureBoot: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.SSHUserName = "peerpod"
+			p := &azureProvider{serviceConfig: &config}
+
+			vm, err := p.getVMParameters("Standard_DC2as_v5", "disk", "", []byte("ssh-rsa key"), "podvm", "nic", "image")
+			if err != nil {
+				t.Fatalf("getVMParameters() error = %v", err)
+			}
+			uefi := vm.Properties.SecurityProfile.UefiSettings
+			if got := *uefi.SecureBootEnabled; got != tt.wantSecureBoot {
+				t.Errorf("SecureBootEnabled = %v, want %v", got, tt.wantSecureBoot)
+			}
+			if got := *uefi.VTpmEnabled; got != tt.wantVTPM {
+				t.Errorf("VTpmEnabled = %v, want %v", got, tt.wantVTPM)
+			}
+		})
+	}
+}
+
+func TestGetVMParametersSecurityType(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           Config
+		wantSecurityType *armcompute.SecurityTypes
+		wantEncryption   bool
+	}{
+		{
+			name:             "confidential VM by default",
+			config:           Config{},
+			wantSecurityType: to.Ptr(armcompute.SecurityTypesConfidentialVM),
+			wantEncryption:   true,
+		},
+		{
+			name:             "confidential VM",
+			config:           Config{SecurityType: securityTypeConfidentialVM},
+			wantSecurityType: to.Ptr(armcompute.SecurityTypesConfidentialVM),
+			wantEncryption:   true,
+		},
+		{
+			name:             "trusted launch",
+			config:           Config{SecurityType: securityTypeTrustedLaunch, DisableCVM: true},
+			wantSecurityType: to.Ptr(armcompute.SecurityTypesTrustedLaunch),
+		},
+		{
+			name:   "standard with -disable-cvm",
+			config: Config{DisableCVM: true},
+		},
+		{
+			name:   "standard",
+			config: Config{SecurityType: securityTypeStandard},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.SSHUserName = "peerpod"
+			p := &azureProvider{serviceConfig: &config}
+
+			vm, err := p.getVMParameters("Standard_DC2as_v5", "disk", "", []byte("ssh-rsa key"), "podvm", "nic", "image")
+			if err != nil {
+				t.Fatalf("getVMParameters() error = %v", err)
+			}
+
+			securityProfile := vm.Properties.SecurityProfile
+			if tt.wantSecurityType == nil {
+				if securityProfile != nil {
+					t.Errorf("SecurityProfile = %+v, want nil", securityProfile)
+				}
+			} else if securityProfile == nil || !reflect.DeepEqual(securityProfile.SecurityType, tt.wantSecurityType) {
+				t.Errorf("SecurityProfile = %+v, want security type %s", securityProfile, *tt.wantSecurityType)
+			} else if securityProfile.UefiSettings == nil || !*securityProfile.UefiSettings.VTpmEnabled {
+				t.Errorf("UefiSettings = %+v, want the vTPM enabled", securityProfile.UefiSettings)
+			}
+
+			diskSecurity := vm.Properties.StorageProfile.OSDisk.ManagedDisk.SecurityProfile
+			if got := diskSecurity != nil; got != tt.wantEncryption {
+				t.Errorf("disk SecurityProfile = %+v, want guest state encryption %v", diskSecurity, tt.wantEncryption)
+			}
+		})
+	}
+}
+
+func TestGetVMParametersRootVolume(t *testing.T) {
+	for _, disableCVM := range []bool{false, true} {
+		for _, rootVolumeType := range []string{"", "StandardSSD_LRS"} {
+			p := &azureProvider{serviceConfig: &Config{
+				SSHUserName:    "peerpod",
+				DisableCVM:     disableCVM,
+				RootVolumeSize: 64,
+				RootVolumeType: rootVolumeType,
+			}}
+
+			vm, err := p.getVMParameters("Standard_DC2as_v5", "disk", "", []byte("ssh-rsa key"), "podvm", "nic", "image")
+			if err != nil {
+				t.Fatalf("getVMParameters() error = %v", err)
+			}
+
+			osDisk := vm.Properties.StorageProfile.OSDisk
+			if osDisk.DiskSizeGB == nil || *osDisk.DiskSizeGB != 64 {
+				t.Errorf("disableCVM %v: DiskSizeGB = %v, want 64", disableCVM, osDisk.DiskSizeGB)
+			}
+			want := armcompute.StorageAccountTypesPremiumLRS
+			if rootVolumeType != "" {
+				want = armcompute.StorageAccountTypes(rootVolumeType)
+			}
+			if got := *osDisk.ManagedDisk.StorageAccountType; got != want {
+				t.Errorf("disableCVM %v: StorageAccountType = %s, want %s", disableCVM, got, want)
+			}
+			// The confidential VM disk encryption is kept with any disk type
+			if hasSecurity := osDisk.ManagedDisk.SecurityProfile != nil; hasSecurity == disableCVM {
+				t.Errorf("disableCVM %v: disk SecurityProfile = %+v", disableCVM, osDisk.ManagedDisk.SecurityProfile)
+			}
+		}
+	}
+}
+
+func TestConfigVerifierRootVolumeType(t *testing.T) {
+	p := &azureProvider{serviceConfig: &Config{ImageId: "image", RootVolumeType: "premium"}}
+	if err := p.ConfigVerifier(); err == nil {
+		t.Error("ConfigVerifier() error = nil, want an error for an invalid root volume type")
+	}
+
+	// Premium SSD v2 and Ultra disks can't be OS disks
+	for _, rootVolumeType := range []string{"PremiumV2_LRS", "UltraSSD_LRS"} {
+		p.serviceConfig.RootVolumeType = rootVolumeType
+		if err := p.ConfigVerifier(); err == nil {
+			t.Errorf("ConfigVerifier() error = nil, want an error for root volume type %s", rootVolumeType)
+		}
+	}
+
+	p.serviceConfig.RootVolumeType = "StandardSSD_LRS"
+	if err := p.ConfigVerifier(); err != nil {
+		t.Errorf("ConfigVerifier() error = %v", err)
+	}
+}
+
+func TestConfigVerifierSecurityType(t *testing.T) {
+	p := &azureProvider{serviceConfig: &Config{ImageId: "image", SecurityType: securityTypeConfidentialVM, DisableCVM: true}}
+	if err := p.ConfigVerifier(); err == nil {
+		t.Error("ConfigVerifier() error = nil, want an error for a confidential VM security type with -disable-cvm")
+	}
+
+	// Trusted Launch VMs support hibernation
+	p.serviceConfig = &Config{ImageId: "image", SecurityType: securityTypeTrustedLaunch, UseHibernation: true}
+	if err := p.ConfigVerifier(); err != nil {
+		t.Errorf("ConfigVerifier() error = %v", err)
+	}
+}
+
+func TestGetVMParametersOSDiskDeleteOption(t *testing.T) {
+	for retain, want := range map[bool]armcompute.DiskDeleteOptionTypes{
+		false: armcompute.DiskDeleteOptionTypesDelete,
+		true:  armcompute.DiskDeleteOptionTypesDetach,
+	} {
+		p := &azureProvider{serviceConfig: &Config{SSHUserName: "peerpod", RetainOSDiskOnDelete: retain}}
+
+		vm, err := p.getVMParameters("Standard_DC2as_v5", "disk", "", []byte("ssh-rsa key"), "podvm", "nic", "image")
+		if err != nil {
+			t.Fatalf("getVMParameters() error = %v", err)
+		}
+		if got := *vm.Properties.StorageProfile.OSDisk.DeleteOption; got != want {
+			t.Errorf("with RetainOSDiskOnDelete %v, DeleteOption = %v, want %v", retain, got, want)
+		}
+	}
+}
+
+func TestBuildNetworkConfigApplicationSecurityGroups(t *testing.T) {
+	asg1 := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/peerpods"
+	asg2 := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/monitoring"
+
+	tests := []struct {
+		name string
+		ids  applicationSecurityGroupIds
+		want []string
+	}{
+		{
+			name: "no application security groups",
+		},
+		{
+			name: "application security groups",
+			ids:  applicationSecurityGroupIds{asg1, asg2},
+			want: []string{asg1, asg2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &azureProvider{serviceConfig: &Config{SubnetId: "subnet", ApplicationSecurityGroupIds: tt.ids}}
+
+			config := p.buildNetworkConfig("nic")
+			var got []string
+			for _, asg := range config.Properties.IPConfigurations[0].Properties.ApplicationSecurityGroups {
+				got = append(got, *asg.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ApplicationSecurityGroups = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildNetworkConfigAcceleratedNetworking(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		p := &azureProvider{serviceConfig: &Config{SubnetId: "subnet", EnableAcceleratedNetworking: enabled}}
+
+		config := p.buildNetworkConfig("nic")
+		got := config.Properties.EnableAcceleratedNetworking
+		if enabled && (got == nil || !*got) || !enabled && got != nil {
+			t.Errorf("EnableAcceleratedNetworking = %v with -enable-accelerated-networking=%v", got, enabled)
+		}
+	}
+}
+
+func TestCreateAcceleratedNetworkingNotPermitted(t *testing.T) {
+	body := `{"error":{"code":"VMSizeIsNotPermittedToEnableAcceleratedNetworking","message":"VM size Standard_DC2as_v5 is not compatible with Accelerated Networking"}}`
+	p := newTestProvider(&statusTransport{statusCode: http.StatusBadRequest, body: body})
+
+	parameters := &armcompute.VirtualMachine{
+		Properties: &armcompute.VirtualMachineProperties{
+			HardwareProfile: &armcompute.HardwareProfile{
+				VMSize: to.Ptr(armcompute.VirtualMachineSizeTypes("Standard_DC2as_v5")),
+			},
+		},
+	}
+
+	_, err := p.create(context.Background(), "podvm-test", parameters)
+	if err == nil {
+		t.Fatal("create() error = nil, want an error")
+	}
+	for _, want := range []string{"Standard_DC2as_v5 does not support accelerated networking", "-enable-accelerated-networking"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("create() error = %q, want it to contain %q", err, want)
+		}
+	}
+	if errors.Is(err, provider.ErrCapacityUnavailable) {
+		t.Errorf("create() error = %v, want no capacity error", err)
+	}
+}
+
+func TestGetVMParametersMarketplaceImage(t *testing.T) {
+	p := &azureProvider{serviceConfig: &Config{SSHUserName: "peerpod"}}
+
+	vm, err := p.getVMParameters("Standard_DC2as_v5", "disk", "", []byte("ssh-rsa key"), "podvm", "nic", "Canonical:ubuntu:22_04-lts-cvm:1.2.3")
+	if err != nil {
+		t.Fatalf("getVMParameters() error = %v", err)
+	}
+	imgRef := vm.Properties.StorageProfile.ImageReference
+	if imgRef.ID != nil || imgRef.Publisher == nil || *imgRef.Publisher != "Canonical" || *imgRef.Version != "1.2.3" {
+		t.Errorf("ImageReference = %+v, want the marketplace image", imgRef)
+	}
+
+	if _, err := p.getVMParameters("Standard_DC2as_v5", "disk", "", []byte("ssh-rsa key"), "podvm", "nic", "Canonical:ubuntu"); err == nil {
+		t.Error("getVMParameters() error = nil, want an error for an invalid URN")
+	}
+}
+
+// nicTransport serves a NIC whose private IP is assigned after pending requests
+type nicTransport struct {
+	privateIP string
+	pending   int
+	requests  int
+}
+
+func (t *nicTransport) Do(req *http.Request) (*http.Response, error) {
+	t.requests++
+	ipConfig := `{"name":"ipconfig","properties":{}}`
+	if t.requests > t.pending {
+		ipConfig = fmt.Sprintf(`{"name":"ipconfig","properties":{"privateIPAddress":"%s"}}`, t.privateIP)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(fmt.Sprintf(`{"name":"podvm-net","properties":{"ipConfigurations":[%s]}}`, ipConfig))),
+		Request:    req,
+	}, nil
+}
+
+func testNICVM() *armcompute.VirtualMachine {
+	return &armcompute.VirtualMachine{
+		ID: to.Ptr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/podvm"),
+		Properties: &armcompute.VirtualMachineProperties{
+			NetworkProfile: &armcompute.NetworkProfile{
+				NetworkInterfaces: []*armcompute.NetworkInterfaceReference{
+					{ID: to.Ptr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/podvm-net")},
+				},
+			},
+		},
+	}
+}
+
+func newNICTestProvider(transport *nicTransport) *azureProvider {
+	return &azureProvider{
+		azureClient: &fake.TokenCredential{},
+		clientOptions: &arm.ClientOptions{
+			ClientOptions: policy.ClientOptions{Transport: transport},
+		},
+		serviceConfig: &Config{
+			SubscriptionId:    "sub",
+			ResourceGroupName: "rg",
+		},
+	}
+}
+
+func TestGetIPs(t *testing.T) {
+	p := newNICTestProvider(&nicTransport{privateIP: "10.0.0.4"})
+
+	ips, err := p.getIPs(context.Background(), testNICVM())
+	if err != nil {
+		t.Fatalf("getIPs() error = %v", err)
+	}
+	if want := []netip.Addr{netip.MustParseAddr("10.0.0.4")}; !reflect.DeepEqual(ips, want) {
+		t.Errorf("getIPs() = %v, want %v", ips, want)
+	}
+}
+
+func TestGetIPsNotReady(t *testing.T) {
+	p := newNICTestProvider(&nicTransport{privateIP: "10.0.0.4", pending: 1})
+
+	if _, err := p.getIPs(context.Background(), testNICVM()); !errors.Is(err, errNotReady) {
+		t.Errorf("getIPs() error = %v, want %v", err, errNotReady)
+	}
+}
+
+func TestInstanceIPsRetry(t *testing.T) {
+	transport := &nicTransport{privateIP: "10.0.0.4", pending: 2}
+	p := newNICTestProvider(transport)
+	clock := providertest.NewFakeClock()
+	clock.AutoAdvance = true
+	p.clock = clock
+
+	ips, err := p.instanceIPs(context.Background(), testNICVM())
+	if err != nil {
+		t.Fatalf("instanceIPs() error = %v", err)
+	}
+	if len(ips) != 1 || ips[0].String() != "10.0.0.4" {
+		t.Errorf("instanceIPs() = %v, want [10.0.0.4]", ips)
+	}
+	if transport.requests != 3 {
+		t.Errorf("expected 3 NIC requests, got %d", transport.requests)
+	}
+	for _, wait := range clock.Waits() {
+		if wait < ipPollInterval {
+			t.Errorf("polled the IPs again after %v, want at least %v", wait, ipPollInterval)
+		}
+	}
+
+	transport = &nicTransport{privateIP: "10.0.0.4", pending: ipPollAttempts + 1}
+	p = newNICTestProvider(transport)
+	p.clock = &providertest.FakeClock{AutoAdvance: true}
+	if _, err := p.instanceIPs(context.Background(), testNICVM()); !errors.Is(err, errNotReady) {
+		t.Errorf("instanceIPs() error = %v, want %v after %d attempts", err, errNotReady, ipPollAttempts)
+	}
+	if transport.requests != ipPollAttempts {
+		t.Errorf("expected %d NIC requests, got %d", ipPollAttempts, transport.requests)
+	}
+}
+
+// createVMTransport creates VMs whose NIC gets privateIP after pending requests, never if it's
+// empty. It records the deleted VMs and, like tagTransport, the tags set on the NICs and disks.
+type createVMTransport struct {
+	tagTransport
+	privateIP   string
+	pending     int
+	nicRequests int
+	deleted     []string
+	// createError is the error body returned with a 409 when creating the VM, if set
+	createError string
+}
+
+func (t *createVMTransport) Do(req *http.Request) (*http.Response, error) {
+	body := ""
+	switch {
+	case req.Method == http.MethodPut && strings.Contains(req.URL.Path, "/virtualMachines/") && t.createError != "":
+		return &http.Response{
+			StatusCode: http.StatusConflict,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(t.createError)),
+			Request:    req,
+		}, nil
+	case req.Method == http.MethodPut && strings.Contains(req.URL.Path, "/virtualMachines/"):
+		name := path.Base(req.URL.Path)
+		body = fmt.Sprintf(`{"id":"%s","name":"%s","properties":{"provisioningState":"Succeeded","networkProfile":{"networkInterfaces":[{"id":"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/%s-net"}]}}}`,
+			req.URL.Path, name, name)
+	case req.Method == http.MethodGet && strings.Contains(req.URL.Path, "/networkInterfaces/"):
+		t.nicRequests++
+		ipConfig := `{"name":"ipconfig","properties":{}}`
+		if t.privateIP != "" && t.nicRequests > t.pending {
+			ipConfig = fmt.Sprintf(`{"name":"ipconfig","properties":{"privateIPAddress":"%s"}}`, t.privateIP)
+		}
+		body = fmt.Sprintf(`{"name":"podvm-net","properties":{"ipConfigurations":[%s]}}`, ipConfig)
+	case req.Method == http.MethodDelete:
+		t.deleted = append(t.deleted, path.Base(req.URL.Path))
+		body = `{}`
+	default:
+		return t.tagTransport.Do(req)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func newCreateVMTestProvider(transport *createVMTransport, clock provider.Clock) *azureProvider {
+	transport.tagTransport = tagTransport{statusTransport: statusTransport{statusCode: http.StatusOK, body: `{}`}, tags: map[string]map[string]string{}}
+	return &azureProvider{
+		azureClient:   &fake.TokenCredential{},
+		clientOptions: &arm.ClientOptions{ClientOptions: policy.ClientOptions{Transport: transport}},
+		serviceConfig: &Config{
+			SubscriptionId:    "sub",
+			ResourceGroupName: "rg",
+			Size:              "Standard_DC2as_v5",
+			ImageId:           "image",
+			SSHUserName:       "peerpod",
+		},
+		nodeName: "worker-1",
+		clock:    clock,
+	}
+}
+
+func TestCreateInstanceCreationDuration(t *testing.T) {
+	transport := &createVMTransport{privateIP: "10.0.0.4", pending: 2}
+	clock := providertest.NewFakeClock()
+	clock.AutoAdvance = true
+	p := newCreateVMTestProvider(transport, clock)
+
+	instance, err := p.CreateInstance(context.Background(), "podtest", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	// The clock only moved while the IPs were polled
+	waits := clock.Waits()
+	if len(waits) != 2 {
+		t.Fatalf("waited %d times for the IPs, want 2", len(waits))
+	}
+	if want := waits[0] + waits[1]; instance.CreationDuration != want {
+		t.Errorf("CreationDuration = %v, want %v", instance.CreationDuration, want)
+	}
+}
+
+func TestCreateInstanceDeletesVMWithoutIP(t *testing.T) {
+	transport := &createVMTransport{}
+	p := newCreateVMTestProvider(transport, &providertest.FakeClock{AutoAdvance: true})
+
+	if _, err := p.CreateInstance(context.Background(), "podtest", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{}); !errors.Is(err, errNotReady) {
+		t.Fatalf("CreateInstance() error = %v, want %v", err, errNotReady)
+	}
+
+	if want := []string{"podvm-podtest-123"}; !reflect.DeepEqual(transport.deleted, want) {
+		t.Errorf("deleted %v, want %v", transport.deleted, want)
+	}
+	if _, ok := transport.tags["podvm-podtest-123-net"]; !ok {
+		t.Errorf("expected the leftover NIC to be tagged, got %v", transport.tags)
+	}
+	if _, ok := transport.tags["podvm-podtest-123-disk"]; !ok {
+		t.Errorf("expected the leftover disk to be tagged, got %v", transport.tags)
+	}
+}
+
+func TestCreateInstanceQuotaExceeded(t *testing.T) {
+	transport := &createVMTransport{
+		createError: `{"error":{"code":"OperationNotAllowed","message":"Operation could not be completed as it results in exceeding approved ` +
+			`standardDCASv5Family Cores quota. Additional details - Deployment Model: Resource Manager, Location: eastus, Current Limit: 10, ` +
+			`Current Usage: 8, Additional Required: 2, (Minimum) New Limit Required: 12."}}`,
+	}
+	p := newCreateVMTestProvider(transport, &providertest.FakeClock{AutoAdvance: true})
+
+	_, err := p.CreateInstance(context.Background(), "podtest", "123", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if !errors.Is(err, provider.ErrCapacityUnavailable) {
+		t.Fatalf("CreateInstance() error = %v, want %v", err, provider.ErrCapacityUnavailable)
+	}
+}
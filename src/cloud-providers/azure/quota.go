@@ -0,0 +1,53 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+// quotaFamilyRe extracts the quota from messages such as "Operation could not be completed as it
+// results in exceeding approved standardDCASv5Family Cores quota", or "Total Regional Cores quota"
+var quotaFamilyRe = regexp.MustCompile(`exceeding approved (.+?) Cores quota`)
+
+// quotaError turns the error of a VM creation that exceeds a vCPU quota into an actionable
+// error wrapping provider.ErrCapacityUnavailable. Other capacity errors, such as allocation
+// failures, wrap it too, and the remaining errors are returned as is.
+func (p *azureProvider) quotaError(err error, parameters *armcompute.VirtualMachine) error {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+	if respErr.ErrorCode != "QuotaExceeded" &&
+		!(respErr.ErrorCode == "OperationNotAllowed" && strings.Contains(respErr.Error(), "quota")) {
+		if retryClassifier.Classify(err) == provider.RetryClassCapacity {
+			return fmt.Errorf("%w: %w", provider.ErrCapacityUnavailable, err)
+		}
+		return err
+	}
+
+	size := vmSize(parameters)
+	family := "VM size family"
+	if match := quotaFamilyRe.FindStringSubmatch(respErr.Error()); match != nil {
+		family = match[1]
+	}
+
+	return fmt.Errorf("%w: creating a VM of size %s exceeds the %s vCPU quota of the subscription in region %s, "+
+		"request a quota increase or configure another VM size: %w", provider.ErrCapacityUnavailable, size, family, p.serviceConfig.Region, err)
+}
+
+// vmSize returns the size of the VM to create, for the error messages
+func vmSize(parameters *armcompute.VirtualMachine) string {
+	if parameters.Properties != nil && parameters.Properties.HardwareProfile != nil && parameters.Properties.HardwareProfile.VMSize != nil {
+		return string(*parameters.Properties.HardwareProfile.VMSize)
+	}
+	return "unknown"
+}
@@ -0,0 +1,88 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+func TestCreateQuotaExceeded(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCode   int
+		body         string
+		wantCapacity bool
+		wantMessage  []string
+	}{
+		{
+			name:       "family quota",
+			statusCode: http.StatusConflict,
+			body: `{"error":{"code":"OperationNotAllowed","message":"Operation could not be completed as it results in exceeding approved ` +
+				`standardDCASv5Family Cores quota. Additional details - Deployment Model: Resource Manager, Location: eastus, Current Limit: 10, ` +
+				`Current Usage: 8, Additional Required: 4, (Minimum) New Limit Required: 12."}}`,
+			wantCapacity: true,
+			wantMessage:  []string{"Standard_DC4as_v5", "standardDCASv5Family vCPU quota", "eastus", "request a quota increase"},
+		},
+		{
+			name:         "quota exceeded code",
+			statusCode:   http.StatusConflict,
+			body:         `{"error":{"code":"QuotaExceeded","message":"Quota exceeded"}}`,
+			wantCapacity: true,
+			wantMessage:  []string{"Standard_DC4as_v5", "VM size family vCPU quota"},
+		},
+		{
+			name:         "allocation failed",
+			statusCode:   http.StatusConflict,
+			body:         `{"error":{"code":"ZonalAllocationFailed","message":"Allocation failed. We do not have sufficient capacity"}}`,
+			wantCapacity: true,
+			wantMessage:  []string{"sufficient capacity"},
+		},
+		{
+			name:       "other operation not allowed",
+			statusCode: http.StatusConflict,
+			body:       `{"error":{"code":"OperationNotAllowed","message":"The operation is not allowed"}}`,
+		},
+		{
+			name:       "invalid request",
+			statusCode: http.StatusBadRequest,
+			body:       `{"error":{"code":"InvalidParameter","message":"invalid"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(&statusTransport{statusCode: tt.statusCode, body: tt.body})
+			p.serviceConfig.Region = "eastus"
+
+			parameters := &armcompute.VirtualMachine{
+				Properties: &armcompute.VirtualMachineProperties{
+					HardwareProfile: &armcompute.HardwareProfile{
+						VMSize: to.Ptr(armcompute.VirtualMachineSizeTypes("Standard_DC4as_v5")),
+					},
+				},
+			}
+
+			_, err := p.create(context.Background(), "podvm-test", parameters)
+			if err == nil {
+				t.Fatal("create() error = nil, want an error")
+			}
+			if got := errors.Is(err, provider.ErrCapacityUnavailable); got != tt.wantCapacity {
+				t.Errorf("errors.Is(err, ErrCapacityUnavailable) = %v, want %v: %v", got, tt.wantCapacity, err)
+			}
+			for _, want := range tt.wantMessage {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("create() error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"errors"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+// retryClassifier classifies the Azure API errors, which carry their code and status in fields
+var retryClassifier = provider.RetryClassifier{Details: azureErrorDetails}
+
+func azureErrorDetails(err error) (code string, status int, ok bool) {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return "", 0, false
+	}
+	return respErr.ErrorCode, respErr.StatusCode, true
+}
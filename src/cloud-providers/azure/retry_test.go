@@ -0,0 +1,71 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+func TestRetryClassifier(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want provider.RetryClass
+	}{
+		{
+			name: "throttled",
+			err:  &azcore.ResponseError{ErrorCode: "SubscriptionRequestsThrottled", StatusCode: http.StatusTooManyRequests},
+			want: provider.RetryClassThrottling,
+		},
+		{
+			name: "throttled by status",
+			err:  &azcore.ResponseError{StatusCode: http.StatusTooManyRequests},
+			want: provider.RetryClassThrottling,
+		},
+		{
+			name: "server error",
+			err:  fmt.Errorf("creating VM: %w", &azcore.ResponseError{ErrorCode: "InternalServerError", StatusCode: http.StatusInternalServerError}),
+			want: provider.RetryClassServer,
+		},
+		{
+			name: "operation in progress",
+			err:  &azcore.ResponseError{ErrorCode: "AnotherOperationInProgress", StatusCode: http.StatusConflict},
+			want: provider.RetryClassEventualConsistency,
+		},
+		{
+			name: "allocation failed",
+			err:  &azcore.ResponseError{ErrorCode: "AllocationFailed", StatusCode: http.StatusConflict},
+			want: provider.RetryClassCapacity,
+		},
+		{
+			name: "authorization failed",
+			err:  &azcore.ResponseError{ErrorCode: "AuthorizationFailed", StatusCode: http.StatusForbidden},
+			want: provider.RetryClassAuth,
+		},
+		{
+			name: "invalid parameter",
+			err:  &azcore.ResponseError{ErrorCode: "InvalidParameter", StatusCode: http.StatusBadRequest},
+			want: provider.RetryClassPermanent,
+		},
+		{
+			name: "not an API error",
+			err:  errors.New("unknown"),
+			want: provider.RetryClassPermanent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryClassifier.Classify(tt.err); got != tt.want {
+				t.Errorf("Classify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	retailPricesEndpoint = "https://prices.azure.com/api/retail/prices"
+
+	// spotMaxPriceUncapped tells Azure to never evict a spot VM because of price,
+	// only for capacity, and to charge at most the on-demand price
+	spotMaxPriceUncapped = -1
+
+	// spotPriceHeadroom is the margin kept above the current spot price, as the
+	// price fluctuates and VMs are evicted as soon as it exceeds the max price
+	spotPriceHeadroom = 0.1
+)
+
+// spotPriceClient looks up the current spot price of a VM size in USD per hour
+type spotPriceClient interface {
+	getSpotPrice(ctx context.Context, region, size string) (float64, error)
+}
+
+// retailPriceClient queries the public Azure Retail Prices API, which doesn't require credentials
+type retailPriceClient struct {
+	httpClient *http.Client
+	endpoint   string
+}
+
+func newSpotPriceClient() spotPriceClient {
+	return &retailPriceClient{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		endpoint:   retailPricesEndpoint,
+	}
+}
+
+type retailPricesResponse struct {
+	Items []struct {
+		RetailPrice float64 `json:"retailPrice"`
+		SkuName     string  `json:"skuName"`
+		ProductName string  `json:"productName"`
+	} `json:"Items"`
+}
+
+func (c *retailPriceClient) getSpotPrice(ctx context.Context, region, size string) (float64, error) {
+	filter := fmt.Sprintf("serviceName eq 'Virtual Machines' and priceType eq 'Consumption' and armRegionName eq '%s' and armSkuName eq '%s'", region, size)
+	reqURL := c.endpoint + "?" + url.Values{"$filter": {filter}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("creating retail prices request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("querying retail prices: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("querying retail prices: unexpected status %s", resp.Status)
+	}
+
+	var prices retailPricesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&prices); err != nil {
+		return 0, fmt.Errorf("decoding retail prices: %w", err)
+	}
+
+	price := -1.0
+	for _, item := range prices.Items {
+		// Pod VMs are Linux, so skip the Windows meters
+		if !strings.HasSuffix(item.SkuName, " Spot") || strings.Contains(item.ProductName, "Windows") {
+			continue
+		}
+		if price < 0 || item.RetailPrice < price {
+			price = item.RetailPrice
+		}
+	}
+	if price < 0 {
+		return 0, fmt.Errorf("no spot price found for VM size %q in region %q", size, region)
+	}
+
+	return price, nil
+}
+
+// adjustSpotMaxPrice returns the max price to use for a VM size given its current spot price,
+// and a warning when the configured max price is likely to make pod VM creation fail or be evicted.
+func adjustSpotMaxPrice(size string, maxPrice, spotPrice float64) (float64, string) {
+	if maxPrice == spotMaxPriceUncapped {
+		return maxPrice, ""
+	}
+
+	target := spotPrice * (1 + spotPriceHeadroom)
+	if maxPrice < spotPrice {
+		return target, fmt.Sprintf("spot max price %.4f is below the current spot price %.4f of VM size %q, raising it to %.4f",
+			maxPrice, spotPrice, size, target)
+	}
+	if maxPrice < target {
+		return maxPrice, fmt.Sprintf("spot max price %.4f is within %d%% of the current spot price %.4f of VM size %q, pod VMs are likely to be evicted",
+			maxPrice, int(spotPriceHeadroom*100), spotPrice, size)
+	}
+
+	return maxPrice, ""
+}
+
+// preflightSpotPrice checks the spot max price against the current spot price of all
+// configured instance sizes and returns the max price to use. Price lookup failures are
+// only logged, so that spot VMs can still be created when the pricing API is unreachable.
+func (p *azureProvider) preflightSpotPrice(ctx context.Context, maxPrice float64) float64 {
+	sizes := p.serviceConfig.InstanceSizes
+	if len(sizes) == 0 {
+		sizes = []string{p.serviceConfig.Size}
+	}
+
+	adjusted := maxPrice
+	for _, size := range sizes {
+		spotPrice, err := p.spotPriceClient.getSpotPrice(ctx, p.serviceConfig.Region, size)
+		if err != nil {
+			logger.Printf("skipping spot price check for VM size %q: %v", size, err)
+			continue
+		}
+
+		price, warning := adjustSpotMaxPrice(size, maxPrice, spotPrice)
+		if warning != "" {
+			logger.Printf("warning: %s", warning)
+		}
+		// A single max price applies to all sizes, so it has to cover the most expensive one
+		if price > adjusted {
+			adjusted = price
+		}
+	}
+
+	return adjusted
+}
@@ -0,0 +1,126 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Mock spot price client
+type mockSpotPriceClient struct {
+	prices map[string]float64
+}
+
+func (m *mockSpotPriceClient) getSpotPrice(ctx context.Context, region, size string) (float64, error) {
+	price, ok := m.prices[size]
+	if !ok {
+		return 0, fmt.Errorf("no spot price found for VM size %q", size)
+	}
+	return price, nil
+}
+
+func TestAdjustSpotMaxPrice(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxPrice  float64
+		spotPrice float64
+		want      float64
+		wantWarn  bool
+	}{
+		{
+			name:      "uncapped",
+			maxPrice:  spotMaxPriceUncapped,
+			spotPrice: 0.05,
+			want:      spotMaxPriceUncapped,
+		},
+		{
+			name:      "enough headroom",
+			maxPrice:  0.10,
+			spotPrice: 0.05,
+			want:      0.10,
+		},
+		{
+			name:      "little headroom warns",
+			maxPrice:  0.052,
+			spotPrice: 0.05,
+			want:      0.052,
+			wantWarn:  true,
+		},
+		{
+			name:      "below spot price is raised",
+			maxPrice:  0.04,
+			spotPrice: 0.05,
+			want:      0.055,
+			wantWarn:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warning := adjustSpotMaxPrice("Standard_D2as_v5", tt.maxPrice, tt.spotPrice)
+			if fmt.Sprintf("%.4f", got) != fmt.Sprintf("%.4f", tt.want) {
+				t.Errorf("adjustSpotMaxPrice() = %v, want %v", got, tt.want)
+			}
+			if (warning != "") != tt.wantWarn {
+				t.Errorf("adjustSpotMaxPrice() warning = %q, wantWarn %v", warning, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestPreflightSpotPrice(t *testing.T) {
+	p := &azureProvider{
+		serviceConfig: &Config{
+			Region:        "eastus",
+			InstanceSizes: instanceSizes{"Standard_D2as_v5", "Standard_D4as_v5", "Standard_Unknown"},
+		},
+		spotPriceClient: &mockSpotPriceClient{
+			prices: map[string]float64{
+				"Standard_D2as_v5": 0.02,
+				"Standard_D4as_v5": 0.04,
+			},
+		},
+	}
+
+	// The max price has to cover the most expensive size, sizes without a price are skipped
+	if got := p.preflightSpotPrice(context.Background(), 0.03); fmt.Sprintf("%.4f", got) != "0.0440" {
+		t.Errorf("preflightSpotPrice() = %v, want 0.044", got)
+	}
+	if got := p.preflightSpotPrice(context.Background(), 0.1); got != 0.1 {
+		t.Errorf("preflightSpotPrice() = %v, want 0.1", got)
+	}
+	if got := p.preflightSpotPrice(context.Background(), spotMaxPriceUncapped); got != spotMaxPriceUncapped {
+		t.Errorf("preflightSpotPrice() = %v, want %v", got, spotMaxPriceUncapped)
+	}
+}
+
+func TestRetailPriceClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter := r.URL.Query().Get("$filter")
+		if !strings.Contains(filter, "armSkuName eq 'Standard_D2as_v5'") || !strings.Contains(filter, "armRegionName eq 'eastus'") {
+			t.Errorf("unexpected filter %q", filter)
+		}
+		fmt.Fprint(w, `{"Items":[
+			{"retailPrice":0.096,"skuName":"D2as v5","productName":"Virtual Machines Dasv5 Series"},
+			{"retailPrice":0.030,"skuName":"D2as v5 Spot","productName":"Virtual Machines Dasv5 Series Windows"},
+			{"retailPrice":0.012,"skuName":"D2as v5 Spot","productName":"Virtual Machines Dasv5 Series"}
+		]}`)
+	}))
+	defer server.Close()
+
+	client := &retailPriceClient{httpClient: server.Client(), endpoint: server.URL}
+
+	price, err := client.getSpotPrice(context.Background(), "eastus", "Standard_D2as_v5")
+	if err != nil {
+		t.Fatalf("getSpotPrice() error = %v", err)
+	}
+	if price != 0.012 {
+		t.Errorf("getSpotPrice() = %v, want 0.012", price)
+	}
+}
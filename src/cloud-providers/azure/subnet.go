@@ -0,0 +1,144 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	armnetwork "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+)
+
+// virtualNetworkClient reads the virtual network of the pod VM subnet
+type virtualNetworkClient interface {
+	get(ctx context.Context) (*armnetwork.VirtualNetwork, error)
+}
+
+type azureVirtualNetworkClient struct {
+	client            *armnetwork.VirtualNetworksClient
+	resourceGroupName string
+	vnetName          string
+}
+
+func newVirtualNetworkClient(subnetID string, credential azcore.TokenCredential, options *arm.ClientOptions) (virtualNetworkClient, error) {
+	id, err := arm.ParseResourceID(subnetID)
+	if err != nil {
+		return nil, fmt.Errorf("parsing subnet id %q: %w", subnetID, err)
+	}
+	vnetID := id.Parent
+	if vnetID == nil || !strings.EqualFold(vnetID.ResourceType.String(), "Microsoft.Network/virtualNetworks") {
+		return nil, fmt.Errorf("subnet id %q has no virtual network", subnetID)
+	}
+
+	client, err := armnetwork.NewVirtualNetworksClient(vnetID.SubscriptionID, credential, options)
+	if err != nil {
+		return nil, fmt.Errorf("creating virtual networks client: %w", err)
+	}
+
+	return &azureVirtualNetworkClient{
+		client:            client,
+		resourceGroupName: vnetID.ResourceGroupName,
+		vnetName:          vnetID.Name,
+	}, nil
+}
+
+func (c *azureVirtualNetworkClient) get(ctx context.Context) (*armnetwork.VirtualNetwork, error) {
+	resp, err := c.client.Get(ctx, c.resourceGroupName, c.vnetName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getting virtual network %q: %w", c.vnetName, err)
+	}
+	return &resp.VirtualNetwork, nil
+}
+
+// checkSubnetReachability returns an error when nodeIP is neither in the address space of vnet
+// nor in the one of a connected peering, as the pod VMs on vnet then can't reach the worker node.
+// Routes through gateways or network virtual appliances aren't known, so this is best effort.
+func checkSubnetReachability(vnet *armnetwork.VirtualNetwork, nodeIP netip.Addr) error {
+	if vnet.Properties == nil {
+		return fmt.Errorf("virtual network %s has no properties", stringValue(vnet.Name))
+	}
+
+	if addressSpaceContains(vnet.Properties.AddressSpace, nodeIP) {
+		return nil
+	}
+
+	for _, peering := range vnet.Properties.VirtualNetworkPeerings {
+		if peering == nil || peering.Properties == nil {
+			continue
+		}
+		props := peering.Properties
+		if !addressSpaceContains(props.RemoteAddressSpace, nodeIP) && !addressSpaceContains(props.RemoteVirtualNetworkAddressSpace, nodeIP) {
+			continue
+		}
+		if props.PeeringState == nil || *props.PeeringState != armnetwork.VirtualNetworkPeeringStateConnected {
+			state := "unknown"
+			if props.PeeringState != nil {
+				state = string(*props.PeeringState)
+			}
+			return fmt.Errorf("worker node IP %s is in the peering %s of virtual network %s, but the peering state is %s",
+				nodeIP, stringValue(peering.Name), stringValue(vnet.Name), state)
+		}
+		if props.AllowVirtualNetworkAccess != nil && !*props.AllowVirtualNetworkAccess {
+			return fmt.Errorf("worker node IP %s is in the peering %s of virtual network %s, but the peering doesn't allow virtual network access",
+				nodeIP, stringValue(peering.Name), stringValue(vnet.Name))
+		}
+		return nil
+	}
+
+	return fmt.Errorf("worker node IP %s is neither in virtual network %s nor in a peered network", nodeIP, stringValue(vnet.Name))
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func addressSpaceContains(space *armnetwork.AddressSpace, ip netip.Addr) bool {
+	if space == nil {
+		return false
+	}
+	for _, prefix := range space.AddressPrefixes {
+		if prefix == nil {
+			continue
+		}
+		p, err := netip.ParsePrefix(*prefix)
+		if err != nil {
+			continue
+		}
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSubnetReachability warns when the pod VM subnet looks unreachable from the worker node.
+// It never fails the startup, as the worker node may still be reachable through routes it can't see.
+func (p *azureProvider) validateSubnetReachability(ctx context.Context, client virtualNetworkClient, nodeIP string) error {
+	if nodeIP == "" {
+		logger.Printf("worker node IP is unknown, skipping the subnet reachability check")
+		return nil
+	}
+	ip, err := netip.ParseAddr(nodeIP)
+	if err != nil {
+		return fmt.Errorf("parsing worker node IP %q: %w", nodeIP, err)
+	}
+
+	vnet, err := client.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := checkSubnetReachability(vnet, ip.Unmap()); err != nil {
+		return fmt.Errorf("pod VMs on subnet %s may not be able to reach the worker node: %w", p.serviceConfig.SubnetId, err)
+	}
+	logger.Printf("worker node IP %s is reachable from virtual network %s", ip, stringValue(vnet.Name))
+	return nil
+}
@@ -0,0 +1,144 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	armnetwork "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+)
+
+type mockVirtualNetworkClient struct {
+	vnet *armnetwork.VirtualNetwork
+	err  error
+}
+
+func (m *mockVirtualNetworkClient) get(ctx context.Context) (*armnetwork.VirtualNetwork, error) {
+	return m.vnet, m.err
+}
+
+func testVirtualNetwork(peerings ...*armnetwork.VirtualNetworkPeering) *armnetwork.VirtualNetwork {
+	return &armnetwork.VirtualNetwork{
+		Name: to.Ptr("podvm-vnet"),
+		Properties: &armnetwork.VirtualNetworkPropertiesFormat{
+			AddressSpace: &armnetwork.AddressSpace{
+				AddressPrefixes: []*string{to.Ptr("10.0.0.0/16")},
+			},
+			VirtualNetworkPeerings: peerings,
+		},
+	}
+}
+
+func testPeering(state armnetwork.VirtualNetworkPeeringState, allowAccess bool, prefixes ...string) *armnetwork.VirtualNetworkPeering {
+	return &armnetwork.VirtualNetworkPeering{
+		Name: to.Ptr("to-aks-vnet"),
+		Properties: &armnetwork.VirtualNetworkPeeringPropertiesFormat{
+			PeeringState:              to.Ptr(state),
+			AllowVirtualNetworkAccess: to.Ptr(allowAccess),
+			RemoteAddressSpace: &armnetwork.AddressSpace{
+				AddressPrefixes: to.SliceOfPtrs(prefixes...),
+			},
+		},
+	}
+}
+
+func TestValidateSubnetReachability(t *testing.T) {
+	tests := []struct {
+		name   string
+		client *mockVirtualNetworkClient
+		nodeIP string
+		err    string
+	}{
+		{
+			name:   "unknown node IP",
+			client: &mockVirtualNetworkClient{err: errors.New("must not be called")},
+		},
+		{
+			name:   "invalid node IP",
+			client: &mockVirtualNetworkClient{vnet: testVirtualNetwork()},
+			nodeIP: "node-1",
+			err:    "parsing worker node IP",
+		},
+		{
+			name:   "same virtual network",
+			client: &mockVirtualNetworkClient{vnet: testVirtualNetwork()},
+			nodeIP: "10.0.1.4",
+		},
+		{
+			name: "connected peering",
+			client: &mockVirtualNetworkClient{vnet: testVirtualNetwork(
+				testPeering(armnetwork.VirtualNetworkPeeringStateConnected, true, "10.224.0.0/12"),
+			)},
+			nodeIP: "10.224.0.4",
+		},
+		{
+			name: "disconnected peering",
+			client: &mockVirtualNetworkClient{vnet: testVirtualNetwork(
+				testPeering(armnetwork.VirtualNetworkPeeringStateDisconnected, true, "10.224.0.0/12"),
+			)},
+			nodeIP: "10.224.0.4",
+			err:    "peering state is Disconnected",
+		},
+		{
+			name: "peering without virtual network access",
+			client: &mockVirtualNetworkClient{vnet: testVirtualNetwork(
+				testPeering(armnetwork.VirtualNetworkPeeringStateConnected, false, "10.224.0.0/12"),
+			)},
+			nodeIP: "10.224.0.4",
+			err:    "doesn't allow virtual network access",
+		},
+		{
+			name: "disconnected network",
+			client: &mockVirtualNetworkClient{vnet: testVirtualNetwork(
+				testPeering(armnetwork.VirtualNetworkPeeringStateConnected, true, "172.16.0.0/16"),
+			)},
+			nodeIP: "10.224.0.4",
+			err:    "neither in virtual network podvm-vnet nor in a peered network",
+		},
+		{
+			name:   "virtual network lookup fails",
+			client: &mockVirtualNetworkClient{err: errors.New("authorization failed")},
+			nodeIP: "10.0.1.4",
+			err:    "authorization failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &azureProvider{
+				serviceConfig: &Config{SubnetId: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/podvm-vnet/subnets/default"},
+			}
+
+			err := p.validateSubnetReachability(context.Background(), tt.client, tt.nodeIP)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("validateSubnetReachability() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("validateSubnetReachability() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewVirtualNetworkClient(t *testing.T) {
+	client, err := newVirtualNetworkClient("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/podvm-vnet/subnets/default", nil, nil)
+	if err != nil {
+		t.Fatalf("newVirtualNetworkClient() error = %v", err)
+	}
+	azureClient := client.(*azureVirtualNetworkClient)
+	if azureClient.resourceGroupName != "rg" || azureClient.vnetName != "podvm-vnet" {
+		t.Errorf("expected virtual network rg/podvm-vnet, got %s/%s", azureClient.resourceGroupName, azureClient.vnetName)
+	}
+
+	if _, err := newVirtualNetworkClient("/subscriptions/sub/resourceGroups/rg", nil, nil); err == nil {
+		t.Error("expected an error for an id without a virtual network")
+	}
+}
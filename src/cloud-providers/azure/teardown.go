@@ -0,0 +1,174 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	armcompute "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
+	armnetwork "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+const (
+	// ownerTag marks the VMs created by the adaptor, so that they can be told apart from
+	// the other VMs of the resource group
+	ownerTag      = "peerpod-owner"
+	ownerTagValue = "cloud-api-adaptor"
+
+	// The NIC of a pod VM is named after the VM, with this suffix
+	nicNameSuffix = "-net"
+
+	// leftoverTag records when the NIC left behind by a failed VM create was tagged, in RFC 3339
+	leftoverTag = "peerpod-leftover-since"
+	// A leftover NIC younger than this may still be in use, e.g. by a retried create
+	orphanedNICMinAge = 10 * time.Minute
+
+	teardownTimeout = 10 * time.Minute
+)
+
+// ownsVM returns whether a VM was created by this adaptor
+func (p *azureProvider) ownsVM(vm *armcompute.VirtualMachine) bool {
+	return p.ownsTags(vm.Tags)
+}
+
+// ownsTags returns whether tags mark a resource created by this adaptor, i.e. they have the
+// owner tag and, when the node name is known, the node name tag of this node
+func (p *azureProvider) ownsTags(tags map[string]*string) bool {
+	if owner := tags[ownerTag]; owner == nil || *owner != ownerTagValue {
+		return false
+	}
+	if p.nodeName == "" {
+		return true
+	}
+	node := tags[provider.NodeNameTag]
+	return node != nil && *node == p.nodeName
+}
+
+// deleteOwnedVMs deletes all the VMs of the resource group created by this adaptor, including
+// the ones it lost track of. It's only meant for tearing down the environment.
+func (p *azureProvider) deleteOwnedVMs(ctx context.Context) error {
+	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, p.clientOptions)
+	if err != nil {
+		return fmt.Errorf("creating VM client: %w", err)
+	}
+
+	var ids []string
+	pager := vmClient.NewListPager(p.serviceConfig.ResourceGroupName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("listing VMs: %w", err)
+		}
+		for _, vm := range page.Value {
+			if vm.ID != nil && p.ownsVM(vm) {
+				ids = append(ids, *vm.ID)
+			}
+		}
+	}
+
+	logger.Printf("Teardown: deleting %d pod VMs", len(ids))
+
+	var errs []error
+	for _, id := range ids {
+		if err := p.DeleteInstance(ctx, id); err != nil {
+			errs = append(errs, fmt.Errorf("deleting %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// tagLeftoverNIC marks the NIC a failed VM create may have left behind as owned by this adaptor,
+// since NICs created along with their VM don't get its tags. This is best-effort: an untagged
+// NIC is never deleted by the teardown.
+func (p *azureProvider) tagLeftoverNIC(ctx context.Context, name string) {
+	nicClient, err := armnetwork.NewInterfacesClient(p.serviceConfig.SubscriptionId, p.azureClient, p.clientOptions)
+	if err != nil {
+		logger.Printf("creating network interfaces client: %v", err)
+		return
+	}
+
+	tags := p.getResourceTags()
+	tags[leftoverTag] = to.Ptr(p.getClock().Now().UTC().Format(time.RFC3339))
+	if _, err := nicClient.UpdateTags(ctx, p.serviceConfig.ResourceGroupName, name, armnetwork.TagsObject{Tags: tags}, nil); err != nil && !isNotFoundError(err) {
+		logger.Printf("tagging leftover network interface %s: %v", name, err)
+	}
+}
+
+// deleteOrphanedNICs deletes the pod VM NICs of the subnet that no VM uses. NICs are deleted
+// along with their VM, but a failed VM create can leave its NIC behind. They are deleted one
+// at a time and waited for, so that they are gone when the adaptor shutdown completes.
+func (p *azureProvider) deleteOrphanedNICs(ctx context.Context) error {
+	nicClient, err := armnetwork.NewInterfacesClient(p.serviceConfig.SubscriptionId, p.azureClient, p.clientOptions)
+	if err != nil {
+		return fmt.Errorf("creating network interfaces client: %w", err)
+	}
+
+	now := p.getClock().Now()
+	var names []string
+	pager := nicClient.NewListPager(p.serviceConfig.ResourceGroupName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("listing network interfaces: %w", err)
+		}
+		for _, nic := range page.Value {
+			if p.isOrphanedNIC(nic, now) {
+				names = append(names, *nic.Name)
+			}
+		}
+	}
+
+	logger.Printf("Teardown: deleting %d orphaned pod VM network interfaces", len(names))
+
+	var errs []error
+	for _, name := range names {
+		if err := p.deleteNetworkInterface(ctx, nicClient, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isOrphanedNIC returns whether nic is a pod VM NIC of the configured subnet not attached to any VM,
+// tagged as left behind by this adaptor, or node, for at least orphanedNICMinAge
+func (p *azureProvider) isOrphanedNIC(nic *armnetwork.Interface, now time.Time) bool {
+	if nic.Name == nil || !strings.HasSuffix(*nic.Name, nicNameSuffix) || nic.Properties == nil || nic.Properties.VirtualMachine != nil {
+		return false
+	}
+	if !p.ownsTags(nic.Tags) || nic.Tags[leftoverTag] == nil {
+		return false
+	}
+	if since, err := time.Parse(time.RFC3339, *nic.Tags[leftoverTag]); err != nil || now.Sub(since) < orphanedNICMinAge {
+		return false
+	}
+	for _, ipConfig := range nic.Properties.IPConfigurations {
+		if ipConfig.Properties == nil || ipConfig.Properties.Subnet == nil || ipConfig.Properties.Subnet.ID == nil {
+			continue
+		}
+		if strings.EqualFold(*ipConfig.Properties.Subnet.ID, p.serviceConfig.SubnetId) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteNetworkInterface deletes a NIC and waits for the deletion to complete
+func (p *azureProvider) deleteNetworkInterface(ctx context.Context, nicClient *armnetwork.InterfacesClient, name string) error {
+	poller, err := nicClient.BeginDelete(ctx, p.serviceConfig.ResourceGroupName, name, nil)
+	if err == nil {
+		_, err = poller.PollUntilDone(ctx, nil)
+	}
+	if err != nil && !isNotFoundError(err) {
+		return fmt.Errorf("deleting network interface %s: %w", name, err)
+	}
+
+	logger.Printf("deleted network interface %s", name)
+	return nil
+}
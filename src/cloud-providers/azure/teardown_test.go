@@ -0,0 +1,221 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/providertest"
+)
+
+const vmIDPrefix = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/"
+
+// vmListTransport serves the VM list of a resource group in pages of one VM and
+// its NIC list in a single page, and records the VMs and NICs deleted
+type vmListTransport struct {
+	vms         []string // JSON VM objects
+	nics        []string // JSON NIC objects
+	deleted     []string
+	deletedNICs []string
+}
+
+func (t *vmListTransport) Do(req *http.Request) (*http.Response, error) {
+	respond := func(status int, body string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	}
+
+	if strings.Contains(req.URL.Path, "/disks") && req.Method == http.MethodGet {
+		return respond(http.StatusOK, `{"value":[]}`)
+	}
+
+	if strings.Contains(req.URL.Path, "/networkInterfaces") {
+		switch req.Method {
+		case http.MethodGet:
+			return respond(http.StatusOK, fmt.Sprintf(`{"value":[%s]}`, strings.Join(t.nics, ",")))
+		case http.MethodDelete:
+			t.deletedNICs = append(t.deletedNICs, req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:])
+			return respond(http.StatusOK, "")
+		}
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		page := 0
+		if p := req.URL.Query().Get("page"); p != "" {
+			fmt.Sscan(p, &page)
+		}
+		if page >= len(t.vms) {
+			return respond(http.StatusOK, `{"value":[]}`)
+		}
+		next := ""
+		if page+1 < len(t.vms) {
+			next = fmt.Sprintf(`,"nextLink":"https://management.azure.com%s?page=%d"`, req.URL.Path, page+1)
+		}
+		return respond(http.StatusOK, fmt.Sprintf(`{"value":[%s]%s}`, t.vms[page], next))
+	case http.MethodDelete:
+		t.deleted = append(t.deleted, strings.TrimPrefix(req.URL.Path, vmIDPrefix))
+		return respond(http.StatusOK, "")
+	}
+	return respond(http.StatusBadRequest, `{"error":{"code":"BadRequest","message":"unexpected request"}}`)
+}
+
+func testVM(name string, tags map[string]string) string {
+	var pairs []string
+	for k, v := range tags {
+		pairs = append(pairs, fmt.Sprintf("%q:%q", k, v))
+	}
+	return fmt.Sprintf(`{"id":"%s%s","name":"%s","tags":{%s}}`, vmIDPrefix, name, name, strings.Join(pairs, ","))
+}
+
+func TestTeardownDeleteVMs(t *testing.T) {
+	vms := []string{
+		testVM("podvm-a", map[string]string{ownerTag: ownerTagValue, "peerpod-node": "worker-1"}),
+		testVM("podvm-b", map[string]string{ownerTag: ownerTagValue, "peerpod-node": "worker-2"}),
+		testVM("unrelated", map[string]string{"app": "db"}),
+		testVM("podvm-c", map[string]string{ownerTag: ownerTagValue, "peerpod-node": "worker-1"}),
+	}
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		nodeName string
+		want     []string
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:     "node VMs",
+			enabled:  true,
+			nodeName: "worker-1",
+			want:     []string{"podvm-a", "podvm-c"},
+		},
+		{
+			name:    "unknown node",
+			enabled: true,
+			want:    []string{"podvm-a", "podvm-b", "podvm-c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &vmListTransport{vms: vms}
+			p := &azureProvider{
+				azureClient:   &fake.TokenCredential{},
+				clientOptions: &arm.ClientOptions{ClientOptions: policy.ClientOptions{Transport: transport}},
+				serviceConfig: &Config{
+					SubscriptionId:    "sub",
+					ResourceGroupName: "rg",
+					TeardownDeleteVMs: tt.enabled,
+				},
+				nodeName: tt.nodeName,
+			}
+
+			if err := p.Teardown(); err != nil {
+				t.Fatalf("Teardown() error = %v", err)
+			}
+			sort.Strings(transport.deleted)
+			if !reflect.DeepEqual(transport.deleted, tt.want) {
+				t.Errorf("expected %v to be deleted, got %v", tt.want, transport.deleted)
+			}
+		})
+	}
+}
+
+func testNIC(name, subnetID string, attached bool, tags map[string]string) string {
+	vm := ""
+	if attached {
+		vm = fmt.Sprintf(`"virtualMachine":{"id":"%s%s"},`, vmIDPrefix, strings.TrimSuffix(name, nicNameSuffix))
+	}
+	var pairs []string
+	for k, v := range tags {
+		pairs = append(pairs, fmt.Sprintf("%q:%q", k, v))
+	}
+	return fmt.Sprintf(`{"name":"%s","tags":{%s},"properties":{%s"ipConfigurations":[{"properties":{"subnet":{"id":"%s"}}}]}}`,
+		name, strings.Join(pairs, ","), vm, subnetID)
+}
+
+func TestTeardownDeleteOrphanedNICs(t *testing.T) {
+	const subnetID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/podvms"
+
+	clock := providertest.NewFakeClock()
+	old := clock.Now().Add(-orphanedNICMinAge).UTC().Format(time.RFC3339)
+	leftover := map[string]string{ownerTag: ownerTagValue, provider.NodeNameTag: "worker-1", leftoverTag: old}
+	transport := &vmListTransport{
+		nics: []string{
+			testNIC("podvm-a-net", subnetID, true, leftover),
+			testNIC("podvm-b-net", subnetID, false, leftover),
+			testNIC("podvm-c-net", strings.ToUpper(subnetID), false, leftover),
+			testNIC("podvm-d-net", "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/other", false, leftover),
+			testNIC("db-nic", subnetID, false, leftover),
+			// Possibly in use by another adaptor or a create in progress
+			testNIC("podvm-e-net", subnetID, false, nil),
+			testNIC("podvm-f-net", subnetID, false, map[string]string{ownerTag: ownerTagValue, provider.NodeNameTag: "worker-2", leftoverTag: old}),
+			testNIC("podvm-g-net", subnetID, false, map[string]string{ownerTag: ownerTagValue, provider.NodeNameTag: "worker-1"}),
+			testNIC("podvm-h-net", subnetID, false, map[string]string{ownerTag: ownerTagValue, provider.NodeNameTag: "worker-1",
+				leftoverTag: clock.Now().Add(-orphanedNICMinAge + time.Second).UTC().Format(time.RFC3339)}),
+		},
+	}
+	p := &azureProvider{
+		nodeName:      "worker-1",
+		azureClient:   &fake.TokenCredential{},
+		clientOptions: &arm.ClientOptions{ClientOptions: policy.ClientOptions{Transport: transport}},
+		serviceConfig: &Config{
+			SubscriptionId:    "sub",
+			ResourceGroupName: "rg",
+			SubnetId:          subnetID,
+			TeardownDeleteVMs: true,
+		},
+		clock: clock,
+	}
+
+	if err := p.Teardown(); err != nil {
+		t.Fatalf("Teardown() error = %v", err)
+	}
+
+	// The deletions are complete when Teardown returns, only leftovers of this node old enough are deleted
+	if want := []string{"podvm-b-net", "podvm-c-net"}; !reflect.DeepEqual(transport.deletedNICs, want) {
+		t.Errorf("expected %v to be deleted, got %v", want, transport.deletedNICs)
+	}
+}
+
+func TestTeardownDeleteVMsListError(t *testing.T) {
+	transport := &statusTransport{statusCode: http.StatusForbidden}
+	p := newTestProvider(transport)
+	p.serviceConfig.TeardownDeleteVMs = true
+
+	if err := p.Teardown(); err == nil {
+		t.Error("expected an error when the VMs can't be listed")
+	}
+}
+
+func TestGetResourceTagsOwner(t *testing.T) {
+	p := &azureProvider{
+		serviceConfig: &Config{Tags: map[string]string{"app": "peerpods"}},
+		nodeName:      "worker-1",
+	}
+
+	tags := p.getResourceTags()
+	for k, want := range map[string]string{ownerTag: ownerTagValue, "peerpod-node": "worker-1", "app": "peerpods"} {
+		if got := tags[k]; got == nil || *got != want {
+			t.Errorf("expected tag %s=%s, got %v", k, want, got)
+		}
+	}
+}
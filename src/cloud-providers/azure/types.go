@@ -4,6 +4,7 @@
 package azure
 
 import (
+	"fmt"
 	"strings"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
@@ -25,6 +26,45 @@ func (i *instanceSizes) Set(value string) error {
 	return nil
 }
 
+type applicationSecurityGroupIds []string
+
+func (i *applicationSecurityGroupIds) String() string {
+	return strings.Join(*i, ", ")
+}
+
+func (i *applicationSecurityGroupIds) Set(value string) error {
+	if len(value) == 0 {
+		*i = make(applicationSecurityGroupIds, 0)
+	} else {
+		*i = append(*i, strings.Split(value, ",")...)
+	}
+	return nil
+}
+
+// Security types of the VMs
+const (
+	securityTypeConfidentialVM = "ConfidentialVM"
+	securityTypeTrustedLaunch  = "TrustedLaunch"
+	securityTypeStandard       = "Standard"
+)
+
+// securityType is one of the security types of the VMs, or empty to use -disable-cvm
+type securityType string
+
+func (t *securityType) String() string {
+	return string(*t)
+}
+
+func (t *securityType) Set(value string) error {
+	switch value {
+	case "", securityTypeConfidentialVM, securityTypeTrustedLaunch, securityTypeStandard:
+		*t = securityType(value)
+		return nil
+	default:
+		return fmt.Errorf("invalid security type %q: must be %s, %s or %s", value, securityTypeConfidentialVM, securityTypeTrustedLaunch, securityTypeStandard)
+	}
+}
+
 type Config struct {
 	SubscriptionId       string
 	ClientId             string
@@ -48,8 +88,71 @@ type Config struct {
 	// Disabled by default, we want to do measured boot.
 	// Secure boot brings no additional security.
 	EnableSecureBoot bool
-	UsePublicIP      bool
-	RootVolumeSize   int
+	// The vTPM is on by default for trusted launch VMs, some images boot
+	// without it. Confidential VMs require it.
+	DisableVTPM    bool
+	UsePublicIP    bool
+	RootVolumeSize int
+	// Some confidential images don't ship the Azure guest agent, which also
+	// runs the extensions such as guest configuration
+	DisableVMAgent             bool
+	DisableExtensionOperations bool
+	DisableBootDiagnostics     bool
+	// Create the network security group rules required by the pod network tunnel at startup
+	EnsureNSGRules      bool
+	NSGRuleSourcePrefix string
+	ForwarderPort       string
+	VXLANPort           string
+	// Storage account and container for the userData over the Azure size limit, disabled if empty
+	UserDataStorageAccount   string
+	UserDataStorageContainer string
+	// Delete all the VMs created from this node, found by their tags, on teardown
+	TeardownDeleteVMs bool
+	// Create the VMs with the hibernation capability, which the size and the image must support
+	UseHibernation bool
+	// Format of the userData, cloud-init or ignition
+	UserDataFormat string
+	// Don't tag the VMs with the name and namespace of their pod
+	DisablePodTags bool
+	// Keep the OS disk of a deleted VM, e.g. for forensics, instead of deleting it along with the VM
+	RetainOSDiskOnDelete bool
+	// Place the VMs on a dedicated host, or on any host of a host group, isolated from other
+	// tenants. At most one of the resource IDs can be set.
+	DedicatedHostId string
+	HostGroupId     string
+	// Application security groups the NICs of the VMs join, so that the NSG rules can target
+	// the Pod VMs as a group rather than by address
+	ApplicationSecurityGroupIds applicationSecurityGroupIds
+	// Create Spot VMs, evicted with SpotEvictionPolicy when Azure needs the capacity back or the
+	// spot price exceeds SpotMaxPrice in USD per hour, -1 to pay at most the on-demand price
+	UseSpot            bool
+	SpotMaxPrice       float64
+	SpotEvictionPolicy string
+	// Security type of the VMs. Trusted Launch VMs have secure boot and a vTPM without the
+	// memory encryption of confidential VMs. If empty, DisableCVM selects Standard VMs over
+	// confidential VMs.
+	SecurityType securityType
+	// Storage account type of the OS disks, e.g. StandardSSD_LRS, Premium_LRS if empty
+	RootVolumeType string
+	// SSH public key of the VMs in authorized_keys format, e.g. from a secret, used over
+	// SSHKeyPath
+	SSHPubKey string
+	// Enable accelerated networking on the NICs of the VMs, which the VM sizes must support
+	EnableAcceleratedNetworking bool
+	// Delete the OS disks failed creates left behind at startup and teardown, only the ones
+	// tagged by this node
+	CleanupOrphanedDisks bool
+}
+
+// vmSecurityType returns the security type of the VMs
+func (c *Config) vmSecurityType() securityType {
+	if c.SecurityType != "" {
+		return c.SecurityType
+	}
+	if c.DisableCVM {
+		return securityTypeStandard
+	}
+	return securityTypeConfidentialVM
 }
 
 func (c Config) Redact() Config {
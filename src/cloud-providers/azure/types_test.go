@@ -57,3 +57,17 @@ func TestGenerateSSHKeyPair(t *testing.T) {
 		t.Errorf("Failed to parse generated public key: %v", err)
 	}
 }
+
+func TestSecurityTypeSet(t *testing.T) {
+	for _, value := range []string{"", securityTypeConfidentialVM, securityTypeTrustedLaunch, securityTypeStandard} {
+		var st securityType
+		if err := st.Set(value); err != nil || st.String() != value {
+			t.Errorf("Set(%q) = %v, got %q", value, err, st)
+		}
+	}
+
+	var st securityType
+	if err := st.Set("trustedlaunch"); err == nil {
+		t.Error("Set() error = nil, want an error for an unknown security type")
+	}
+}
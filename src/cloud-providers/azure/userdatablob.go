@@ -0,0 +1,156 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+const (
+	defaultUserDataContainer = "peerpod-userdata"
+
+	// userDataSASValidity bounds how long the pod VM can fetch its userData. process-user-data
+	// fetches it at first boot, so this only has to cover the VM provisioning time.
+	userDataSASValidity = time.Hour
+)
+
+// userDataStore keeps userData that is too large for the VM API out of band
+type userDataStore interface {
+	// put stores the userData and returns a URL the pod VM can read it from
+	put(ctx context.Context, name string, data []byte) (string, error)
+	// delete removes the userData, it returns nil when it doesn't exist
+	delete(ctx context.Context, name string) error
+}
+
+// blobUserDataStore stores userData as block blobs, and hands out read-only user delegation
+// SAS URLs, so that neither the pod VM nor the blob needs an account key.
+// The credential needs the Storage Blob Data Contributor role on the container.
+type blobUserDataStore struct {
+	client    *service.Client
+	container string
+	now       func() time.Time
+}
+
+// blobServiceURL returns the URL of the blob service of a storage account
+func blobServiceURL(account string) string {
+	return fmt.Sprintf("https://%s.blob.core.windows.net/", account)
+}
+
+func newBlobUserDataStore(credential azcore.TokenCredential, serviceURL, container string, options *service.ClientOptions) (*blobUserDataStore, error) {
+	client, err := service.NewClient(serviceURL, credential, options)
+	if err != nil {
+		return nil, fmt.Errorf("creating blob service client: %w", err)
+	}
+
+	return &blobUserDataStore{
+		client:    client,
+		container: container,
+		now:       time.Now,
+	}, nil
+}
+
+// ensureContainer creates the container if it doesn't exist yet
+func (s *blobUserDataStore) ensureContainer(ctx context.Context) error {
+	_, err := s.client.CreateContainer(ctx, s.container, nil)
+	if err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+		return fmt.Errorf("creating container %s: %w", s.container, err)
+	}
+	return nil
+}
+
+func (s *blobUserDataStore) blobClient(name string) *blockblob.Client {
+	return s.client.NewContainerClient(s.container).NewBlockBlobClient(name)
+}
+
+func (s *blobUserDataStore) put(ctx context.Context, name string, data []byte) (string, error) {
+	blobClient := s.blobClient(name)
+	_, err := blobClient.Upload(ctx, streaming.NopCloser(bytes.NewReader(data)), &blockblob.UploadOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: to.Ptr("text/cloud-config")},
+	})
+	if err != nil {
+		return "", fmt.Errorf("uploading userData blob %s: %w", name, err)
+	}
+
+	query, err := s.readSAS(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	return blobClient.URL() + "?" + query, nil
+}
+
+func (s *blobUserDataStore) delete(ctx context.Context, name string) error {
+	_, err := s.blobClient(name).Delete(ctx, nil)
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("deleting userData blob %s: %w", name, err)
+	}
+	return nil
+}
+
+// readSAS returns a user delegation SAS query string granting read access to a single blob
+func (s *blobUserDataStore) readSAS(ctx context.Context, name string) (string, error) {
+	now := s.now().UTC()
+	// Allow for clock skew between the adaptor and the storage service
+	start := now.Add(-5 * time.Minute)
+	expiry := now.Add(userDataSASValidity)
+
+	credential, err := s.client.GetUserDelegationCredential(ctx, service.KeyInfo{
+		Start:  to.Ptr(start.Format(sas.TimeFormat)),
+		Expiry: to.Ptr(expiry.Format(sas.TimeFormat)),
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("getting user delegation key: %w", err)
+	}
+
+	values, err := sas.BlobSignatureValues{
+		Protocol:      sas.ProtocolHTTPS,
+		StartTime:     start,
+		ExpiryTime:    expiry,
+		Permissions:   (&sas.BlobPermissions{Read: true}).String(),
+		ContainerName: s.container,
+		BlobName:      name,
+	}.SignWithUserDelegation(credential)
+	if err != nil {
+		return "", fmt.Errorf("signing userData SAS: %w", err)
+	}
+	return values.Encode(), nil
+}
+
+// userDataFor returns the cloud config passed to the VM. When it doesn't fit in the Azure
+// userData limit and a storage account is configured, the cloud config is stored as a blob,
+// and the VM gets a small bootstrap pointing process-user-data, or Ignition, at it instead.
+func (p *azureProvider) userDataFor(ctx context.Context, instanceName, cloudConfig string) (string, error) {
+	_, err := provider.UserDataEncoder{MaxEncodedSize: provider.AzureUserDataMaxEncodedSize}.Encode(cloudConfig)
+	if !errors.Is(err, provider.ErrUserDataTooLarge) || p.userDataStore == nil {
+		// getVMParameters reports the error if it's too large
+		return cloudConfig, nil
+	}
+
+	logger.Printf("userData of %s is %d bytes, over the Azure limit, storing it in a blob", instanceName, len(cloudConfig))
+
+	blobURL, err := p.userDataStore.put(ctx, instanceName, []byte(cloudConfig))
+	if err != nil {
+		return "", err
+	}
+
+	if p.serviceConfig.UserDataFormat == cloudinit.UserDataFormatIgnition {
+		return cloudinit.IgnitionReplaceConfig(blobURL)
+	}
+	return fmt.Sprintf("#cloud-config\nuserdata_url: %q\n", blobURL), nil
+}
@@ -0,0 +1,194 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	blobservice "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+// fakeBlobService emulates the blob service endpoints used by blobUserDataStore
+type fakeBlobService struct {
+	blobs map[string]string
+}
+
+func (f *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Query().Get("comp") == "userdelegationkey":
+		key := base64.StdEncoding.EncodeToString([]byte("user-delegation-key"))
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = io.WriteString(w, `<?xml version="1.0" encoding="utf-8"?><UserDelegationKey><SignedOid>oid</SignedOid><SignedTid>tid</SignedTid>`+
+			`<SignedStart>2025-01-01T00:00:00Z</SignedStart><SignedExpiry>2025-01-01T01:00:00Z</SignedExpiry><SignedService>b</SignedService>`+
+			`<SignedVersion>2022-11-02</SignedVersion><Value>`+key+`</Value></UserDelegationKey>`)
+	case r.Method == http.MethodPut && r.URL.Query().Get("restype") == "container":
+		w.Header().Set("x-ms-error-code", "ContainerAlreadyExists")
+		w.WriteHeader(http.StatusConflict)
+	case r.Method == http.MethodPut && r.Header.Get("x-ms-blob-type") == "BlockBlob":
+		data, _ := io.ReadAll(r.Body)
+		f.blobs[r.URL.Path] = string(data)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete:
+		if _, ok := f.blobs[r.URL.Path]; !ok {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.blobs, r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func newTestUserDataStore(t *testing.T) (*blobUserDataStore, *fakeBlobService) {
+	service := &fakeBlobService{blobs: map[string]string{}}
+	// The SDK only sends bearer tokens over TLS
+	srv := httptest.NewTLSServer(service)
+	t.Cleanup(srv.Close)
+
+	options := &blobservice.ClientOptions{ClientOptions: policy.ClientOptions{Transport: srv.Client()}}
+	store, err := newBlobUserDataStore(&fake.TokenCredential{}, srv.URL, defaultUserDataContainer, options)
+	if err != nil {
+		t.Fatalf("newBlobUserDataStore() error = %v", err)
+	}
+	store.now = func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) }
+	return store, service
+}
+
+func TestBlobUserDataStore(t *testing.T) {
+	store, _ := newTestUserDataStore(t)
+	ctx := context.Background()
+
+	// An existing container is not an error
+	if err := store.ensureContainer(ctx); err != nil {
+		t.Errorf("ensureContainer() error = %v", err)
+	}
+	// Nor is a blob that was already deleted
+	if err := store.delete(ctx, "podvm-missing"); err != nil {
+		t.Errorf("delete() error = %v", err)
+	}
+}
+
+func TestUserDataForFallback(t *testing.T) {
+	// 48KB is exactly the 64KB limit once base64 encoded
+	small := strings.Repeat("a", provider.AzureUserDataMaxEncodedSize/4*3)
+	large := small + "a"
+
+	t.Run("within limit", func(t *testing.T) {
+		store, service := newTestUserDataStore(t)
+		p := &azureProvider{serviceConfig: &Config{}, userDataStore: store}
+
+		got, err := p.userDataFor(context.Background(), "podvm-test", small)
+		if err != nil {
+			t.Fatalf("userDataFor() error = %v", err)
+		}
+		if got != small {
+			t.Error("expected the userData to be passed as is")
+		}
+		if len(service.blobs) != 0 {
+			t.Errorf("expected no blob to be uploaded, got %d", len(service.blobs))
+		}
+	})
+
+	t.Run("over limit without storage", func(t *testing.T) {
+		p := &azureProvider{serviceConfig: &Config{}}
+
+		got, err := p.userDataFor(context.Background(), "podvm-test", large)
+		if err != nil {
+			t.Fatalf("userDataFor() error = %v", err)
+		}
+		if got != large {
+			t.Error("expected the userData to be passed as is")
+		}
+	})
+
+	t.Run("over limit with ignition", func(t *testing.T) {
+		store, service := newTestUserDataStore(t)
+		p := &azureProvider{serviceConfig: &Config{UserDataFormat: cloudinit.UserDataFormatIgnition}, userDataStore: store}
+
+		got, err := p.userDataFor(context.Background(), "podvm-test", large)
+		if err != nil {
+			t.Fatalf("userDataFor() error = %v", err)
+		}
+		if blob := service.blobs["/peerpod-userdata/podvm-test"]; blob != large {
+			t.Errorf("expected the userData to be uploaded, got %d bytes", len(blob))
+		}
+
+		var config struct {
+			Ignition struct {
+				Config struct {
+					Replace struct {
+						Source string `json:"source"`
+					} `json:"replace"`
+				} `json:"config"`
+			} `json:"ignition"`
+		}
+		if err := json.Unmarshal([]byte(got), &config); err != nil {
+			t.Fatalf("expected a bootstrap ignition config, got %q: %v", got, err)
+		}
+		blobURL, err := url.Parse(config.Ignition.Config.Replace.Source)
+		if err != nil || blobURL.Path != "/peerpod-userdata/podvm-test" {
+			t.Errorf("unexpected ignition config source %q", config.Ignition.Config.Replace.Source)
+		}
+	})
+
+	t.Run("over limit", func(t *testing.T) {
+		store, service := newTestUserDataStore(t)
+		p := &azureProvider{serviceConfig: &Config{}, userDataStore: store}
+
+		got, err := p.userDataFor(context.Background(), "podvm-test", large)
+		if err != nil {
+			t.Fatalf("userDataFor() error = %v", err)
+		}
+
+		if blob := service.blobs["/peerpod-userdata/podvm-test"]; blob != large {
+			t.Errorf("expected the userData to be uploaded, got %d bytes", len(blob))
+		}
+		if !strings.HasPrefix(got, "#cloud-config\nuserdata_url: ") {
+			t.Fatalf("expected a bootstrap cloud config, got %q", got)
+		}
+
+		rawURL := strings.Trim(strings.TrimSpace(strings.TrimPrefix(got, "#cloud-config\nuserdata_url: ")), `"`)
+		blobURL, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatalf("invalid userData URL %q: %v", rawURL, err)
+		}
+		if blobURL.Path != "/peerpod-userdata/podvm-test" {
+			t.Errorf("unexpected blob path %q", blobURL.Path)
+		}
+		query := blobURL.Query()
+		for k, want := range map[string]string{"sp": "r", "sr": "b", "skoid": "oid", "st": "2024-12-31T23:55:00Z", "se": "2025-01-01T01:00:00Z"} {
+			if got := query.Get(k); got != want {
+				t.Errorf("expected SAS parameter %s=%q, got %q", k, want, got)
+			}
+		}
+		if query.Get("sig") == "" {
+			t.Error("expected a signed SAS")
+		}
+
+		p.deleteUserData(context.Background(), "podvm-test")
+		if len(service.blobs) != 0 {
+			t.Errorf("expected the blob to be deleted, got %d blobs", len(service.blobs))
+		}
+	})
+}
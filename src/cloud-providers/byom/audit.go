@@ -0,0 +1,153 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	auditDataKey             = "allocation-history"
+	auditConfigMapNameSuffix = "-audit"
+	defaultAuditHistorySize  = 100
+
+	AllocationEventAllocate   = "allocate"
+	AllocationEventDeallocate = "deallocate"
+)
+
+// AllocationEvent is an entry of the allocation audit trail
+type AllocationEvent struct {
+	Type         string      `json:"type"`
+	Timestamp    metav1.Time `json:"timestamp"`
+	AllocationID string      `json:"allocationID"`
+	IP           string      `json:"ip"`
+	NodeName     string      `json:"nodeName"`
+	PodName      string      `json:"podName"`
+}
+
+// recordEvent appends an event to the audit ConfigMap, dropping the oldest events beyond
+// AuditHistorySize. The audit trail is informational, so failures are only logged and
+// never fail the allocation itself.
+func (cm *ConfigMapVMPoolManager) recordEvent(ctx context.Context, eventType string, allocation IPAllocation) {
+	if cm.config.AuditHistorySize <= 0 {
+		return
+	}
+
+	event := AllocationEvent{
+		Type:         eventType,
+		Timestamp:    cm.now(),
+		AllocationID: allocation.AllocationID,
+		IP:           allocation.IP,
+		NodeName:     allocation.NodeName,
+		PodName:      allocation.PodName,
+	}
+
+	configMaps := cm.client.CoreV1().ConfigMaps(cm.config.Namespace)
+	err := retry.RetryOnConflict(cm.conflictBackoff(), func() error {
+		configMap, err := configMaps.Get(ctx, cm.config.AuditConfigMapName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			data, err := marshalEvents([]AllocationEvent{event})
+			if err != nil {
+				return err
+			}
+			newConfigMap := &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      cm.config.AuditConfigMapName,
+					Namespace: cm.config.Namespace,
+					Labels: map[string]string{
+						"app.kubernetes.io/name":      "cloud-api-adaptor",
+						"app.kubernetes.io/component": "byom-ip-pool-audit",
+					},
+				},
+				Data: map[string]string{auditDataKey: data},
+			}
+			// If creation fails with "already exists", the retry loop will handle it.
+			_, err = configMaps.Create(ctx, newConfigMap, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		events, err := unmarshalEvents(configMap.Data[auditDataKey])
+		if err != nil {
+			logger.Printf("Warning: discarding unreadable allocation history: %v", err)
+		}
+		events = append(events, event)
+		if len(events) > cm.config.AuditHistorySize {
+			events = events[len(events)-cm.config.AuditHistorySize:]
+		}
+
+		data, err := marshalEvents(events)
+		if err != nil {
+			return err
+		}
+		configMapToUpdate := configMap.DeepCopy()
+		if configMapToUpdate.Data == nil {
+			configMapToUpdate.Data = make(map[string]string)
+		}
+		configMapToUpdate.Data[auditDataKey] = data
+		_, err = configMaps.Update(ctx, configMapToUpdate, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		logger.Printf("Warning: failed to record %s event for IP %s: %v", eventType, allocation.IP, err)
+	}
+}
+
+// GetAllocationHistory returns up to limit of the most recent allocation events, newest first.
+// A limit of zero or less returns the whole history.
+func (cm *ConfigMapVMPoolManager) GetAllocationHistory(ctx context.Context, limit int) ([]AllocationEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	configMap, err := cm.client.CoreV1().ConfigMaps(cm.config.Namespace).Get(ctx, cm.config.AuditConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return []AllocationEvent{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRetrievingConfigMap, err)
+	}
+
+	events, err := unmarshalEvents(configMap.Data[auditDataKey])
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+
+	history := make([]AllocationEvent, 0, len(events))
+	for i := len(events) - 1; i >= 0; i-- {
+		history = append(history, events[i])
+	}
+	return history, nil
+}
+
+func marshalEvents(events []AllocationEvent) (string, error) {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal allocation history: %w", err)
+	}
+	return string(data), nil
+}
+
+func unmarshalEvents(data string) ([]AllocationEvent, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var events []AllocationEvent
+	if err := json.Unmarshal([]byte(data), &events); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal allocation history: %w", err)
+	}
+	return events, nil
+}
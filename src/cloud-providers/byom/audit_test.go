@@ -0,0 +1,174 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestAllocationHistory(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10", "192.168.1.11"},
+		OperationTimeout: 10 * time.Second,
+		AuditHistorySize: 3,
+		SkipVMReadiness:  true,
+	}
+
+	client := fake.NewSimpleClientset()
+	manager, err := NewConfigMapVMPoolManager(client, config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+
+	// Two allocate/deallocate rounds record four events, of which only the last three are kept
+	var ips []string
+	for i := 0; i < 2; i++ {
+		allocationID := fmt.Sprintf("allocation-%d", i)
+		ip, err := manager.AllocateIP(ctx, allocationID, fmt.Sprintf("pod-%d", i))
+		if err != nil {
+			t.Fatalf("Failed to allocate IP: %v", err)
+		}
+		ips = append(ips, ip.String())
+		if err := manager.DeallocateIP(ctx, allocationID); err != nil {
+			t.Fatalf("Failed to deallocate IP: %v", err)
+		}
+	}
+
+	if _, err := client.CoreV1().ConfigMaps(config.Namespace).Get(ctx, "test-configmap-audit", metav1.GetOptions{}); err != nil {
+		t.Fatalf("Expected audit ConfigMap to be created: %v", err)
+	}
+
+	history, err := manager.GetAllocationHistory(ctx, 0)
+	if err != nil {
+		t.Fatalf("Failed to get allocation history: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("Expected history to be capped at 3 events, got %d", len(history))
+	}
+
+	expected := []struct {
+		eventType string
+		pod       string
+		ip        string
+	}{
+		{AllocationEventDeallocate, "pod-1", ips[1]},
+		{AllocationEventAllocate, "pod-1", ips[1]},
+		{AllocationEventDeallocate, "pod-0", ips[0]},
+	}
+	for i, e := range expected {
+		event := history[i]
+		if event.Type != e.eventType || event.PodName != e.pod || event.IP != e.ip {
+			t.Errorf("Event %d: expected %s of %s by %s, got %s of %s by %s",
+				i, e.eventType, e.ip, e.pod, event.Type, event.IP, event.PodName)
+		}
+		if event.NodeName != "test-node" {
+			t.Errorf("Event %d: expected node test-node, got %s", i, event.NodeName)
+		}
+		if event.Timestamp.IsZero() {
+			t.Errorf("Event %d: expected a timestamp", i)
+		}
+	}
+
+	history, err = manager.GetAllocationHistory(ctx, 1)
+	if err != nil {
+		t.Fatalf("Failed to get allocation history: %v", err)
+	}
+	if len(history) != 1 || history[0].Type != AllocationEventDeallocate || history[0].PodName != "pod-1" {
+		t.Errorf("Expected only the most recent event, got %+v", history)
+	}
+}
+
+func TestAllocationHistoryDisabled(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10"},
+		OperationTimeout: 10 * time.Second,
+		SkipVMReadiness:  true,
+	}
+
+	manager, err := NewConfigMapVMPoolManager(fake.NewSimpleClientset(), config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := manager.AllocateIP(ctx, "allocation-0", "pod-0"); err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+
+	history, err := manager.GetAllocationHistory(ctx, 0)
+	if err != nil {
+		t.Fatalf("Failed to get allocation history: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("Expected no history when the audit trail is disabled, got %d events", len(history))
+	}
+}
+
+func TestAllocationHistoryWrittenWithoutLock(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10"},
+		OperationTimeout: 10 * time.Second,
+		AuditHistorySize: 10,
+		SkipVMReadiness:  true,
+	}
+
+	client := fake.NewSimpleClientset()
+	manager, err := NewConfigMapVMPoolManager(client, config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+
+	// Every audit write must find the pool lock released
+	cm := manager.(*ConfigMapVMPoolManager)
+	var writes, lockedWrites int
+	client.PrependReactor("get", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		if action.(ktesting.GetAction).GetName() != config.AuditConfigMapName {
+			return false, nil, nil
+		}
+		writes++
+		if cm.mutex.TryLock() {
+			cm.mutex.Unlock()
+		} else {
+			lockedWrites++
+		}
+		return false, nil, nil
+	})
+
+	ctx := context.Background()
+	if _, err := manager.AllocateIP(ctx, "allocation-0", "pod-0"); err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	if err := manager.DeallocateIP(ctx, "allocation-0"); err != nil {
+		t.Fatalf("Failed to deallocate IP: %v", err)
+	}
+
+	if writes != 2 || lockedWrites != 0 {
+		t.Errorf("Expected 2 audit writes without the pool lock, got %d writes of which %d locked", writes, lockedWrites)
+	}
+}
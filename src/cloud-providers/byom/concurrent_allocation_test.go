@@ -7,13 +7,20 @@ import (
 	"context"
 	stderrors "errors"
 	"fmt"
+	"net/netip"
 	"os"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
 )
 
 // setupTestClient sets up a fake Kubernetes client for testing
@@ -379,3 +386,120 @@ func TestHashBasedIPDistribution(t *testing.T) {
 			len(uniqueIPs), len(allocatedIPs))
 	}
 }
+
+// enforceResourceVersions makes the fake client set the resource version of the ConfigMaps and
+// reject the updates of a stale one with a conflict, as the API server does
+func enforceResourceVersions(client *fake.Clientset) {
+	gvr := v1.SchemeGroupVersion.WithResource("configmaps")
+	client.PrependReactor("create", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		action.(ktesting.CreateAction).GetObject().(*v1.ConfigMap).ResourceVersion = "1"
+		return false, nil, nil
+	})
+	client.PrependReactor("update", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		configMap := action.(ktesting.UpdateAction).GetObject().(*v1.ConfigMap)
+
+		// The reactors run with the client locked, the tracker is used directly
+		current, err := client.Tracker().Get(gvr, configMap.Namespace, configMap.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		currentVersion := current.(*v1.ConfigMap).ResourceVersion
+		if configMap.ResourceVersion != currentVersion {
+			return true, nil, errors.NewConflict(v1.Resource("configmaps"), configMap.Name,
+				fmt.Errorf("resource version is %s, got %s", currentVersion, configMap.ResourceVersion))
+		}
+
+		version, err := strconv.Atoi(currentVersion)
+		if err != nil {
+			return true, nil, err
+		}
+		updated := configMap.DeepCopy()
+		updated.ResourceVersion = strconv.Itoa(version + 1)
+		if err := client.Tracker().Update(gvr, updated, updated.Namespace); err != nil {
+			return true, nil, err
+		}
+		return true, updated, nil
+	})
+}
+
+// TestConcurrentIPAllocationUniqueIPs allocates all the IPs of the pool at once from several
+// replicas sharing the pool ConfigMap, and checks that no IP is handed out twice
+func TestConcurrentIPAllocationUniqueIPs(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	client := fake.NewSimpleClientset()
+	enforceResourceVersions(client)
+	// Slow reads let the replicas compute their allocations from the same state
+	client.PrependReactor("get", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		time.Sleep(time.Millisecond)
+		return false, nil, nil
+	})
+
+	var poolIPs []string
+	for i := 0; i < 24; i++ {
+		poolIPs = append(poolIPs, fmt.Sprintf("192.168.1.%d", 10+i))
+	}
+	config := &GlobalVMPoolConfig{
+		Namespace:        "default",
+		ConfigMapName:    "test-unique-allocation",
+		PoolIPs:          poolIPs,
+		OperationTimeout: 10000,
+		SkipVMReadiness:  true,
+		// Enough retries for every allocation to win eventually
+		ConflictBackoff: wait.Backoff{Steps: 100, Duration: time.Millisecond, Factor: 1.2, Jitter: 1, Cap: 20 * time.Millisecond},
+	}
+
+	ctx := context.Background()
+	var managers []GlobalVMPoolManager
+	for i := 0; i < 4; i++ {
+		manager, err := NewConfigMapVMPoolManager(client, config)
+		if err != nil {
+			t.Fatalf("Failed to create manager: %v", err)
+		}
+		managers = append(managers, manager)
+	}
+	if err := managers[0].RecoverState(ctx, nil); err != nil {
+		t.Fatalf("Failed to initialize state: %v", err)
+	}
+
+	ips := make([]netip.Addr, len(poolIPs))
+	errs := make([]error, len(poolIPs))
+	var wg sync.WaitGroup
+	for i := range poolIPs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			manager := managers[i%len(managers)]
+			ips[i], errs[i] = manager.AllocateIP(ctx, fmt.Sprintf("allocation-%d", i), fmt.Sprintf("pod-%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	allocatedTo := map[netip.Addr]int{}
+	for i, ip := range ips {
+		if errs[i] != nil {
+			t.Errorf("allocation-%d failed: %v", i, errs[i])
+			continue
+		}
+		if other, taken := allocatedTo[ip]; taken {
+			t.Errorf("IP %s allocated to both allocation-%d and allocation-%d", ip, other, i)
+		}
+		allocatedTo[ip] = i
+	}
+
+	allocated, err := managers[0].ListAllocatedIPs(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list allocated IPs: %v", err)
+	}
+	if len(allocated) != len(poolIPs) {
+		t.Errorf("Expected %d allocations in the final state, got %d", len(poolIPs), len(allocated))
+	}
+	_, available, _, err := managers[0].GetPoolStatus(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get pool status: %v", err)
+	}
+	if available != 0 {
+		t.Errorf("Expected no available IPs left, got %d", available)
+	}
+}
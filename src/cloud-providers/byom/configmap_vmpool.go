@@ -12,13 +12,16 @@ import (
 	"net"
 	"net/netip"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/util/retry"
 )
@@ -36,6 +39,11 @@ type ConfigMapVMPoolManager struct {
 	client kubernetes.Interface
 	config *GlobalVMPoolConfig
 	mutex  sync.RWMutex
+
+	// lastKnownState is the state last read from or written to the ConfigMap, used to restore
+	// the live allocations if the ConfigMap is deleted while the adaptor runs
+	lastKnownMutex sync.Mutex
+	lastKnownState *IPAllocationState
 }
 
 // NewConfigMapVMPoolManager creates a new ConfigMap-based VM pool manager
@@ -60,6 +68,10 @@ func NewConfigMapVMPoolManager(client kubernetes.Interface, config *GlobalVMPool
 		}
 	}
 
+	if config.AuditConfigMapName == "" {
+		config.AuditConfigMapName = config.ConfigMapName + auditConfigMapNameSuffix
+	}
+
 	manager := &ConfigMapVMPoolManager{
 		client: client,
 		config: config,
@@ -68,6 +80,14 @@ func NewConfigMapVMPoolManager(client kubernetes.Interface, config *GlobalVMPool
 	return manager, nil
 }
 
+// now returns the time of the configured clock
+func (cm *ConfigMapVMPoolManager) now() metav1.Time {
+	if cm.config.Clock == nil {
+		return metav1.Now()
+	}
+	return metav1.NewTime(cm.config.Clock.Now())
+}
+
 // getCurrentNodeName attempts to determine the current node name using multiple strategies
 func getCurrentNodeName() (string, error) {
 	// Strategy 1: Try environment variable first (set by CAA deployment)
@@ -112,7 +132,16 @@ func (cm *ConfigMapVMPoolManager) marshalStateForConfigMap(state *IPAllocationSt
 
 // selectIPIndex uses hash-based distribution to select an IP index from available IPs
 // This reduces conflicts when multiple CAA instances try to allocate simultaneously
-func (cm *ConfigMapVMPoolManager) selectIPIndex(availableIPs []string, allocationID string) int {
+// The preferred IP, the one a restarted pod had before, is selected if it's still available
+// Otherwise the IPs released within the warm window, if any, are selected over the others
+func (cm *ConfigMapVMPoolManager) selectIPIndex(availableIPs []string, allocationID, preferredIP string, releasedAt map[string]metav1.Time) int {
+	if preferredIP != "" {
+		if index := slices.Index(availableIPs, preferredIP); index >= 0 {
+			logger.Printf("Affinity IP selection: allocationID=%s, previous IP %s is available", allocationID, preferredIP)
+			return index
+		}
+	}
+
 	if len(availableIPs) <= 1 {
 		return 0
 	}
@@ -122,6 +151,14 @@ func (cm *ConfigMapVMPoolManager) selectIPIndex(availableIPs []string, allocatio
 	hash := md5.Sum([]byte(allocationID))
 	seed := binary.BigEndian.Uint32(hash[:4])
 
+	if warm := cm.warmIndices(availableIPs, releasedAt); len(warm) > 0 {
+		selectedIndex := warm[int(seed)%len(warm)]
+		logger.Printf("Warm IP selection: allocationID=%s, %s was released %s ago, index=%d/%d",
+			allocationID, availableIPs[selectedIndex], cm.now().Sub(releasedAt[availableIPs[selectedIndex]].Time).Round(time.Second),
+			selectedIndex, len(availableIPs))
+		return selectedIndex
+	}
+
 	selectedIndex := int(seed) % len(availableIPs)
 	logger.Printf("Hash-based IP selection: allocationID=%s, hash=%x, index=%d/%d",
 		allocationID, hash[:4], selectedIndex, len(availableIPs))
@@ -129,6 +166,30 @@ func (cm *ConfigMapVMPoolManager) selectIPIndex(availableIPs []string, allocatio
 	return selectedIndex
 }
 
+// warmIndices returns the indices of the available IPs released within the warm window
+func (cm *ConfigMapVMPoolManager) warmIndices(availableIPs []string, releasedAt map[string]metav1.Time) []int {
+	if cm.config.WarmWindow <= 0 || len(releasedAt) == 0 {
+		return nil
+	}
+
+	now := cm.now()
+	var indices []int
+	for i, ip := range availableIPs {
+		if released, ok := releasedAt[ip]; ok && now.Sub(released.Time) < cm.config.WarmWindow {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// conflictBackoff returns the backoff between the retries of conflicting state updates
+func (cm *ConfigMapVMPoolManager) conflictBackoff() wait.Backoff {
+	if cm.config.ConflictBackoff.Steps == 0 {
+		return retry.DefaultBackoff
+	}
+	return cm.config.ConflictBackoff
+}
+
 // checkVMReadiness verifies that a VM is ready by checking network connectivity
 func (cm *ConfigMapVMPoolManager) checkVMReadiness(ctx context.Context, ipStr string) error {
 	logger.Printf("Checking VM readiness for IP %s", ipStr)
@@ -152,47 +213,104 @@ func (cm *ConfigMapVMPoolManager) checkVMReadiness(ctx context.Context, ipStr st
 
 // AllocateIP allocates an IP from the global pool
 func (cm *ConfigMapVMPoolManager) AllocateIP(ctx context.Context, allocationID string, podName string) (netip.Addr, error) {
+	if cm.config.ReadOnly {
+		return netip.Addr{}, fmt.Errorf("%w: cannot allocate an IP to allocation ID %s", ErrReadOnly, allocationID)
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
 	defer cancel()
 
-	// Direct allocation - retry logic is handled inside updateState
-	allocatedIP, err := cm.doAllocateIP(ctx, allocationID, podName)
+	// Direct allocation - conflicts with the other replicas are retried inside doAllocateIP
+	allocatedIP, allocation, err := cm.doAllocateIP(ctx, allocationID, podName)
 	if err != nil {
 		return netip.Addr{}, err
 	}
+	// Written once the pool lock is released, so that other allocations don't wait on it
+	if allocation != nil {
+		cm.recordEvent(ctx, AllocationEventAllocate, *allocation)
+	}
 
 	logger.Printf("Successfully allocated IP %s to allocation ID %s", allocatedIP.String(), allocationID)
 	return allocatedIP, nil
 }
 
-// doAllocateIP performs the actual allocation with optimistic locking and smart IP selection
-func (cm *ConfigMapVMPoolManager) doAllocateIP(ctx context.Context, allocationID string, podName string) (netip.Addr, error) {
+// doAllocateIP performs the actual allocation with optimistic locking and smart IP selection. It
+// returns the new allocation to record in the audit trail, nil if the IP was already allocated.
+// The local mutex doesn't serialize the replicas, so the allocation is written only if the
+// ConfigMap is still at the ResourceVersion it was computed from, and computed again from the
+// updated ConfigMap on a conflict.
+func (cm *ConfigMapVMPoolManager) doAllocateIP(ctx context.Context, allocationID string, podName string) (netip.Addr, *IPAllocation, error) {
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
 
-	// Get current state
-	state, _, err := cm.getCurrentState(ctx)
+	var ipStr string
+	var allocation *IPAllocation
+	var allocErr error
+	err := retry.RetryOnConflict(cm.conflictBackoff(), func() error {
+		// Get current state
+		state, resourceVersion, err := cm.getCurrentState(ctx)
+		if err != nil {
+			allocErr = fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+			return nil
+		}
+
+		ipStr, allocation, allocErr = cm.allocateInState(ctx, state, allocationID, podName)
+		if allocErr != nil || allocation == nil {
+			return nil
+		}
+
+		err = cm.compareAndSwapState(ctx, state, resourceVersion)
+		if errors.IsConflict(err) {
+			logger.Printf("State was updated concurrently while allocating an IP to allocation ID %s, allocating again", allocationID)
+		}
+		return err
+	})
+	if allocErr != nil {
+		return netip.Addr{}, nil, allocErr
+	}
+	if err != nil {
+		return netip.Addr{}, nil, fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+
+	// Convert to netip.Addr before returning
+	ip, err := netip.ParseAddr(ipStr)
 	if err != nil {
-		return netip.Addr{}, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+		return netip.Addr{}, nil, fmt.Errorf("%w: %s: %w", ErrInvalidAllocatedIP, ipStr, err)
 	}
 
+	if allocation != nil {
+		logger.Printf("Successfully allocated IP %s to allocation %s on node %s",
+			ip.String(), allocationID, allocation.NodeName)
+	}
+
+	return ip, allocation, nil
+}
+
+// allocateInState allocates an IP to allocationID in state and returns it with the new
+// allocation, which is nil if the IP was already allocated and state is left unchanged
+func (cm *ConfigMapVMPoolManager) allocateInState(ctx context.Context, state *IPAllocationState, allocationID string, podName string) (string, *IPAllocation, error) {
 	// Check if already allocated
 	if allocation, exists := state.AllocatedIPs[allocationID]; exists {
-		ip, parseErr := netip.ParseAddr(allocation.IP)
-		if parseErr != nil {
-			return netip.Addr{}, fmt.Errorf("%w: %s: %w", ErrInvalidAllocatedIP, allocation.IP, parseErr)
-		}
 		logger.Printf("IP %s already allocated to allocation ID %s", allocation.IP, allocationID)
-		return ip, nil
+		return allocation.IP, nil, nil
 	}
 
+	podNamespace := provider.PodNamespaceFromContext(ctx)
+	if err := cm.checkNamespaceQuota(state, podNamespace); err != nil {
+		return "", nil, err
+	}
+
+	// The promoted IPs are written back with the allocation
+	cm.promoteQuarantinedIPs(state)
+
 	// Check if any IPs are available
 	if len(state.AvailableIPs) == 0 {
-		return netip.Addr{}, ErrNoAvailableIPs
+		return "", nil, ErrNoAvailableIPs
 	}
 
-	// IP selection: use hash-based distribution to reduce conflicts
-	selectedIndex := cm.selectIPIndex(state.AvailableIPs, allocationID)
+	// IP selection: prefer the previous IP of the pod, otherwise use hash-based distribution to reduce conflicts
+	podKey := affinityKey(podNamespace, podName)
+	selectedIndex := cm.selectIPIndex(state.AvailableIPs, allocationID, state.LastIPs[podKey], state.ReleasedAt)
 	ipStr := state.AvailableIPs[selectedIndex]
 	logger.Printf("Selected IP %s (index %d of %d) for allocation %s",
 		ipStr, selectedIndex, len(state.AvailableIPs), allocationID)
@@ -201,7 +319,7 @@ func (cm *ConfigMapVMPoolManager) doAllocateIP(ctx context.Context, allocationID
 	if !cm.config.SkipVMReadiness {
 		if err := cm.checkVMReadiness(ctx, ipStr); err != nil {
 			logger.Printf("VM %s failed readiness check. Can't be allocated: %v", ipStr, err)
-			return netip.Addr{}, fmt.Errorf("%w: %s: %w", ErrInvalidAllocatedIP, ipStr, err)
+			return "", nil, fmt.Errorf("%w: %s: %w", ErrInvalidAllocatedIP, ipStr, err)
 		}
 	} else {
 		logger.Printf("Skipping VM readiness check for IP %s (test mode)", ipStr)
@@ -215,84 +333,182 @@ func (cm *ConfigMapVMPoolManager) doAllocateIP(ctx context.Context, allocationID
 	// Get current node name
 	nodeName, err := getCurrentNodeName()
 	if err != nil {
-		return netip.Addr{}, fmt.Errorf("%w: %w", ErrNodeNameDetection, err)
+		return "", nil, fmt.Errorf("%w: %w", ErrNodeNameDetection, err)
 	}
 
 	// Add to allocated IPs
-	state.AllocatedIPs[allocationID] = IPAllocation{
+	allocation := IPAllocation{
 		AllocationID: allocationID,
 		IP:           ipStr,
 		NodeName:     nodeName,
 		PodName:      podName,
-		AllocatedAt:  metav1.Now(),
+		PodNamespace: podNamespace,
+		AllocatedAt:  cm.now(),
 	}
+	state.AllocatedIPs[allocationID] = allocation
+	state.rememberPodIP(podKey, ipStr)
+	delete(state.ReleasedAt, ipStr)
 
-	state.LastUpdated = metav1.Now()
+	state.LastUpdated = cm.now()
 	state.Version = state.Version + 1
 
-	// Update ConfigMap - retry logic handled internally in updateState
-	if err := cm.updateState(ctx, state); err != nil {
-		return netip.Addr{}, fmt.Errorf("%w: %w", ErrConflict, err)
+	return ipStr, &allocation, nil
+}
+
+// checkNamespaceQuota returns an error wrapping ErrNamespaceQuotaExceeded when the namespace
+// already holds all the IPs its quota allows
+func (cm *ConfigMapVMPoolManager) checkNamespaceQuota(state *IPAllocationState, podNamespace string) error {
+	quota, limited := cm.config.NamespaceQuotas[podNamespace]
+	if !limited {
+		return nil
+	}
+	inUse := 0
+	for _, allocation := range state.AllocatedIPs {
+		if allocation.PodNamespace == podNamespace {
+			inUse++
+		}
 	}
+	if inUse >= quota {
+		return fmt.Errorf("%w: namespace %s holds %d of %d IPs", ErrNamespaceQuotaExceeded, podNamespace, inUse, quota)
+	}
+	return nil
+}
 
-	// Convert to netip.Addr before returning
-	ip, err := netip.ParseAddr(ipStr)
+// DryRunAllocate reports the IP that AllocateIP would select for the allocation ID without
+// changing the pool state. The returned bool is false when the pool has no capacity left.
+// An allocation ID that already holds an IP reports that IP. Like AllocateIP, it returns an
+// error wrapping ErrNamespaceQuotaExceeded when the namespace of the pod in ctx is over its
+// quota. The pod isn't known here, so the affinity to the previous IP of a restarted pod isn't
+// taken into account.
+func (cm *ConfigMapVMPoolManager) DryRunAllocate(ctx context.Context, allocationID string) (netip.Addr, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	state, _, err := cm.getCurrentState(ctx)
 	if err != nil {
-		return netip.Addr{}, fmt.Errorf("%w: %s: %w", ErrInvalidAllocatedIP, ipStr, err)
+		return netip.Addr{}, false, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+	}
+
+	state.promoteQuarantinedIPs(cm.now().Time, cm.config.ReuseGracePeriod)
+
+	ipStr := ""
+	if allocation, exists := state.AllocatedIPs[allocationID]; exists {
+		ipStr = allocation.IP
+	} else if err := cm.checkNamespaceQuota(state, provider.PodNamespaceFromContext(ctx)); err != nil {
+		return netip.Addr{}, false, err
+	} else if len(state.AvailableIPs) > 0 {
+		ipStr = state.AvailableIPs[cm.selectIPIndex(state.AvailableIPs, allocationID, "", state.ReleasedAt)]
+	} else {
+		return netip.Addr{}, false, nil
 	}
 
-	logger.Printf("Successfully allocated IP %s to allocation %s on node %s",
-		ip.String(), allocationID, nodeName)
+	ip, err := netip.ParseAddr(ipStr)
+	if err != nil {
+		return netip.Addr{}, false, fmt.Errorf("%w: %s: %w", ErrInvalidAllocatedIP, ipStr, err)
+	}
 
-	return ip, nil
+	return ip, true, nil
 }
 
 // DeallocateIP returns an IP to the global pool by allocation ID
 func (cm *ConfigMapVMPoolManager) DeallocateIP(ctx context.Context, allocationID string) error {
+	if cm.config.ReadOnly {
+		return fmt.Errorf("%w: cannot deallocate the IP of allocation ID %s", ErrReadOnly, allocationID)
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
 	defer cancel()
 
-	// Direct deallocation - retry logic is handled inside updateState
-	if err := cm.doDeallocateIP(ctx, allocationID); err != nil {
+	// Direct deallocation - conflicts with the other replicas are retried inside removeAllocation
+	allocation, err := cm.removeAllocation(ctx, allocationID)
+	if err != nil || allocation == nil {
 		return err
 	}
 
-	logger.Printf("Successfully deallocated IP for allocation ID %s", allocationID)
+	// Written once the pool lock is released, so that other allocations don't wait on it
+	cm.recordEvent(ctx, AllocationEventDeallocate, *allocation)
+
+	logger.Printf("Successfully deallocated IP %s for allocation ID %s", allocation.IP, allocationID)
 	return nil
 }
 
-// doDeallocateIP performs the actual deallocation with optimistic locking
-func (cm *ConfigMapVMPoolManager) doDeallocateIP(ctx context.Context, allocationID string) error {
+// inPool returns whether ip is one of the configured pool IPs
+func (cm *ConfigMapVMPoolManager) inPool(ip string) bool {
+	for _, poolIP := range cm.config.PoolIPs {
+		if poolIP == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// removeAllocation removes the allocation from the current state under the pool lock, and
+// returns it, nil if there is none. As for the allocations, the state is written only if the
+// ConfigMap is still at the ResourceVersion it was computed from.
+func (cm *ConfigMapVMPoolManager) removeAllocation(ctx context.Context, allocationID string) (*IPAllocation, error) {
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
 
-	// Get current state
-	state, _, err := cm.getCurrentState(ctx)
+	var removed *IPAllocation
+	var getErr error
+	err := retry.RetryOnConflict(cm.conflictBackoff(), func() error {
+		// Get current state
+		state, resourceVersion, err := cm.getCurrentState(ctx)
+		if err != nil {
+			getErr = err
+			return nil
+		}
+
+		removed = cm.removeFromState(state, allocationID)
+		if removed == nil {
+			return nil
+		}
+
+		err = cm.compareAndSwapState(ctx, state, resourceVersion)
+		if errors.IsConflict(err) {
+			logger.Printf("State was updated concurrently while deallocating IP %s, deallocating again", removed.IP)
+		}
+		return err
+	})
+	if getErr != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRetrievingPoolState, getErr)
+	}
 	if err != nil {
-		return fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
+		return nil, fmt.Errorf("%w: %w", ErrUpdatingPoolState, err)
 	}
 
+	return removed, nil
+}
+
+// removeFromState removes the allocation from state and returns it, nil if there is none
+func (cm *ConfigMapVMPoolManager) removeFromState(state *IPAllocationState, allocationID string) *IPAllocation {
 	// Find allocation
 	allocation, exists := state.AllocatedIPs[allocationID]
 	if !exists {
 		logger.Printf("allocation ID %s not found", allocationID)
 		return nil
 	}
-
-	// Return IP to available pool
-	state.AvailableIPs = append(state.AvailableIPs, allocation.IP)
 	delete(state.AllocatedIPs, allocationID)
 
-	state.LastUpdated = metav1.Now()
-	state.Version = state.Version + 1
-
-	// Update ConfigMap - retry logic handled internally in updateState
-	if err := cm.updateState(ctx, state); err != nil {
-		return fmt.Errorf("%w: %w", ErrUpdatingPoolState, err)
+	// Return IP to available pool, unless it was removed from the pool since it was allocated
+	if cm.inPool(allocation.IP) && cm.config.ReuseGracePeriod > 0 {
+		state.quarantine(allocation.IP, cm.now())
+		logger.Printf("IP %s of allocation ID %s is quarantined for %s before it can be allocated again",
+			allocation.IP, allocationID, cm.config.ReuseGracePeriod)
+	} else if cm.inPool(allocation.IP) {
+		state.AvailableIPs = append(state.AvailableIPs, allocation.IP)
+		if state.ReleasedAt == nil {
+			state.ReleasedAt = map[string]metav1.Time{}
+		}
+		state.ReleasedAt[allocation.IP] = cm.now()
+	} else {
+		logger.Printf("IP %s of allocation ID %s is no longer in the pool, not making it available", allocation.IP, allocationID)
 	}
 
-	logger.Printf("Successfully deallocated IP %s", allocation.IP)
-	return nil
+	state.LastUpdated = cm.now()
+	state.Version = state.Version + 1
+
+	return &allocation
 }
 
 // GetIPfromAllocationID returns the IP allocated to a specific allocation ID
@@ -348,9 +564,11 @@ func (cm *ConfigMapVMPoolManager) GetPoolStatus(ctx context.Context) (total, ava
 		return 0, 0, 0, fmt.Errorf("%w: %w", ErrRetrievingPoolState, err)
 	}
 
+	state.promoteQuarantinedIPs(cm.now().Time, cm.config.ReuseGracePeriod)
+
 	available = len(state.AvailableIPs)
 	inUse = len(state.AllocatedIPs)
-	total = available + inUse
+	total = available + inUse + len(state.QuarantinedIPs)
 
 	return total, available, inUse, nil
 }
@@ -380,8 +598,7 @@ func (cm *ConfigMapVMPoolManager) getCurrentState(ctx context.Context) (*IPAlloc
 		ctx, cm.config.ConfigMapName, metav1.GetOptions{})
 
 	if errors.IsNotFound(err) {
-		// Initialize empty state
-		return cm.initializeEmptyState(), "", nil
+		return cm.restoreOrInitializeState(ctx)
 	}
 
 	if err != nil {
@@ -390,22 +607,90 @@ func (cm *ConfigMapVMPoolManager) getCurrentState(ctx context.Context) (*IPAlloc
 
 	stateData, exists := configMap.Data[stateDataKey]
 	if !exists {
-		// Initialize empty state
-		return cm.initializeEmptyState(), "", nil
+		// The ResourceVersion is the one of the ConfigMap without state, which a restore updates
+		state, _, err := cm.restoreOrInitializeState(ctx)
+		return state, configMap.ResourceVersion, err
 	}
 
 	var state IPAllocationState
 	if err := json.Unmarshal([]byte(stateData), &state); err != nil {
 		return nil, "", fmt.Errorf("failed to unmarshal state data: %w", err)
 	}
+	cm.rememberState(&state)
 
 	// Return ResourceVersion for true optimistic locking
 	return &state, configMap.ResourceVersion, nil
 }
 
-// updateState updates the allocation state in ConfigMap with proper optimistic locking
-// This method handles all retry logic internally and is the single point for ConfigMap updates
+// restoreOrInitializeState returns the state to use when the ConfigMap holds none. Before the
+// state was ever seen, that's an empty state. Afterwards the ConfigMap was deleted while the
+// adaptor runs, and starting over would hand out IPs of live allocations again, so the ConfigMap
+// is recreated from the last known state instead. If that fails, an error is returned, which
+// blocks the allocations until the ConfigMap is back. A read-only manager never writes, it
+// returns the last known state as is for inspection.
+func (cm *ConfigMapVMPoolManager) restoreOrInitializeState(ctx context.Context) (*IPAllocationState, string, error) {
+	cm.lastKnownMutex.Lock()
+	lastKnown := cm.lastKnownState.clone()
+	cm.lastKnownMutex.Unlock()
+
+	if lastKnown == nil {
+		return cm.initializeEmptyState(), "", nil
+	}
+
+	if cm.config.ReadOnly {
+		logger.Printf("Warning: pool state ConfigMap %s/%s was deleted, showing the %d allocations last known to this node",
+			cm.config.Namespace, cm.config.ConfigMapName, len(lastKnown.AllocatedIPs))
+		return lastKnown, "", nil
+	}
+
+	logger.Printf("CRITICAL: pool state ConfigMap %s/%s was deleted, restoring it with the %d allocations last known to this node",
+		cm.config.Namespace, cm.config.ConfigMapName, len(lastKnown.AllocatedIPs))
+
+	lastKnown.LastUpdated = cm.now()
+	lastKnown.Version++
+	if err := cm.updateState(ctx, lastKnown); err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrPoolStateLost, err)
+	}
+
+	return lastKnown, "", nil
+}
+
+// rememberState records a copy of the state last read from or written to the ConfigMap,
+// and updates the metrics
+func (cm *ConfigMapVMPoolManager) rememberState(state *IPAllocationState) {
+	if cm.config.Metrics != nil {
+		cm.config.Metrics.update(state)
+	}
+
+	cm.lastKnownMutex.Lock()
+	defer cm.lastKnownMutex.Unlock()
+	cm.lastKnownState = state.clone()
+}
+
+// newStateConfigMap returns the ConfigMap holding formattedState, for creating it
+func (cm *ConfigMapVMPoolManager) newStateConfigMap(formattedState string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cm.config.ConfigMapName,
+			Namespace: cm.config.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":      "cloud-api-adaptor",
+				"app.kubernetes.io/component": "byom-ip-pool-state",
+			},
+		},
+		Data: map[string]string{stateDataKey: formattedState},
+	}
+}
+
+// updateState updates the allocation state in ConfigMap, retrying on conflicts with the latest
+// version of the ConfigMap, so that the state overwrites whatever was written since it was read.
+// The callers serialize with the mutex of this node. Use compareAndSwapState instead where other
+// replicas may have updated the ConfigMap since the state was computed.
 func (cm *ConfigMapVMPoolManager) updateState(ctx context.Context, state *IPAllocationState) error {
+	if cm.config.ReadOnly {
+		return ErrReadOnly
+	}
+
 	// Use formatted JSON for better readability
 	formattedState, err := cm.marshalStateForConfigMap(state)
 	if err != nil {
@@ -414,26 +699,16 @@ func (cm *ConfigMapVMPoolManager) updateState(ctx context.Context, state *IPAllo
 
 	// Use RetryOnConflict for the entire get-modify-update loop.
 	// This also gracefully handles the case where the ConfigMap doesn't exist yet.
-	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+	return retry.RetryOnConflict(cm.conflictBackoff(), func() error {
 		// 1. READ: Get the latest version of the ConfigMap.
 		configMap, err := cm.client.CoreV1().ConfigMaps(cm.config.Namespace).Get(
 			ctx, cm.config.ConfigMapName, metav1.GetOptions{})
 
 		if errors.IsNotFound(err) {
 			// ConfigMap doesn't exist, so we create it.
-			newConfigMap := &v1.ConfigMap{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      cm.config.ConfigMapName,
-					Namespace: cm.config.Namespace,
-					Labels: map[string]string{
-						"app.kubernetes.io/name":      "cloud-api-adaptor",
-						"app.kubernetes.io/component": "byom-ip-pool-state",
-					},
-				},
-				Data: map[string]string{stateDataKey: formattedState},
-			}
-			_, createErr := cm.client.CoreV1().ConfigMaps(cm.config.Namespace).Create(ctx, newConfigMap, metav1.CreateOptions{})
+			_, createErr := cm.client.CoreV1().ConfigMaps(cm.config.Namespace).Create(ctx, cm.newStateConfigMap(formattedState), metav1.CreateOptions{})
 			if createErr == nil {
+				cm.rememberState(state)
 				logger.Printf("Created new ConfigMap %s with initial state", cm.config.ConfigMapName)
 			} else {
 				logger.Printf("Failed to create ConfigMap %s: %v", cm.config.ConfigMapName, createErr)
@@ -458,6 +733,7 @@ func (cm *ConfigMapVMPoolManager) updateState(ctx context.Context, state *IPAllo
 		// is stale. RetryOnConflict will then re-execute this whole function.
 		_, updateErr := cm.client.CoreV1().ConfigMaps(cm.config.Namespace).Update(ctx, configMapToUpdate, metav1.UpdateOptions{})
 		if updateErr == nil {
+			cm.rememberState(state)
 			logger.Printf("Successfully updated ConfigMap %s with new state (version %d)",
 				cm.config.ConfigMapName, state.Version)
 		} else {
@@ -466,3 +742,54 @@ func (cm *ConfigMapVMPoolManager) updateState(ctx context.Context, state *IPAllo
 		return updateErr
 	})
 }
+
+// compareAndSwapState updates the allocation state in ConfigMap only if the ConfigMap is still at
+// resourceVersion, as returned by getCurrentState along with the state this one was computed from.
+// An empty resourceVersion means that the ConfigMap didn't exist. Otherwise a conflict error is
+// returned, without retrying: the caller computes the state again from the current ConfigMap.
+func (cm *ConfigMapVMPoolManager) compareAndSwapState(ctx context.Context, state *IPAllocationState, resourceVersion string) error {
+	if cm.config.ReadOnly {
+		return ErrReadOnly
+	}
+
+	formattedState, err := cm.marshalStateForConfigMap(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state data: %w", err)
+	}
+
+	configMaps := cm.client.CoreV1().ConfigMaps(cm.config.Namespace)
+	configMap, err := configMaps.Get(ctx, cm.config.ConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		if resourceVersion != "" {
+			return errors.NewConflict(v1.Resource("configmaps"), cm.config.ConfigMapName, err)
+		}
+		_, err := configMaps.Create(ctx, cm.newStateConfigMap(formattedState), metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			return errors.NewConflict(v1.Resource("configmaps"), cm.config.ConfigMapName, err)
+		}
+		if err != nil {
+			return err
+		}
+		cm.rememberState(state)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRetrievingConfigMap, err)
+	}
+	if configMap.ResourceVersion != resourceVersion {
+		return errors.NewConflict(v1.Resource("configmaps"), cm.config.ConfigMapName,
+			fmt.Errorf("resource version is %s, expected %s", configMap.ResourceVersion, resourceVersion))
+	}
+
+	// The API server also rejects the update if the ConfigMap changes in between
+	configMapToUpdate := configMap.DeepCopy()
+	if configMapToUpdate.Data == nil {
+		configMapToUpdate.Data = make(map[string]string)
+	}
+	configMapToUpdate.Data[stateDataKey] = formattedState
+	if _, err := configMaps.Update(ctx, configMapToUpdate, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	cm.rememberState(state)
+	return nil
+}
@@ -6,15 +6,21 @@ package byom
 import (
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"net/netip"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/providertest"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/fake"
 	ktesting "k8s.io/client-go/testing"
 )
@@ -175,6 +181,320 @@ func TestConfigMapVMPoolManagerAllocateIP(t *testing.T) {
 	}
 }
 
+func TestConfigMapVMPoolManagerDryRunAllocate(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10", "192.168.1.11"},
+		OperationTimeout: 10000,
+		SkipVMReadiness:  true, // Skip VM readiness checks in tests
+	}
+
+	client := fake.NewSimpleClientset()
+
+	manager, err := NewConfigMapVMPoolManager(client, config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+
+	if _, err := manager.AllocateIP(ctx, "test-allocation-1", "test-pod-1"); err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+
+	configMaps := client.CoreV1().ConfigMaps(config.Namespace)
+	before, err := configMaps.Get(ctx, config.ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get ConfigMap: %v", err)
+	}
+
+	// The dry run reports the remaining IP
+	candidate, ok, err := manager.DryRunAllocate(ctx, "test-allocation-2")
+	if err != nil {
+		t.Fatalf("Failed to dry run allocation: %v", err)
+	}
+	if !ok {
+		t.Fatal("Expected capacity to be available")
+	}
+	if candidate != netip.MustParseAddr("192.168.1.11") {
+		t.Errorf("Expected candidate IP 192.168.1.11, got %s", candidate)
+	}
+
+	after, err := configMaps.Get(ctx, config.ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get ConfigMap: %v", err)
+	}
+	if after.ResourceVersion != before.ResourceVersion || after.Data[stateDataKey] != before.Data[stateDataKey] {
+		t.Error("Expected dry run to leave the pool state unchanged")
+	}
+
+	// The real allocation picks the reported candidate
+	allocatedIP, err := manager.AllocateIP(ctx, "test-allocation-2", "test-pod-2")
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	if allocatedIP != candidate {
+		t.Errorf("Expected allocated IP %s to match the dry run, got %s", candidate, allocatedIP)
+	}
+
+	// An existing allocation reports its own IP
+	ip, ok, err := manager.DryRunAllocate(ctx, "test-allocation-2")
+	if err != nil || !ok || ip != allocatedIP {
+		t.Errorf("Expected existing allocation to report %s, got %s (ok=%v, err=%v)", allocatedIP, ip, ok, err)
+	}
+
+	// No capacity left for new allocations
+	_, ok, err = manager.DryRunAllocate(ctx, "test-allocation-3")
+	if err != nil {
+		t.Fatalf("Failed to dry run allocation: %v", err)
+	}
+	if ok {
+		t.Error("Expected no capacity to be available")
+	}
+}
+
+func TestConfigMapVMPoolManagerPodAffinity(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10", "192.168.1.11", "192.168.1.12", "192.168.1.13"},
+		OperationTimeout: 10000,
+		SkipVMReadiness:  true, // Skip VM readiness checks in tests
+	}
+
+	manager, err := NewConfigMapVMPoolManager(fake.NewSimpleClientset(), config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+
+	ctx := provider.WithPodNamespace(context.Background(), "default")
+
+	previousIP, err := manager.AllocateIP(ctx, "web-sandbox-0", "web")
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+
+	// Each restart has a new sandbox ID, and so a different hash, but gets the previous IP back
+	for i := 1; i <= 5; i++ {
+		if err := manager.DeallocateIP(ctx, fmt.Sprintf("web-sandbox-%d", i-1)); err != nil {
+			t.Fatalf("Failed to deallocate IP: %v", err)
+		}
+		ip, err := manager.AllocateIP(ctx, fmt.Sprintf("web-sandbox-%d", i), "web")
+		if err != nil {
+			t.Fatalf("Failed to allocate IP: %v", err)
+		}
+		if ip != previousIP {
+			t.Errorf("Expected restart %d to get the previous IP %s, got %s", i, previousIP, ip)
+		}
+	}
+}
+
+func TestConfigMapVMPoolManagerPodAffinityIPTaken(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10", "192.168.1.11"},
+		OperationTimeout: 10000,
+		SkipVMReadiness:  true, // Skip VM readiness checks in tests
+	}
+
+	client := fake.NewSimpleClientset()
+	manager, err := NewConfigMapVMPoolManager(client, config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+
+	webIP, err := manager.AllocateIP(ctx, "web-sandbox-1", "web")
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	dbIP, err := manager.AllocateIP(ctx, "db-sandbox-1", "db")
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+
+	// While web restarts, its previous IP goes to another pod
+	if err := manager.DeallocateIP(ctx, "web-sandbox-1"); err != nil {
+		t.Fatalf("Failed to deallocate IP: %v", err)
+	}
+	if ip, err := manager.AllocateIP(ctx, "cache-sandbox-1", "cache"); err != nil || ip != webIP {
+		t.Fatalf("Expected cache to get the only free IP %s, got %s (err=%v)", webIP, ip, err)
+	}
+	if err := manager.DeallocateIP(ctx, "db-sandbox-1"); err != nil {
+		t.Fatalf("Failed to deallocate IP: %v", err)
+	}
+
+	// web gets a fresh IP
+	ip, err := manager.AllocateIP(ctx, "web-sandbox-2", "web")
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	if ip != dbIP {
+		t.Errorf("Expected web to get the free IP %s, got %s", dbIP, ip)
+	}
+
+	// Each IP is only remembered for the last pod it was allocated to
+	cm, err := client.CoreV1().ConfigMaps(config.Namespace).Get(ctx, config.ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get ConfigMap: %v", err)
+	}
+	var state IPAllocationState
+	if err := json.Unmarshal([]byte(cm.Data[stateDataKey]), &state); err != nil {
+		t.Fatalf("Failed to unmarshal state: %v", err)
+	}
+	want := map[string]string{"web": dbIP.String(), "cache": webIP.String()}
+	if !reflect.DeepEqual(state.LastIPs, want) {
+		t.Errorf("Expected last IPs %v, got %v", want, state.LastIPs)
+	}
+}
+
+func TestConfigMapVMPoolManagerWarmIPs(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	for _, warmWindow := range []time.Duration{5 * time.Minute, 0} {
+		t.Run(fmt.Sprintf("window %s", warmWindow), func(t *testing.T) {
+			clock := providertest.NewFakeClock()
+			manager, err := NewConfigMapVMPoolManager(fake.NewSimpleClientset(), &GlobalVMPoolConfig{
+				Namespace:        "test-namespace",
+				ConfigMapName:    "test-configmap",
+				PoolIPs:          []string{"192.168.1.10", "192.168.1.11", "192.168.1.12", "192.168.1.13"},
+				OperationTimeout: 10 * time.Second,
+				SkipVMReadiness:  true, // Skip VM readiness checks in tests
+				WarmWindow:       warmWindow,
+				Clock:            clock,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+			}
+
+			ctx := context.Background()
+			ips := map[string]netip.Addr{}
+			for i := 0; i < 4; i++ {
+				id := fmt.Sprintf("sandbox-%d", i)
+				if ips[id], err = manager.AllocateIP(ctx, id, "pod"); err != nil {
+					t.Fatalf("Failed to allocate IP: %v", err)
+				}
+			}
+
+			// One VM has been idle for long, the other one was released a minute ago
+			if err := manager.DeallocateIP(ctx, "sandbox-0"); err != nil {
+				t.Fatalf("Failed to deallocate IP: %v", err)
+			}
+			clock.Advance(10 * time.Minute)
+			if err := manager.DeallocateIP(ctx, "sandbox-1"); err != nil {
+				t.Fatalf("Failed to deallocate IP: %v", err)
+			}
+			clock.Advance(time.Minute)
+			idleIP, warmIP := ips["sandbox-0"], ips["sandbox-1"]
+
+			selected := map[netip.Addr]int{}
+			for i := 0; i < 20; i++ {
+				ip, ok, err := manager.DryRunAllocate(ctx, fmt.Sprintf("new-sandbox-%d", i))
+				if err != nil || !ok {
+					t.Fatalf("DryRunAllocate() = %s, %v, %v", ip, ok, err)
+				}
+				selected[ip]++
+			}
+
+			if warmWindow == 0 {
+				// Without a window, the hash spreads the allocations over both VMs
+				if selected[idleIP] == 0 || selected[warmIP] == 0 {
+					t.Errorf("Expected both free IPs to be selected, got %v", selected)
+				}
+				return
+			}
+			if selected[warmIP] != 20 {
+				t.Fatalf("Expected the recently released IP %s to be preferred over %s, got %v", warmIP, idleIP, selected)
+			}
+
+			ip, err := manager.AllocateIP(ctx, "new-sandbox", "new-pod")
+			if err != nil || ip != warmIP {
+				t.Fatalf("Expected the warm IP %s to be allocated, got %s (err=%v)", warmIP, ip, err)
+			}
+
+			// Past the window, the long idle VM is the only one left and is selected anyway
+			clock.Advance(warmWindow)
+			if ip, err := manager.AllocateIP(ctx, "other-sandbox", "other-pod"); err != nil || ip != idleIP {
+				t.Errorf("Expected the idle IP %s to be allocated, got %s (err=%v)", idleIP, ip, err)
+			}
+		})
+	}
+}
+
+func TestConfigMapVMPoolManagerNamespaceQuota(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10", "192.168.1.11", "192.168.1.12", "192.168.1.13"},
+		OperationTimeout: 10000,
+		SkipVMReadiness:  true, // Skip VM readiness checks in tests
+		NamespaceQuotas:  map[string]int{"team-a": 2},
+	}
+
+	manager, err := NewConfigMapVMPoolManager(fake.NewSimpleClientset(), config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+
+	teamA := provider.WithPodNamespace(context.Background(), "team-a")
+	teamB := provider.WithPodNamespace(context.Background(), "team-b")
+
+	// Under quota
+	for i := 0; i < 2; i++ {
+		if _, err := manager.AllocateIP(teamA, fmt.Sprintf("team-a-%d", i), "test-pod"); err != nil {
+			t.Fatalf("Expected allocation %d under quota to succeed: %v", i, err)
+		}
+	}
+
+	// At quota, the dry run rejects the allocation like the real one
+	if _, _, err := manager.DryRunAllocate(teamA, "team-a-2"); !stderrors.Is(err, ErrNamespaceQuotaExceeded) {
+		t.Errorf("Expected ErrNamespaceQuotaExceeded from the dry run, got %v", err)
+	}
+	_, err = manager.AllocateIP(teamA, "team-a-2", "test-pod")
+	if !stderrors.Is(err, ErrNamespaceQuotaExceeded) {
+		t.Errorf("Expected ErrNamespaceQuotaExceeded, got %v", err)
+	}
+	if _, ok, err := manager.DryRunAllocate(teamB, "team-b-0"); err != nil || !ok {
+		t.Errorf("Expected the dry run of a namespace without quota to succeed, got %v, %v", ok, err)
+	}
+
+	// An existing allocation is still returned at quota
+	if _, err := manager.AllocateIP(teamA, "team-a-0", "test-pod"); err != nil {
+		t.Errorf("Expected existing allocation to be returned: %v", err)
+	}
+
+	// Namespaces without a quota are not limited
+	for i := 0; i < 2; i++ {
+		if _, err := manager.AllocateIP(teamB, fmt.Sprintf("team-b-%d", i), "test-pod"); err != nil {
+			t.Errorf("Expected allocation %d without quota to succeed: %v", i, err)
+		}
+	}
+
+	// Freeing an IP makes room for the namespace again
+	if err := manager.DeallocateIP(teamA, "team-a-1"); err != nil {
+		t.Fatalf("Failed to deallocate IP: %v", err)
+	}
+	if _, err := manager.AllocateIP(teamA, "team-a-2", "test-pod"); err != nil {
+		t.Errorf("Expected allocation after deallocation to succeed: %v", err)
+	}
+}
+
 func TestConfigMapVMPoolManagerDeallocateIP(t *testing.T) {
 	config := &GlobalVMPoolConfig{
 		Namespace:        "test-namespace",
@@ -248,6 +568,74 @@ func TestConfigMapVMPoolManagerDeallocateIP(t *testing.T) {
 	}
 }
 
+func TestConfigMapVMPoolManagerDeallocateRemovedIP(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10", "192.168.1.11"},
+		OperationTimeout: 10000,
+		SkipVMReadiness:  true,
+	}
+
+	client := fake.NewSimpleClientset()
+
+	// 192.168.1.12 was allocated before it was removed from the pool
+	initialState := &IPAllocationState{
+		AllocatedIPs: map[string]IPAllocation{
+			"test-allocation-1": {AllocationID: "test-allocation-1", IP: "192.168.1.10", AllocatedAt: metav1.Now()},
+			"test-allocation-2": {AllocationID: "test-allocation-2", IP: "192.168.1.12", AllocatedAt: metav1.Now()},
+		},
+		AvailableIPs: []string{"192.168.1.11"},
+		LastUpdated:  metav1.Now(),
+		Version:      1,
+	}
+	stateData, _ := json.Marshal(initialState)
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      config.ConfigMapName,
+			Namespace: config.Namespace,
+		},
+		Data: map[string]string{
+			stateDataKey: string(stateData),
+		},
+	}
+	if _, err := client.CoreV1().ConfigMaps(config.Namespace).Create(context.Background(), cm, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create initial ConfigMap: %v", err)
+	}
+
+	manager, err := NewConfigMapVMPoolManager(client, config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+
+	if err := manager.DeallocateIP(ctx, "test-allocation-1"); err != nil {
+		t.Fatalf("Failed to deallocate IP: %v", err)
+	}
+	if total, available, inUse, _ := manager.GetPoolStatus(ctx); total != 3 || available != 2 || inUse != 1 {
+		t.Errorf("Expected 3 total, 2 available and 1 in use, got %d, %d and %d", total, available, inUse)
+	}
+
+	// An IP no longer in the pool is not made available
+	if err := manager.DeallocateIP(ctx, "test-allocation-2"); err != nil {
+		t.Fatalf("Failed to deallocate IP: %v", err)
+	}
+	state, _, err := manager.(*ConfigMapVMPoolManager).getCurrentState(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if len(state.AllocatedIPs) != 0 {
+		t.Errorf("Expected no allocation, got %v", state.AllocatedIPs)
+	}
+	if want := []string{"192.168.1.11", "192.168.1.10"}; !reflect.DeepEqual(state.AvailableIPs, want) {
+		t.Errorf("Expected available IPs %v, got %v", want, state.AvailableIPs)
+	}
+}
+
 func TestConfigMapVMPoolManagerGetAllocatedIP(t *testing.T) {
 	cleanup := setupTestEnvironment(t)
 	defer cleanup()
@@ -475,3 +863,298 @@ func TestConfigMapVMPoolManagerDoubleAllocation(t *testing.T) {
 		t.Errorf("Expected same IP for double allocation, got %s and %s", ip1, ip2)
 	}
 }
+
+func TestConfigMapDeletedAtRuntime(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10", "192.168.1.11", "192.168.1.12"},
+		OperationTimeout: 10000,
+		SkipVMReadiness:  true,
+	}
+
+	client := fake.NewSimpleClientset()
+	manager, err := NewConfigMapVMPoolManager(client, config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("Failed to initialize state: %v", err)
+	}
+
+	firstIP, err := manager.AllocateIP(ctx, "allocation-1", "pod-1")
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+
+	if err := client.CoreV1().ConfigMaps(config.Namespace).Delete(ctx, config.ConfigMapName, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Failed to delete ConfigMap: %v", err)
+	}
+
+	secondIP, err := manager.AllocateIP(ctx, "allocation-2", "pod-2")
+	if err != nil {
+		t.Fatalf("Failed to allocate IP after the ConfigMap deletion: %v", err)
+	}
+	if secondIP == firstIP {
+		t.Errorf("Expected the live allocation of %s to be kept, got it allocated again", firstIP)
+	}
+
+	// The ConfigMap is recreated with both allocations
+	configMap, err := client.CoreV1().ConfigMaps(config.Namespace).Get(ctx, config.ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected the ConfigMap to be recreated: %v", err)
+	}
+	var state IPAllocationState
+	if err := json.Unmarshal([]byte(configMap.Data[stateDataKey]), &state); err != nil {
+		t.Fatalf("Failed to parse state: %v", err)
+	}
+	if len(state.AllocatedIPs) != 2 || len(state.AvailableIPs) != 1 {
+		t.Errorf("Expected 2 allocated and 1 available IPs, got %d and %d", len(state.AllocatedIPs), len(state.AvailableIPs))
+	}
+	if state.AllocatedIPs["allocation-1"].IP != firstIP.String() {
+		t.Errorf("Expected allocation-1 to keep %s, got %+v", firstIP, state.AllocatedIPs["allocation-1"])
+	}
+}
+
+func TestConfigMapDeletedAtRuntimeRestoreFails(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10", "192.168.1.11"},
+		OperationTimeout: 10000,
+		SkipVMReadiness:  true,
+	}
+
+	client := fake.NewSimpleClientset()
+	manager, err := NewConfigMapVMPoolManager(client, config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("Failed to initialize state: %v", err)
+	}
+	if _, err := manager.AllocateIP(ctx, "allocation-1", "pod-1"); err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+
+	if err := client.CoreV1().ConfigMaps(config.Namespace).Delete(ctx, config.ConfigMapName, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Failed to delete ConfigMap: %v", err)
+	}
+	client.PrependReactor("create", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(v1.Resource("configmaps"), config.ConfigMapName, stderrors.New("denied"))
+	})
+
+	// Allocations are blocked instead of starting over from an empty pool
+	if _, err := manager.AllocateIP(ctx, "allocation-2", "pod-2"); !stderrors.Is(err, ErrPoolStateLost) {
+		t.Errorf("Expected ErrPoolStateLost, got %v", err)
+	}
+}
+
+func TestConfigMapVMPoolManagerCompareAndSwapState(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10", "192.168.1.11"},
+		OperationTimeout: 10000,
+		SkipVMReadiness:  true, // Skip VM readiness checks in tests
+	}
+
+	client := fake.NewSimpleClientset()
+	manager, err := NewConfigMapVMPoolManager(client, config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+	cm := manager.(*ConfigMapVMPoolManager)
+
+	ctx := context.Background()
+	state := &IPAllocationState{
+		AllocatedIPs: map[string]IPAllocation{},
+		AvailableIPs: []string{"192.168.1.10", "192.168.1.11"},
+		Version:      1,
+	}
+
+	// An empty ResourceVersion creates the ConfigMap
+	if err := cm.compareAndSwapState(ctx, state, ""); err != nil {
+		t.Fatalf("Failed to create the state: %v", err)
+	}
+
+	configMaps := client.CoreV1().ConfigMaps(config.Namespace)
+	configMap, err := configMaps.Get(ctx, config.ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get ConfigMap: %v", err)
+	}
+	configMap.ResourceVersion = "5"
+	if err := client.Tracker().Update(v1.SchemeGroupVersion.WithResource("configmaps"), configMap, config.Namespace); err != nil {
+		t.Fatalf("Failed to update ConfigMap: %v", err)
+	}
+
+	// A stale ResourceVersion leaves the state unchanged
+	state.AvailableIPs = []string{"192.168.1.10"}
+	state.Version = 2
+	if err := cm.compareAndSwapState(ctx, state, "4"); !errors.IsConflict(err) {
+		t.Fatalf("Expected a conflict for a stale resource version, got %v", err)
+	}
+	current, _, err := cm.getCurrentState(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if current.Version != 1 {
+		t.Errorf("Expected version 1 to be kept, got %d", current.Version)
+	}
+
+	// The current ResourceVersion updates it
+	if err := cm.compareAndSwapState(ctx, state, "5"); err != nil {
+		t.Fatalf("Failed to update the state: %v", err)
+	}
+	current, _, err = cm.getCurrentState(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if current.Version != 2 || !reflect.DeepEqual(current.AvailableIPs, state.AvailableIPs) {
+		t.Errorf("Expected the swapped state, got %+v", current)
+	}
+
+	// A ConfigMap deleted since it was read is a conflict as well
+	if err := configMaps.Delete(ctx, config.ConfigMapName, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Failed to delete ConfigMap: %v", err)
+	}
+	if err := cm.compareAndSwapState(ctx, state, "5"); !errors.IsConflict(err) {
+		t.Errorf("Expected a conflict for a deleted ConfigMap, got %v", err)
+	}
+}
+
+func TestConfigMapVMPoolManagerConflictBackoff(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10"},
+		OperationTimeout: 10000,
+		SkipVMReadiness:  true,
+		ConflictBackoff:  wait.Backoff{Steps: 3, Duration: 20 * time.Millisecond, Factor: 2, Cap: time.Second},
+	}
+	client := fake.NewSimpleClientset()
+	manager, err := NewConfigMapVMPoolManager(client, config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("Failed to initialize state: %v", err)
+	}
+
+	// Another node always wins the update
+	attempts := 0
+	client.PrependReactor("update", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		attempts++
+		return true, nil, errors.NewConflict(v1.Resource("configmaps"), config.ConfigMapName, stderrors.New("conflict"))
+	})
+
+	start := time.Now()
+	if _, err := manager.AllocateIP(ctx, "allocation-1", "pod-1"); !errors.IsConflict(err) {
+		t.Fatalf("Expected a conflict error, got %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if attempts != 3 {
+		t.Errorf("Expected 3 update attempts, got %d", attempts)
+	}
+	// The waits of 20ms and then 40ms
+	if elapsed < 60*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("Expected the retries to take about 60ms, took %v", elapsed)
+	}
+}
+
+func TestConfigMapVMPoolManagerReadOnly(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+
+	newManager := func(readOnly bool) GlobalVMPoolManager {
+		manager, err := NewConfigMapVMPoolManager(client, &GlobalVMPoolConfig{
+			Namespace:        "test-namespace",
+			ConfigMapName:    "test-configmap",
+			PoolIPs:          []string{"192.168.1.10", "192.168.1.11"},
+			OperationTimeout: 10000,
+			SkipVMReadiness:  true,
+			ReadOnly:         readOnly,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+		}
+		return manager
+	}
+
+	// The production state, written by a regular manager
+	if _, err := newManager(false).AllocateIP(ctx, "test-allocation-1", "test-pod-1"); err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+
+	manager := newManager(true)
+
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Errorf("Expected RecoverState to succeed, got %v", err)
+	}
+
+	total, available, inUse, err := manager.GetPoolStatus(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get pool status: %v", err)
+	}
+	if total != 2 || available != 1 || inUse != 1 {
+		t.Errorf("Expected 2 total, 1 available and 1 in use, got %d, %d and %d", total, available, inUse)
+	}
+
+	allocations, err := manager.ListAllocatedIPs(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list allocated IPs: %v", err)
+	}
+	if _, exists := allocations["test-allocation-1"]; !exists || len(allocations) != 1 {
+		t.Errorf("Expected only test-allocation-1 to be allocated, got %v", allocations)
+	}
+
+	if _, err := manager.AllocateIP(ctx, "test-allocation-2", "test-pod-2"); !stderrors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected %v, got %v", ErrReadOnly, err)
+	}
+	if err := manager.DeallocateIP(ctx, "test-allocation-1"); !stderrors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected %v, got %v", ErrReadOnly, err)
+	}
+
+	// The ConfigMap is left untouched
+	if _, available, inUse, _ := manager.GetPoolStatus(ctx); available != 1 || inUse != 1 {
+		t.Errorf("Expected 1 available and 1 in use, got %d and %d", available, inUse)
+	}
+
+	// Without the ConfigMap, the last known state is shown and the ConfigMap isn't recreated
+	if err := client.CoreV1().ConfigMaps("test-namespace").Delete(ctx, "test-configmap", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Failed to delete the ConfigMap: %v", err)
+	}
+	if _, available, inUse, err := manager.GetPoolStatus(ctx); err != nil || available != 1 || inUse != 1 {
+		t.Errorf("Expected 1 available and 1 in use, got %d and %d, error %v", available, inUse, err)
+	}
+	if _, err := client.CoreV1().ConfigMaps("test-namespace").Get(ctx, "test-configmap", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("Expected the ConfigMap not to be recreated, got %v", err)
+	}
+
+	// A manager that never saw the state shows an empty pool
+	if _, available, inUse, err := newManager(true).GetPoolStatus(ctx); err != nil || available != 2 || inUse != 0 {
+		t.Errorf("Expected 2 available and 0 in use, got %d and %d, error %v", available, inUse, err)
+	}
+}
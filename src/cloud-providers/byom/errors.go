@@ -3,7 +3,10 @@
 
 package byom
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // BYOM Provider Error Definitions
 //
@@ -19,6 +22,9 @@ var (
 	// ErrNoAvailableIPs indicates that no IPs are available in the pool for allocation
 	ErrNoAvailableIPs = errors.New("no available IPs in pool")
 
+	// ErrNamespaceQuotaExceeded indicates that the namespace already holds as many IPs as its quota allows
+	ErrNamespaceQuotaExceeded = errors.New("namespace pool quota exceeded")
+
 	// ErrRetrievingPoolState indicates an error related to the pool state
 	ErrRetrievingPoolState = errors.New("failed to retrieve pool state")
 
@@ -28,8 +34,17 @@ var (
 	// ErrRetrievingConfigMap indicates an error related to retrieving the pool state ConfigMap
 	ErrRetrievingConfigMap = errors.New("failed to retrieve the pool state configmap")
 
+	// ErrPoolStateLost indicates that the pool state ConfigMap was deleted and could not be restored
+	ErrPoolStateLost = errors.New("pool state configmap was deleted and could not be restored")
+
 	// ErrUpdatingConfigMap indicates an error related to updating the pool state ConfigMap
 	ErrUpdatingConfigMap = errors.New("failed to update the pool state configmap")
+
+	// ErrPoolUnhealthy indicates that too few pool VMs were reachable at startup
+	ErrPoolUnhealthy = errors.New("too few pool VMs are reachable")
+
+	// ErrReadOnly indicates that the pool state was about to be modified by a read-only pool manager
+	ErrReadOnly = errors.New("pool manager is read-only")
 )
 
 // Configuration Validation Errors
@@ -45,8 +60,48 @@ var (
 
 	// ErrInvalidIPAddress indicates that an IP address format is invalid
 	ErrInvalidIPAddress = errors.New("invalid IP address")
+
+	// ErrInvalidFileTransport indicates that the configured file transport is not supported
+	ErrInvalidFileTransport = errors.New("invalid file transport")
 )
 
+// File Transport Errors
+var (
+	// ErrPermissionDenied indicates that the SSH user is not allowed to write a file on a VM,
+	// which retrying doesn't fix
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// SFTP operations reported by SFTPError
+const (
+	SFTPOpSend  = "send"
+	SFTPOpProbe = "probe"
+)
+
+// SFTPError is returned by the SFTP file transport, it carries the VM and the operation that
+// failed as fields to correlate the failures in logs. Use errors.As to get it.
+type SFTPError struct {
+	// IP is the address of the VM
+	IP string
+	// RemotePath is the path of the file on the VM, before the chroot to /media. It is empty
+	// when probing.
+	RemotePath string
+	// Op is SFTPOpSend or SFTPOpProbe
+	Op  string
+	Err error
+}
+
+func (e *SFTPError) Error() string {
+	if e.RemotePath == "" {
+		return fmt.Sprintf("sftp %s on VM %s: %v", e.Op, e.IP, e.Err)
+	}
+	return fmt.Sprintf("sftp %s of %s on VM %s: %v", e.Op, e.RemotePath, e.IP, e.Err)
+}
+
+func (e *SFTPError) Unwrap() error {
+	return e.Err
+}
+
 // Node Detection Errors
 var (
 	// ErrNodeNameDetection indicates failure to determine the current node name
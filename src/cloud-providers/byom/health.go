@@ -0,0 +1,250 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	poolHealthPath         = "/pool/health"
+	defaultHealthCacheTTL  = 10 * time.Second
+	defaultProbeTimeout    = 5 * time.Second
+	maxConcurrentProbes    = 8
+	healthStatusUp         = "up"
+	healthStatusDown       = "down"
+	healthStatusUnprobed   = "unknown"
+	healthHeaderFromCached = "X-Pool-Health-Cached"
+)
+
+// vmProber checks whether a pool VM is reachable
+type vmProber interface {
+	Probe(ctx context.Context, ip string) error
+}
+
+// transportProber checks reachability by establishing a session with the VM
+// using the configured file transport
+type transportProber struct {
+	transport fileTransport
+	sshConfig *ssh.ClientConfig
+}
+
+func (p *transportProber) Probe(ctx context.Context, ip string) error {
+	return p.transport.Probe(ctx, net.JoinHostPort(ip, sshPort), p.sshConfig)
+}
+
+// PoolHealth is the response of the pool health endpoint
+type PoolHealth struct {
+	IPs       map[string]string `json:"ips"`
+	Up        int               `json:"up"`
+	Down      int               `json:"down"`
+	CheckedAt time.Time         `json:"checkedAt"`
+}
+
+// poolHealthChecker probes all pool IPs on demand. Results are cached for
+// cacheTTL so that frequent requests don't hammer the pool VMs.
+type poolHealthChecker struct {
+	ips          []string
+	prober       vmProber
+	cacheTTL     time.Duration
+	probeTimeout time.Duration
+	now          func() time.Time
+
+	mutex    sync.Mutex
+	cached   *PoolHealth
+	inflight *healthRound // the running probe round, nil if none is
+}
+
+// healthRound is a probe round of all the pool IPs, done is closed once health is set
+type healthRound struct {
+	done   chan struct{}
+	health *PoolHealth
+}
+
+func newPoolHealthChecker(ips []string, prober vmProber) *poolHealthChecker {
+	return &poolHealthChecker{
+		ips:          ips,
+		prober:       prober,
+		cacheTTL:     defaultHealthCacheTTL,
+		probeTimeout: defaultProbeTimeout,
+		now:          time.Now,
+	}
+}
+
+// Check returns the pool health and whether it was served from cache.
+// Concurrent callers wait for a single probe round instead of starting their own.
+// A caller whose ctx is done before the round completes gets all the IPs as unprobed.
+func (h *poolHealthChecker) Check(ctx context.Context) (*PoolHealth, bool) {
+	h.mutex.Lock()
+	if h.cached != nil && h.now().Sub(h.cached.CheckedAt) < h.cacheTTL {
+		cached := h.cached
+		h.mutex.Unlock()
+		return cached, true
+	}
+	round := h.inflight
+	if round == nil {
+		round = &healthRound{done: make(chan struct{})}
+		h.inflight = round
+		// The round is shared, it must not stop when the caller starting it goes away. Each
+		// probe is bounded by probeTimeout.
+		go h.probeRound(context.WithoutCancel(ctx), round)
+	}
+	h.mutex.Unlock()
+
+	select {
+	case <-round.done:
+		return round.health, false
+	case <-ctx.Done():
+		return h.unprobed(), false
+	}
+}
+
+// probeRound probes all the pool IPs, then caches the result and completes round
+func (h *poolHealthChecker) probeRound(ctx context.Context, round *healthRound) {
+	health := h.probeAll(ctx)
+
+	h.mutex.Lock()
+	h.cached = health
+	h.inflight = nil
+	h.mutex.Unlock()
+
+	round.health = health
+	close(round.done)
+}
+
+// probeAll probes all the pool IPs, at most maxConcurrentProbes at a time
+func (h *poolHealthChecker) probeAll(ctx context.Context) *PoolHealth {
+	health := &PoolHealth{
+		IPs:       make(map[string]string, len(h.ips)),
+		CheckedAt: h.now(),
+	}
+
+	var wg sync.WaitGroup
+	var resultMutex sync.Mutex
+	sem := make(chan struct{}, maxConcurrentProbes)
+
+	for _, ip := range h.ips {
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			status := healthStatusUp
+			probeCtx, cancel := context.WithTimeout(ctx, h.probeTimeout)
+			defer cancel()
+			if err := h.prober.Probe(probeCtx, ip); err != nil {
+				logger.Printf("Pool VM %s is unreachable: %v", ip, err)
+				status = healthStatusDown
+			}
+
+			resultMutex.Lock()
+			defer resultMutex.Unlock()
+			health.IPs[ip] = status
+			if status == healthStatusUp {
+				health.Up++
+			} else {
+				health.Down++
+			}
+		}(ip)
+	}
+	wg.Wait()
+
+	return health
+}
+
+// unprobed returns the pool health with all the IPs not probed
+func (h *poolHealthChecker) unprobed() *PoolHealth {
+	health := &PoolHealth{
+		IPs:       make(map[string]string, len(h.ips)),
+		CheckedAt: h.now(),
+	}
+	for _, ip := range h.ips {
+		health.IPs[ip] = healthStatusUnprobed
+	}
+	return health
+}
+
+// ServeHTTP implements the pool health endpoint
+func (h *poolHealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	health, cached := h.Check(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if cached {
+		w.Header().Set(healthHeaderFromCached, "true")
+	}
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		logger.Printf("Failed to write pool health response: %v", err)
+	}
+}
+
+// sweepPool probes every pool VM once, logs the unreachable ones and fails if less than
+// minHealthy percent of the VMs are reachable. A minHealthy of 0 never fails.
+func sweepPool(ctx context.Context, checker *poolHealthChecker, minHealthy int, metrics *PoolMetrics) error {
+	health, _ := checker.Check(ctx)
+
+	var unreachable []string
+	for ip, status := range health.IPs {
+		if status != healthStatusUp {
+			unreachable = append(unreachable, ip)
+		}
+	}
+	sort.Strings(unreachable)
+
+	if metrics != nil {
+		metrics.setUnreachable(len(unreachable))
+	}
+
+	total := len(health.IPs)
+	if len(unreachable) > 0 {
+		logger.Printf("Warning: %d of %d pool VMs are unreachable at startup: %s", len(unreachable), total, strings.Join(unreachable, ", "))
+	} else {
+		logger.Printf("All %d pool VMs are reachable", total)
+	}
+
+	if minHealthy > 0 && health.Up*100 < minHealthy*total {
+		return fmt.Errorf("%w: %d of %d reachable, at least %d%% required", ErrPoolUnhealthy, health.Up, total, minHealthy)
+	}
+	return nil
+}
+
+// startPoolHealthServer serves the pool health and metrics endpoints on the given address
+func startPoolHealthServer(addr string, checker *poolHealthChecker, metrics *PoolMetrics) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(poolHealthPath, checker)
+	if metrics != nil {
+		mux.Handle(poolMetricsPath, metrics)
+	}
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.Printf("Serving pool health on %s%s", addr, poolHealthPath)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Printf("Pool health server failed: %v", err)
+		}
+	}()
+
+	return server
+}
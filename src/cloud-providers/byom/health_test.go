@@ -0,0 +1,214 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProber reports the configured IPs as down and counts probes
+type fakeProber struct {
+	mutex  sync.Mutex
+	down   map[string]bool
+	probes int
+}
+
+func (f *fakeProber) Probe(ctx context.Context, ip string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.probes++
+	if f.down[ip] {
+		return fmt.Errorf("connection refused")
+	}
+	return nil
+}
+
+func TestPoolHealthEndpoint(t *testing.T) {
+	prober := &fakeProber{
+		down: map[string]bool{"192.168.1.11": true},
+	}
+	ips := []string{"192.168.1.10", "192.168.1.11", "192.168.1.12"}
+	checker := newPoolHealthChecker(ips, prober)
+
+	now := time.Now()
+	checker.now = func() time.Time { return now }
+
+	mux := http.NewServeMux()
+	mux.Handle(poolHealthPath, checker)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func() (*PoolHealth, *http.Response) {
+		resp, err := http.Get(server.URL + poolHealthPath)
+		if err != nil {
+			t.Fatalf("Failed to query pool health: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+
+		var health PoolHealth
+		if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+			t.Fatalf("Failed to decode pool health: %v", err)
+		}
+		return &health, resp
+	}
+
+	health, resp := get()
+	expected := map[string]string{
+		"192.168.1.10": healthStatusUp,
+		"192.168.1.11": healthStatusDown,
+		"192.168.1.12": healthStatusUp,
+	}
+	for ip, status := range expected {
+		if health.IPs[ip] != status {
+			t.Errorf("Expected %s to be %s, got %s", ip, status, health.IPs[ip])
+		}
+	}
+	if health.Up != 2 || health.Down != 1 {
+		t.Errorf("Expected 2 up and 1 down, got %d up and %d down", health.Up, health.Down)
+	}
+	if resp.Header.Get(healthHeaderFromCached) != "" {
+		t.Error("Expected first response not to be cached")
+	}
+
+	// A second request within the cache TTL must not probe again
+	_, resp = get()
+	if prober.probes != len(ips) {
+		t.Errorf("Expected %d probes, got %d", len(ips), prober.probes)
+	}
+	if resp.Header.Get(healthHeaderFromCached) != "true" {
+		t.Error("Expected second response to be cached")
+	}
+
+	// Once the cache expires the pool is probed again
+	now = now.Add(defaultHealthCacheTTL)
+	get()
+	if prober.probes != 2*len(ips) {
+		t.Errorf("Expected %d probes, got %d", 2*len(ips), prober.probes)
+	}
+}
+
+// blockingProber blocks every probe until release is closed, and counts probes
+type blockingProber struct {
+	started chan struct{}
+	release chan struct{}
+	probes  atomic.Int32
+}
+
+func (b *blockingProber) Probe(ctx context.Context, ip string) error {
+	b.probes.Add(1)
+	b.started <- struct{}{}
+	<-b.release
+	return nil
+}
+
+func TestPoolHealthCheckHungProbe(t *testing.T) {
+	prober := &blockingProber{started: make(chan struct{}, 1), release: make(chan struct{})}
+	checker := newPoolHealthChecker([]string{"192.168.1.10"}, prober)
+
+	results := make(chan *PoolHealth, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			health, _ := checker.Check(context.Background())
+			results <- health
+		}()
+	}
+	<-prober.started
+
+	// A caller giving up doesn't wait for the hung probe, nor is blocked by the other callers
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	health, cached := checker.Check(ctx)
+	if cached || health.IPs["192.168.1.10"] != healthStatusUnprobed {
+		t.Errorf("Expected 192.168.1.10 to be unprobed, got %v (cached %t)", health.IPs, cached)
+	}
+
+	close(prober.release)
+	for i := 0; i < 2; i++ {
+		if health := <-results; health.IPs["192.168.1.10"] != healthStatusUp {
+			t.Errorf("Expected 192.168.1.10 to be up, got %v", health.IPs)
+		}
+	}
+	// The concurrent callers shared a single probe round
+	if probes := prober.probes.Load(); probes != 1 {
+		t.Errorf("Expected 1 probe, got %d", probes)
+	}
+	if _, cached := checker.Check(context.Background()); !cached {
+		t.Error("Expected the shared round to be cached")
+	}
+}
+
+func TestPoolHealthEndpointMethodNotAllowed(t *testing.T) {
+	checker := newPoolHealthChecker([]string{"192.168.1.10"}, &fakeProber{})
+
+	req := httptest.NewRequest(http.MethodPost, poolHealthPath, nil)
+	rec := httptest.NewRecorder()
+	checker.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rec.Code)
+	}
+}
+
+func TestSweepPool(t *testing.T) {
+	ips := []string{"192.168.1.10", "192.168.1.11", "192.168.1.12", "192.168.1.13"}
+	down := map[string]bool{"192.168.1.11": true, "192.168.1.13": true}
+
+	tests := []struct {
+		name       string
+		minHealthy int
+		wantErr    bool
+	}{
+		{name: "no threshold", minHealthy: 0},
+		{name: "threshold met", minHealthy: 50},
+		{name: "threshold not met", minHealthy: 51, wantErr: true},
+		{name: "all required", minHealthy: 100, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prober := &fakeProber{down: down}
+			metrics := NewPoolMetrics()
+
+			err := sweepPool(context.Background(), newPoolHealthChecker(ips, prober), tt.minHealthy, metrics)
+			if tt.wantErr && !errors.Is(err, ErrPoolUnhealthy) {
+				t.Errorf("Expected ErrPoolUnhealthy, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if prober.probes != len(ips) {
+				t.Errorf("Expected %d probes, got %d", len(ips), prober.probes)
+			}
+
+			assertPoolMetrics(t, scrapePoolMetrics(t, metrics), []string{"byom_pool_vms_unreachable_at_startup 2"})
+		})
+	}
+}
+
+func TestConfigVerifierPoolStartupMinHealthy(t *testing.T) {
+	for _, minHealthy := range []int{-1, 101} {
+		p := &byomProvider{serviceConfig: &Config{
+			VMPoolIPs:             vmPoolIPs{"192.168.1.10"},
+			SSHUserName:           "peerpod",
+			SSHPrivKey:            "key",
+			PoolStartupMinHealthy: minHealthy,
+		}}
+		if err := p.ConfigVerifier(); err == nil {
+			t.Errorf("Expected an error for pool-startup-min-healthy %d, got nil", minHealthy)
+		}
+	}
+}
@@ -30,10 +30,23 @@ func (m *Manager) ParseCmd(flags *flag.FlagSet) {
 	flags.StringVar(&byomcfg.SSHPrivKeyPath, "ssh-priv-key", "/root/.ssh/id_rsa", "SSH private key file path")
 	flags.IntVar(&byomcfg.SSHTimeout, "ssh-timeout", 30, "SSH connection timeout in seconds")
 	flags.StringVar(&byomcfg.SSHHostKeyAllowlistDir, "ssh-host-key-allowlist-dir", "", "Directory containing allowed SSH host key files (enables allowlist mode if set)")
+	flags.StringVar(&byomcfg.FileTransport, "file-transport", "sftp", "Transport used to copy files to VMs: sftp, or scp for images without the SFTP subsystem")
+	flags.BoolVar(&byomcfg.ResetOnAllocate, "reset-on-allocate", false, "Reboot VMs before sending the user-data on allocation, in addition to the reboot on release")
+	flags.BoolVar(&byomcfg.AllowSkipReboot, "allow-skip-reboot", false, "Honor the byom.confidentialcontainers.org/skip-reboot pod annotation, which returns the VM to the pool without rebooting it. Any pod author can then leave state to the next pod, so only enable it for debugging")
 
 	// Pool management configuration
 	flags.StringVar(&byomcfg.PoolNamespace, "pool-namespace", "", "Namespace for ConfigMap storage (default: auto-detect from running pod)")
 	flags.StringVar(&byomcfg.PoolConfigMapName, "pool-configmap-name", "byom-ip-pool-state", "ConfigMap name for state storage")
+	flags.IntVar(&byomcfg.AuditHistorySize, "pool-audit-history-size", defaultAuditHistorySize, "Number of allocate/deallocate events kept in the <pool-configmap-name>-audit ConfigMap, 0 to disable")
+	flags.Var(&byomcfg.NamespaceQuotas, "pool-namespace-quotas", "Comma-separated namespace=quota pairs limiting the VMs each namespace can hold, other namespaces are not limited")
+	flags.StringVar(&byomcfg.PoolHealthListenAddr, "pool-health-listen", "", "Listen address for the /pool/health and /metrics endpoints (disabled if empty)")
+	flags.BoolVar(&byomcfg.PoolStartupProbe, "pool-startup-probe", false, "Probe every pool VM at startup and log the unreachable ones")
+	flags.IntVar(&byomcfg.PoolStartupMinHealthy, "pool-startup-min-healthy", 0, "Fail startup if less than this percentage of the pool VMs is reachable, 0 to never fail. Implies -pool-startup-probe")
+	flags.BoolVar(&byomcfg.PoolReadOnly, "pool-read-only", false, "Only read the pool state ConfigMap, creating and deleting instances fails. For inspecting the pool during an incident")
+	flags.IntVar(&byomcfg.PoolWarmWindow, "pool-warm-window", 0, "Seconds after its release during which a VM is preferred for the next allocations, as it is likely still warm, 0 to disable")
+	flags.IntVar(&byomcfg.PoolReuseGracePeriod, "pool-reuse-grace-period", 0, "Seconds a released VM is kept from being allocated again, e.g. while it still cleans up, 0 to disable")
+	flags.BoolVar(&byomcfg.ShredOnDelete, "shred-on-delete", false, "Send a shred trigger file to the VMs before rebooting them on release, for images that shred the secrets of the pod on it")
+	flags.StringVar(&byomcfg.ClusterID, "cluster-id", "", "Cluster ID prefixed to allocation IDs, VMs allocated with another prefix are never released by this cluster")
 }
 
 func (m *Manager) LoadEnv() {
@@ -44,13 +57,22 @@ func (m *Manager) LoadEnv() {
 		}
 	}
 
+	if quotasEnv := os.Getenv("POOL_NAMESPACE_QUOTAS"); quotasEnv != "" && len(byomcfg.NamespaceQuotas) == 0 {
+		if err := byomcfg.NamespaceQuotas.Set(quotasEnv); err != nil {
+			log.Printf("Warning: failed to parse POOL_NAMESPACE_QUOTAS environment variable: %v", err)
+		}
+	}
+
 	provider.DefaultToEnv(&byomcfg.SSHUserName, "SSH_USERNAME", "peerpod")
 	provider.DefaultToEnv(&byomcfg.SSHPubKeyPath, "SSH_PUB_KEY_PATH", "/root/.ssh/id_rsa.pub")
 	provider.DefaultToEnv(&byomcfg.SSHPrivKeyPath, "SSH_PRIV_KEY_PATH", "/root/.ssh/id_rsa")
+	provider.DefaultToEnv(&byomcfg.FileTransport, "FILE_TRANSPORT", "sftp")
 
 	// Pool management configuration
 	provider.DefaultToEnv(&byomcfg.PoolNamespace, "POOL_NAMESPACE", "")
 	provider.DefaultToEnv(&byomcfg.PoolConfigMapName, "POOL_CONFIGMAP_NAME", "byom-ip-pool-state")
+	provider.DefaultToEnv(&byomcfg.PoolHealthListenAddr, "POOL_HEALTH_LISTEN", "")
+	provider.DefaultToEnv(&byomcfg.ClusterID, "CLUSTER_ID", "")
 }
 
 func (m *Manager) NewProvider() (provider.Provider, error) {
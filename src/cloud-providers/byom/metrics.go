@@ -0,0 +1,113 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+const (
+	poolMetricsPath            = "/metrics"
+	poolMetricsRefreshInterval = 30 * time.Second
+)
+
+// PoolMetrics exposes the pool state as Prometheus gauges. It's updated each time the pool
+// manager reads or writes the state, so the gauges follow the allocations of all the nodes.
+type PoolMetrics struct {
+	mutex       sync.Mutex
+	total       int
+	available   int
+	inUse       int
+	quarantined int
+	perNode     map[string]int
+
+	// Set by the startup sweep, reported only if it ran
+	unreachable *int
+}
+
+func NewPoolMetrics() *PoolMetrics {
+	return &PoolMetrics{perNode: map[string]int{}}
+}
+
+func (m *PoolMetrics) update(state *IPAllocationState) {
+	perNode := make(map[string]int)
+	for _, allocation := range state.AllocatedIPs {
+		perNode[allocation.NodeName]++
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.available = len(state.AvailableIPs)
+	m.inUse = len(state.AllocatedIPs)
+	m.quarantined = len(state.QuarantinedIPs)
+	m.total = m.available + m.inUse + m.quarantined
+	m.perNode = perNode
+}
+
+func (m *PoolMetrics) setUnreachable(count int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.unreachable = &count
+}
+
+// ServeHTTP writes the gauges in the Prometheus text format
+func (m *PoolMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP byom_pool_vms Number of VMs in the pool.\n")
+	fmt.Fprintf(w, "# TYPE byom_pool_vms gauge\n")
+	fmt.Fprintf(w, "byom_pool_vms %d\n", m.total)
+	fmt.Fprintf(w, "# HELP byom_pool_vms_available Number of pool VMs that can be allocated.\n")
+	fmt.Fprintf(w, "# TYPE byom_pool_vms_available gauge\n")
+	fmt.Fprintf(w, "byom_pool_vms_available %d\n", m.available)
+	fmt.Fprintf(w, "# HELP byom_pool_vms_in_use Number of pool VMs allocated to pods.\n")
+	fmt.Fprintf(w, "# TYPE byom_pool_vms_in_use gauge\n")
+	fmt.Fprintf(w, "byom_pool_vms_in_use %d\n", m.inUse)
+	fmt.Fprintf(w, "# HELP byom_pool_vms_quarantined Number of released pool VMs waiting for the reuse grace period to expire.\n")
+	fmt.Fprintf(w, "# TYPE byom_pool_vms_quarantined gauge\n")
+	fmt.Fprintf(w, "byom_pool_vms_quarantined %d\n", m.quarantined)
+	fmt.Fprintf(w, "# HELP byom_pool_node_allocations Number of pool VMs allocated by each worker node.\n")
+	fmt.Fprintf(w, "# TYPE byom_pool_node_allocations gauge\n")
+
+	nodes := make([]string, 0, len(m.perNode))
+	for node := range m.perNode {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		fmt.Fprintf(w, "byom_pool_node_allocations{node=%q} %d\n", node, m.perNode[node])
+	}
+
+	if m.unreachable != nil {
+		fmt.Fprintf(w, "# HELP byom_pool_vms_unreachable_at_startup Number of pool VMs that were unreachable at startup.\n")
+		fmt.Fprintf(w, "# TYPE byom_pool_vms_unreachable_at_startup gauge\n")
+		fmt.Fprintf(w, "byom_pool_vms_unreachable_at_startup %d\n", *m.unreachable)
+	}
+}
+
+// refreshPoolMetrics reads the pool state periodically, so that the gauges also follow the
+// allocations of the other nodes while this one is idle
+func refreshPoolMetrics(ctx context.Context, poolMgr GlobalVMPoolManager, interval time.Duration, clock provider.Clock) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(interval):
+			if _, _, _, err := poolMgr.GetPoolStatus(ctx); err != nil {
+				logger.Printf("Warning: failed to refresh pool metrics: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/providertest"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func scrapePoolMetrics(t *testing.T, metrics *PoolMetrics) string {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", poolMetricsPath, nil))
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected a text content type, got %q", ct)
+	}
+	return recorder.Body.String()
+}
+
+func assertPoolMetrics(t *testing.T, scraped string, want []string) {
+	t.Helper()
+
+	for _, line := range want {
+		if !strings.Contains(scraped, line+"\n") {
+			t.Errorf("Expected %q in the metrics, got:\n%s", line, scraped)
+		}
+	}
+}
+
+func TestPoolMetrics(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	client := fake.NewSimpleClientset()
+	newManager := func(metrics *PoolMetrics) GlobalVMPoolManager {
+		manager, err := NewConfigMapVMPoolManager(client, &GlobalVMPoolConfig{
+			Namespace:        "test-namespace",
+			ConfigMapName:    "test-configmap",
+			PoolIPs:          []string{"192.168.1.10", "192.168.1.11", "192.168.1.12", "192.168.1.13"},
+			OperationTimeout: 10 * time.Second,
+			SkipVMReadiness:  true, // Skip VM readiness checks in tests
+			Metrics:          metrics,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+		}
+		return manager
+	}
+
+	metrics := NewPoolMetrics()
+	manager := newManager(metrics)
+	ctx := context.Background()
+
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("Failed to recover state: %v", err)
+	}
+	assertPoolMetrics(t, scrapePoolMetrics(t, metrics), []string{
+		"byom_pool_vms 4",
+		"byom_pool_vms_available 4",
+		"byom_pool_vms_in_use 0",
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := manager.AllocateIP(ctx, fmt.Sprintf("test-allocation-%d", i), "test-pod"); err != nil {
+			t.Fatalf("Failed to allocate IP: %v", err)
+		}
+	}
+	assertPoolMetrics(t, scrapePoolMetrics(t, metrics), []string{
+		"byom_pool_vms 4",
+		"byom_pool_vms_available 2",
+		"byom_pool_vms_in_use 2",
+		`byom_pool_node_allocations{node="test-node"} 2`,
+	})
+
+	// An allocation from another node shows up on the next refresh
+	os.Setenv("NODE_NAME", "other-node")
+	if _, err := newManager(nil).AllocateIP(ctx, "other-allocation", "other-pod"); err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+
+	clock := providertest.NewFakeClock()
+	refreshCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go refreshPoolMetrics(refreshCtx, manager, poolMetricsRefreshInterval, clock)
+
+	// Nothing is refreshed before the interval has passed
+	<-clock.Waiting()
+	clock.Advance(poolMetricsRefreshInterval - time.Second)
+	assertPoolMetrics(t, scrapePoolMetrics(t, metrics), []string{"byom_pool_vms_in_use 2"})
+
+	// The refresh is done once the next one is waited for
+	clock.Advance(time.Second)
+	<-clock.Waiting()
+	assertPoolMetrics(t, scrapePoolMetrics(t, metrics), []string{
+		"byom_pool_vms 4",
+		"byom_pool_vms_available 1",
+		"byom_pool_vms_in_use 3",
+		`byom_pool_node_allocations{node="other-node"} 1`,
+		`byom_pool_node_allocations{node="test-node"} 2`,
+	})
+
+	if err := manager.DeallocateIP(ctx, "test-allocation-0"); err != nil {
+		t.Fatalf("Failed to deallocate IP: %v", err)
+	}
+	assertPoolMetrics(t, scrapePoolMetrics(t, metrics), []string{
+		"byom_pool_vms_available 2",
+		"byom_pool_vms_in_use 2",
+		`byom_pool_node_allocations{node="test-node"} 1`,
+	})
+}
@@ -5,10 +5,13 @@ package byom
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"net/netip"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,19 +29,49 @@ const (
 	sshPort      = "22"
 	userDataFile = "/media/cidata/user-data" // User-data file
 	rebootFile   = "/media/cidata/reboot"    // Reboot trigger file
+	shredFile    = "/media/cidata/shred"     // Secret shredding trigger file
+
+	defaultResetTimeout      = 5 * time.Minute
+	defaultResetPollInterval = 2 * time.Second
+
+	clusterIDSeparator = "/"     // Separates the cluster ID from the rest of an allocation ID
+	instanceNamePrefix = "byom-" // Instance names are the prefix followed by the IP of the VM
+
+	// Pod annotation that releases the VM without rebooting it, to inspect its state when debugging
+	skipRebootAnnotation = "byom.confidentialcontainers.org/skip-reboot"
 )
 
 // byomProvider implements the Provider interface for BYOM
 type byomProvider struct {
 	serviceConfig *Config
 	globalPoolMgr GlobalVMPoolManager
-	sshConfig     *ssh.ClientConfig // Pre-computed SSH client configuration
+	sshConfig     *ssh.ClientConfig  // Pre-computed SSH client configuration
+	transport     fileTransport      // Copies files to VMs via SFTP or scp
+	healthServer  *http.Server       // Pool health endpoint server, nil if disabled
+	stopMetrics   context.CancelFunc // Stops the periodic pool metrics refresh, nil if disabled
+	metricsDone   chan struct{}      // Closed when the pool metrics refresh has stopped
+	stopSweep     context.CancelFunc // Stops the periodic quarantine sweep, nil if disabled
+	sweepDone     chan struct{}      // Closed when the quarantine sweep has stopped
+
+	// Run before a VM is released, e.g. to shred the secrets of the pod
+	preDeleteHooks []provider.PreDeleteHook
+
+	// How long an allocate-time reset may take, and how often the VM is probed meanwhile
+	resetTimeout      time.Duration
+	resetPollInterval time.Duration
+
+	clock provider.Clock // nil uses the system clock
 }
 
 // NewProvider creates a new BYOM provider instance
 func NewProvider(config *Config) (provider.Provider, error) {
 	logger.Printf("BYOM config: %+v", config.Redact())
 
+	transport, err := newFileTransport(config.FileTransport)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize SSH configuration and keys
 	sshConfig := &util.SSHConfig{
 		PublicKey:           config.SSHPubKey,
@@ -87,6 +120,15 @@ func NewProvider(config *Config) (provider.Provider, error) {
 		MaxRetries:       5,
 		RetryInterval:    100 * time.Millisecond,
 		OperationTimeout: 30 * time.Second,
+		AuditHistorySize: config.AuditHistorySize,
+		NamespaceQuotas:  config.NamespaceQuotas,
+		ReadOnly:         config.PoolReadOnly,
+		WarmWindow:       time.Duration(config.PoolWarmWindow) * time.Second,
+		ReuseGracePeriod: time.Duration(config.PoolReuseGracePeriod) * time.Second,
+		Clock:            provider.RealClock{},
+	}
+	if config.PoolHealthListenAddr != "" {
+		poolConfig.Metrics = NewPoolMetrics()
 	}
 
 	logger.Printf("Pool configuration: namespace=%s, configMap=%s, IPs=%d",
@@ -99,9 +141,17 @@ func NewProvider(config *Config) (provider.Provider, error) {
 	}
 
 	p := &byomProvider{
-		serviceConfig: config,
-		globalPoolMgr: globalPoolMgr,
-		sshConfig:     sshClientConf,
+		serviceConfig:     config,
+		globalPoolMgr:     globalPoolMgr,
+		sshConfig:         sshClientConf,
+		transport:         transport,
+		resetTimeout:      defaultResetTimeout,
+		resetPollInterval: defaultResetPollInterval,
+		clock:             poolConfig.Clock,
+	}
+
+	if config.ShredOnDelete {
+		p.preDeleteHooks = append(p.preDeleteHooks, p.sendShredFile)
 	}
 
 	// Initialize state recovery
@@ -117,13 +167,31 @@ func NewProvider(config *Config) (provider.Provider, error) {
 		logger.Printf("Initialized BYOM provider with %d VMs (%d available, %d in use)", total, available, inUse)
 	}
 
+	checker := newPoolHealthChecker(config.VMPoolIPs, &transportProber{transport: transport, sshConfig: sshClientConf})
+
+	if config.PoolStartupProbe || config.PoolStartupMinHealthy > 0 {
+		if err := sweepPool(ctx, checker, config.PoolStartupMinHealthy, poolConfig.Metrics); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.PoolHealthListenAddr != "" {
+		p.healthServer = startPoolHealthServer(config.PoolHealthListenAddr, checker, poolConfig.Metrics)
+
+		p.startMetricsRefresh(poolMetricsRefreshInterval)
+	}
+
+	if config.PoolReuseGracePeriod > 0 && !config.PoolReadOnly {
+		p.startQuarantineSweep(quarantineSweepInterval)
+	}
+
 	return p, nil
 }
 
 // CreateInstance allocates a VM from the pool and configures it
 func (p *byomProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
-	// Generate allocation ID
-	allocationID := fmt.Sprintf("%s-%s", podName, sandboxID)
+	allocationID := p.allocationID(podName, sandboxID)
+	start := p.getClock().Now()
 
 	// Allocate IP from global pool
 	ip, err := p.globalPoolMgr.AllocateIP(ctx, allocationID, podName)
@@ -141,7 +209,17 @@ func (p *byomProvider) CreateInstance(ctx context.Context, podName, sandboxID st
 		return nil, fmt.Errorf("failed to generate cloud config: %w", err)
 	}
 
-	// Send config to the VM via SFTP
+	// Reboot the VM first, in case the reboot on release failed and left state from the previous pod
+	if p.serviceConfig.ResetOnAllocate {
+		if err := p.resetVM(ctx, ip); err != nil {
+			if rollbackErr := p.globalPoolMgr.DeallocateIP(ctx, allocationID); rollbackErr != nil {
+				logger.Printf("Warning: failed to rollback IP allocation: %v", rollbackErr)
+			}
+			return nil, fmt.Errorf("failed to reset VM %s: %w", ip.String(), err)
+		}
+	}
+
+	// Send config to the VM
 	if err := p.sendConfigFile(ctx, cloudConfigData, ip); err != nil {
 		// Rollback allocation on error
 		if rollbackErr := p.globalPoolMgr.DeallocateIP(ctx, allocationID); rollbackErr != nil {
@@ -155,14 +233,36 @@ func (p *byomProvider) CreateInstance(ctx context.Context, podName, sandboxID st
 
 	// Create instance object
 	instance := &provider.Instance{
-		ID:   ip.String(), // Use IP as instance ID for BYOM
-		Name: fmt.Sprintf("byom-%s", ip.String()),
-		IPs:  []netip.Addr{ip},
+		ID:    ip.String(), // Use IP as instance ID for BYOM
+		Name:  instanceNamePrefix + ip.String(),
+		IPs:   []netip.Addr{ip},
+		State: provider.InstanceStateRunning,
+		// BYOM VMs always come from the pool
+		FromPool:         true,
+		CreationDuration: p.getClock().Now().Sub(start),
 	}
 
 	return instance, nil
 }
 
+// allocationID returns the ID of the allocation of a VM to a pod sandbox, prefixed with the cluster ID if set
+func (p *byomProvider) allocationID(podName, sandboxID string) string {
+	id := fmt.Sprintf("%s-%s", podName, sandboxID)
+	if p.serviceConfig.ClusterID == "" {
+		return id
+	}
+	return p.serviceConfig.ClusterID + clusterIDSeparator + id
+}
+
+// ownsAllocation returns whether an allocation was made by this cluster. Without a cluster ID,
+// all the allocations are considered owned, as they were before cluster IDs were introduced.
+func (p *byomProvider) ownsAllocation(allocationID string) bool {
+	if p.serviceConfig.ClusterID == "" {
+		return true
+	}
+	return strings.HasPrefix(allocationID, p.serviceConfig.ClusterID+clusterIDSeparator)
+}
+
 // DeleteInstance returns a VM back to the pool
 func (p *byomProvider) DeleteInstance(ctx context.Context, instanceID string) error {
 
@@ -171,23 +271,46 @@ func (p *byomProvider) DeleteInstance(ctx context.Context, instanceID string) er
 		logger.Printf("Instance ID is empty, nothing to delete")
 		return nil
 	}
+
+	// Refuse before the reboot, which would otherwise still reach the VM
+	if p.serviceConfig.PoolReadOnly {
+		return fmt.Errorf("%w: cannot delete instance %s", ErrReadOnly, instanceID)
+	}
 	// Parse instance ID (which is the IP address)
 	ip, err := netip.ParseAddr(instanceID)
 	if err != nil {
 		return fmt.Errorf("invalid instance ID %s: %w", instanceID, err)
 	}
 
-	// Send reboot trigger file to VM before deallocating
-	if err := p.sendRebootFile(ctx, ip); err != nil {
-		logger.Printf("Warning: failed to send reboot file to VM %s: %v", ip.String(), err)
-		// Continue with deallocation even if reboot file sending fails
-	}
-
 	// Get allocation ID from IP
 	allocationID, found, err := p.globalPoolMgr.GetAllocationIDfromIP(ctx, ip)
 	if err != nil {
 		return fmt.Errorf("failed to get allocation ID for IP %s: %w", ip.String(), err)
 	}
+
+	// Leave the VM alone, including the reboot, when another cluster sharing the ConfigMap allocated it
+	if found && !p.ownsAllocation(allocationID) {
+		logger.Printf("Warning: IP %s is allocated by another cluster (allocation ID: %s), not deallocating it", ip.String(), allocationID)
+		return nil
+	}
+
+	// Before the reboot, the VM still runs the pod and holds its secrets
+	provider.RunPreDeleteHooks(ctx, ip.String(), provider.DefaultPreDeleteHookTimeout, p.preDeleteHooks)
+
+	// Send reboot trigger file to VM before deallocating, unless the pod asked to keep the VM state for
+	// debugging. Any pod author can set the annotation, so it's only honored when the operator allows it.
+	skipReboot, _ := strconv.ParseBool(provider.PodAnnotationsFromContext(ctx)[skipRebootAnnotation])
+	if skipReboot && !p.serviceConfig.AllowSkipReboot {
+		logger.Printf("Warning: ignoring %s on VM %s, -allow-skip-reboot is not set", skipRebootAnnotation, ip.String())
+		skipReboot = false
+	}
+	if skipReboot {
+		logger.Printf("Warning: %s is set, not rebooting VM %s, the next pod gets it with the state left by this one", skipRebootAnnotation, ip.String())
+	} else if err := p.sendRebootFile(ctx, ip); err != nil {
+		logger.Printf("Warning: failed to send reboot file to VM %s: %v", ip.String(), err)
+		// Continue with deallocation even if reboot file sending fails
+	}
+
 	if !found {
 		logger.Printf("IP %s not found in allocated pool, nothing to deallocate", ip.String())
 		return nil
@@ -203,12 +326,73 @@ func (p *byomProvider) DeleteInstance(ctx context.Context, instanceID string) er
 	return nil
 }
 
-// Teardown cleans up resources
+// DeleteInstanceByName returns the VM named name, i.e. "byom-<IP>", to the pool
+func (p *byomProvider) DeleteInstanceByName(ctx context.Context, name string) error {
+	ip, ok := strings.CutPrefix(name, instanceNamePrefix)
+	if !ok {
+		return fmt.Errorf("invalid instance name %s: expected %s<IP>", name, instanceNamePrefix)
+	}
+	return p.DeleteInstance(ctx, ip)
+}
+
+// getClock returns the clock of the provider, the system clock if unset
+func (p *byomProvider) getClock() provider.Clock {
+	if p.clock == nil {
+		return provider.RealClock{}
+	}
+	return p.clock
+}
+
+// startMetricsRefresh refreshes the pool metrics in the background until Close
+func (p *byomProvider) startMetricsRefresh(interval time.Duration) {
+	var ctx context.Context
+	ctx, p.stopMetrics = context.WithCancel(context.Background())
+	p.metricsDone = make(chan struct{})
+
+	go func() {
+		defer close(p.metricsDone)
+		refreshPoolMetrics(ctx, p.globalPoolMgr, interval, p.getClock())
+	}()
+}
+
+// startQuarantineSweep promotes the expired quarantined IPs in the background until Close
+func (p *byomProvider) startQuarantineSweep(interval time.Duration) {
+	var ctx context.Context
+	ctx, p.stopSweep = context.WithCancel(context.Background())
+	p.sweepDone = make(chan struct{})
+
+	go func() {
+		defer close(p.sweepDone)
+		sweepQuarantinedIPs(ctx, p.globalPoolMgr, interval, p.getClock())
+	}()
+}
+
+// Teardown leaves the VMs alone, they belong to the pool
 func (p *byomProvider) Teardown() error {
 	logger.Printf("BYOM provider teardown completed")
 	return nil
 }
 
+// Close stops the pool metrics refresh, the quarantine sweep and the pool health server
+func (p *byomProvider) Close() error {
+	if p.stopMetrics != nil {
+		p.stopMetrics()
+		<-p.metricsDone
+	}
+	if p.stopSweep != nil {
+		p.stopSweep()
+		<-p.sweepDone
+	}
+	if p.healthServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.healthServer.Shutdown(ctx); err != nil {
+			return fmt.Errorf("failed to shut down pool health server: %w", err)
+		}
+	}
+	return nil
+}
+
 // ConfigVerifier validates the provider configuration
 func (p *byomProvider) ConfigVerifier() error {
 	if len(p.serviceConfig.VMPoolIPs) == 0 {
@@ -223,8 +407,16 @@ func (p *byomProvider) ConfigVerifier() error {
 		return fmt.Errorf("SSH private key is required")
 	}
 
-	// SSH is disabled, only SFTP is used.
-	// Todo: check VM connectivity here to verify the VM_POOL_IPS entries?
+	if strings.Contains(p.serviceConfig.ClusterID, clusterIDSeparator) {
+		return fmt.Errorf("cluster-id must not contain %q", clusterIDSeparator)
+	}
+
+	if p.serviceConfig.PoolStartupMinHealthy < 0 || p.serviceConfig.PoolStartupMinHealthy > 100 {
+		return fmt.Errorf("pool-startup-min-healthy must be a percentage between 0 and 100")
+	}
+
+	// Interactive SSH is not used, files are copied via SFTP or scp only.
+	// VM connectivity is checked at startup with -pool-startup-probe.
 
 	return nil
 }
@@ -234,7 +426,7 @@ func (p *byomProvider) createSSHConfig() (*ssh.ClientConfig, error) {
 	return p.sshConfig, nil
 }
 
-// sendConfigFile sends cloud-init user-data to a VM via SFTP
+// sendConfigFile sends cloud-init user-data to a VM
 func (p *byomProvider) sendConfigFile(ctx context.Context, userData string, ip netip.Addr) error {
 	logger.Printf("Attempting to send user-data to VM %s (size: %d bytes)", ip.String(), len(userData))
 
@@ -244,8 +436,13 @@ func (p *byomProvider) sendConfigFile(ctx context.Context, userData string, ip n
 	}
 
 	address := net.JoinHostPort(ip.String(), sshPort)
-	if err := p.sendFileViaSFTPWithChroot(ctx, address, sshConfig, userDataFile, []byte(userData)); err != nil {
+	if err := p.transport.SendFile(ctx, address, sshConfig, userDataFile, []byte(userData)); err != nil {
 		logger.Printf("Failed to send user-data to VM %s: %v", ip.String(), err)
+		if errors.Is(err, ErrPermissionDenied) {
+			// Not transient, so point to the likely misconfiguration instead
+			return fmt.Errorf("SSH user %q cannot write %s on VM %s, check -ssh-username, that the file system is not read-only and that the SFTP server chroots to /media: %w",
+				p.serviceConfig.SSHUserName, userDataFile, ip.String(), err)
+		}
 		return fmt.Errorf("failed to send user-data to VM %s: %w", ip.String(), err)
 	}
 
@@ -253,7 +450,7 @@ func (p *byomProvider) sendConfigFile(ctx context.Context, userData string, ip n
 	return nil
 }
 
-// sendRebootFile sends a reboot trigger file to a VM via SFTP
+// sendRebootFile sends a reboot trigger file to a VM
 func (p *byomProvider) sendRebootFile(ctx context.Context, ip netip.Addr) error {
 
 	logger.Printf("Sending reboot file to VM %s", ip.String())
@@ -264,17 +461,69 @@ func (p *byomProvider) sendRebootFile(ctx context.Context, ip netip.Addr) error
 	}
 
 	address := net.JoinHostPort(ip.String(), sshPort)
-	if err := p.sendFileViaSFTPWithChroot(ctx, address, sshConfig, rebootFile, []byte("reboot")); err != nil {
+	if err := p.transport.SendFile(ctx, address, sshConfig, rebootFile, []byte("reboot")); err != nil {
 		return fmt.Errorf("failed to send reboot file to VM %s: %w", ip.String(), err)
 	}
 
 	return nil
 }
 
-// sendFileViaSFTPWithChroot sends a file via SFTP, adjusting path for chrooted environment
-func (p *byomProvider) sendFileViaSFTPWithChroot(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePath string, content []byte) error {
-	// Strip /media prefix for chrooted SFTP (SFTP server chroots to /media)
-	// SFTP path is hardcoded to /media/cidata
-	adjustedPath := strings.TrimPrefix(remotePath, "/media/")
-	return util.SendFileViaSFTPWithContext(ctx, address, sshConfig, adjustedPath, content)
+// sendShredFile sends a trigger file asking the VM to shred the secrets of the pod, e.g. to have
+// the KBS revoke its keys, before it is rebooted. The pod VM image acts on it.
+func (p *byomProvider) sendShredFile(ctx context.Context, instanceID string) error {
+	logger.Printf("Sending shred file to VM %s", instanceID)
+
+	sshConfig, err := p.createSSHConfig()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH config: %w", err)
+	}
+
+	address := net.JoinHostPort(instanceID, sshPort)
+	if err := p.transport.SendFile(ctx, address, sshConfig, shredFile, []byte("shred")); err != nil {
+		return fmt.Errorf("failed to send shred file to VM %s: %w", instanceID, err)
+	}
+
+	return nil
+}
+
+// resetVM reboots a VM and waits until it is back. /media/cidata is a tmpfs, so the
+// VM has to go down first, otherwise the user-data sent next would be lost on reboot.
+func (p *byomProvider) resetVM(ctx context.Context, ip netip.Addr) error {
+	if err := p.sendRebootFile(ctx, ip); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.resetTimeout)
+	defer cancel()
+
+	address := net.JoinHostPort(ip.String(), sshPort)
+	probe := func() error {
+		probeCtx, probeCancel := context.WithTimeout(ctx, p.resetPollInterval)
+		defer probeCancel()
+		return p.transport.Probe(probeCtx, address, p.sshConfig)
+	}
+
+	ticker := time.NewTicker(p.resetPollInterval)
+	defer ticker.Stop()
+
+	down := false
+	for {
+		err := probe()
+		if !down && err != nil {
+			logger.Printf("VM %s is rebooting", ip.String())
+			down = true
+		} else if down && err == nil {
+			logger.Printf("VM %s is back after reboot", ip.String())
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if !down {
+				return fmt.Errorf("VM %s did not reboot within %s", ip.String(), p.resetTimeout)
+			}
+			return fmt.Errorf("VM %s did not come back within %s after reboot", ip.String(), p.resetTimeout)
+		case <-ticker.C:
+		}
+	}
 }
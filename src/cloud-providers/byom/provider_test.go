@@ -0,0 +1,369 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"golang.org/x/crypto/ssh"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// recordingTransport records the files sent to VMs and answers probes from a script
+type recordingTransport struct {
+	sent   []string
+	probes []error // results of the successive probes, the last one is repeated
+}
+
+func (r *recordingTransport) SendFile(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePath string, content []byte) error {
+	r.sent = append(r.sent, remotePath)
+	return nil
+}
+
+func (r *recordingTransport) Probe(ctx context.Context, address string, sshConfig *ssh.ClientConfig) error {
+	if len(r.probes) == 0 {
+		return nil
+	}
+	err := r.probes[0]
+	if len(r.probes) > 1 {
+		r.probes = r.probes[1:]
+	}
+	return err
+}
+
+type staticCloudConfig struct{}
+
+func (staticCloudConfig) Generate() (string, error) {
+	return "#cloud-config", nil
+}
+
+func newResetTestProvider(t *testing.T, resetOnAllocate bool, transport *recordingTransport) *byomProvider {
+	poolMgr, err := NewConfigMapVMPoolManager(fake.NewSimpleClientset(), &GlobalVMPoolConfig{
+		Namespace:     "test-namespace",
+		ConfigMapName: "test-configmap",
+		PoolIPs:       []string{"192.168.1.10"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create pool manager: %v", err)
+	}
+	if err := poolMgr.RecoverState(context.Background(), nil); err != nil {
+		t.Fatalf("Failed to initialize pool state: %v", err)
+	}
+
+	return &byomProvider{
+		serviceConfig:     &Config{ResetOnAllocate: resetOnAllocate},
+		globalPoolMgr:     poolMgr,
+		sshConfig:         &ssh.ClientConfig{},
+		transport:         transport,
+		resetTimeout:      time.Second,
+		resetPollInterval: time.Millisecond,
+	}
+}
+
+func TestCreateInstanceResetOnAllocate(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	tests := []struct {
+		name            string
+		resetOnAllocate bool
+		want            []string
+	}{
+		{
+			name: "disabled",
+			want: []string{userDataFile},
+		},
+		{
+			name:            "enabled",
+			resetOnAllocate: true,
+			want:            []string{rebootFile, userDataFile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The VM is down for two probes while rebooting
+			transport := &recordingTransport{probes: []error{errors.New("down"), errors.New("down"), nil}}
+			p := newResetTestProvider(t, tt.resetOnAllocate, transport)
+
+			if _, err := p.CreateInstance(context.Background(), "test-pod", "sandbox", staticCloudConfig{}, provider.InstanceTypeSpec{}); err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			if !reflect.DeepEqual(transport.sent, tt.want) {
+				t.Errorf("Expected files %v to be sent, got %v", tt.want, transport.sent)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceResetTimeout(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	// The VM never comes back after the reboot
+	transport := &recordingTransport{probes: []error{errors.New("down")}}
+	p := newResetTestProvider(t, true, transport)
+
+	if _, err := p.CreateInstance(context.Background(), "test-pod", "sandbox", staticCloudConfig{}, provider.InstanceTypeSpec{}); err == nil {
+		t.Fatal("Expected an error when the VM doesn't come back")
+	}
+	if !reflect.DeepEqual(transport.sent, []string{rebootFile}) {
+		t.Errorf("Expected only the reboot file to be sent, got %v", transport.sent)
+	}
+
+	// The allocation is rolled back
+	_, available, inUse, err := p.globalPoolMgr.GetPoolStatus(context.Background())
+	if err != nil {
+		t.Fatalf("GetPoolStatus() error = %v", err)
+	}
+	if available != 1 || inUse != 0 {
+		t.Errorf("Expected the VM to be returned to the pool, got %d available and %d in use", available, inUse)
+	}
+}
+
+func TestCreateInstanceFromPool(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	p := newResetTestProvider(t, false, &recordingTransport{})
+
+	instance, err := p.CreateInstance(context.Background(), "test-pod", "sandbox", staticCloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if !instance.FromPool {
+		t.Error("Expected the instance to come from the pool")
+	}
+	if instance.Zone != "" {
+		t.Errorf("Expected no zone for a BYOM VM, got %q", instance.Zone)
+	}
+}
+
+func TestClusterIDAllocation(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	transport := &recordingTransport{}
+	p := newResetTestProvider(t, false, transport)
+	p.serviceConfig.ClusterID = "cluster-a"
+
+	instance, err := p.CreateInstance(ctx, "test-pod", "sandbox", staticCloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	allocationID, found, err := p.globalPoolMgr.GetAllocationIDfromIP(ctx, instance.IPs[0])
+	if err != nil || !found {
+		t.Fatalf("Expected the VM to be allocated, got found=%v, err=%v", found, err)
+	}
+	if allocationID != "cluster-a/test-pod-sandbox" {
+		t.Errorf("Expected allocation ID cluster-a/test-pod-sandbox, got %s", allocationID)
+	}
+
+	// Another cluster sharing the ConfigMap must not release the VM
+	foreign := &byomProvider{
+		serviceConfig: &Config{ClusterID: "cluster-b"},
+		globalPoolMgr: p.globalPoolMgr,
+		sshConfig:     &ssh.ClientConfig{},
+		transport:     transport,
+	}
+	transport.sent = nil
+	if err := foreign.DeleteInstance(ctx, instance.ID); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if len(transport.sent) != 0 {
+		t.Errorf("Expected no reboot of a foreign VM, got %v", transport.sent)
+	}
+	if _, found, _ := p.globalPoolMgr.GetAllocationIDfromIP(ctx, instance.IPs[0]); !found {
+		t.Error("Expected the VM of another cluster to stay allocated")
+	}
+
+	if err := p.DeleteInstance(ctx, instance.ID); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if _, found, _ := p.globalPoolMgr.GetAllocationIDfromIP(ctx, instance.IPs[0]); found {
+		t.Error("Expected the VM to be returned to the pool")
+	}
+}
+
+func TestAllocationIDWithoutClusterID(t *testing.T) {
+	p := &byomProvider{serviceConfig: &Config{}}
+
+	if got := p.allocationID("test-pod", "sandbox"); got != "test-pod-sandbox" {
+		t.Errorf("Expected allocation ID test-pod-sandbox, got %s", got)
+	}
+	if !p.ownsAllocation("cluster-a/test-pod-sandbox") {
+		t.Error("Expected all the allocations to be owned without a cluster ID")
+	}
+}
+
+func TestDeleteInstanceByName(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	transport := &recordingTransport{}
+	p := newResetTestProvider(t, false, transport)
+
+	instance, err := p.CreateInstance(ctx, "test-pod", "sandbox", staticCloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	if err := p.DeleteInstanceByName(ctx, "podvm-test-pod"); err == nil {
+		t.Error("Expected an error for a name without the byom- prefix")
+	}
+
+	if err := p.DeleteInstanceByName(ctx, instance.Name); err != nil {
+		t.Fatalf("DeleteInstanceByName() error = %v", err)
+	}
+	if _, found, _ := p.globalPoolMgr.GetAllocationIDfromIP(ctx, instance.IPs[0]); found {
+		t.Error("Expected the VM to be returned to the pool")
+	}
+}
+
+func TestDeleteInstanceReadOnly(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	transport := &recordingTransport{}
+	p := newResetTestProvider(t, false, transport)
+	p.serviceConfig.PoolReadOnly = true
+
+	if err := p.DeleteInstance(context.Background(), "192.168.1.10"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Expected %v, got %v", ErrReadOnly, err)
+	}
+	if len(transport.sent) != 0 {
+		t.Errorf("Expected no reboot file to be sent, got %v", transport.sent)
+	}
+}
+
+func TestClose(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	p := newResetTestProvider(t, false, &recordingTransport{})
+	p.startMetricsRefresh(time.Millisecond)
+	p.startQuarantineSweep(time.Millisecond)
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	select {
+	case <-p.metricsDone:
+	default:
+		t.Error("Expected the pool metrics refresh to be stopped")
+	}
+	select {
+	case <-p.sweepDone:
+	default:
+		t.Error("Expected the quarantine sweep to be stopped")
+	}
+}
+
+func TestDeleteInstancePreDeleteHooks(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	transport := &recordingTransport{}
+	p := newResetTestProvider(t, false, transport)
+	ctx := context.Background()
+
+	instance, err := p.CreateInstance(ctx, "test-pod", "sandbox", staticCloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	// The hooks run while the VM still holds the pod, and a failure doesn't prevent its release
+	var hookCalls int
+	p.preDeleteHooks = []provider.PreDeleteHook{
+		p.sendShredFile,
+		func(ctx context.Context, instanceID string) error {
+			hookCalls++
+			if instanceID != instance.ID {
+				t.Errorf("Expected the hook to get instance %s, got %s", instance.ID, instanceID)
+			}
+			if _, found, _ := p.globalPoolMgr.GetAllocationIDfromIP(ctx, instance.IPs[0]); !found {
+				t.Error("Expected the VM to be allocated while the hook runs")
+			}
+			return errors.New("KBS unreachable")
+		},
+	}
+
+	if err := p.DeleteInstance(ctx, instance.ID); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+
+	if hookCalls != 1 {
+		t.Errorf("Expected the hook to run once, ran %d times", hookCalls)
+	}
+	if want := []string{userDataFile, shredFile, rebootFile}; !reflect.DeepEqual(transport.sent, want) {
+		t.Errorf("Expected files %v to be sent, got %v", want, transport.sent)
+	}
+	if _, found, _ := p.globalPoolMgr.GetAllocationIDfromIP(ctx, instance.IPs[0]); found {
+		t.Error("Expected the VM to be returned to the pool")
+	}
+}
+
+func TestDeleteInstanceSkipReboot(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	tests := []struct {
+		name            string
+		allowSkipReboot bool
+		annotations     map[string]string
+		want            []string
+	}{
+		{
+			name:            "no annotation",
+			allowSkipReboot: true,
+			want:            []string{userDataFile, rebootFile},
+		},
+		{
+			name:            "skip reboot",
+			allowSkipReboot: true,
+			annotations:     map[string]string{skipRebootAnnotation: "true"},
+			want:            []string{userDataFile},
+		},
+		{
+			name:        "skip reboot not allowed",
+			annotations: map[string]string{skipRebootAnnotation: "true"},
+			want:        []string{userDataFile, rebootFile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &recordingTransport{}
+			p := newResetTestProvider(t, false, transport)
+			p.serviceConfig.AllowSkipReboot = tt.allowSkipReboot
+			ctx := provider.WithPodAnnotations(context.Background(), tt.annotations)
+
+			instance, err := p.CreateInstance(ctx, "test-pod", "sandbox", staticCloudConfig{}, provider.InstanceTypeSpec{})
+			if err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+			if err := p.DeleteInstance(ctx, instance.ID); err != nil {
+				t.Fatalf("DeleteInstance() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(transport.sent, tt.want) {
+				t.Errorf("Expected files %v to be sent, got %v", tt.want, transport.sent)
+			}
+			if _, found, _ := p.globalPoolMgr.GetAllocationIDfromIP(ctx, instance.IPs[0]); found {
+				t.Error("Expected the VM to be returned to the pool")
+			}
+		})
+	}
+}
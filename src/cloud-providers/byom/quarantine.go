@@ -0,0 +1,123 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+const quarantineSweepInterval = 30 * time.Second
+
+// quarantine keeps a released IP from being allocated until the reuse grace period has passed
+func (s *IPAllocationState) quarantine(ip string, releasedAt metav1.Time) {
+	if s.QuarantinedIPs == nil {
+		s.QuarantinedIPs = map[string]metav1.Time{}
+	}
+	s.QuarantinedIPs[ip] = releasedAt
+}
+
+// promoteQuarantinedIPs makes the IPs quarantined for at least gracePeriod available and returns
+// them. Their release time is kept, so the warm window still counts from the release.
+func (s *IPAllocationState) promoteQuarantinedIPs(now time.Time, gracePeriod time.Duration) []string {
+	var promoted []string
+	for ip, releasedAt := range s.QuarantinedIPs {
+		if now.Sub(releasedAt.Time) >= gracePeriod {
+			promoted = append(promoted, ip)
+		}
+	}
+	sort.Strings(promoted)
+
+	for _, ip := range promoted {
+		if s.ReleasedAt == nil {
+			s.ReleasedAt = map[string]metav1.Time{}
+		}
+		s.ReleasedAt[ip] = s.QuarantinedIPs[ip]
+		s.AvailableIPs = append(s.AvailableIPs, ip)
+		delete(s.QuarantinedIPs, ip)
+	}
+	if len(s.QuarantinedIPs) == 0 {
+		s.QuarantinedIPs = nil
+	}
+	return promoted
+}
+
+// promoteQuarantinedIPs makes the IPs whose grace period has expired available in state, which the
+// caller writes back
+func (cm *ConfigMapVMPoolManager) promoteQuarantinedIPs(state *IPAllocationState) []string {
+	promoted := state.promoteQuarantinedIPs(cm.now().Time, cm.config.ReuseGracePeriod)
+	if len(promoted) > 0 {
+		logger.Printf("Reuse grace period expired for IPs %v, making them available", promoted)
+	}
+	return promoted
+}
+
+// PromoteQuarantinedIPs makes the released IPs whose reuse grace period has expired available
+// and returns how many were. The local mutex doesn't serialize the replicas, so the promoted
+// state is written only if the ConfigMap is still at the ResourceVersion it was computed from,
+// and computed again from the updated ConfigMap on a conflict.
+func (cm *ConfigMapVMPoolManager) PromoteQuarantinedIPs(ctx context.Context) (int, error) {
+	if cm.config.ReadOnly {
+		return 0, fmt.Errorf("%w: cannot promote quarantined IPs", ErrReadOnly)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cm.config.OperationTimeout)
+	defer cancel()
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	var promoted []string
+	var getErr error
+	err := retry.RetryOnConflict(cm.conflictBackoff(), func() error {
+		state, resourceVersion, err := cm.getCurrentState(ctx)
+		if err != nil {
+			getErr = err
+			return nil
+		}
+
+		promoted = cm.promoteQuarantinedIPs(state)
+		if len(promoted) == 0 {
+			return nil
+		}
+
+		state.LastUpdated = cm.now()
+		state.Version = state.Version + 1
+		err = cm.compareAndSwapState(ctx, state, resourceVersion)
+		if errors.IsConflict(err) {
+			logger.Printf("State was updated concurrently while promoting quarantined IPs, promoting them again")
+		}
+		return err
+	})
+	if getErr != nil {
+		return 0, fmt.Errorf("%w: %w", ErrRetrievingPoolState, getErr)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrUpdatingPoolState, err)
+	}
+
+	return len(promoted), nil
+}
+
+// sweepQuarantinedIPs promotes the expired quarantined IPs periodically. The allocations promote
+// them too, the sweep keeps the ConfigMap and the metrics up to date while no pod is created.
+func sweepQuarantinedIPs(ctx context.Context, poolMgr GlobalVMPoolManager, interval time.Duration, clock provider.Clock) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(interval):
+			if _, err := poolMgr.PromoteQuarantinedIPs(ctx); err != nil {
+				logger.Printf("Warning: failed to promote quarantined IPs: %v", err)
+			}
+		}
+	}
+}
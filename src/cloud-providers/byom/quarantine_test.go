@@ -0,0 +1,246 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/providertest"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+const testGracePeriod = 2 * time.Minute
+
+func newQuarantineTestManager(t *testing.T, client kubernetes.Interface, clock *providertest.FakeClock) *ConfigMapVMPoolManager {
+	t.Helper()
+
+	manager, err := NewConfigMapVMPoolManager(client, &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10", "192.168.1.11"},
+		OperationTimeout: 10 * time.Second,
+		SkipVMReadiness:  true, // Skip VM readiness checks in tests
+		ReuseGracePeriod: testGracePeriod,
+		Clock:            clock,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+	return manager.(*ConfigMapVMPoolManager)
+}
+
+func readTestState(t *testing.T, client kubernetes.Interface) IPAllocationState {
+	t.Helper()
+
+	cm, err := client.CoreV1().ConfigMaps("test-namespace").Get(context.Background(), "test-configmap", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get ConfigMap: %v", err)
+	}
+	var state IPAllocationState
+	if err := json.Unmarshal([]byte(cm.Data[stateDataKey]), &state); err != nil {
+		t.Fatalf("Failed to unmarshal state: %v", err)
+	}
+	return state
+}
+
+func TestConfigMapVMPoolManagerReuseGracePeriod(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	clock := providertest.NewFakeClock()
+	manager := newQuarantineTestManager(t, client, clock)
+
+	ip, err := manager.AllocateIP(ctx, "sandbox-0", "pod-0")
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	if _, err := manager.AllocateIP(ctx, "sandbox-1", "pod-1"); err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	if err := manager.DeallocateIP(ctx, "sandbox-0"); err != nil {
+		t.Fatalf("Failed to deallocate IP: %v", err)
+	}
+
+	// The just released IP can't be allocated again
+	if _, err := manager.AllocateIP(ctx, "sandbox-2", "pod-2"); !stderrors.Is(err, ErrNoAvailableIPs) {
+		t.Fatalf("Expected %v, got %v", ErrNoAvailableIPs, err)
+	}
+	if _, ok, err := manager.DryRunAllocate(ctx, "sandbox-2"); err != nil || ok {
+		t.Errorf("Expected no capacity while the IP is quarantined, got %v (err=%v)", ok, err)
+	}
+	if total, available, inUse, err := manager.GetPoolStatus(ctx); err != nil || total != 2 || available != 0 || inUse != 1 {
+		t.Errorf("Expected 2 total, 0 available and 1 in use, got %d, %d and %d (err=%v)", total, available, inUse, err)
+	}
+	if state := readTestState(t, client); len(state.QuarantinedIPs) != 1 || len(state.AvailableIPs) != 0 {
+		t.Errorf("Expected %s to be quarantined, got available %v and quarantined %v", ip, state.AvailableIPs, state.QuarantinedIPs)
+	}
+
+	clock.Advance(testGracePeriod - time.Second)
+	if _, err := manager.AllocateIP(ctx, "sandbox-2", "pod-2"); !stderrors.Is(err, ErrNoAvailableIPs) {
+		t.Fatalf("Expected %v before the grace period expires, got %v", ErrNoAvailableIPs, err)
+	}
+
+	// Once the grace period has expired, the allocation promotes the IP
+	clock.Advance(time.Second)
+	reused, err := manager.AllocateIP(ctx, "sandbox-2", "pod-2")
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	if reused != ip {
+		t.Errorf("Expected the released IP %s to be allocated, got %s", ip, reused)
+	}
+	if state := readTestState(t, client); len(state.QuarantinedIPs) != 0 {
+		t.Errorf("Expected no quarantined IPs, got %v", state.QuarantinedIPs)
+	}
+}
+
+func TestSweepQuarantinedIPs(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	clock := providertest.NewFakeClock()
+	manager := newQuarantineTestManager(t, client, clock)
+
+	ip, err := manager.AllocateIP(ctx, "sandbox-0", "pod-0")
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	if err := manager.DeallocateIP(ctx, "sandbox-0"); err != nil {
+		t.Fatalf("Failed to deallocate IP: %v", err)
+	}
+
+	sweepCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sweepQuarantinedIPs(sweepCtx, manager, quarantineSweepInterval, clock)
+	}()
+
+	// A sweep before the grace period has expired leaves the IP quarantined
+	<-clock.Waiting()
+	clock.Advance(quarantineSweepInterval)
+	<-clock.Waiting()
+	if state := readTestState(t, client); len(state.QuarantinedIPs) != 1 || len(state.AvailableIPs) != 1 {
+		t.Errorf("Expected 1 quarantined and 1 available IP, got %v and %v", state.QuarantinedIPs, state.AvailableIPs)
+	}
+
+	clock.Advance(testGracePeriod)
+	<-clock.Waiting()
+	state := readTestState(t, client)
+	if len(state.QuarantinedIPs) != 0 || len(state.AvailableIPs) != 2 {
+		t.Errorf("Expected the IP to be promoted, got quarantined %v and available %v", state.QuarantinedIPs, state.AvailableIPs)
+	}
+	if _, ok := state.ReleasedAt[ip.String()]; !ok {
+		t.Errorf("Expected the release time of the promoted IP to be kept, got %v", state.ReleasedAt)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestPromoteQuarantinedIPsConflict(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	clock := providertest.NewFakeClock()
+	manager := newQuarantineTestManager(t, client, clock)
+
+	ip, err := manager.AllocateIP(ctx, "sandbox-0", "pod-0")
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	if err := manager.DeallocateIP(ctx, "sandbox-0"); err != nil {
+		t.Fatalf("Failed to deallocate IP: %v", err)
+	}
+	clock.Advance(testGracePeriod)
+
+	// Another replica allocates the other IP while this one promotes the quarantined IP
+	updates := 0
+	client.PrependReactor("update", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		updates++
+		if updates > 1 {
+			return false, nil, nil
+		}
+
+		// The reactors run with the client locked, the tracker is used directly
+		configMap, err := client.Tracker().Get(v1.SchemeGroupVersion.WithResource("configmaps"), "test-namespace", "test-configmap")
+		if err != nil {
+			return true, nil, err
+		}
+		updated := configMap.(*v1.ConfigMap).DeepCopy()
+		var state IPAllocationState
+		if err := json.Unmarshal([]byte(updated.Data[stateDataKey]), &state); err != nil {
+			return true, nil, err
+		}
+		state.AllocatedIPs["sandbox-1"] = IPAllocation{AllocationID: "sandbox-1", IP: state.AvailableIPs[0], NodeName: "other-node", PodName: "pod-1"}
+		state.AvailableIPs = nil
+		data, err := json.Marshal(state)
+		if err != nil {
+			return true, nil, err
+		}
+		updated.Data[stateDataKey] = string(data)
+		updated.ResourceVersion = "2"
+		if err := client.Tracker().Update(v1.SchemeGroupVersion.WithResource("configmaps"), updated, "test-namespace"); err != nil {
+			return true, nil, err
+		}
+		return true, nil, errors.NewConflict(v1.Resource("configmaps"), "test-configmap", stderrors.New("updated concurrently"))
+	})
+
+	promoted, err := manager.PromoteQuarantinedIPs(ctx)
+	if err != nil || promoted != 1 {
+		t.Fatalf("Expected 1 promoted IP, got %d (err=%v)", promoted, err)
+	}
+
+	// The promotion was computed again, keeping the allocation of the other replica
+	state := readTestState(t, client)
+	if _, ok := state.AllocatedIPs["sandbox-1"]; !ok {
+		t.Errorf("Expected the allocation of the other replica to be kept, got %v", state.AllocatedIPs)
+	}
+	if len(state.AvailableIPs) != 1 || state.AvailableIPs[0] != ip.String() || len(state.QuarantinedIPs) != 0 {
+		t.Errorf("Expected only %s to be available, got available %v and quarantined %v", ip, state.AvailableIPs, state.QuarantinedIPs)
+	}
+}
+
+func TestRecoverStateKeepsQuarantine(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	clock := providertest.NewFakeClock()
+	manager := newQuarantineTestManager(t, client, clock)
+
+	ip, err := manager.AllocateIP(ctx, "sandbox-0", "pod-0")
+	if err != nil {
+		t.Fatalf("Failed to allocate IP: %v", err)
+	}
+	if err := manager.DeallocateIP(ctx, "sandbox-0"); err != nil {
+		t.Fatalf("Failed to deallocate IP: %v", err)
+	}
+
+	// A restarted adaptor doesn't make the quarantined IP available
+	if err := newQuarantineTestManager(t, client, clock).RecoverState(ctx, nil); err != nil {
+		t.Fatalf("Failed to recover state: %v", err)
+	}
+	state := readTestState(t, client)
+	if _, ok := state.QuarantinedIPs[ip.String()]; !ok || len(state.AvailableIPs) != 1 {
+		t.Errorf("Expected %s to stay quarantined, got quarantined %v and available %v", ip, state.QuarantinedIPs, state.AvailableIPs)
+	}
+}
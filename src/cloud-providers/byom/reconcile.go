@@ -0,0 +1,47 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+// Reconcile returns to the pool the VMs allocated from this node that no sandbox uses
+func (p *byomProvider) Reconcile(ctx context.Context, inUse map[string]bool) error {
+	if p.serviceConfig.PoolReadOnly {
+		return nil
+	}
+
+	currentNode, err := getCurrentNodeName()
+	if err != nil {
+		return err
+	}
+
+	allocations, err := p.globalPoolMgr.ListAllocatedIPs(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for allocationID, allocation := range allocations {
+		if allocation.NodeName != currentNode || !p.ownsAllocation(allocationID) || inUse[allocation.IP] {
+			continue
+		}
+		if p.getClock().Now().Sub(allocation.AllocatedAt.Time) < provider.ReconcileGracePeriod {
+			continue
+		}
+
+		logger.Printf("Reconcile: returning VM %s (allocation ID: %s, pod: %s) to the pool, no sandbox uses it",
+			allocation.IP, allocationID, allocation.PodName)
+		if err := p.DeleteInstance(ctx, allocation.IP); err != nil {
+			errs = append(errs, fmt.Errorf("returning orphaned VM %s to the pool: %w", allocation.IP, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
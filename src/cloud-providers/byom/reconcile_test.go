@@ -0,0 +1,147 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/providertest"
+	"golang.org/x/crypto/ssh"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReconcile(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10", "192.168.1.11", "192.168.1.12", "192.168.1.13"},
+		OperationTimeout: 10 * time.Second,
+	}
+
+	old := metav1.NewTime(time.Now().Add(-time.Hour))
+	state := &IPAllocationState{
+		AllocatedIPs: map[string]IPAllocation{
+			"inuse-sandbox":    {AllocationID: "inuse-sandbox", IP: "192.168.1.10", NodeName: "test-node", PodName: "inuse", AllocatedAt: old},
+			"orphan-sandbox":   {AllocationID: "orphan-sandbox", IP: "192.168.1.11", NodeName: "test-node", PodName: "orphan", AllocatedAt: old},
+			"creating-sandbox": {AllocationID: "creating-sandbox", IP: "192.168.1.12", NodeName: "test-node", PodName: "creating", AllocatedAt: metav1.Now()},
+			"other-sandbox":    {AllocationID: "other-sandbox", IP: "192.168.1.13", NodeName: "other-node", PodName: "other", AllocatedAt: old},
+		},
+		AvailableIPs: []string{},
+		LastUpdated:  metav1.Now(),
+		Version:      1,
+	}
+	stateBytes, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("Failed to marshal state: %v", err)
+	}
+
+	client := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: config.ConfigMapName, Namespace: config.Namespace},
+		Data:       map[string]string{stateDataKey: string(stateBytes)},
+	})
+	poolMgr, err := NewConfigMapVMPoolManager(client, config)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	transport := &recordingTransport{}
+	p := &byomProvider{
+		serviceConfig: &Config{},
+		globalPoolMgr: poolMgr,
+		sshConfig:     &ssh.ClientConfig{},
+		transport:     transport,
+	}
+
+	ctx := context.Background()
+	if err := p.Reconcile(ctx, map[string]bool{"192.168.1.10": true}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	allocations, err := poolMgr.ListAllocatedIPs(ctx)
+	if err != nil {
+		t.Fatalf("ListAllocatedIPs() error = %v", err)
+	}
+	var remaining []string
+	for id := range allocations {
+		remaining = append(remaining, id)
+	}
+	sort.Strings(remaining)
+
+	// Only the orphan allocated from this node long enough ago is returned to the pool
+	if want := []string{"creating-sandbox", "inuse-sandbox", "other-sandbox"}; !reflect.DeepEqual(remaining, want) {
+		t.Errorf("Expected allocations %v to remain, got %v", want, remaining)
+	}
+	if want := []string{rebootFile}; !reflect.DeepEqual(transport.sent, want) {
+		t.Errorf("Expected the orphan to be rebooted, got files %v sent", transport.sent)
+	}
+}
+
+func TestReconcileGracePeriod(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	clock := providertest.NewFakeClock()
+	poolMgr, err := NewConfigMapVMPoolManager(fake.NewSimpleClientset(), &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10"},
+		OperationTimeout: 10 * time.Second,
+		Clock:            clock,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := poolMgr.AllocateIP(ctx, "orphan-sandbox", "orphan"); err != nil {
+		t.Fatalf("AllocateIP() error = %v", err)
+	}
+	allocations, err := poolMgr.ListAllocatedIPs(ctx)
+	if err != nil {
+		t.Fatalf("ListAllocatedIPs() error = %v", err)
+	}
+	if allocatedAt := allocations["orphan-sandbox"].AllocatedAt.Time; !allocatedAt.Equal(clock.Now()) {
+		t.Fatalf("Expected the allocation time to come from the clock, got %v", allocatedAt)
+	}
+
+	transport := &recordingTransport{}
+	p := &byomProvider{
+		serviceConfig: &Config{},
+		globalPoolMgr: poolMgr,
+		sshConfig:     &ssh.ClientConfig{},
+		transport:     transport,
+		clock:         clock,
+	}
+
+	// Within the grace period, the sandbox may still be being created
+	clock.Advance(provider.ReconcileGracePeriod - time.Second)
+	if err := p.Reconcile(ctx, nil); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if _, _, inUse, _ := poolMgr.GetPoolStatus(ctx); inUse != 1 {
+		t.Fatalf("Expected the allocation to be kept within the grace period, got %d in use", inUse)
+	}
+
+	clock.Advance(time.Second)
+	if err := p.Reconcile(ctx, nil); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if _, _, inUse, _ := poolMgr.GetPoolStatus(ctx); inUse != 0 {
+		t.Errorf("Expected the stale allocation to be returned to the pool, got %d in use", inUse)
+	}
+	if want := []string{rebootFile}; !reflect.DeepEqual(transport.sent, want) {
+		t.Errorf("Expected the orphan to be rebooted, got files %v sent", transport.sent)
+	}
+}
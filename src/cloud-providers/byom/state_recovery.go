@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"net/netip"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
 )
 
 // RecoverState initializes state from persistent storage
@@ -22,6 +24,11 @@ func (cm *ConfigMapVMPoolManager) RecoverState(ctx context.Context, vmCleanupFun
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
 
+	if cm.config.ReadOnly {
+		logger.Printf("Pool manager is read-only, skipping state recovery")
+		return nil
+	}
+
 	logger.Printf("Starting state recovery for VM pool...")
 
 	// Get current node name
@@ -65,15 +72,34 @@ func (cm *ConfigMapVMPoolManager) RecoverState(ctx context.Context, vmCleanupFun
 	return cm.initializeAndSaveEmptyState(ctx)
 }
 
-// repairStateFromPrimaryConfig rebuilds the state to match the primary configuration from peer-pods-cm
-// AvailableIPs = config.PoolIPs - currently allocated IPs (keeps ALL allocations for PeerPod controller cleanup)
+// repairStateFromPrimaryConfig rebuilds the state to match the primary configuration from peer-pods-cm.
+// The local mutex doesn't serialize the recoveries of several CAA replicas, so the repaired state is
+// written only if the ConfigMap is still at the ResourceVersion it was computed from. On a conflict it
+// is computed again from the updated ConfigMap, keeping the allocations of the other replicas.
 func (cm *ConfigMapVMPoolManager) repairStateFromPrimaryConfig(ctx context.Context) error {
-	// Get current state
-	currentState, _, err := cm.getCurrentState(ctx)
+	err := retry.RetryOnConflict(cm.conflictBackoff(), func() error {
+		currentState, resourceVersion, err := cm.getCurrentState(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get current state for repair: %w", err)
+		}
+
+		err = cm.compareAndSwapState(ctx, cm.repairedState(currentState), resourceVersion)
+		if errors.IsConflict(err) {
+			logger.Printf("State was updated concurrently during repair, repairing it again")
+		}
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get current state for repair: %w", err)
+		return fmt.Errorf("failed to update repaired state: %w", err)
 	}
 
+	logger.Printf("State successfully repaired to match primary configuration - PeerPod controller will handle orphaned allocations")
+	return nil
+}
+
+// repairedState returns currentState rebuilt to match the primary configuration from peer-pods-cm
+// AvailableIPs = config.PoolIPs - currently allocated IPs - quarantined IPs (keeps ALL allocations for PeerPod controller cleanup)
+func (cm *ConfigMapVMPoolManager) repairedState(currentState *IPAllocationState) *IPAllocationState {
 	// Keep ALL existing allocations - let PeerPod controller handle cleanup of orphaned pods
 	// Revisit this if we ever decide to change this approach and want CAA to handle the cleanup instead
 	// of peerpod controller
@@ -86,9 +112,25 @@ func (cm *ConfigMapVMPoolManager) repairStateFromPrimaryConfig(ctx context.Conte
 	}
 
 	availableIPs := []string{}
+	var releasedAt, quarantinedIPs map[string]metav1.Time
 	for _, ip := range cm.config.PoolIPs {
+		// The quarantined IPs still in the pool stay quarantined until their grace period expires
+		if quarantined, ok := currentState.QuarantinedIPs[ip]; ok && !allocatedIPSet[ip] {
+			if quarantinedIPs == nil {
+				quarantinedIPs = map[string]metav1.Time{}
+			}
+			quarantinedIPs[ip] = quarantined
+			continue
+		}
 		if !allocatedIPSet[ip] {
 			availableIPs = append(availableIPs, ip)
+			// Release times are only kept for the IPs still in the pool
+			if released, ok := currentState.ReleasedAt[ip]; ok {
+				if releasedAt == nil {
+					releasedAt = map[string]metav1.Time{}
+				}
+				releasedAt[ip] = released
+			}
 		}
 	}
 
@@ -96,19 +138,18 @@ func (cm *ConfigMapVMPoolManager) repairStateFromPrimaryConfig(ctx context.Conte
 	repairedState := &IPAllocationState{
 		AllocatedIPs: validAllocatedIPs, // Keep all allocations unchanged
 		AvailableIPs: availableIPs,
-		LastUpdated:  metav1.Now(),
+		LastUpdated:  cm.now(),
 		Version:      currentState.Version + 1,
+		LastIPs:      currentState.LastIPs,
+		ReleasedAt:   releasedAt,
+		// Promoted by the next allocation or sweep, even if the grace period was disabled since
+		QuarantinedIPs: quarantinedIPs,
 	}
 
 	logger.Printf("Repairing state: primary config has %d IPs, keeping %d allocated (including orphaned), %d available",
 		len(cm.config.PoolIPs), len(validAllocatedIPs), len(availableIPs))
 
-	if err := cm.updateState(ctx, repairedState); err != nil {
-		return fmt.Errorf("failed to update repaired state: %w", err)
-	}
-
-	logger.Printf("State successfully repaired to match primary configuration - PeerPod controller will handle orphaned allocations")
-	return nil
+	return repairedState
 }
 
 // initializeAndSaveEmptyState creates and saves an empty state
@@ -128,7 +169,7 @@ func (cm *ConfigMapVMPoolManager) initializeEmptyState() *IPAllocationState {
 	return &IPAllocationState{
 		AllocatedIPs: make(map[string]IPAllocation),
 		AvailableIPs: append([]string{}, cm.config.PoolIPs...), // Copy slice
-		LastUpdated:  metav1.Now(),
+		LastUpdated:  cm.now(),
 		Version:      1,
 	}
 }
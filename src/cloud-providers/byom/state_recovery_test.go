@@ -6,12 +6,17 @@ package byom
 import (
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"net/netip"
+	"reflect"
 	"testing"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
 )
 
 func TestConfigMapVMPoolManagerRecoverState(t *testing.T) {
@@ -790,3 +795,104 @@ func TestConfigMapVMPoolManagerPoolIPsChange(t *testing.T) {
 		t.Errorf("Expected preserved allocation IP 192.168.1.10, got %s", allocation.IP)
 	}
 }
+
+func TestConfigMapVMPoolManagerRecoverStateConcurrentUpdate(t *testing.T) {
+	cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	config := &GlobalVMPoolConfig{
+		Namespace:        "test-namespace",
+		ConfigMapName:    "test-configmap",
+		PoolIPs:          []string{"192.168.1.10", "192.168.1.11", "192.168.1.12"},
+		OperationTimeout: 10000,
+		SkipVMReadiness:  true, // Skip VM readiness checks in tests
+	}
+
+	client := fake.NewSimpleClientset()
+
+	newConfigMap := func(state *IPAllocationState) *v1.ConfigMap {
+		stateData, err := json.Marshal(state)
+		if err != nil {
+			t.Fatalf("Failed to marshal state: %v", err)
+		}
+		return &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      config.ConfigMapName,
+				Namespace: config.Namespace,
+			},
+			Data: map[string]string{
+				stateDataKey: string(stateData),
+			},
+		}
+	}
+
+	// The state predates 192.168.1.12 in the pool
+	_, err := client.CoreV1().ConfigMaps(config.Namespace).Create(context.Background(), newConfigMap(&IPAllocationState{
+		AllocatedIPs: map[string]IPAllocation{},
+		AvailableIPs: []string{"192.168.1.10", "192.168.1.11"},
+		LastUpdated:  metav1.Now(),
+		Version:      1,
+	}), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMap: %v", err)
+	}
+
+	manager, err := NewConfigMapVMPoolManager(client, config)
+	if err != nil {
+		t.Fatalf("Failed to create ConfigMapVMPoolManager: %v", err)
+	}
+
+	// Another replica repairs the state and allocates 192.168.1.12 between the read and the
+	// update of the first repair
+	attempts := 0
+	client.PrependReactor("update", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		attempts++
+		if attempts > 1 {
+			return false, nil, nil
+		}
+		concurrent := newConfigMap(&IPAllocationState{
+			AllocatedIPs: map[string]IPAllocation{
+				"other-allocation": {
+					AllocationID: "other-allocation",
+					IP:           "192.168.1.12",
+					AllocatedAt:  metav1.Now(),
+				},
+			},
+			AvailableIPs: []string{"192.168.1.10", "192.168.1.11"},
+			LastUpdated:  metav1.Now(),
+			Version:      3,
+		})
+		if err := client.Tracker().Update(v1.SchemeGroupVersion.WithResource("configmaps"), concurrent, config.Namespace); err != nil {
+			t.Errorf("Failed to update ConfigMap concurrently: %v", err)
+		}
+		return true, nil, errors.NewConflict(v1.Resource("configmaps"), config.ConfigMapName, stderrors.New("the object has been modified"))
+	})
+
+	ctx := context.Background()
+	if err := manager.RecoverState(ctx, nil); err != nil {
+		t.Fatalf("Failed to recover state: %v", err)
+	}
+
+	if attempts != 2 {
+		t.Errorf("Expected 2 update attempts, got %d", attempts)
+	}
+
+	// The repair was computed again, keeping the concurrent allocation
+	allocations, err := manager.ListAllocatedIPs(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list allocations: %v", err)
+	}
+	if allocation, ok := allocations["other-allocation"]; !ok || allocation.IP != "192.168.1.12" {
+		t.Errorf("Expected the concurrent allocation of 192.168.1.12 to be kept, got %v", allocations)
+	}
+
+	state, _, err := manager.(*ConfigMapVMPoolManager).getCurrentState(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if want := []string{"192.168.1.10", "192.168.1.11"}; !reflect.DeepEqual(state.AvailableIPs, want) {
+		t.Errorf("Expected available IPs %v, got %v", want, state.AvailableIPs)
+	}
+	if state.Version != 4 {
+		t.Errorf("Expected version 4, got %d", state.Version)
+	}
+}
@@ -0,0 +1,100 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	fileTransportSFTP = "sftp"
+	fileTransportSCP  = "scp"
+)
+
+// Overridden in tests
+var (
+	sendFileViaSFTP = util.SendFileViaSFTPWithContext
+	sendFileViaSCP  = util.SendFileViaSCPWithContext
+	probeSFTP       = util.ProbeSFTPWithContext
+	probeSSH        = util.ProbeSSHWithContext
+)
+
+// fileTransport copies files such as cloud-init user-data to pool VMs
+type fileTransport interface {
+	SendFile(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePath string, content []byte) error
+	Probe(ctx context.Context, address string, sshConfig *ssh.ClientConfig) error
+}
+
+// sftpTransport uses the SFTP subsystem, which the pod VM image chroots to /media
+type sftpTransport struct{}
+
+func (sftpTransport) SendFile(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePath string, content []byte) error {
+	// Strip /media prefix for chrooted SFTP (SFTP server chroots to /media)
+	adjustedPath := strings.TrimPrefix(remotePath, "/media/")
+	if err := sendFileViaSFTP(ctx, address, sshConfig, adjustedPath, content); err != nil {
+		if isPermissionDenied(err) {
+			err = fmt.Errorf("%w: %v", ErrPermissionDenied, err)
+		}
+		return &SFTPError{IP: hostOf(address), RemotePath: remotePath, Op: SFTPOpSend, Err: err}
+	}
+	return nil
+}
+
+// hostOf returns the host of address, or address if it has no port
+func hostOf(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+// isPermissionDenied returns whether err is an SFTP permission denied status. The SFTP client
+// maps it to os.ErrPermission for some requests only, e.g. not for writes.
+func isPermissionDenied(err error) bool {
+	if errors.Is(err, os.ErrPermission) {
+		return true
+	}
+	var statusErr *sftp.StatusError
+	return errors.As(err, &statusErr) && statusErr.FxCode() == sftp.ErrSSHFxPermissionDenied
+}
+
+func (sftpTransport) Probe(ctx context.Context, address string, sshConfig *ssh.ClientConfig) error {
+	if err := probeSFTP(ctx, address, sshConfig); err != nil {
+		return &SFTPError{IP: hostOf(address), Op: SFTPOpProbe, Err: err}
+	}
+	return nil
+}
+
+// scpTransport runs scp over an SSH exec session for images without the SFTP subsystem.
+// Exec sessions aren't chrooted, so remote paths are used as is.
+type scpTransport struct{}
+
+func (scpTransport) SendFile(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePath string, content []byte) error {
+	return sendFileViaSCP(ctx, address, sshConfig, remotePath, content)
+}
+
+func (scpTransport) Probe(ctx context.Context, address string, sshConfig *ssh.ClientConfig) error {
+	return probeSSH(ctx, address, sshConfig)
+}
+
+// newFileTransport returns the transport with the given name, defaulting to SFTP
+func newFileTransport(name string) (fileTransport, error) {
+	switch name {
+	case "", fileTransportSFTP:
+		return sftpTransport{}, nil
+	case fileTransportSCP:
+		return scpTransport{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q (supported: %s, %s)", ErrInvalidFileTransport, name, fileTransportSFTP, fileTransportSCP)
+	}
+}
@@ -0,0 +1,186 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package byom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFileTransportSelection(t *testing.T) {
+	oldSFTP, oldSCP := sendFileViaSFTP, sendFileViaSCP
+	defer func() {
+		sendFileViaSFTP, sendFileViaSCP = oldSFTP, oldSCP
+	}()
+
+	var called, gotPath string
+	sendFileViaSFTP = func(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePath string, content []byte) error {
+		called, gotPath = fileTransportSFTP, remotePath
+		return nil
+	}
+	sendFileViaSCP = func(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePath string, content []byte) error {
+		called, gotPath = fileTransportSCP, remotePath
+		return nil
+	}
+
+	tests := []struct {
+		name      string
+		transport string
+		wantCall  string
+		wantPath  string
+	}{
+		{
+			name:      "default is sftp",
+			transport: "",
+			wantCall:  fileTransportSFTP,
+			wantPath:  "cidata/user-data",
+		},
+		{
+			name:      "sftp",
+			transport: fileTransportSFTP,
+			wantCall:  fileTransportSFTP,
+			wantPath:  "cidata/user-data",
+		},
+		{
+			name:      "scp",
+			transport: fileTransportSCP,
+			wantCall:  fileTransportSCP,
+			wantPath:  userDataFile,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called, gotPath = "", ""
+
+			transport, err := newFileTransport(tt.transport)
+			if err != nil {
+				t.Fatalf("newFileTransport() error = %v", err)
+			}
+			p := &byomProvider{
+				serviceConfig: &Config{FileTransport: tt.transport},
+				sshConfig:     &ssh.ClientConfig{},
+				transport:     transport,
+			}
+
+			if err := p.sendConfigFile(context.Background(), "#cloud-config", netip.MustParseAddr("192.168.1.10")); err != nil {
+				t.Fatalf("sendConfigFile() error = %v", err)
+			}
+			if called != tt.wantCall {
+				t.Errorf("Expected %s transport to be used, got %q", tt.wantCall, called)
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("Expected remote path %s, got %s", tt.wantPath, gotPath)
+			}
+		})
+	}
+}
+
+func TestSendConfigFilePermissionDenied(t *testing.T) {
+	oldSFTP := sendFileViaSFTP
+	defer func() {
+		sendFileViaSFTP = oldSFTP
+	}()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantDenied bool
+	}{
+		{
+			name:       "EACCES creating the file",
+			err:        fmt.Errorf("failed to create file cidata/user-data: %w", &os.PathError{Op: "open", Path: "cidata/user-data", Err: syscall.EACCES}),
+			wantDenied: true,
+		},
+		{
+			name:       "permission denied status writing the file",
+			err:        fmt.Errorf("failed to write content: %w", &sftp.StatusError{Code: uint32(sftp.ErrSSHFxPermissionDenied)}),
+			wantDenied: true,
+		},
+		{
+			name: "connection refused",
+			err:  fmt.Errorf("failed to connect to 192.168.1.10:22: %w", syscall.ECONNREFUSED),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sendFileViaSFTP = func(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePath string, content []byte) error {
+				return tt.err
+			}
+			p := &byomProvider{
+				serviceConfig: &Config{SSHUserName: "peerpod"},
+				sshConfig:     &ssh.ClientConfig{},
+				transport:     sftpTransport{},
+			}
+
+			err := p.sendConfigFile(context.Background(), "#cloud-config", netip.MustParseAddr("192.168.1.10"))
+			if err == nil {
+				t.Fatal("Expected an error, got nil")
+			}
+			if denied := errors.Is(err, ErrPermissionDenied); denied != tt.wantDenied {
+				t.Fatalf("Expected ErrPermissionDenied %v, got %v", tt.wantDenied, err)
+			}
+			if tt.wantDenied && !strings.Contains(err.Error(), `SSH user "peerpod"`) {
+				t.Errorf("Expected the error to name the SSH user, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileTransportInvalid(t *testing.T) {
+	if _, err := newFileTransport("rsync"); !errors.Is(err, ErrInvalidFileTransport) {
+		t.Errorf("Expected ErrInvalidFileTransport, got %v", err)
+	}
+}
+
+func TestSFTPError(t *testing.T) {
+	oldSFTP, oldProbe := sendFileViaSFTP, probeSFTP
+	defer func() {
+		sendFileViaSFTP, probeSFTP = oldSFTP, oldProbe
+	}()
+
+	connErr := fmt.Errorf("failed to connect to 192.168.1.10:22: %w", syscall.ECONNREFUSED)
+	sendFileViaSFTP = func(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePath string, content []byte) error {
+		return connErr
+	}
+	probeSFTP = func(ctx context.Context, address string, sshConfig *ssh.ClientConfig) error {
+		return connErr
+	}
+
+	p := &byomProvider{
+		serviceConfig: &Config{SSHUserName: "peerpod"},
+		sshConfig:     &ssh.ClientConfig{},
+		transport:     sftpTransport{},
+	}
+
+	err := p.sendConfigFile(context.Background(), "#cloud-config", netip.MustParseAddr("192.168.1.10"))
+	var sftpErr *SFTPError
+	if !errors.As(err, &sftpErr) {
+		t.Fatalf("Expected an SFTPError, got %v", err)
+	}
+	if sftpErr.IP != "192.168.1.10" || sftpErr.RemotePath != userDataFile || sftpErr.Op != SFTPOpSend {
+		t.Errorf("Expected IP 192.168.1.10, remote path %s and op %s, got %+v", userDataFile, SFTPOpSend, sftpErr)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("Expected the SFTPError to wrap the connection error, got %v", err)
+	}
+
+	err = sftpTransport{}.Probe(context.Background(), "[fd00::10]:22", &ssh.ClientConfig{})
+	if !errors.As(err, &sftpErr) {
+		t.Fatalf("Expected an SFTPError, got %v", err)
+	}
+	if sftpErr.IP != "fd00::10" || sftpErr.RemotePath != "" || sftpErr.Op != SFTPOpProbe {
+		t.Errorf("Expected IP fd00::10, no remote path and op %s, got %+v", SFTPOpProbe, sftpErr)
+	}
+}
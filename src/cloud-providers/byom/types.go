@@ -8,11 +8,15 @@ import (
 	"fmt"
 	"log"
 	"net/netip"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 // vmPoolIPs represents a flag for VM pool IP addresses
@@ -87,6 +91,46 @@ func (v *vmPoolIPs) Set(value string) error {
 	return nil
 }
 
+// namespaceQuotas represents a flag for the maximum number of VMs each namespace can hold
+type namespaceQuotas map[string]int
+
+// String returns the string representation of the namespaceQuotas
+func (q *namespaceQuotas) String() string {
+	var pairs []string
+	for namespace, quota := range *q {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", namespace, quota))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set parses namespace=quota pairs separated by commas
+func (q *namespaceQuotas) Set(value string) error {
+	if *q == nil {
+		*q = make(namespaceQuotas)
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		namespace, quotaStr, found := strings.Cut(entry, "=")
+		namespace = strings.TrimSpace(namespace)
+		if !found || namespace == "" {
+			return fmt.Errorf("invalid namespace quota %q: expected namespace=quota", entry)
+		}
+		quota, err := strconv.Atoi(strings.TrimSpace(quotaStr))
+		if err != nil || quota < 0 {
+			return fmt.Errorf("invalid namespace quota %q: quota must be a non-negative integer", entry)
+		}
+		(*q)[namespace] = quota
+	}
+
+	return nil
+}
+
 // Config holds the BYOM provider configuration
 type Config struct {
 	VMPoolIPs              vmPoolIPs // VM pool IP addresses (required)
@@ -97,10 +141,42 @@ type Config struct {
 	SSHPrivKey             string    // SSH private key content (populated from file)
 	SSHTimeout             int       // SSH connection timeout in seconds
 	SSHHostKeyAllowlistDir string    // Directory containing allowed SSH host key files (enables allowlist mode if set)
+	FileTransport          string    // How files are copied to VMs: "sftp" (default) or "scp" over SSH exec
+	ResetOnAllocate        bool      // Reboot VMs on allocation too, before the user-data is sent
+	AllowSkipReboot        bool      // Honor the skip-reboot pod annotation, which releases VMs without rebooting them
 
 	// Pool management configuration
-	PoolNamespace     string // Namespace for ConfigMap storage (default: auto-detect from running pod)
-	PoolConfigMapName string // ConfigMap name for state storage (default: "byom-ip-pool-state")
+	PoolNamespace     string          // Namespace for ConfigMap storage (default: auto-detect from running pod)
+	PoolConfigMapName string          // ConfigMap name for state storage (default: "byom-ip-pool-state")
+	AuditHistorySize  int             // Number of allocation events kept in the "<PoolConfigMapName>-audit" ConfigMap, 0 disables it
+	NamespaceQuotas   namespaceQuotas // Maximum number of VMs allocated to each listed namespace, other namespaces are not limited
+
+	// Pool health endpoint
+	PoolHealthListenAddr string // Listen address for the pool health endpoint (disabled if empty)
+
+	// Startup reachability sweep
+	PoolStartupProbe      bool // Probe every pool VM at startup and log the unreachable ones
+	PoolStartupMinHealthy int  // Fail startup if less than this percentage of the pool VMs is reachable (0 never fails, implies PoolStartupProbe otherwise)
+
+	// ClusterID prefixes the allocation IDs, so that clusters mistakenly sharing a pool ConfigMap
+	// don't release each other's VMs (allocation IDs are not prefixed if empty)
+	ClusterID string
+
+	// PoolReadOnly only reads the pool state, e.g. to inspect a production ConfigMap during an
+	// incident. Creating and deleting instances fails.
+	PoolReadOnly bool
+
+	// PoolWarmWindow is how long in seconds a released VM is preferred for the next allocation,
+	// as it is likely still warm (0 disables the preference)
+	PoolWarmWindow int
+
+	// PoolReuseGracePeriod is how long in seconds a released VM is quarantined before it can be
+	// allocated again, e.g. while it still cleans up after the previous pod (0 disables it)
+	PoolReuseGracePeriod int
+
+	// ShredOnDelete sends a shred trigger file to the VMs before they are released, for pod VM
+	// images that then shred the secrets of the pod
+	ShredOnDelete bool
 }
 
 // Redact returns a copy of the config with sensitive information redacted
@@ -120,10 +196,37 @@ type GlobalVMPoolConfig struct {
 	// Retry configuration
 	MaxRetries    int
 	RetryInterval time.Duration
+	// Backoff between the retries of the state updates conflicting with another node,
+	// its Steps, Duration, Factor and Cap can be tuned for the contention expected.
+	// As with any wait.Backoff, the retries stop once the wait reaches Cap
+	// (default: retry.DefaultBackoff, used if Steps is 0)
+	ConflictBackoff wait.Backoff
 
 	// Timeout configuration
 	OperationTimeout time.Duration
 
+	// Allocation audit trail configuration
+	AuditConfigMapName string // ConfigMap holding the allocation history (default: ConfigMapName + "-audit")
+	AuditHistorySize   int    // Number of allocation events kept, 0 disables the audit trail
+
+	// Maximum number of IPs allocated to pods of each listed namespace
+	NamespaceQuotas map[string]int
+
+	// Gauges updated with each state read or written (disabled if nil)
+	Metrics *PoolMetrics
+
+	// Refuse any change of the pool state, only reads are served
+	ReadOnly bool
+
+	// Prefer the IPs released within this window over the ones idle for longer (disabled if 0)
+	WarmWindow time.Duration
+
+	// Keep the released IPs from being allocated again for this long (disabled if 0)
+	ReuseGracePeriod time.Duration
+
+	// Clock timestamping allocations and state updates (default: the system clock)
+	Clock provider.Clock
+
 	// Test configuration
 	SkipVMReadiness bool // Skip VM readiness checks (for testing)
 }
@@ -133,6 +236,9 @@ type GlobalVMPoolManager interface {
 	// AllocateIP allocates an IP from the global pool
 	AllocateIP(ctx context.Context, allocationID string, podName string) (netip.Addr, error)
 
+	// DryRunAllocate reports the IP AllocateIP would select and whether capacity exists, without side effects
+	DryRunAllocate(ctx context.Context, allocationID string) (netip.Addr, bool, error)
+
 	// DeallocateIP returns an IP to the global pool
 	DeallocateIP(ctx context.Context, allocationID string) error
 
@@ -150,6 +256,12 @@ type GlobalVMPoolManager interface {
 
 	// ListAllocatedIPs returns all currently allocated IPs
 	ListAllocatedIPs(ctx context.Context) (map[string]IPAllocation, error)
+
+	// GetAllocationHistory returns the most recent allocate and deallocate events, newest first
+	GetAllocationHistory(ctx context.Context, limit int) ([]AllocationEvent, error)
+
+	// PromoteQuarantinedIPs makes the released IPs whose reuse grace period has expired available
+	PromoteQuarantinedIPs(ctx context.Context) (int, error)
 }
 
 // IPAllocation represents an allocated IP address
@@ -158,6 +270,7 @@ type IPAllocation struct {
 	IP           string      `json:"ip"`
 	NodeName     string      `json:"nodeName"` // Track which node allocated this IP
 	PodName      string      `json:"podName"`  // For better tracking and debugging
+	PodNamespace string      `json:"podNamespace,omitempty"`
 	AllocatedAt  metav1.Time `json:"allocatedAt"`
 }
 
@@ -167,4 +280,64 @@ type IPAllocationState struct {
 	AvailableIPs []string                `json:"availableIPs"`
 	LastUpdated  metav1.Time             `json:"lastUpdated"`
 	Version      int64                   `json:"version"` // For optimistic locking
+	// LastIPs maps a pod to the IP it was last allocated, so that a restarted pod gets its VM back
+	LastIPs map[string]string `json:"lastIPs,omitempty"`
+	// ReleasedAt maps the available IPs to the time they were last released, if ever
+	ReleasedAt map[string]metav1.Time `json:"releasedAt,omitempty"`
+	// QuarantinedIPs maps the released IPs not available yet to the time they were released
+	QuarantinedIPs map[string]metav1.Time `json:"quarantinedIPs,omitempty"`
+}
+
+// clone returns a deep copy of the state, nil for a nil state
+func (s *IPAllocationState) clone() *IPAllocationState {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.AllocatedIPs = make(map[string]IPAllocation, len(s.AllocatedIPs))
+	for id, allocation := range s.AllocatedIPs {
+		c.AllocatedIPs[id] = allocation
+	}
+	c.AvailableIPs = append([]string{}, s.AvailableIPs...)
+	if s.LastIPs != nil {
+		c.LastIPs = make(map[string]string, len(s.LastIPs))
+		for pod, ip := range s.LastIPs {
+			c.LastIPs[pod] = ip
+		}
+	}
+	if s.ReleasedAt != nil {
+		c.ReleasedAt = make(map[string]metav1.Time, len(s.ReleasedAt))
+		for ip, releasedAt := range s.ReleasedAt {
+			c.ReleasedAt[ip] = releasedAt
+		}
+	}
+	if s.QuarantinedIPs != nil {
+		c.QuarantinedIPs = make(map[string]metav1.Time, len(s.QuarantinedIPs))
+		for ip, releasedAt := range s.QuarantinedIPs {
+			c.QuarantinedIPs[ip] = releasedAt
+		}
+	}
+	return &c
+}
+
+// affinityKey identifies a pod across restarts, unlike the allocation ID which includes the sandbox ID
+func affinityKey(podNamespace, podName string) string {
+	if podNamespace == "" {
+		return podName
+	}
+	return podNamespace + "/" + podName
+}
+
+// rememberPodIP records the IP allocated to a pod. An IP is only remembered for the last pod
+// it was allocated to, which bounds LastIPs to the pool size.
+func (s *IPAllocationState) rememberPodIP(podKey, ip string) {
+	if s.LastIPs == nil {
+		s.LastIPs = map[string]string{}
+	}
+	for pod, lastIP := range s.LastIPs {
+		if lastIP == ip {
+			delete(s.LastIPs, pod)
+		}
+	}
+	s.LastIPs[podKey] = ip
 }
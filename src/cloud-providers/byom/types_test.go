@@ -177,3 +177,23 @@ func TestVMPoolIPsValidation(t *testing.T) {
 		t.Errorf("Expected trimmed IPs, got %v", ips)
 	}
 }
+
+func TestNamespaceQuotas(t *testing.T) {
+	var quotas namespaceQuotas
+	if err := quotas.Set("team-a=2, team-b = 0"); err != nil {
+		t.Fatalf("Failed to parse namespace quotas: %v", err)
+	}
+	if quotas["team-a"] != 2 || quotas["team-b"] != 0 || len(quotas) != 2 {
+		t.Errorf("Unexpected namespace quotas: %v", quotas)
+	}
+	if s := quotas.String(); s != "team-a=2,team-b=0" {
+		t.Errorf("Expected team-a=2,team-b=0, got %s", s)
+	}
+
+	for _, invalid := range []string{"team-a", "=2", "team-a=-1", "team-a=two"} {
+		var q namespaceQuotas
+		if err := q.Set(invalid); err == nil {
+			t.Errorf("Expected error for invalid namespace quota %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import "time"
+
+// Clock reads the time and waits for durations. Providers and managers take one instead of
+// calling the time package directly, so that tests can drive intervals, grace periods and
+// backoffs without sleeping. A Clock is also a RetryTimer.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// RealClock is the Clock of the system time
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
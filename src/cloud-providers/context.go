@@ -0,0 +1,71 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import "context"
+
+// Tags recording the pod an instance was created for
+const (
+	PodTagPrefix    = "peerpod-"
+	PodNameTag      = PodTagPrefix + "pod"
+	PodNamespaceTag = PodTagPrefix + "namespace"
+	PodSandboxTag   = PodTagPrefix + "sandbox"
+)
+
+// PodIdentity identifies the pod a provider call is made for
+type PodIdentity struct {
+	Name      string
+	Namespace string
+	SandboxID string
+}
+
+// Tags returns the PodNameTag, PodNamespaceTag and PodSandboxTag tags of the fields that are set
+func (id PodIdentity) Tags() map[string]string {
+	tags := map[string]string{}
+	for k, v := range map[string]string{PodNameTag: id.Name, PodNamespaceTag: id.Namespace, PodSandboxTag: id.SandboxID} {
+		if v != "" {
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
+type podIdentityKey struct{}
+
+type podAnnotationsKey struct{}
+
+// WithPodIdentity returns a copy of ctx carrying the identity of the pod a provider call is
+// made for, so that code deep in the providers can log or tag with it
+func WithPodIdentity(ctx context.Context, id PodIdentity) context.Context {
+	return context.WithValue(ctx, podIdentityKey{}, id)
+}
+
+// PodIdentityFromContext returns the identity set with WithPodIdentity, or an empty one
+func PodIdentityFromContext(ctx context.Context) PodIdentity {
+	id, _ := ctx.Value(podIdentityKey{}).(PodIdentity)
+	return id
+}
+
+// WithPodNamespace returns a copy of ctx carrying the namespace of the pod a provider call is made for
+func WithPodNamespace(ctx context.Context, namespace string) context.Context {
+	id := PodIdentityFromContext(ctx)
+	id.Namespace = namespace
+	return WithPodIdentity(ctx, id)
+}
+
+// PodNamespaceFromContext returns the namespace set with WithPodIdentity or WithPodNamespace, or an empty string
+func PodNamespaceFromContext(ctx context.Context) string {
+	return PodIdentityFromContext(ctx).Namespace
+}
+
+// WithPodAnnotations returns a copy of ctx carrying the sandbox annotations of the pod a provider call is made for
+func WithPodAnnotations(ctx context.Context, annotations map[string]string) context.Context {
+	return context.WithValue(ctx, podAnnotationsKey{}, annotations)
+}
+
+// PodAnnotationsFromContext returns the annotations set with WithPodAnnotations, or nil
+func PodAnnotationsFromContext(ctx context.Context) map[string]string {
+	annotations, _ := ctx.Value(podAnnotationsKey{}).(map[string]string)
+	return annotations
+}
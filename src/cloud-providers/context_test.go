@@ -0,0 +1,36 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPodIdentityContext(t *testing.T) {
+	ctx := context.Background()
+	if got := PodIdentityFromContext(ctx); got != (PodIdentity{}) {
+		t.Errorf("PodIdentityFromContext() = %+v, want an empty identity", got)
+	}
+
+	ctx = WithPodIdentity(ctx, PodIdentity{Name: "web-0", SandboxID: "abc"})
+	ctx = WithPodNamespace(ctx, "team-a")
+
+	want := PodIdentity{Name: "web-0", Namespace: "team-a", SandboxID: "abc"}
+	if got := PodIdentityFromContext(ctx); got != want {
+		t.Errorf("PodIdentityFromContext() = %+v, want %+v", got, want)
+	}
+	if got := PodNamespaceFromContext(ctx); got != "team-a" {
+		t.Errorf("PodNamespaceFromContext() = %q, want %q", got, "team-a")
+	}
+}
+
+func TestPodIdentityTags(t *testing.T) {
+	tags := PodIdentity{Name: "web-0", SandboxID: "abc"}.Tags()
+	want := map[string]string{PodNameTag: "web-0", PodSandboxTag: "abc"}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("Tags() = %v, want %v", tags, want)
+	}
+}
@@ -0,0 +1,30 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrDeleteByNameUnsupported is returned by DeleteInstanceByName for providers that can't
+// find an instance from its name
+var ErrDeleteByNameUnsupported = errors.New("deleting instances by name is not supported")
+
+// NameDeleter is implemented by providers that can delete an instance knowing only its
+// name, for callers that kept the name returned by CreateInstance but not the ID
+type NameDeleter interface {
+	// DeleteInstanceByName finds the ID of the instance named name and deletes it with
+	// DeleteInstance. Like DeleteInstance, it must return nil when no such instance exists.
+	DeleteInstanceByName(ctx context.Context, name string) error
+}
+
+// DeleteInstanceByName deletes the instance named name, if p implements NameDeleter
+func DeleteInstanceByName(ctx context.Context, p Provider, name string) error {
+	deleter, ok := p.(NameDeleter)
+	if !ok {
+		return ErrDeleteByNameUnsupported
+	}
+	return deleter.DeleteInstanceByName(ctx, name)
+}
@@ -0,0 +1,34 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type fakeNameDeleter struct {
+	fakeProvider
+	deleted []string
+}
+
+func (p *fakeNameDeleter) DeleteInstanceByName(ctx context.Context, name string) error {
+	p.deleted = append(p.deleted, name)
+	return nil
+}
+
+func TestDeleteInstanceByName(t *testing.T) {
+	if err := DeleteInstanceByName(context.Background(), &fakeProvider{}, "podvm-1"); !errors.Is(err, ErrDeleteByNameUnsupported) {
+		t.Errorf("expected ErrDeleteByNameUnsupported, got %v", err)
+	}
+
+	p := &fakeNameDeleter{}
+	if err := DeleteInstanceByName(context.Background(), p, "podvm-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(p.deleted) != 1 || p.deleted[0] != "podvm-1" {
+		t.Errorf("expected podvm-1 to be deleted, got %v", p.deleted)
+	}
+}
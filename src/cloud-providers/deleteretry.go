@@ -0,0 +1,138 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultNotFoundRetryWindow is how long after creation a not found error
+	// from a delete call is considered transient
+	DefaultNotFoundRetryWindow = 2 * time.Minute
+
+	defaultNotFoundInitialBackoff = 1 * time.Second
+	defaultNotFoundMaxBackoff     = 16 * time.Second
+)
+
+// RecentInstances remembers when instances were created. Cloud APIs are often eventually
+// consistent, so a delete issued right after creation can report an instance as not found
+// although it exists. Providers use it to tell such an instance apart from one that is
+// really gone. A nil *RecentInstances tracks nothing.
+type RecentInstances struct {
+	window         time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	clock          Clock
+
+	mutex   sync.Mutex
+	created map[string]time.Time
+}
+
+func NewRecentInstances(window time.Duration) *RecentInstances {
+	return &RecentInstances{
+		window:         window,
+		initialBackoff: defaultNotFoundInitialBackoff,
+		maxBackoff:     defaultNotFoundMaxBackoff,
+		clock:          RealClock{},
+		created:        make(map[string]time.Time),
+	}
+}
+
+// SetClock replaces the system clock used for the retry window and the backoffs
+func (r *RecentInstances) SetClock(clock Clock) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.clock = clock
+}
+
+// Add records that the instance was just created
+func (r *RecentInstances) Add(instanceID string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Drop expired entries so that the map doesn't grow with instances that are never deleted
+	now := r.clock.Now()
+	for id, created := range r.created {
+		if now.Sub(created) >= r.window {
+			delete(r.created, id)
+		}
+	}
+	r.created[instanceID] = now
+}
+
+// Remove forgets the instance
+func (r *RecentInstances) Remove(instanceID string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.created, instanceID)
+}
+
+// IsRecent returns true when the instance was created within the retry window
+func (r *RecentInstances) IsRecent(instanceID string) bool {
+	if r == nil {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	created, ok := r.created[instanceID]
+	return ok && r.clock.Now().Sub(created) < r.window
+}
+
+// DeleteWithNotFoundRetry calls deleteFn until it succeeds. A not found error is retried with
+// WithCloudRetry as long as the instance was created within the retry window, and is treated as
+// success otherwise, since the instance is then assumed to be already deleted.
+func (r *RecentInstances) DeleteWithNotFoundRetry(ctx context.Context, instanceID string, deleteFn func(context.Context) error, isNotFound func(error) bool) error {
+	opts := RetryOptions{
+		// Until the instance is no longer recent
+		Attempts:     -1,
+		InitialDelay: defaultNotFoundInitialBackoff,
+		MaxDelay:     defaultNotFoundMaxBackoff,
+		Retryable:    r.deleteRetryable(instanceID, isNotFound),
+		Timer:        RealClock{},
+	}
+	if r != nil {
+		opts.InitialDelay, opts.MaxDelay, opts.Timer = r.initialBackoff, r.maxBackoff, r.clock
+	}
+
+	err := WithCloudRetry(ctx, func(ctx context.Context) error {
+		err := deleteFn(ctx)
+		if err != nil && opts.Retryable(err) {
+			logger.Printf("Instance %s was created recently and is not visible yet, retrying delete", instanceID)
+		}
+		return err
+	}, opts)
+	switch {
+	case err == nil:
+		r.Remove(instanceID)
+		return nil
+	case ctx.Err() != nil:
+		return fmt.Errorf("deleting recently created instance %s: %w", instanceID, err)
+	case isNotFound(err):
+		logger.Printf("Instance %s not found, assuming it is already deleted", instanceID)
+		r.Remove(instanceID)
+		return nil
+	}
+	return err
+}
+
+// deleteRetryable classifies the errors of deleting an instance: only a not found error is
+// retried, as eventual consistency, while the instance was created within the retry window
+func (r *RecentInstances) deleteRetryable(instanceID string, isNotFound func(error) bool) func(error) bool {
+	return func(err error) bool {
+		return isNotFound(err) && r.IsRecent(instanceID)
+	}
+}
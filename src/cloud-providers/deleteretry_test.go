@@ -0,0 +1,154 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/providertest"
+)
+
+var errTestNotFound = errors.New("not found")
+
+func isTestNotFound(err error) bool {
+	return errors.Is(err, errTestNotFound)
+}
+
+func newTestRecentInstances(clock provider.Clock) *provider.RecentInstances {
+	r := provider.NewRecentInstances(time.Minute)
+	r.SetClock(clock)
+	return r
+}
+
+func TestDeleteWithNotFoundRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		recent    bool
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "not found once after creation then deleted",
+			recent:    true,
+			errs:      []error{errTestNotFound, nil},
+			wantCalls: 2,
+		},
+		{
+			name:      "not found for an old instance is already deleted",
+			recent:    false,
+			errs:      []error{errTestNotFound},
+			wantCalls: 1,
+		},
+		{
+			name:      "other errors are not retried",
+			recent:    true,
+			errs:      []error{errors.New("access denied")},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRecentInstances(&providertest.FakeClock{AutoAdvance: true})
+			if tt.recent {
+				r.Add("i-1")
+			}
+
+			calls := 0
+			deleteFn := func(ctx context.Context) error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			}
+
+			err := r.DeleteWithNotFoundRetry(context.Background(), "i-1", deleteFn, isTestNotFound)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeleteWithNotFoundRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("DeleteWithNotFoundRetry() made %d delete calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDeleteWithNotFoundRetryWindowExpires(t *testing.T) {
+	// The default backoffs, the fake clock doesn't actually wait for them
+	clock := providertest.NewFakeClock()
+	clock.AutoAdvance = true
+	r := newTestRecentInstances(clock)
+	r.Add("i-1")
+
+	calls := 0
+	deleteFn := func(ctx context.Context) error {
+		calls++
+		// The instance never shows up, so the window eventually runs out
+		return errTestNotFound
+	}
+
+	if err := r.DeleteWithNotFoundRetry(context.Background(), "i-1", deleteFn, isTestNotFound); err != nil {
+		t.Errorf("DeleteWithNotFoundRetry() error = %v", err)
+	}
+
+	// 1+2+4+8+16+16+16 seconds is past the minute of the window, with up to half a second of
+	// jitter added to each wait
+	want := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 16 * time.Second, 16 * time.Second}
+	waits := clock.Waits()
+	if len(waits) != len(want) {
+		t.Fatalf("DeleteWithNotFoundRetry() waited %v, want %v plus jitter", waits, want)
+	}
+	for i, wait := range waits {
+		if wait < want[i] || wait >= want[i]+time.Second/2 {
+			t.Errorf("DeleteWithNotFoundRetry() waited %v, want %v plus jitter", waits, want)
+			break
+		}
+	}
+	if calls != len(want)+1 {
+		t.Errorf("DeleteWithNotFoundRetry() made %d delete calls, want %d", calls, len(want)+1)
+	}
+	if r.IsRecent("i-1") {
+		t.Error("Expected the instance to be forgotten")
+	}
+}
+
+func TestDeleteWithNotFoundRetryNil(t *testing.T) {
+	var r *provider.RecentInstances
+	r.Add("i-1")
+
+	err := r.DeleteWithNotFoundRetry(context.Background(), "i-1", func(ctx context.Context) error {
+		return errTestNotFound
+	}, isTestNotFound)
+	if err != nil {
+		t.Errorf("DeleteWithNotFoundRetry() error = %v", err)
+	}
+}
+
+func TestDeleteWithNotFoundRetryCanceled(t *testing.T) {
+	r := newTestRecentInstances(providertest.NewFakeClock())
+	r.Add("i-1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := r.DeleteWithNotFoundRetry(ctx, "i-1", func(ctx context.Context) error {
+		calls++
+		// Canceled while waiting for the retry
+		cancel()
+		return errTestNotFound
+	}, isTestNotFound)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DeleteWithNotFoundRetry() error = %v, want %v", err, context.Canceled)
+	}
+	if calls != 1 {
+		t.Errorf("DeleteWithNotFoundRetry() made %d delete calls, want 1", calls)
+	}
+	if !r.IsRecent("i-1") {
+		t.Error("Expected the instance to be still tracked")
+	}
+}
@@ -14,6 +14,7 @@ import (
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	putil "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	cerrdefs "github.com/containerd/errdefs"
 	"github.com/docker/docker/client"
 )
 
@@ -125,9 +126,10 @@ func (p *dockerProvider) CreateInstance(ctx context.Context, podName, sandboxID
 	}
 
 	return &provider.Instance{
-		ID:   instanceID,
-		Name: instanceName,
-		IPs:  []netip.Addr{ipAddr}, // Convert ipAddr to a slice of netip.Addr
+		ID:    instanceID,
+		Name:  instanceName,
+		IPs:   []netip.Addr{ipAddr}, // Convert ipAddr to a slice of netip.Addr
+		State: provider.InstanceStateRunning,
 	}, nil
 
 }
@@ -139,6 +141,10 @@ func (p *dockerProvider) DeleteInstance(ctx context.Context, instanceID string)
 	// Delete the container
 	err := deleteContainer(ctx, p.Client, instanceID)
 	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			logger.Printf("container %s not found, assuming it is already deleted", instanceID)
+			return nil
+		}
 		return err
 	}
 
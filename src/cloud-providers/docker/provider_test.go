@@ -5,6 +5,7 @@ package docker
 
 import (
 	"context"
+	"fmt"
 	"net/netip"
 	"reflect"
 	"testing"
@@ -12,6 +13,7 @@ import (
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	cerrdefs "github.com/containerd/errdefs"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -129,9 +131,10 @@ func Test_dockerProvider_CreateInstance(t *testing.T) {
 				spec:      provider.InstanceTypeSpec{},
 			},
 			want: &provider.Instance{
-				ID:   "mock-container-id-12345",
-				Name: "podvm-test-test",
-				IPs:  []netip.Addr{netip.MustParseAddr("172.17.0.2")},
+				ID:    "mock-container-id-12345",
+				Name:  "podvm-test-test",
+				IPs:   []netip.Addr{netip.MustParseAddr("172.17.0.2")},
+				State: provider.InstanceStateRunning,
 			},
 			wantErr: false,
 		},
@@ -157,3 +160,57 @@ func Test_dockerProvider_CreateInstance(t *testing.T) {
 		})
 	}
 }
+
+// Mock Docker client for a container that no longer exists
+type mockDockerClientNotFound struct {
+	mockDockerClient
+}
+
+// Create a mock Docker ContainerRemove method returning a not found error
+func (m mockDockerClientNotFound) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
+	return fmt.Errorf("No such container: %s: %w", containerID, cerrdefs.ErrNotFound)
+}
+
+// Mock Docker client failing to remove a container
+type mockDockerClientRemoveFailure struct {
+	mockDockerClient
+}
+
+// Create a mock Docker ContainerRemove method returning an error
+func (m mockDockerClientRemoveFailure) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
+	return fmt.Errorf("removal of container %s is already in progress: %w", containerID, cerrdefs.ErrConflict)
+}
+
+func Test_dockerProvider_DeleteInstance(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  dockerClient
+		wantErr bool
+	}{
+		{
+			name:    "DeleteInstance",
+			client:  newMockDockerClient(),
+			wantErr: false,
+		},
+		{
+			name:    "DeleteInstanceNotFound",
+			client:  mockDockerClientNotFound{},
+			wantErr: false,
+		},
+		{
+			name:    "DeleteInstanceFailure",
+			client:  mockDockerClientRemoveFailure{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &dockerProvider{
+				Client: tt.client,
+			}
+			if err := p.DeleteInstance(context.Background(), "mock-container-id-12345"); (err != nil) != tt.wantErr {
+				t.Errorf("dockerProvider.DeleteInstance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
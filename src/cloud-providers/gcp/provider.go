@@ -6,8 +6,10 @@ package gcp
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/netip"
 	"strings"
 
@@ -20,6 +22,7 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 	proto "google.golang.org/protobuf/proto"
 )
@@ -79,6 +82,19 @@ func getIPs(instance *computepb.Instance) ([]netip.Addr, error) {
 	return podNodeIPs, nil
 }
 
+// getInstanceState maps the Compute Engine instance status to the provider instance state
+func getInstanceState(instance *computepb.Instance) string {
+	switch instance.GetStatus() {
+	case "RUNNING":
+		return provider.InstanceStateRunning
+	case "STOPPING", "SUSPENDING", "SUSPENDED", "TERMINATED":
+		// A TERMINATED instance is stopped and can be started again
+		return provider.InstanceStateStopped
+	default:
+		return provider.InstanceStatePending
+	}
+}
+
 func (p *gcpProvider) ListAllTags(ctx context.Context) (map[string]map[string]*crmpb.TagValue, error) {
 	tagKeysClient, err := crm.NewTagKeysClient(ctx)
 	if err != nil {
@@ -350,12 +366,19 @@ func (p *gcpProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 	}
 
 	return &provider.Instance{
-		ID:   instance.GetName(),
-		Name: instance.GetName(),
-		IPs:  ips,
+		ID:    instance.GetName(),
+		Name:  instance.GetName(),
+		IPs:   ips,
+		State: getInstanceState(instance),
 	}, nil
 }
 
+// isNotFoundError returns true when the GCP API reports that the resource doesn't exist
+func isNotFoundError(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
 func (p *gcpProvider) DeleteInstance(ctx context.Context, instanceID string) error {
 	req := &computepb.DeleteInstanceRequest{
 		Project:  p.serviceConfig.ProjectId,
@@ -364,10 +387,18 @@ func (p *gcpProvider) DeleteInstance(ctx context.Context, instanceID string) err
 	}
 	op, err := p.instancesClient.Delete(ctx, req)
 	if err != nil {
+		if isNotFoundError(err) {
+			logger.Printf("instance %s not found, assuming it is already deleted", instanceID)
+			return nil
+		}
 		return fmt.Errorf("Instances.Delete error: %w, req: %v", err, req)
 	}
 	err = op.Wait(ctx)
 	if err != nil {
+		if isNotFoundError(err) {
+			logger.Printf("instance %s not found, assuming it is already deleted", instanceID)
+			return nil
+		}
 		return fmt.Errorf("waiting for Instances.Delete error: %s. req: %v", err, req)
 	}
 	logger.Printf("deleted an instance %s", instanceID)
@@ -0,0 +1,54 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	compute "cloud.google.com/go/compute/apiv1"
+	"google.golang.org/api/option"
+)
+
+func newTestProvider(t *testing.T, handler http.HandlerFunc) *gcpProvider {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := compute.NewInstancesRESTClient(context.Background(), option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("NewInstancesRESTClient() error = %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return &gcpProvider{
+		serviceConfig:   &Config{ProjectId: "project", Zone: "us-central1-a"},
+		instancesClient: client,
+	}
+}
+
+func TestDeleteInstanceNotFound(t *testing.T) {
+	p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"code":404,"message":"The resource 'podvm-test' was not found"}}`))
+	})
+
+	if err := p.DeleteInstance(context.Background(), "podvm-test"); err != nil {
+		t.Errorf("DeleteInstance() error = %v, want nil for an instance that doesn't exist", err)
+	}
+}
+
+func TestDeleteInstanceError(t *testing.T) {
+	p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":{"code":403,"message":"Permission denied"}}`))
+	})
+
+	if err := p.DeleteInstance(context.Background(), "podvm-test"); err == nil {
+		t.Error("DeleteInstance() error = nil, want the permission error")
+	}
+}
@@ -6,6 +6,7 @@ package ibmcloud_powervs
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"net/netip"
@@ -13,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/IBM-Cloud/power-go-client/power/client/p_cloud_p_vm_instances"
 	"github.com/IBM-Cloud/power-go-client/power/models"
 	"github.com/IBM/go-sdk-core/v5/core"
 	retry "github.com/avast/retry-go/v4"
@@ -125,28 +127,23 @@ func (p *ibmcloudPowerVSProvider) CreateInstance(ctx context.Context, podName, s
 	defer cancel()
 
 	logger.Printf("Waiting for instance to reach state: ACTIVE")
-	err = retry.Do(
-		func() error {
-			in, err := p.powervsService.instanceClient(getctx).Get(*ins.PvmInstanceID)
-			if err != nil {
-				return fmt.Errorf("failed to get the instance: %v", err)
-			}
+	err = provider.WithCloudRetry(getctx, func(ctx context.Context) error {
+		in, err := p.powervsService.instanceClient(ctx).Get(*ins.PvmInstanceID)
+		if err != nil {
+			return fmt.Errorf("failed to get the instance: %v", err)
+		}
 
-			if *in.Status == "ERROR" {
-				return fmt.Errorf("instance is in error state")
-			}
+		if *in.Status == "ERROR" {
+			return retry.Unrecoverable(fmt.Errorf("instance is in error state"))
+		}
 
-			if *in.Status == "ACTIVE" {
-				logger.Printf("instance is in desired state: %s", *in.Status)
-				return nil
-			}
+		if *in.Status == "ACTIVE" {
+			logger.Printf("instance is in desired state: %s", *in.Status)
+			return nil
+		}
 
-			return fmt.Errorf("Instance failed to reach ACTIVE state")
-		},
-		retry.Context(getctx),
-		retry.Attempts(0),
-		retry.MaxDelay(5*time.Second),
-	)
+		return fmt.Errorf("Instance failed to reach ACTIVE state")
+	}, waitRetryOptions(5*time.Second))
 
 	if err != nil {
 		logger.Print(err)
@@ -159,16 +156,30 @@ func (p *ibmcloudPowerVSProvider) CreateInstance(ctx context.Context, podName, s
 	}
 
 	return &provider.Instance{
-		ID:   instanceID,
-		Name: instanceName,
-		IPs:  ips,
+		ID:    instanceID,
+		Name:  instanceName,
+		IPs:   ips,
+		State: provider.InstanceStateRunning,
 	}, nil
 }
 
+// waitRetryOptions polls until the context is done, whatever the error
+func waitRetryOptions(maxDelay time.Duration) provider.RetryOptions {
+	return provider.RetryOptions{
+		Attempts:  -1,
+		MaxDelay:  maxDelay,
+		Retryable: func(error) bool { return true },
+	}
+}
+
 func (p *ibmcloudPowerVSProvider) DeleteInstance(ctx context.Context, instanceID string) error {
 
 	err := p.powervsService.instanceClient(ctx).Delete(instanceID)
 	if err != nil {
+		if isNotFoundError(err) {
+			logger.Printf("instance %s not found, assuming it is already deleted", instanceID)
+			return nil
+		}
 		logger.Printf("failed to delete an instance: %v", err)
 		return err
 	}
@@ -177,6 +188,12 @@ func (p *ibmcloudPowerVSProvider) DeleteInstance(ctx context.Context, instanceID
 	return nil
 }
 
+// isNotFoundError returns true when the PowerVS API reports that the instance doesn't exist
+func isNotFoundError(err error) bool {
+	var notFound *p_cloud_p_vm_instances.PcloudPvminstancesDeleteNotFound
+	return errors.As(err, &notFound)
+}
+
 func (p *ibmcloudPowerVSProvider) Teardown() error {
 	return nil
 }
@@ -222,7 +239,7 @@ func (p *ibmcloudPowerVSProvider) getVMIPs(ctx context.Context, instanceID strin
 
 	// If IP is not assigned to the instance, fetch it from DHCP server
 	logger.Printf("Trying to fetch IP from DHCP server..")
-	err = retry.Do(func() error {
+	err = provider.WithCloudRetry(ctx, func(ctx context.Context) error {
 		ip, err := p.getIPFromDHCPServer(ctx, ins)
 		if err != nil {
 			logger.Print(err)
@@ -240,11 +257,7 @@ func (p *ibmcloudPowerVSProvider) getVMIPs(ctx context.Context, instanceID strin
 		ips = append(ips, addr)
 		logger.Printf("podNodeIP=%s", addr.String())
 		return nil
-	},
-		retry.Context(ctx),
-		retry.Attempts(0),
-		retry.MaxDelay(10*time.Second),
-	)
+	}, waitRetryOptions(10*time.Second))
 
 	if err != nil {
 		logger.Print(err)
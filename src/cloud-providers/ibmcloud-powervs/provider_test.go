@@ -0,0 +1,42 @@
+// Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ibmcloud_powervs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/IBM-Cloud/power-go-client/power/client/p_cloud_p_vm_instances"
+)
+
+func TestIsNotFoundError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "not found",
+			err:  fmt.Errorf("failed to Delete PVM Instance pvm-1 :%w", p_cloud_p_vm_instances.NewPcloudPvminstancesDeleteNotFound()),
+			want: true,
+		},
+		{
+			name: "other API error",
+			err:  fmt.Errorf("failed to Delete PVM Instance pvm-1 :%w", p_cloud_p_vm_instances.NewPcloudPvminstancesDeleteInternalServerError()),
+		},
+		{
+			name: "other error",
+			err:  errors.New("connection refused"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNotFoundError(tt.err); got != tt.want {
+				t.Errorf("isNotFoundError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
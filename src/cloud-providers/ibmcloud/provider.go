@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/netip"
 	"os"
 	"time"
@@ -249,6 +250,24 @@ func getIPs(instance *vpcv1.Instance, instanceID string, numInterfaces int) ([]n
 	return ips, nil
 }
 
+// getInstanceState maps the VPC instance status to the provider instance state
+func getInstanceState(instance *vpcv1.Instance) string {
+	if instance.Status == nil {
+		return provider.InstanceStatePending
+	}
+
+	switch *instance.Status {
+	case vpcv1.InstanceStatusRunningConst:
+		return provider.InstanceStateRunning
+	case vpcv1.InstanceStatusStoppingConst, vpcv1.InstanceStatusStoppedConst:
+		return provider.InstanceStateStopped
+	case vpcv1.InstanceStatusDeletingConst, vpcv1.InstanceStatusFailedConst:
+		return provider.InstanceStateTerminated
+	default:
+		return provider.InstanceStatePending
+	}
+}
+
 func (p *ibmcloudVPCProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
 
 	instanceName := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
@@ -310,9 +329,10 @@ func (p *ibmcloudVPCProvider) CreateInstance(ctx context.Context, podName, sandb
 	}
 
 	instance := &provider.Instance{
-		ID:   instanceID,
-		Name: instanceName,
-		IPs:  ips,
+		ID:    instanceID,
+		Name:  instanceName,
+		IPs:   ips,
+		State: getInstanceState(vpcInstance),
 	}
 
 	return instance, nil
@@ -434,6 +454,10 @@ func (p *ibmcloudVPCProvider) DeleteInstance(ctx context.Context, instanceID str
 	options.SetID(instanceID)
 	resp, err := p.vpc.DeleteInstanceWithContext(ctx, options)
 	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			logger.Printf("instance %s not found, assuming it is already deleted", instanceID)
+			return nil
+		}
 		logger.Printf("failed to delete an instance: %v and the response is %v", err, resp)
 		return err
 	}
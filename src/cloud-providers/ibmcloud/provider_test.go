@@ -17,7 +17,8 @@ import (
 )
 
 type mockVPC struct {
-	prototype vpcv1.InstancePrototypeIntf
+	prototype        vpcv1.InstancePrototypeIntf
+	deleteStatusCode int
 }
 
 func ptr(s string) *string {
@@ -123,6 +124,13 @@ func (c *mockCloudConfig) Generate() (string, error) {
 
 func (v *mockVPC) DeleteInstanceWithContext(context.Context, *vpcv1.DeleteInstanceOptions) (*core.DetailedResponse, error) {
 
+	if v.deleteStatusCode != 0 && v.deleteStatusCode != http.StatusOK {
+		res := &core.DetailedResponse{
+			StatusCode: v.deleteStatusCode,
+		}
+		return res, fmt.Errorf("%s", http.StatusText(v.deleteStatusCode))
+	}
+
 	res := &core.DetailedResponse{
 		StatusCode: http.StatusOK,
 	}
@@ -177,6 +185,21 @@ func TestDeleteInstance(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestDeleteInstanceNotFound(t *testing.T) {
+
+	provider := &ibmcloudVPCProvider{
+		vpc:           &mockVPC{deleteStatusCode: http.StatusNotFound},
+		serviceConfig: &Config{},
+	}
+
+	err := provider.DeleteInstance(context.Background(), "123")
+	assert.NoError(t, err)
+
+	provider.vpc = &mockVPC{deleteStatusCode: http.StatusForbidden}
+	err = provider.DeleteInstance(context.Background(), "123")
+	assert.Error(t, err)
+}
+
 func TestGetInstanceTypeInformation(t *testing.T) {
 	type args struct {
 		instanceType string
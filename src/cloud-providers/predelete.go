@@ -0,0 +1,32 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultPreDeleteHookTimeout bounds each pre-delete hook, so that an unreachable VM doesn't
+// hold up its deletion
+const DefaultPreDeleteHookTimeout = 30 * time.Second
+
+// PreDeleteHook is run before the instance instanceID is deleted, e.g. to have a confidential
+// pod VM shred its secrets or to ask the KBS to revoke the keys it released. The identity of
+// the pod is in ctx when known.
+type PreDeleteHook func(ctx context.Context, instanceID string) error
+
+// RunPreDeleteHooks runs the hooks in order, each with timeout, before the instance instanceID
+// is deleted. They are best-effort: a failure is logged, and the next hooks and the deletion
+// proceed.
+func RunPreDeleteHooks(ctx context.Context, instanceID string, timeout time.Duration, hooks []PreDeleteHook) {
+	for i, hook := range hooks {
+		hookCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := hook(hookCtx, instanceID)
+		cancel()
+		if err != nil {
+			logger.Printf("Warning: pre-delete hook %d of %d failed for instance %s, deleting it anyway: %v", i+1, len(hooks), instanceID, err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunPreDeleteHooks(t *testing.T) {
+	var calls []string
+	hook := func(name string, err error) PreDeleteHook {
+		return func(ctx context.Context, instanceID string) error {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Errorf("hook %s: context has no deadline", name)
+			}
+			calls = append(calls, name+":"+instanceID)
+			return err
+		}
+	}
+
+	RunPreDeleteHooks(context.Background(), "i-123", time.Second, []PreDeleteHook{
+		hook("shred", errors.New("unreachable")),
+		hook("revoke", nil),
+	})
+
+	// A failed hook doesn't stop the next ones
+	if want := []string{"shred:i-123", "revoke:i-123"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("RunPreDeleteHooks() calls = %v, want %v", calls, want)
+	}
+}
+
+func TestRunPreDeleteHooksTimeout(t *testing.T) {
+	start := time.Now()
+	RunPreDeleteHooks(context.Background(), "i-123", 10*time.Millisecond, []PreDeleteHook{
+		func(ctx context.Context, instanceID string) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("RunPreDeleteHooks() took %v, want the hook to be canceled after its timeout", elapsed)
+	}
+}
@@ -0,0 +1,99 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package providertest
+
+import (
+	"sync"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+// FakeClockStart is the time of a new FakeClock
+var FakeClockStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// FakeClock is a provider.Clock whose time only moves when it is told to. Advance moves the
+// time forward and fires the waits that are due. With AutoAdvance, each wait instead moves
+// the time by its full duration and fires at once, so that retries and polls run without
+// waiting. The zero value starts at the zero time.
+type FakeClock struct {
+	// AutoAdvance makes After advance the time by the waited duration and fire immediately
+	AutoAdvance bool
+
+	mutex   sync.Mutex
+	now     time.Time
+	waits   []time.Duration
+	waiters []fakeWaiter
+	waiting chan struct{}
+}
+
+var _ provider.Clock = (*FakeClock)(nil)
+
+// NewFakeClock returns a FakeClock set to FakeClockStart
+func NewFakeClock() *FakeClock {
+	return &FakeClock{
+		now:     FakeClockStart,
+		waiting: make(chan struct{}, 100),
+	}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.waits = append(c.waits, d)
+	ch := make(chan time.Time, 1)
+	if c.AutoAdvance {
+		c.now = c.now.Add(d)
+		ch <- c.now
+	} else {
+		c.waiters = append(c.waiters, fakeWaiter{deadline: c.now.Add(d), ch: ch})
+	}
+
+	select {
+	case c.waiting <- struct{}{}:
+	default:
+	}
+	return ch
+}
+
+// Advance moves the time forward by d and fires the waits that are due
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+	var pending []fakeWaiter
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+// Waits returns the durations passed to After, in order
+func (c *FakeClock) Waits() []time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]time.Duration(nil), c.waits...)
+}
+
+// Waiting receives a value each time After is called, up to a buffer of 100 unread calls
+func (c *FakeClock) Waiting() <-chan struct{} {
+	return c.waiting
+}
@@ -0,0 +1,59 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package providertest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFakeClockAdvance(t *testing.T) {
+	clock := NewFakeClock()
+
+	short := clock.After(time.Second)
+	long := clock.After(time.Minute)
+	<-clock.Waiting()
+	<-clock.Waiting()
+
+	clock.Advance(time.Second)
+	select {
+	case now := <-short:
+		if want := FakeClockStart.Add(time.Second); !now.Equal(want) {
+			t.Errorf("After(1s) fired at %v, want %v", now, want)
+		}
+	default:
+		t.Error("After(1s) didn't fire after Advance(1s)")
+	}
+	select {
+	case <-long:
+		t.Error("After(1m) fired after Advance(1s)")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case <-long:
+	default:
+		t.Error("After(1m) didn't fire after Advance(1m)")
+	}
+	if want := FakeClockStart.Add(time.Minute + time.Second); !clock.Now().Equal(want) {
+		t.Errorf("Now() = %v, want %v", clock.Now(), want)
+	}
+}
+
+func TestFakeClockAutoAdvance(t *testing.T) {
+	clock := NewFakeClock()
+	clock.AutoAdvance = true
+
+	<-clock.After(time.Second)
+	<-clock.After(2 * time.Second)
+
+	if want := FakeClockStart.Add(3 * time.Second); !clock.Now().Equal(want) {
+		t.Errorf("Now() = %v, want %v", clock.Now(), want)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; !reflect.DeepEqual(clock.Waits(), want) {
+		t.Errorf("Waits() = %v, want %v", clock.Waits(), want)
+	}
+}
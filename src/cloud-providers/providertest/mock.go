@@ -0,0 +1,147 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package providertest provides a mock cloud provider for the tests of the code driving
+// providers, such as the cloud service of the adaptor.
+package providertest
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+// MockProvider is a provider.Provider keeping its instances in memory. The zero value creates
+// instances with the IP 127.0.0.1 without limit. It is safe for concurrent use, but its
+// behavior fields must be set before it is used.
+type MockProvider struct {
+	// IPs are the IPs of the created instances, 127.0.0.1 if empty
+	IPs []netip.Addr
+	// CreateDelay is how long CreateInstance takes, it returns the context error if the
+	// context is done first
+	CreateDelay time.Duration
+	// CreateErr is returned by CreateInstance instead of creating an instance
+	CreateErr error
+	// Capacity is the number of instances that can exist at once, unlimited if 0. Beyond it,
+	// CreateInstance returns an error wrapping provider.ErrCapacityUnavailable.
+	Capacity int
+	// DeleteErr, TeardownErr and ConfigErr are returned by the corresponding methods
+	DeleteErr   error
+	TeardownErr error
+	ConfigErr   error
+
+	mutex     sync.Mutex
+	instances map[string]*provider.Instance
+	nextID    int
+	creates   int
+	deletes   int
+	teardowns int
+}
+
+var _ provider.Provider = (*MockProvider)(nil)
+
+func (p *MockProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
+	p.mutex.Lock()
+	p.creates++
+	p.mutex.Unlock()
+
+	if p.CreateDelay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(p.CreateDelay):
+		}
+	}
+
+	if p.CreateErr != nil {
+		return nil, p.CreateErr
+	}
+
+	if _, err := cloudConfig.Generate(); err != nil {
+		return nil, fmt.Errorf("generating userData: %w", err)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.Capacity > 0 && len(p.instances) >= p.Capacity {
+		return nil, fmt.Errorf("%d instances exist: %w", len(p.instances), provider.ErrCapacityUnavailable)
+	}
+
+	ips := p.IPs
+	if len(ips) == 0 {
+		ips = []netip.Addr{netip.MustParseAddr("127.0.0.1")}
+	}
+
+	p.nextID++
+	instance := &provider.Instance{
+		ID:    fmt.Sprintf("mock-%d", p.nextID),
+		Name:  fmt.Sprintf("podvm-%s-%.8s", podName, sandboxID),
+		IPs:   append([]netip.Addr{}, ips...),
+		State: provider.InstanceStateRunning,
+	}
+	if p.instances == nil {
+		p.instances = map[string]*provider.Instance{}
+	}
+	p.instances[instance.ID] = instance
+
+	return instance, nil
+}
+
+// DeleteInstance deletes the instance instanceID, and returns nil if it doesn't exist
+func (p *MockProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.deletes++
+	if p.DeleteErr != nil {
+		return p.DeleteErr
+	}
+	delete(p.instances, instanceID)
+	return nil
+}
+
+// Teardown deletes all the instances, like a provider tearing down its environment
+func (p *MockProvider) Teardown() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.teardowns++
+	if p.TeardownErr != nil {
+		return p.TeardownErr
+	}
+	p.instances = nil
+	return nil
+}
+
+func (p *MockProvider) ConfigVerifier() error {
+	return p.ConfigErr
+}
+
+// Instances returns the IDs of the existing instances in order
+func (p *MockProvider) Instances() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ids := make([]string, 0, len(p.instances))
+	for id := range p.instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Calls returns the number of calls of CreateInstance, DeleteInstance and Teardown, including
+// the failed ones
+func (p *MockProvider) Calls() (creates, deletes, teardowns int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.creates, p.deletes, p.teardowns
+}
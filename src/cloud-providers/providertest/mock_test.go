@@ -0,0 +1,107 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package providertest
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+func TestMockProviderLifecycle(t *testing.T) {
+	p := &MockProvider{IPs: []netip.Addr{netip.MustParseAddr("10.0.0.4")}}
+	ctx := context.Background()
+
+	first, err := p.CreateInstance(ctx, "pod-a", "0123456789", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if first.Name != "podvm-pod-a-01234567" || !reflect.DeepEqual(first.IPs, p.IPs) {
+		t.Errorf("CreateInstance() = %+v, want the name podvm-pod-a-01234567 and IPs %v", first, p.IPs)
+	}
+	second, err := p.CreateInstance(ctx, "pod-b", "abcdef", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	if err := p.DeleteInstance(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	// Deleting an instance that doesn't exist succeeds, as the interface requires
+	if err := p.DeleteInstance(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteInstance() error = %v for a deleted instance", err)
+	}
+	if got, want := p.Instances(), []string{second.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Instances() = %v, want %v", got, want)
+	}
+
+	if err := p.Teardown(); err != nil {
+		t.Fatalf("Teardown() error = %v", err)
+	}
+	if got := p.Instances(); len(got) != 0 {
+		t.Errorf("Instances() = %v after Teardown(), want none", got)
+	}
+
+	if creates, deletes, teardowns := p.Calls(); creates != 2 || deletes != 2 || teardowns != 1 {
+		t.Errorf("Calls() = %d, %d, %d, want 2, 2, 1", creates, deletes, teardowns)
+	}
+}
+
+func TestMockProviderCapacity(t *testing.T) {
+	p := &MockProvider{Capacity: 1}
+	ctx := context.Background()
+
+	instance, err := p.CreateInstance(ctx, "pod-a", "1", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	if _, err := p.CreateInstance(ctx, "pod-b", "2", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{}); !errors.Is(err, provider.ErrCapacityUnavailable) {
+		t.Fatalf("CreateInstance() error = %v, want %v", err, provider.ErrCapacityUnavailable)
+	}
+
+	// Deleting an instance frees its capacity
+	if err := p.DeleteInstance(ctx, instance.ID); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if _, err := p.CreateInstance(ctx, "pod-b", "2", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{}); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+}
+
+func TestMockProviderErrors(t *testing.T) {
+	errCreate := errors.New("create failed")
+	errDelete := errors.New("delete failed")
+	errTeardown := errors.New("teardown failed")
+	p := &MockProvider{CreateErr: errCreate, DeleteErr: errDelete, TeardownErr: errTeardown}
+	ctx := context.Background()
+
+	if _, err := p.CreateInstance(ctx, "pod-a", "1", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{}); !errors.Is(err, errCreate) {
+		t.Errorf("CreateInstance() error = %v, want %v", err, errCreate)
+	}
+	if err := p.DeleteInstance(ctx, "mock-1"); !errors.Is(err, errDelete) {
+		t.Errorf("DeleteInstance() error = %v, want %v", err, errDelete)
+	}
+	if err := p.Teardown(); !errors.Is(err, errTeardown) {
+		t.Errorf("Teardown() error = %v, want %v", err, errTeardown)
+	}
+	if got := p.Instances(); len(got) != 0 {
+		t.Errorf("Instances() = %v, want none after a failed create", got)
+	}
+}
+
+func TestMockProviderCreateDelay(t *testing.T) {
+	p := &MockProvider{CreateDelay: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := p.CreateInstance(ctx, "pod-a", "1", &cloudinit.CloudConfig{}, provider.InstanceTypeSpec{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CreateInstance() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
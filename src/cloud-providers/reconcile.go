@@ -0,0 +1,27 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// NodeNameTag is the tag recording which worker node created an instance, so that
+	// the adaptor of each node only reconciles its own instances
+	NodeNameTag = "peerpod-node"
+
+	// ReconcileGracePeriod is how old an instance must be before it's considered orphaned,
+	// so that instances of creates that haven't returned yet are left alone
+	ReconcileGracePeriod = 10 * time.Minute
+)
+
+// Reconciler is implemented by providers that can garbage-collect orphaned instances,
+// e.g. left behind by a failed delete or an adaptor restart in the middle of a create
+type Reconciler interface {
+	// Reconcile terminates, or returns to the pool, the instances created from this worker
+	// node that are older than ReconcileGracePeriod and whose ID is not in inUse
+	Reconcile(ctx context.Context, inUse map[string]bool) error
+}
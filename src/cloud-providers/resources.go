@@ -0,0 +1,25 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+const mebibyte = 1024 * 1024
+
+// InstanceTypeSpecFromResources returns the spec of an instance fitting the aggregate resource
+// requests of a pod. The CPUs are rounded up to whole vCPUs and the memory up to MiB, the
+// resources not requested are left 0. GPUs are never set, they are only selected by annotations.
+func InstanceTypeSpecFromResources(resources v1.ResourceList) InstanceTypeSpec {
+	var spec InstanceTypeSpec
+
+	if cpu, ok := resources[v1.ResourceCPU]; ok && cpu.Sign() > 0 {
+		spec.VCPUs = (cpu.MilliValue() + 999) / 1000
+	}
+	if memory, ok := resources[v1.ResourceMemory]; ok && memory.Sign() > 0 {
+		spec.Memory = (memory.Value() + mebibyte - 1) / mebibyte
+	}
+	return spec
+}
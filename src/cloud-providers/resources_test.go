@@ -0,0 +1,73 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestInstanceTypeSpecFromResources(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources v1.ResourceList
+		want      InstanceTypeSpec
+	}{
+		{
+			name: "no requests",
+			want: InstanceTypeSpec{},
+		},
+		{
+			name: "whole CPUs and Gi memory",
+			resources: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("2"),
+				v1.ResourceMemory: resource.MustParse("4Gi"),
+			},
+			want: InstanceTypeSpec{VCPUs: 2, Memory: 4096},
+		},
+		{
+			name: "millicores and decimal memory are rounded up",
+			resources: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("1500m"),
+				v1.ResourceMemory: resource.MustParse("1G"),
+			},
+			want: InstanceTypeSpec{VCPUs: 2, Memory: 954},
+		},
+		{
+			name: "small CPU request",
+			resources: v1.ResourceList{
+				v1.ResourceCPU: resource.MustParse("100m"),
+			},
+			want: InstanceTypeSpec{VCPUs: 1},
+		},
+		{
+			name: "GPUs are ignored",
+			resources: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("8"),
+				v1.ResourceMemory: resource.MustParse("32Gi"),
+				"nvidia.com/gpu":  resource.MustParse("2"),
+			},
+			want: InstanceTypeSpec{VCPUs: 8, Memory: 32768},
+		},
+		{
+			name: "other extended resources are ignored",
+			resources: v1.ResourceList{
+				v1.ResourceMemory:           resource.MustParse("512Mi"),
+				"example.com/foo":           resource.MustParse("3"),
+				v1.ResourceEphemeralStorage: resource.MustParse("10Gi"),
+			},
+			want: InstanceTypeSpec{Memory: 512},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InstanceTypeSpecFromResources(tt.resources); got != tt.want {
+				t.Errorf("InstanceTypeSpecFromResources() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
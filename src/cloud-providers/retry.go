@@ -0,0 +1,104 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	retry "github.com/avast/retry-go/v4"
+)
+
+const (
+	DefaultRetryAttempts     = 5
+	DefaultRetryInitialDelay = 1 * time.Second
+	DefaultRetryMaxDelay     = 30 * time.Second
+)
+
+// RetryTimer waits for the retry delays, it's replaced in tests to not wait for real
+type RetryTimer interface {
+	After(time.Duration) <-chan time.Time
+}
+
+// RetryOptions tunes WithCloudRetry, the zero value of each field selects its default
+type RetryOptions struct {
+	// Attempts is the maximum number of calls, a negative value retries until the context is done
+	Attempts int
+	// InitialDelay is the delay before the first retry, it doubles on each retry up to MaxDelay
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	// MaxJitter is the upper bound of the random delay added to each backoff, InitialDelay/2 by default,
+	// so that clients failing together don't retry in lockstep
+	MaxJitter time.Duration
+	// Retryable decides whether an error is worth retrying, IsRetryableError by default
+	Retryable func(error) bool
+	// Timer waits for the delays, e.g. a Clock, the system timers by default
+	Timer RetryTimer
+}
+
+// WithCloudRetry calls fn until it succeeds, returns an error that is not retryable, runs out of
+// attempts or ctx is done, with exponential backoff and jitter between the calls. It returns
+// the last error of fn, or the context error. Errors wrapped with retry.Unrecoverable are
+// never retried.
+func WithCloudRetry(ctx context.Context, fn func(context.Context) error, opts RetryOptions) error {
+	attempts := uint(DefaultRetryAttempts)
+	if opts.Attempts < 0 {
+		attempts = 0 // retry-go retries forever with 0 attempts
+	} else if opts.Attempts > 0 {
+		attempts = uint(opts.Attempts)
+	}
+
+	initialDelay := opts.InitialDelay
+	if initialDelay <= 0 {
+		initialDelay = DefaultRetryInitialDelay
+	}
+	maxDelay := opts.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+	maxJitter := opts.MaxJitter
+	if maxJitter <= 0 {
+		maxJitter = initialDelay / 2
+	}
+	retryable := opts.Retryable
+	if retryable == nil {
+		retryable = IsRetryableError
+	}
+
+	// retry-go passes 1 for the first retry
+	delayType := func(n uint, _ error, _ *retry.Config) time.Duration {
+		delay := initialDelay
+		for i := uint(1); i < n && delay < maxDelay; i++ {
+			delay *= 2
+		}
+		delay = min(delay, maxDelay)
+		if maxJitter > 0 {
+			delay += rand.N(maxJitter)
+		}
+		return delay
+	}
+
+	options := []retry.Option{
+		retry.Context(ctx),
+		retry.Attempts(attempts),
+		retry.DelayType(delayType),
+		retry.RetryIf(func(err error) bool {
+			return retry.IsRecoverable(err) && retryable(err)
+		}),
+		retry.LastErrorOnly(true),
+	}
+	if opts.Timer != nil {
+		options = append(options, retry.WithTimer(opts.Timer))
+	}
+
+	return retry.Do(func() error { return fn(ctx) }, options...)
+}
+
+// IsRetryableError returns whether err is likely transient: throttling, a server side error, an
+// eventual consistency error or a network timeout, as classified by DefaultRetryClassifier.
+// Cancellations and other errors, e.g. invalid requests, are not retried.
+func IsRetryableError(err error) bool {
+	return DefaultRetryClassifier.Retryable(err)
+}
@@ -0,0 +1,190 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	retry "github.com/avast/retry-go/v4"
+)
+
+// fakeTimer fires immediately and records the requested delays
+type fakeTimer struct {
+	delays []time.Duration
+}
+
+func (f *fakeTimer) After(d time.Duration) <-chan time.Time {
+	f.delays = append(f.delays, d)
+	ch := make(chan time.Time, 1)
+	ch <- time.Time{}
+	return ch
+}
+
+// apiError mimics the errors of the AWS SDK
+type apiError struct {
+	code   string
+	status int
+}
+
+func (e *apiError) Error() string       { return e.code }
+func (e *apiError) ErrorCode() string   { return e.code }
+func (e *apiError) HTTPStatusCode() int { return e.status }
+
+var errTestThrottled = &apiError{code: "RequestLimitExceeded", status: http.StatusBadRequest}
+
+func TestWithCloudRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      RetryOptions
+		errs      []error // results of the successive calls, the last one is repeated
+		wantCalls int
+		wantErr   error
+	}{
+		{
+			name:      "succeeds after retries",
+			errs:      []error{errTestThrottled, errTestThrottled, nil},
+			wantCalls: 3,
+		},
+		{
+			name:      "gives up after the default attempts",
+			errs:      []error{errTestThrottled},
+			wantCalls: DefaultRetryAttempts,
+			wantErr:   errTestThrottled,
+		},
+		{
+			name:      "custom attempts",
+			opts:      RetryOptions{Attempts: 2},
+			errs:      []error{errTestThrottled},
+			wantCalls: 2,
+			wantErr:   errTestThrottled,
+		},
+		{
+			name:      "not retryable",
+			errs:      []error{&apiError{code: "UnauthorizedOperation", status: http.StatusForbidden}},
+			wantCalls: 1,
+		},
+		{
+			name:      "unrecoverable",
+			errs:      []error{retry.Unrecoverable(errTestThrottled)},
+			wantCalls: 1,
+			wantErr:   errTestThrottled,
+		},
+		{
+			name:      "custom classification",
+			opts:      RetryOptions{Retryable: func(err error) bool { return true }},
+			errs:      []error{errors.New("flaky"), nil},
+			wantCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timer := &fakeTimer{}
+			tt.opts.Timer = timer
+
+			calls := 0
+			err := WithCloudRetry(context.Background(), func(ctx context.Context) error {
+				err := tt.errs[min(calls, len(tt.errs)-1)]
+				calls++
+				return err
+			}, tt.opts)
+
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+			if tt.errs[len(tt.errs)-1] == nil {
+				if err != nil {
+					t.Errorf("expected success, got %v", err)
+				}
+			} else if err == nil {
+				t.Error("expected an error")
+			} else if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+			if len(timer.delays) != calls-1 {
+				t.Errorf("expected %d waits, got %d", calls-1, len(timer.delays))
+			}
+		})
+	}
+}
+
+func TestWithCloudRetryBackoff(t *testing.T) {
+	timer := &fakeTimer{}
+	opts := RetryOptions{
+		Attempts:     7,
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+		MaxJitter:    10 * time.Millisecond,
+		Timer:        timer,
+	}
+
+	_ = WithCloudRetry(context.Background(), func(ctx context.Context) error {
+		return errTestThrottled
+	}, opts)
+
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	if len(timer.delays) != len(want) {
+		t.Fatalf("expected %d waits, got %v", len(want), timer.delays)
+	}
+	for i, delay := range timer.delays {
+		base := want[i] * time.Millisecond
+		if delay < base || delay >= base+opts.MaxJitter {
+			t.Errorf("wait %d: expected %v plus a jitter below %v, got %v", i, base, opts.MaxJitter, delay)
+		}
+	}
+}
+
+func TestWithCloudRetryContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := WithCloudRetry(ctx, func(ctx context.Context) error {
+		calls++
+		if calls == 3 {
+			cancel()
+		}
+		return errTestThrottled
+	}, RetryOptions{Attempts: -1, InitialDelay: time.Millisecond})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context error, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: context.Canceled, want: false},
+		{err: fmt.Errorf("waiting: %w", context.DeadlineExceeded), want: false},
+		{err: errTestThrottled, want: true},
+		{err: &apiError{code: "InternalError", status: http.StatusInternalServerError}, want: true},
+		{err: &apiError{code: "ServiceUnavailable", status: http.StatusServiceUnavailable}, want: true},
+		{err: &apiError{code: "InvalidParameterValue", status: http.StatusBadRequest}, want: false},
+		{err: fmt.Errorf("dialing: %w", timeoutError{}), want: true},
+		{err: errors.New("unknown"), want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryableError(tt.err); got != tt.want {
+			t.Errorf("IsRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// RetryClass is the kind of failure a cloud API error reports, which decides whether it is retried
+type RetryClass int
+
+const (
+	// RetryClassPermanent errors, e.g. invalid requests, fail again if retried
+	RetryClassPermanent RetryClass = iota
+	// RetryClassThrottling errors report requests rate limited by the cloud
+	RetryClassThrottling
+	// RetryClassServer errors report server side failures and network timeouts
+	RetryClassServer
+	// RetryClassEventualConsistency errors report resources not visible yet right after their creation
+	RetryClassEventualConsistency
+	// RetryClassCapacity errors report the cloud lacking capacity or quota, which retrying soon rarely fixes
+	RetryClassCapacity
+	// RetryClassAuth errors report invalid credentials or missing permissions
+	RetryClassAuth
+)
+
+func (c RetryClass) String() string {
+	switch c {
+	case RetryClassThrottling:
+		return "throttling"
+	case RetryClassServer:
+		return "server"
+	case RetryClassEventualConsistency:
+		return "eventual-consistency"
+	case RetryClassCapacity:
+		return "capacity"
+	case RetryClassAuth:
+		return "auth"
+	}
+	return "permanent"
+}
+
+// Retryable returns whether the errors of the class are likely transient
+func (c RetryClass) Retryable() bool {
+	return c == RetryClassThrottling || c == RetryClassServer || c == RetryClassEventualConsistency
+}
+
+// RetryErrorCodes maps the API error codes of AWS and Azure to their class. The not found errors
+// are permanent: they are only eventual consistency right after a resource is created, which the
+// callers describing such a resource opt in to with RetryClassifier.WithCodes.
+var RetryErrorCodes = map[string]RetryClass{
+	// AWS
+	"Throttling":                   RetryClassThrottling,
+	"ThrottlingException":          RetryClassThrottling,
+	"RequestLimitExceeded":         RetryClassThrottling,
+	"TooManyRequestsException":     RetryClassThrottling,
+	"InternalError":                RetryClassServer,
+	"ServiceUnavailable":           RetryClassServer,
+	"Unavailable":                  RetryClassServer,
+	"InsufficientInstanceCapacity": RetryClassCapacity,
+	"InsufficientHostCapacity":     RetryClassCapacity,
+	"InstanceLimitExceeded":        RetryClassCapacity,
+	"VcpuLimitExceeded":            RetryClassCapacity,
+	// Spot requests that can't be fulfilled now
+	"SpotMaxPriceTooLow":           RetryClassCapacity,
+	"MaxSpotInstanceCountExceeded": RetryClassCapacity,
+	"AuthFailure":                  RetryClassAuth,
+	"UnauthorizedOperation":        RetryClassAuth,
+	"ExpiredToken":                 RetryClassAuth,
+	"InvalidClientTokenId":         RetryClassAuth,
+
+	// Azure
+	"TooManyRequests":                       RetryClassThrottling,
+	"SubscriptionRequestsThrottled":         RetryClassThrottling,
+	"InternalServerError":                   RetryClassServer,
+	"RetryableError":                        RetryClassServer,
+	"AnotherOperationInProgress":            RetryClassEventualConsistency,
+	"AllocationFailed":                      RetryClassCapacity,
+	"ZonalAllocationFailed":                 RetryClassCapacity,
+	"OverconstrainedAllocationRequest":      RetryClassCapacity,
+	"OverconstrainedZonalAllocationRequest": RetryClassCapacity,
+	"SkuNotAvailable":                       RetryClassCapacity,
+	"QuotaExceeded":                         RetryClassCapacity,
+	"AuthorizationFailed":                   RetryClassAuth,
+	"AuthenticationFailed":                  RetryClassAuth,
+	"InvalidAuthenticationToken":            RetryClassAuth,
+	"LinkedAuthorizationFailed":             RetryClassAuth,
+}
+
+// RetryClassifier classifies the cloud API errors by their error code, then by their HTTP status.
+// The zero value classifies the AWS SDK errors with RetryErrorCodes.
+type RetryClassifier struct {
+	// Codes maps the API error codes to their class, RetryErrorCodes by default
+	Codes map[string]RetryClass
+	// Details returns the API error code and HTTP status of err, and false if err is not an
+	// API error. SDKErrorDetails by default.
+	Details func(err error) (code string, status int, ok bool)
+}
+
+// DefaultRetryClassifier is the classifier of IsRetryableError
+var DefaultRetryClassifier = RetryClassifier{}
+
+// WithCodes returns a copy of c classifying the given codes as given, and the other errors as c
+// does. It scopes a rule to the calls it holds for, e.g. a not found error that is only eventual
+// consistency when describing a resource that was just created.
+func (c RetryClassifier) WithCodes(codes map[string]RetryClass) RetryClassifier {
+	base := c.Codes
+	if base == nil {
+		base = RetryErrorCodes
+	}
+	merged := make(map[string]RetryClass, len(base)+len(codes))
+	for code, class := range base {
+		merged[code] = class
+	}
+	for code, class := range codes {
+		merged[code] = class
+	}
+	c.Codes = merged
+	return c
+}
+
+// SDKErrorDetails returns the code and status of the errors implementing ErrorCode() and
+// HTTPStatusCode(), as the AWS SDK errors do
+func SDKErrorDetails(err error) (code string, status int, ok bool) {
+	var coded interface{ ErrorCode() string }
+	if errors.As(err, &coded) {
+		code, ok = coded.ErrorCode(), true
+	}
+	var withStatus interface{ HTTPStatusCode() int }
+	if errors.As(err, &withStatus) {
+		status, ok = withStatus.HTTPStatusCode(), true
+	}
+	return code, status, ok
+}
+
+// Classify returns the class of err. Cancellations and unknown errors are permanent.
+func (c RetryClassifier) Classify(err error) RetryClass {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return RetryClassPermanent
+	}
+
+	details := c.Details
+	if details == nil {
+		details = SDKErrorDetails
+	}
+	codes := c.Codes
+	if codes == nil {
+		codes = RetryErrorCodes
+	}
+
+	if code, status, ok := details(err); ok {
+		if class, found := codes[code]; found {
+			return class
+		}
+		return statusClass(status)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return RetryClassServer
+	}
+	return RetryClassPermanent
+}
+
+// Retryable returns whether err is likely transient
+func (c RetryClassifier) Retryable(err error) bool {
+	return c.Classify(err).Retryable()
+}
+
+func statusClass(code int) RetryClass {
+	switch code {
+	case http.StatusTooManyRequests:
+		return RetryClassThrottling
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return RetryClassServer
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return RetryClassAuth
+	}
+	return RetryClassPermanent
+}
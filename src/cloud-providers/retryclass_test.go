@@ -0,0 +1,111 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRetryClassifierClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want RetryClass
+	}{
+		{name: "nil", err: nil, want: RetryClassPermanent},
+		{name: "canceled", err: fmt.Errorf("creating: %w", context.Canceled), want: RetryClassPermanent},
+		{name: "throttled", err: errTestThrottled, want: RetryClassThrottling},
+		{name: "throttled by status", err: &apiError{code: "SlowDown", status: http.StatusTooManyRequests}, want: RetryClassThrottling},
+		{name: "server error", err: &apiError{code: "InternalError", status: http.StatusInternalServerError}, want: RetryClassServer},
+		{name: "bad gateway", err: &apiError{status: http.StatusBadGateway}, want: RetryClassServer},
+		{name: "network timeout", err: fmt.Errorf("dialing: %w", timeoutError{}), want: RetryClassServer},
+		{name: "not found", err: &apiError{code: "InvalidInstanceID.NotFound", status: http.StatusBadRequest}, want: RetryClassPermanent},
+		{name: "no capacity", err: &apiError{code: "InsufficientInstanceCapacity", status: http.StatusInternalServerError}, want: RetryClassCapacity},
+		{name: "spot price", err: &apiError{code: "SpotMaxPriceTooLow", status: http.StatusBadRequest}, want: RetryClassCapacity},
+		{name: "unauthorized", err: &apiError{code: "UnauthorizedOperation", status: http.StatusForbidden}, want: RetryClassAuth},
+		{name: "forbidden", err: &apiError{status: http.StatusForbidden}, want: RetryClassAuth},
+		{name: "invalid request", err: &apiError{code: "InvalidParameterValue", status: http.StatusBadRequest}, want: RetryClassPermanent},
+		{name: "unknown", err: errors.New("unknown"), want: RetryClassPermanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultRetryClassifier.Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// codedError carries its code in a field, as the errors of some SDKs do
+type codedError struct {
+	code string
+}
+
+func (e *codedError) Error() string { return e.code }
+
+func TestRetryClassifierCustom(t *testing.T) {
+	classifier := RetryClassifier{
+		Codes: map[string]RetryClass{"Busy": RetryClassThrottling},
+		Details: func(err error) (string, int, bool) {
+			var coded *codedError
+			if !errors.As(err, &coded) {
+				return "", 0, false
+			}
+			return coded.code, 0, true
+		},
+	}
+
+	if got := classifier.Classify(&codedError{code: "Busy"}); got != RetryClassThrottling {
+		t.Errorf("Classify() = %v, want %v", got, RetryClassThrottling)
+	}
+	// Only the codes of the classifier are known
+	if got := classifier.Classify(&codedError{code: "RequestLimitExceeded"}); got != RetryClassPermanent {
+		t.Errorf("Classify() = %v, want %v", got, RetryClassPermanent)
+	}
+	if !classifier.Retryable(fmt.Errorf("calling: %w", &codedError{code: "Busy"})) {
+		t.Error("Retryable() = false, want true")
+	}
+}
+
+func TestRetryClassifierWithCodes(t *testing.T) {
+	notFound := &apiError{code: "InvalidInstanceID.NotFound", status: http.StatusBadRequest}
+	classifier := DefaultRetryClassifier.WithCodes(map[string]RetryClass{
+		"InvalidInstanceID.NotFound": RetryClassEventualConsistency,
+	})
+
+	if got := classifier.Classify(notFound); got != RetryClassEventualConsistency {
+		t.Errorf("Classify() = %v, want %v", got, RetryClassEventualConsistency)
+	}
+	// The other codes keep their class
+	if got := classifier.Classify(errTestThrottled); got != RetryClassThrottling {
+		t.Errorf("Classify() = %v, want %v", got, RetryClassThrottling)
+	}
+	// The classifier it was derived from is unchanged
+	if got := DefaultRetryClassifier.Classify(notFound); got != RetryClassPermanent {
+		t.Errorf("DefaultRetryClassifier.Classify() = %v, want %v", got, RetryClassPermanent)
+	}
+	if _, found := RetryErrorCodes["InvalidInstanceID.NotFound"]; found {
+		t.Error("WithCodes() modified RetryErrorCodes")
+	}
+}
+
+func TestRetryClassRetryable(t *testing.T) {
+	for class, want := range map[RetryClass]bool{
+		RetryClassPermanent:           false,
+		RetryClassThrottling:          true,
+		RetryClassServer:              true,
+		RetryClassEventualConsistency: true,
+		RetryClassCapacity:            false,
+		RetryClassAuth:                false,
+	} {
+		if got := class.Retryable(); got != want {
+			t.Errorf("%v.Retryable() = %v, want %v", class, got, want)
+		}
+	}
+}
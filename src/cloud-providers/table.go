@@ -8,9 +8,12 @@ import (
 	"os"
 	"path/filepath"
 	"plugin"
+	"sort"
 	"strings"
 )
 
+// CloudProvider constructs a Provider from its command line flags and environment.
+// Each provider package registers one with AddCloudProvider from its init function.
 type CloudProvider interface {
 	ParseCmd(flags *flag.FlagSet)
 	LoadEnv()
@@ -104,15 +107,21 @@ func LoadCloudProvider(name string) {
 	}
 }
 
+// Get returns the cloud provider registered with the name, loading it from the external
+// plugin first if enabled, or nil if there is none
 func Get(name string) CloudProvider {
 	LoadCloudProvider(name)
 	return providerTable[name]
 }
 
+// AddCloudProvider registers a cloud provider under the name the cloud-api-adaptor is started
+// with. Providers outside this module register themselves the same way, from the init function
+// of a package that is either imported by the build or loaded as an external plugin.
 func AddCloudProvider(name string, cloud CloudProvider) {
 	providerTable[name] = cloud
 }
 
+// List returns the names of the registered cloud providers in alphabetical order
 func List() []string {
 
 	var list []string
@@ -120,6 +129,7 @@ func List() []string {
 	for name := range providerTable {
 		list = append(list, name)
 	}
+	sort.Strings(list)
 
 	return list
 }
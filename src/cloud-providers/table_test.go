@@ -0,0 +1,79 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"flag"
+	"slices"
+	"testing"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+type fakeProvider struct {
+	Provider
+	region string
+}
+
+func (p *fakeProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec InstanceTypeSpec) (*Instance, error) {
+	return &Instance{ID: p.region + "/" + podName}, nil
+}
+
+type fakeCloudProvider struct {
+	region string
+}
+
+func (c *fakeCloudProvider) ParseCmd(flags *flag.FlagSet) {
+	flags.StringVar(&c.region, "region", "", "Region")
+}
+
+func (c *fakeCloudProvider) LoadEnv() {}
+
+func (c *fakeCloudProvider) NewProvider() (Provider, error) {
+	return &fakeProvider{region: c.region}, nil
+}
+
+func TestCloudProviderTable(t *testing.T) {
+	saved := providerTable
+	defer func() {
+		providerTable = saved
+	}()
+	providerTable = map[string]CloudProvider{}
+
+	AddCloudProvider("zz-fake", &fakeCloudProvider{})
+	AddCloudProvider("fake", &fakeCloudProvider{})
+
+	if got, want := List(), []string{"fake", "zz-fake"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if cloud := Get("unknown"); cloud != nil {
+		t.Errorf("expected no provider, got %v", cloud)
+	}
+
+	cloud := Get("fake")
+	if cloud == nil {
+		t.Fatal("expected the fake provider to be registered")
+	}
+
+	flags := flag.NewFlagSet("fake", flag.ContinueOnError)
+	cloud.ParseCmd(flags)
+	if err := flags.Parse([]string{"-region", "test-region"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cloud.LoadEnv()
+
+	p, err := cloud.NewProvider()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	instance, err := p.CreateInstance(context.Background(), "pod", "sandbox", nil, InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if instance.ID != "test-region/pod" {
+		t.Errorf("expected the provider to be constructed from the flags, got instance %q", instance.ID)
+	}
+}
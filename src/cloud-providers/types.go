@@ -9,17 +9,30 @@ import (
 	"fmt"
 	"net/netip"
 	"strings"
+	"time"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 )
 
 type Provider interface {
 	CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec InstanceTypeSpec) (instance *Instance, err error)
+	// DeleteInstance must return nil when the instance doesn't exist anymore
 	DeleteInstance(ctx context.Context, instanceID string) error
 	Teardown() error
 	ConfigVerifier() error
 }
 
+// Closer is implemented by providers holding resources other than the instances, like
+// background goroutines or servers. Close releases them when the adaptor shuts down, after
+// Teardown has dealt with the instances.
+type Closer interface {
+	Close() error
+}
+
+// ErrCapacityUnavailable is wrapped by the CreateInstance errors caused by the cloud lacking
+// capacity for the instance, e.g. an exhausted quota, rather than by the request itself
+var ErrCapacityUnavailable = errors.New("cloud capacity unavailable")
+
 // keyValueFlag represents a flag of key-value pairs
 type KeyValueFlag map[string]string
 
@@ -54,10 +67,27 @@ func (k *KeyValueFlag) Set(value string) error {
 	return nil
 }
 
+// Lifecycle states of an Instance
+const (
+	InstanceStatePending    = "pending"
+	InstanceStateRunning    = "running"
+	InstanceStateStopped    = "stopped"
+	InstanceStateTerminated = "terminated"
+)
+
 type Instance struct {
 	ID   string
 	Name string
 	IPs  []netip.Addr
+	// State is one of the InstanceState constants, as last reported by the provider
+	State string
+	// Zone is the availability zone the instance was created in, if known
+	Zone string
+	// FromPool is set when CreateInstance handed out an existing instance
+	// instead of creating one
+	FromPool bool
+	// CreationDuration is how long CreateInstance took
+	CreationDuration time.Duration
 }
 
 type InstanceTypeSpec struct {
@@ -0,0 +1,65 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+const (
+	// AzureUserDataMaxEncodedSize is the Azure limit, applied to the base64 encoded userData.
+	// Ref: https://learn.microsoft.com/en-us/azure/virtual-machines/user-data
+	AzureUserDataMaxEncodedSize = 64 * 1024
+	// AWSUserDataMaxSize is the AWS limit, applied to the userData before it is base64 encoded.
+	// Ref: https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/user-data.html
+	AWSUserDataMaxSize = 16 * 1024
+)
+
+var ErrUserDataTooLarge = errors.New("userData exceeds the size limit")
+
+// UserDataEncoder encodes the cloud-init userData of a pod VM, checking it against
+// the size limit of the cloud API before the request is sent.
+type UserDataEncoder struct {
+	// MaxSize limits the userData before it is base64 encoded, 0 means no limit
+	MaxSize int
+	// MaxEncodedSize limits the base64 encoded userData, 0 means no limit
+	MaxEncodedSize int
+	// Gzip compresses the userData before it is encoded. Only enable it when the
+	// consumer in the pod VM decompresses the userData.
+	Gzip bool
+}
+
+// Encode returns the base64 encoded userData, or an error wrapping
+// ErrUserDataTooLarge when it doesn't fit in the configured limits.
+func (e UserDataEncoder) Encode(userData string) (string, error) {
+	data := []byte(userData)
+
+	if e.Gzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(data); err != nil {
+			return "", fmt.Errorf("compressing userData: %w", err)
+		}
+		if err := gz.Close(); err != nil {
+			return "", fmt.Errorf("compressing userData: %w", err)
+		}
+		data = buf.Bytes()
+	}
+
+	if e.MaxSize > 0 && len(data) > e.MaxSize {
+		return "", fmt.Errorf("%w: userData is %d bytes, the limit is %d bytes", ErrUserDataTooLarge, len(data), e.MaxSize)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	if e.MaxEncodedSize > 0 && len(encoded) > e.MaxEncodedSize {
+		return "", fmt.Errorf("%w: base64 encoded userData is %d bytes, the limit is %d bytes", ErrUserDataTooLarge, len(encoded), e.MaxEncodedSize)
+	}
+
+	return encoded, nil
+}
@@ -0,0 +1,80 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestUserDataEncoderLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoder  UserDataEncoder
+		size     int
+		tooLarge bool
+	}{
+		{name: "aws within limit", encoder: UserDataEncoder{MaxSize: AWSUserDataMaxSize}, size: AWSUserDataMaxSize},
+		{name: "aws over limit", encoder: UserDataEncoder{MaxSize: AWSUserDataMaxSize}, size: AWSUserDataMaxSize + 1, tooLarge: true},
+		// 48KB of userData is exactly 64KB once base64 encoded
+		{name: "azure within limit", encoder: UserDataEncoder{MaxEncodedSize: AzureUserDataMaxEncodedSize}, size: 48 * 1024},
+		{name: "azure over limit", encoder: UserDataEncoder{MaxEncodedSize: AzureUserDataMaxEncodedSize}, size: 48*1024 + 1, tooLarge: true},
+		{name: "no limit", encoder: UserDataEncoder{}, size: 1024 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userData := strings.Repeat("a", tt.size)
+
+			encoded, err := tt.encoder.Encode(userData)
+			if tt.tooLarge {
+				if !errors.Is(err, ErrUserDataTooLarge) {
+					t.Fatalf("Expected ErrUserDataTooLarge, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if encoded != base64.StdEncoding.EncodeToString([]byte(userData)) {
+				t.Errorf("Encode() returned unexpected data")
+			}
+		})
+	}
+}
+
+func TestUserDataEncoderGzip(t *testing.T) {
+	// Compressed, this is well below the AWS limit
+	userData := strings.Repeat("#cloud-config\n", 4096)
+
+	if _, err := (UserDataEncoder{MaxSize: AWSUserDataMaxSize}).Encode(userData); !errors.Is(err, ErrUserDataTooLarge) {
+		t.Fatalf("Expected ErrUserDataTooLarge without gzip, got %v", err)
+	}
+
+	encoded, err := UserDataEncoder{MaxSize: AWSUserDataMaxSize, Gzip: true}.Encode(userData)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("decoding userData: %v", err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("decompressing userData: %v", err)
+	}
+	decoded, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("decompressing userData: %v", err)
+	}
+	if string(decoded) != userData {
+		t.Errorf("Expected the decoded userData to match the original")
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strings"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 	"golang.org/x/crypto/ssh"
@@ -72,14 +74,22 @@ func SelectInstanceTypeToUse(spec InstanceTypeSpec, specList []InstanceTypeSpec,
 		// If no explicit instance type, GPU gets the next priority
 		instanceType, err = GetBestFitInstanceTypeWithGPU(specList, spec.GPUs, spec.VCPUs, spec.Memory)
 		if err != nil {
-			return "", fmt.Errorf("failed to get instance type based on GPU, vCPU, and memory annotations: %w", err)
+			return "", &NoMatchingInstanceTypeError{
+				Spec:       spec,
+				Candidates: specList,
+				Err:        fmt.Errorf("failed to get instance type based on GPU, vCPU, and memory annotations: %w", err),
+			}
 		}
 		logger.Printf("Instance type selected by the cloud provider based on GPU annotation: %s", instanceType)
 	} else if spec.VCPUs != 0 && spec.Memory != 0 {
 		// If no GPU is required, fall back to vCPU and memory selection
 		instanceType, err = GetBestFitInstanceType(specList, spec.VCPUs, spec.Memory)
 		if err != nil {
-			return "", fmt.Errorf("failed to get instance type based on vCPU and memory annotations: %w", err)
+			return "", &NoMatchingInstanceTypeError{
+				Spec:       spec,
+				Candidates: FilterOutGPUInstances(specList),
+				Err:        fmt.Errorf("failed to get instance type based on vCPU and memory annotations: %w", err),
+			}
 		}
 		logger.Printf("Instance type selected by the cloud provider based on vCPU and memory annotations: %s", instanceType)
 	}
@@ -88,13 +98,56 @@ func SelectInstanceTypeToUse(spec InstanceTypeSpec, specList []InstanceTypeSpec,
 	// If instance type is set in annotations then use that instance type
 	instanceTypeToUse, err := VerifyCloudInstanceType(instanceType, validInstanceTypes, defaultInstanceType)
 	if err != nil {
-		return "", fmt.Errorf("failed to verify instance type: %w", err)
+		return "", &NoMatchingInstanceTypeError{
+			Spec:       spec,
+			Candidates: candidatesFromNames(validInstanceTypes, specList),
+			Err:        fmt.Errorf("failed to verify instance type: %w", err),
+		}
 	}
 
 	return instanceTypeToUse, nil
 
 }
 
+// NoMatchingInstanceTypeError is returned by SelectInstanceTypeToUse when none of the
+// candidate instance types satisfies the requested spec
+type NoMatchingInstanceTypeError struct {
+	// Spec is the requested instance type spec
+	Spec InstanceTypeSpec
+	// Candidates are the instance types that were considered
+	Candidates []InstanceTypeSpec
+	Err        error
+}
+
+func (e *NoMatchingInstanceTypeError) Error() string {
+	names := make([]string, 0, len(e.Candidates))
+	for _, candidate := range e.Candidates {
+		names = append(names, candidate.InstanceType)
+	}
+	return fmt.Sprintf("%v (candidates: [%s])", e.Err, strings.Join(names, ", "))
+}
+
+func (e *NoMatchingInstanceTypeError) Unwrap() error {
+	return e.Err
+}
+
+// candidatesFromNames returns the specs of the named instance types, using the details
+// from specList when available
+func candidatesFromNames(names []string, specList []InstanceTypeSpec) []InstanceTypeSpec {
+	candidates := make([]InstanceTypeSpec, 0, len(names))
+	for _, name := range names {
+		candidate := InstanceTypeSpec{InstanceType: name}
+		for _, spec := range specList {
+			if spec.InstanceType == name {
+				candidate = spec
+				break
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
 // Method to find the best fit instance type for the given memory and vcpus
 // The sortedInstanceTypeSpecList slice is a sorted list of instance types based on ascending order of supported memory
 func GetBestFitInstanceType(sortedInstanceTypeSpecList []InstanceTypeSpec, vcpus int64, memory int64) (string, error) {
@@ -145,6 +198,64 @@ func GetBestFitInstanceTypeWithGPU(sortedInstanceTypeSpecList []InstanceTypeSpec
 	return sortedInstanceTypeSpecList[index].InstanceType, nil
 }
 
+// InstanceTypeMatchScore returns how closely candidate matches the resources requested by spec,
+// as the sum of the resources candidate has in excess, relative to the requested ones. 0 is an
+// exact match and lower is closer. ok is false when candidate lacks some requested resource.
+// Resources that are not requested don't count.
+func InstanceTypeMatchScore(spec, candidate InstanceTypeSpec) (score float64, ok bool) {
+	for _, r := range []struct{ requested, available int64 }{
+		{spec.GPUs, candidate.GPUs},
+		{spec.VCPUs, candidate.VCPUs},
+		{spec.Memory, candidate.Memory},
+	} {
+		if r.requested <= 0 {
+			continue
+		}
+		if r.available < r.requested {
+			return 0, false
+		}
+		score += float64(r.available-r.requested) / float64(r.requested)
+	}
+	return score, true
+}
+
+// GetBestFitInstanceTypes returns up to n instance types of instanceTypeSpecList that have the
+// resources requested by spec, closest match first according to InstanceTypeMatchScore, so that
+// callers can fall back to the next ones. Types with the same score are in the order of
+// SortInstanceTypesOnResources. GPU instance types are left out unless spec requests GPUs. All
+// the matching types are returned if n is 0 or less.
+func GetBestFitInstanceTypes(instanceTypeSpecList []InstanceTypeSpec, spec InstanceTypeSpec, n int) []InstanceTypeSpec {
+	candidates := slices.Clone(instanceTypeSpecList)
+	if spec.GPUs == 0 {
+		candidates = FilterOutGPUInstances(candidates)
+	}
+	candidates = SortInstanceTypesOnResources(candidates)
+
+	type match struct {
+		spec  InstanceTypeSpec
+		score float64
+	}
+	var matches []match
+	for _, candidate := range candidates {
+		if score, ok := InstanceTypeMatchScore(spec, candidate); ok {
+			matches = append(matches, match{candidate, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score < matches[j].score
+	})
+
+	if n > 0 && len(matches) > n {
+		matches = matches[:n]
+	}
+
+	var best []InstanceTypeSpec
+	for _, m := range matches {
+		best = append(best, m.spec)
+	}
+	return best
+}
+
 func DefaultToEnv(field *string, env, fallback string) {
 
 	if *field != "" {
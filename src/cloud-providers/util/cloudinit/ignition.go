@@ -0,0 +1,173 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Supported userData formats
+const (
+	UserDataFormatCloudInit = "cloud-init"
+	UserDataFormatIgnition  = "ignition"
+)
+
+const ignitionVersion = "3.3.0"
+
+// https://coreos.github.io/ignition/configuration-v3_3/
+
+type ignitionConfig struct {
+	Ignition ignitionMeta    `json:"ignition"`
+	Storage  ignitionStorage `json:"storage,omitempty"`
+}
+
+type ignitionMeta struct {
+	Version string          `json:"version"`
+	Config  *ignitionMerges `json:"config,omitempty"`
+}
+
+type ignitionMerges struct {
+	Replace ignitionResource `json:"replace"`
+}
+
+type ignitionStorage struct {
+	Files []ignitionFile `json:"files,omitempty"`
+}
+
+type ignitionFile struct {
+	Path      string             `json:"path"`
+	Overwrite *bool              `json:"overwrite,omitempty"`
+	Mode      *int               `json:"mode,omitempty"`
+	User      *ignitionNode      `json:"user,omitempty"`
+	Group     *ignitionNode      `json:"group,omitempty"`
+	Contents  *ignitionResource  `json:"contents,omitempty"`
+	Append    []ignitionResource `json:"append,omitempty"`
+}
+
+type ignitionNode struct {
+	Name string `json:"name"`
+}
+
+type ignitionResource struct {
+	Source string `json:"source"`
+}
+
+// IgnitionConfig renders the files of a cloud-config as an Ignition config, for podvm
+// images that are provisioned by Ignition instead of cloud-init
+type IgnitionConfig struct {
+	WriteFiles []WriteFile
+}
+
+func (config *IgnitionConfig) Generate() (string, error) {
+	ign := ignitionConfig{Ignition: ignitionMeta{Version: ignitionVersion}}
+
+	for _, wf := range config.WriteFiles {
+		file, err := toIgnitionFile(wf)
+		if err != nil {
+			return "", fmt.Errorf("Error converting %s to an ignition file: %w", wf.Path, err)
+		}
+		ign.Storage.Files = append(ign.Storage.Files, file)
+	}
+
+	data, err := json.Marshal(&ign)
+	if err != nil {
+		return "", fmt.Errorf("Error marshalling ignition userdata: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func toIgnitionFile(wf WriteFile) (ignitionFile, error) {
+	content := []byte(wf.Content)
+	switch wf.Encoding {
+	case "":
+	case "b64", "base64":
+		decoded, err := base64.StdEncoding.DecodeString(wf.Content)
+		if err != nil {
+			return ignitionFile{}, err
+		}
+		content = decoded
+	default:
+		return ignitionFile{}, fmt.Errorf("unsupported encoding %q", wf.Encoding)
+	}
+
+	file := ignitionFile{Path: wf.Path}
+
+	source := ignitionResource{Source: "data:;base64," + base64.StdEncoding.EncodeToString(content)}
+	if appendToFile, _ := strconv.ParseBool(wf.Append); appendToFile {
+		file.Append = []ignitionResource{source}
+	} else {
+		overwrite := true
+		file.Overwrite = &overwrite
+		file.Contents = &source
+	}
+
+	if wf.Permissions != "" {
+		mode, err := strconv.ParseUint(wf.Permissions, 8, 32)
+		if err != nil {
+			return ignitionFile{}, fmt.Errorf("invalid permissions %q: %w", wf.Permissions, err)
+		}
+		m := int(mode)
+		file.Mode = &m
+	}
+
+	if wf.Owner != "" {
+		user, group, _ := strings.Cut(wf.Owner, ":")
+		if user != "" {
+			file.User = &ignitionNode{Name: user}
+		}
+		if group != "" {
+			file.Group = &ignitionNode{Name: group}
+		}
+	}
+
+	return file, nil
+}
+
+// IgnitionReplaceConfig returns an Ignition config that makes Ignition fetch the actual
+// config from url
+func IgnitionReplaceConfig(url string) (string, error) {
+	ign := ignitionConfig{
+		Ignition: ignitionMeta{
+			Version: ignitionVersion,
+			Config:  &ignitionMerges{Replace: ignitionResource{Source: url}},
+		},
+	}
+
+	data, err := json.Marshal(&ign)
+	if err != nil {
+		return "", fmt.Errorf("Error marshalling ignition userdata: %w", err)
+	}
+	return string(data), nil
+}
+
+// ValidateUserDataFormat checks that format is a supported userData format
+func ValidateUserDataFormat(format string) error {
+	switch format {
+	case "", UserDataFormatCloudInit, UserDataFormatIgnition:
+		return nil
+	}
+	return fmt.Errorf("unsupported userData format %q, must be %q or %q", format, UserDataFormatCloudInit, UserDataFormatIgnition)
+}
+
+// NewUserDataGenerator returns a generator that renders config in the given userData
+// format. An empty format keeps the cloud-config as is.
+func NewUserDataGenerator(format string, config CloudConfigGenerator) (CloudConfigGenerator, error) {
+	if err := ValidateUserDataFormat(format); err != nil {
+		return nil, err
+	}
+	if format != UserDataFormatIgnition {
+		return config, nil
+	}
+
+	cloudConfig, ok := config.(*CloudConfig)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %T to ignition userdata", config)
+	}
+	return &IgnitionConfig{WriteFiles: cloudConfig.WriteFiles}, nil
+}
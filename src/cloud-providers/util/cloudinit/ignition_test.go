@@ -0,0 +1,116 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestIgnitionUserData(t *testing.T) {
+	config := &IgnitionConfig{
+		WriteFiles: []WriteFile{
+			{Path: "/123", Content: "Hello\n"},
+			{Path: "/456", Content: base64.StdEncoding.EncodeToString([]byte("World\n")), Encoding: "b64", Owner: "root:root", Permissions: "0600"},
+			{Path: "/789", Content: "More\n", Append: "true"},
+		},
+	}
+
+	userData, err := config.Generate()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	var output ignitionConfig
+	if err := json.Unmarshal([]byte(userData), &output); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	if e, a := ignitionVersion, output.Ignition.Version; e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+
+	overwrite := true
+	mode := 0600
+	expected := []ignitionFile{
+		{
+			Path:      "/123",
+			Overwrite: &overwrite,
+			Contents:  &ignitionResource{Source: "data:;base64," + base64.StdEncoding.EncodeToString([]byte("Hello\n"))},
+		},
+		{
+			Path:      "/456",
+			Overwrite: &overwrite,
+			Mode:      &mode,
+			User:      &ignitionNode{Name: "root"},
+			Group:     &ignitionNode{Name: "root"},
+			Contents:  &ignitionResource{Source: "data:;base64," + base64.StdEncoding.EncodeToString([]byte("World\n"))},
+		},
+		{
+			Path:   "/789",
+			Append: []ignitionResource{{Source: "data:;base64," + base64.StdEncoding.EncodeToString([]byte("More\n"))}},
+		},
+	}
+	if e, a := expected, output.Storage.Files; !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expect %#v, got %#v", e, a)
+	}
+}
+
+func TestIgnitionUserDataInvalidPermissions(t *testing.T) {
+	config := &IgnitionConfig{
+		WriteFiles: []WriteFile{{Path: "/123", Content: "Hello\n", Permissions: "rw"}},
+	}
+
+	if _, err := config.Generate(); err == nil {
+		t.Fatal("Expect error, got nil")
+	}
+}
+
+func TestIgnitionReplaceConfig(t *testing.T) {
+	userData, err := IgnitionReplaceConfig("https://example.com/userdata")
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	var output ignitionConfig
+	if err := json.Unmarshal([]byte(userData), &output); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if output.Ignition.Config == nil {
+		t.Fatal("Expect a replace config, got nil")
+	}
+	if e, a := "https://example.com/userdata", output.Ignition.Config.Replace.Source; e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+}
+
+func TestNewUserDataGenerator(t *testing.T) {
+	cloudConfig := &CloudConfig{
+		WriteFiles: []WriteFile{{Path: "/123", Content: "Hello\n"}},
+	}
+
+	for _, format := range []string{"", UserDataFormatCloudInit} {
+		generator, err := NewUserDataGenerator(format, cloudConfig)
+		if err != nil {
+			t.Fatalf("Expect no error, got %v", err)
+		}
+		if generator != CloudConfigGenerator(cloudConfig) {
+			t.Fatalf("Expect the cloud-config for format %q, got %#v", format, generator)
+		}
+	}
+
+	generator, err := NewUserDataGenerator(UserDataFormatIgnition, cloudConfig)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if e, a := (&IgnitionConfig{WriteFiles: cloudConfig.WriteFiles}), generator; !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expect %#v, got %#v", e, a)
+	}
+
+	if _, err := NewUserDataGenerator("shell", cloudConfig); err == nil {
+		t.Fatal("Expect error for an unknown format, got nil")
+	}
+}
@@ -4,8 +4,10 @@
 package util
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"net"
@@ -339,23 +341,10 @@ func SendFileViaSFTP(address string, sshConfig *ssh.ClientConfig, remotePath str
 
 // SendFileViaSFTPWithContext sends file content to a remote path via SFTP with context support
 func SendFileViaSFTPWithContext(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePath string, content []byte) error {
-	// Create a context-aware dialer
-	dialer := &net.Dialer{}
-	conn, err := dialer.DialContext(ctx, "tcp", address)
-	if err != nil {
-		return fmt.Errorf("failed to connect to %s: %w", address, err)
-	}
-	defer conn.Close()
-
-	// Create SSH connection using the established connection
-	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, sshConfig)
+	client, err := dialSSHWithContext(ctx, address, sshConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create SSH connection: %w", err)
+		return err
 	}
-	defer sshConn.Close()
-
-	// Create SSH client
-	client := ssh.NewClient(sshConn, chans, reqs)
 	defer client.Close()
 
 	// Create SFTP client
@@ -384,3 +373,151 @@ func SendFileViaSFTPWithContext(ctx context.Context, address string, sshConfig *
 
 	return nil
 }
+
+// ProbeSFTPWithContext checks that an SFTP session can be established with the remote host
+func ProbeSFTPWithContext(ctx context.Context, address string, sshConfig *ssh.ClientConfig) error {
+	client, err := dialSSHWithContext(ctx, address, sshConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	return sftpClient.Close()
+}
+
+// SendFileViaSCPWithContext sends file content to a remote path by running scp in sink mode over an SSH
+// exec session. It is meant for hosts that disable the SFTP subsystem but still allow exec.
+func SendFileViaSCPWithContext(ctx context.Context, address string, sshConfig *ssh.ClientConfig, remotePath string, content []byte) error {
+	client, err := dialSSHWithContext(ctx, address, sshConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get stdin of SSH session: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get stdout of SSH session: %w", err)
+	}
+
+	remoteDir := filepath.Dir(remotePath)
+	command := fmt.Sprintf("mkdir -p %s && scp -qt %s", shellQuote(remoteDir), shellQuote(remoteDir))
+	if err := session.Start(command); err != nil {
+		return fmt.Errorf("failed to start scp on %s: %w", address, err)
+	}
+
+	if err := copySCP(stdin, stdout, filepath.Base(remotePath), content); err != nil {
+		return fmt.Errorf("failed to copy file %s: %w", remotePath, err)
+	}
+	stdin.Close()
+
+	if err := session.Wait(); err != nil {
+		return fmt.Errorf("scp on %s failed: %w", address, err)
+	}
+
+	return nil
+}
+
+// ProbeSSHWithContext checks that an SSH session can be established with the remote host
+func ProbeSSHWithContext(ctx context.Context, address string, sshConfig *ssh.ClientConfig) error {
+	client, err := dialSSHWithContext(ctx, address, sshConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	return session.Close()
+}
+
+// dialSSHWithContext establishes an SSH client connection using a context-aware dialer. The SSH
+// handshake doesn't take a context: the deadline of ctx is set on the connection, which then
+// bounds the handshake and the sessions over it, and the connection is closed if ctx is
+// canceled during the handshake.
+func dialSSHWithContext(ctx context.Context, address string, sshConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to set the deadline of the connection to %s: %w", address, err)
+		}
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, sshConfig)
+	if !stop() {
+		// ctx is done, the connection is closed or being closed
+		if err == nil {
+			sshConn.Close()
+		}
+		return nil, fmt.Errorf("failed to create SSH connection: %w", ctx.Err())
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create SSH connection: %w", err)
+	}
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// copySCP speaks the source side of the scp protocol for a single file
+func copySCP(w io.Writer, r io.Reader, name string, content []byte) error {
+	reader := bufio.NewReader(r)
+
+	if err := readSCPAck(reader); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "C0644 %d %s\n", len(content), name); err != nil {
+		return err
+	}
+	if err := readSCPAck(reader); err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+	return readSCPAck(reader)
+}
+
+// readSCPAck reads a single scp response. A zero byte means success, anything else is followed by an error message.
+func readSCPAck(r *bufio.Reader) error {
+	code, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read scp response: %w", err)
+	}
+	if code == 0 {
+		return nil
+	}
+
+	message, _ := r.ReadString('\n')
+	return fmt.Errorf("scp error: %s", strings.TrimSpace(message))
+}
+
+// shellQuote quotes s for use as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
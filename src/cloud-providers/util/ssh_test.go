@@ -4,6 +4,8 @@
 package util
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -610,3 +612,100 @@ func contains(s, substr string) bool {
 	}
 	return false
 }
+
+func TestCopySCP(t *testing.T) {
+	var sent bytes.Buffer
+	acks := bytes.NewReader([]byte{0, 0, 0})
+
+	if err := copySCP(&sent, acks, "user-data", []byte("hello")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := "C0644 5 user-data\nhello\x00"
+	if sent.String() != expected {
+		t.Errorf("Expected %q to be sent, got %q", expected, sent.String())
+	}
+}
+
+func TestCopySCP_RemoteError(t *testing.T) {
+	var sent bytes.Buffer
+	acks := bytes.NewReader([]byte("\x00\x01scp: /media/cidata: Permission denied\n"))
+
+	err := copySCP(&sent, acks, "user-data", []byte("hello"))
+	if err == nil || !strings.Contains(err.Error(), "Permission denied") {
+		t.Errorf("Expected permission denied error, got %v", err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got := shellQuote("/media/it's"); got != `'/media/it'\''s'` {
+		t.Errorf("Unexpected quoting: %s", got)
+	}
+}
+
+// stalledSSHServer accepts TCP connections and never answers the SSH handshake
+func stalledSSHServer(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	conns := make(chan net.Conn, 10)
+	go func() {
+		defer close(conns)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		for conn := range conns {
+			conn.Close()
+		}
+	})
+	return listener.Addr().String()
+}
+
+func TestDialSSHWithContext_StalledHandshake(t *testing.T) {
+	address := stalledSSHServer(t)
+	sshConfig := &ssh.ClientConfig{User: "peerpod", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+
+	tests := map[string]func() (context.Context, context.CancelFunc){
+		"deadline": func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 100*time.Millisecond)
+		},
+		"cancel": func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(100*time.Millisecond, cancel)
+			return ctx, cancel
+		},
+	}
+
+	for name, newContext := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := newContext()
+			defer cancel()
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := dialSSHWithContext(ctx, address, sshConfig)
+				done <- err
+			}()
+
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Error("Expected an error for a stalled handshake")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Expected the handshake to be bounded by the context")
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
@@ -759,3 +760,174 @@ func TestSelectInstanceTypeToUse(t *testing.T) {
 		})
 	}
 }
+
+func TestSelectInstanceTypeToUseNoMatch(t *testing.T) {
+	specList := SortInstanceTypesOnResources([]InstanceTypeSpec{
+		{InstanceType: "t3.small", VCPUs: 2, Memory: 2048},
+		{InstanceType: "t3.medium", VCPUs: 2, Memory: 4096},
+		{InstanceType: "p3.2xlarge", VCPUs: 8, Memory: 61440, GPUs: 1},
+	})
+	validInstanceTypes := []string{"t3.small", "t3.medium", "p3.2xlarge"}
+
+	tests := []struct {
+		name           string
+		spec           InstanceTypeSpec
+		wantCandidates []string
+	}{
+		{
+			name:           "vCPU and memory",
+			spec:           InstanceTypeSpec{VCPUs: 4, Memory: 8192},
+			wantCandidates: []string{"t3.small", "t3.medium"},
+		},
+		{
+			name:           "GPU",
+			spec:           InstanceTypeSpec{GPUs: 2, VCPUs: 4, Memory: 8192},
+			wantCandidates: []string{"t3.small", "t3.medium", "p3.2xlarge"},
+		},
+		{
+			name:           "instance type not allowed",
+			spec:           InstanceTypeSpec{InstanceType: "m5.large"},
+			wantCandidates: []string{"t3.small", "t3.medium", "p3.2xlarge"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SelectInstanceTypeToUse(tt.spec, specList, validInstanceTypes, "t3.small")
+
+			var noMatch *NoMatchingInstanceTypeError
+			if !errors.As(err, &noMatch) {
+				t.Fatalf("SelectInstanceTypeToUse() error = %v, want NoMatchingInstanceTypeError", err)
+			}
+			if !reflect.DeepEqual(noMatch.Spec, tt.spec) {
+				t.Errorf("NoMatchingInstanceTypeError.Spec = %+v, want %+v", noMatch.Spec, tt.spec)
+			}
+			var candidates []string
+			for _, candidate := range noMatch.Candidates {
+				candidates = append(candidates, candidate.InstanceType)
+			}
+			if !reflect.DeepEqual(candidates, tt.wantCandidates) {
+				t.Errorf("NoMatchingInstanceTypeError.Candidates = %v, want %v", candidates, tt.wantCandidates)
+			}
+		})
+	}
+}
+
+func TestInstanceTypeMatchScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      InstanceTypeSpec
+		candidate InstanceTypeSpec
+		wantScore float64
+		wantOK    bool
+	}{
+		{
+			name:      "exact match",
+			spec:      InstanceTypeSpec{VCPUs: 2, Memory: 4096},
+			candidate: InstanceTypeSpec{VCPUs: 2, Memory: 4096},
+			wantScore: 0,
+			wantOK:    true,
+		},
+		{
+			name:      "twice the vCPUs and memory",
+			spec:      InstanceTypeSpec{VCPUs: 2, Memory: 4096},
+			candidate: InstanceTypeSpec{VCPUs: 4, Memory: 8192},
+			wantScore: 2,
+			wantOK:    true,
+		},
+		{
+			name:      "memory not requested",
+			spec:      InstanceTypeSpec{VCPUs: 2},
+			candidate: InstanceTypeSpec{VCPUs: 2, Memory: 8192},
+			wantScore: 0,
+			wantOK:    true,
+		},
+		{
+			name:      "not enough memory",
+			spec:      InstanceTypeSpec{VCPUs: 2, Memory: 8192},
+			candidate: InstanceTypeSpec{VCPUs: 8, Memory: 4096},
+		},
+		{
+			name:      "no GPU",
+			spec:      InstanceTypeSpec{GPUs: 1, VCPUs: 2, Memory: 4096},
+			candidate: InstanceTypeSpec{VCPUs: 2, Memory: 4096},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, ok := InstanceTypeMatchScore(tt.spec, tt.candidate)
+			if ok != tt.wantOK || score != tt.wantScore {
+				t.Errorf("InstanceTypeMatchScore() = %v, %v, want %v, %v", score, ok, tt.wantScore, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGetBestFitInstanceTypes(t *testing.T) {
+	specList := []InstanceTypeSpec{
+		{InstanceType: "t2.large", VCPUs: 8, Memory: 16},
+		{InstanceType: "g4.xlarge", VCPUs: 4, Memory: 16, GPUs: 1},
+		{InstanceType: "r5.large", VCPUs: 2, Memory: 16},
+		{InstanceType: "t2.small", VCPUs: 2, Memory: 6},
+		{InstanceType: "t2.medium", VCPUs: 4, Memory: 8},
+	}
+
+	names := func(specs []InstanceTypeSpec) []string {
+		var names []string
+		for _, spec := range specs {
+			names = append(names, spec.InstanceType)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name string
+		spec InstanceTypeSpec
+		n    int
+		want []string
+	}{
+		{
+			name: "top 3",
+			spec: InstanceTypeSpec{VCPUs: 2, Memory: 6},
+			n:    3,
+			want: []string{"t2.small", "t2.medium", "r5.large"},
+		},
+		{
+			name: "all",
+			spec: InstanceTypeSpec{VCPUs: 2, Memory: 6},
+			want: []string{"t2.small", "t2.medium", "r5.large", "t2.large"},
+		},
+		{
+			name: "memory heavy",
+			spec: InstanceTypeSpec{VCPUs: 2, Memory: 16},
+			n:    2,
+			want: []string{"r5.large", "t2.large"},
+		},
+		{
+			name: "GPU",
+			spec: InstanceTypeSpec{GPUs: 1, VCPUs: 2, Memory: 8},
+			n:    3,
+			want: []string{"g4.xlarge"},
+		},
+		{
+			name: "no match",
+			spec: InstanceTypeSpec{VCPUs: 16, Memory: 64},
+			n:    3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := names(GetBestFitInstanceTypes(specList, tt.spec, tt.n))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetBestFitInstanceTypes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The list of the caller is left as is
+	if e, a := "t2.large", specList[0].InstanceType; e != a {
+		t.Errorf("Expected the list not to be sorted in place, got %s first", a)
+	}
+}
@@ -303,9 +303,10 @@ func (p *vsphereProvider) CreateInstance(ctx context.Context, podName, sandboxID
 	}
 
 	instance := &provider.Instance{
-		ID:   clone.UUID(ctx),
-		Name: vmname,
-		IPs:  ips,
+		ID:    clone.UUID(ctx),
+		Name:  vmname,
+		IPs:   ips,
+		State: provider.InstanceStateRunning,
 	}
 
 	logger.Printf("CreateInstance VM name %s UUID %s done", vmname, clone.UUID(ctx))
@@ -372,6 +373,11 @@ func (p *vsphereProvider) DeleteInstance(ctx context.Context, instanceID string)
 		return err
 	}
 
+	if vmref == nil {
+		logger.Printf("VM UUID %s not found, assuming it is already deleted", instanceID)
+		return nil
+	}
+
 	vm := object.NewVirtualMachine(dc.Client(), vmref.Reference())
 
 	state, err = vm.PowerState(ctx)
@@ -0,0 +1,64 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/simulator"
+)
+
+// newTestProvider returns a provider connected to a simulated vCenter
+func newTestProvider(t *testing.T) *vsphereProvider {
+	model := simulator.VPX()
+	if err := model.Create(); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	t.Cleanup(model.Remove)
+
+	server := model.Service.NewServer()
+	t.Cleanup(server.Close)
+
+	gclient, err := govmomi.NewClient(context.Background(), server.URL, true)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	return &vsphereProvider{
+		gclient:       gclient,
+		serviceConfig: &Config{VcenterURL: server.URL.String(), Datacenter: "DC0"},
+	}
+}
+
+func TestDeleteInstanceNotFound(t *testing.T) {
+	p := newTestProvider(t)
+
+	if err := p.DeleteInstance(context.Background(), "4c2e3e3a-9c25-4d2f-a6a3-0c3e0d6a4b61"); err != nil {
+		t.Errorf("DeleteInstance() error = %v, want nil for a VM that doesn't exist", err)
+	}
+}
+
+func TestDeleteInstanceTwice(t *testing.T) {
+	p := newTestProvider(t)
+	ctx := context.Background()
+
+	vm, err := find.NewFinder(p.gclient.Client).VirtualMachine(ctx, "DC0_H0_VM0")
+	if err != nil {
+		t.Fatalf("VirtualMachine() error = %v", err)
+	}
+	uuid := vm.UUID(ctx)
+
+	if err := p.DeleteInstance(ctx, uuid); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if _, err := find.NewFinder(p.gclient.Client).VirtualMachine(ctx, "DC0_H0_VM0"); err == nil {
+		t.Error("VirtualMachine() error = nil, want the VM deleted")
+	}
+	if err := p.DeleteInstance(ctx, uuid); err != nil {
+		t.Errorf("DeleteInstance() error = %v for a deleted VM, want nil", err)
+	}
+}